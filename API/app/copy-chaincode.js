@@ -0,0 +1,108 @@
+/**
+ * Copies the lenovo_bc chaincode from ChainCode/ to the GOPATH the peers
+ * install it from (CC_SRC_PATH), run by npm start and npm run chaincode:
+ *
+ *   node app/copy-chaincode.js [target [source]]
+ *
+ * ChainCode/ is the only source, the copy is not committed. Tests, testdata
+ * and the command line tools are left out. The copy lists its files with
+ * their SHA-256 in MANIFEST_FILE. Without the source, as in a pushed app,
+ * the existing copy is kept if it still matches its manifest, otherwise the
+ * script fails instead of deploying an unknown chaincode.
+ */
+'use strict';
+var path = require('path');
+var fs = require('fs');
+var crypto = require('crypto');
+var config = require('../config.json');
+
+var MANIFEST_FILE = '.copy-chaincode.json';
+
+var target = process.argv[2] ||
+    path.join(__dirname, config.CC_SRC_PATH, 'src', 'github.com', 'lenovo_bc');
+var source = process.argv[3] ||
+    path.join(__dirname, '..', '..', 'ChainCode', 'github.com', 'lenovo_bc');
+
+var fail = function (message) {
+    console.error('copy-chaincode: ' + message);
+    process.exit(1);
+};
+
+var deployed = function (name, dir) {
+    if (dir) {
+        return name !== 'testdata' && name !== 'cmd';
+    }
+    return path.extname(name) === '.go' && !/_test\.go$/.test(name);
+};
+
+var sha256 = function (file) {
+    return crypto.createHash('sha256').update(fs.readFileSync(file)).digest('hex');
+};
+
+//Files of the chaincode by path relative to dir, with / separators
+var chaincodeFiles = function (dir, prefix, files) {
+    fs.readdirSync(dir).forEach(function (name) {
+        var stat = fs.statSync(path.join(dir, name));
+        if (!deployed(name, stat.isDirectory())) {
+            return;
+        }
+        if (stat.isDirectory()) {
+            chaincodeFiles(path.join(dir, name), prefix + name + '/', files);
+            return;
+        }
+        files.push(prefix + name);
+    });
+    return files;
+};
+
+var remove = function (file) {
+    if (!fs.existsSync(file)) {
+        return;
+    }
+    if (fs.statSync(file).isDirectory()) {
+        fs.readdirSync(file).forEach(function (name) {
+            remove(path.join(file, name));
+        });
+        fs.rmdirSync(file);
+        return;
+    }
+    fs.unlinkSync(file);
+};
+
+var mkdirs = function (dir) {
+    if (fs.existsSync(dir)) {
+        return;
+    }
+    mkdirs(path.dirname(dir));
+    fs.mkdirSync(dir);
+};
+
+if (!fs.existsSync(source)) {
+    var manifestPath = path.join(target, MANIFEST_FILE);
+    if (!fs.existsSync(manifestPath)) {
+        fail(source + ' not found and ' + target + ' has no ' + MANIFEST_FILE);
+    }
+    var stored = JSON.parse(fs.readFileSync(manifestPath, 'utf8'));
+    var files = chaincodeFiles(target, '', []);
+    if (files.length !== Object.keys(stored).length) {
+        fail(source + ' not found and ' + target + ' has other files than its ' + MANIFEST_FILE);
+    }
+    files.forEach(function (name) {
+        if (stored[name] !== sha256(path.join(target, name))) {
+            fail(source + ' not found and ' + target + '/' + name + ' differs from its ' + MANIFEST_FILE);
+        }
+    });
+    console.log('copy-chaincode: ' + source + ' not found, ' + target + ' matches its ' + MANIFEST_FILE);
+    process.exit(0);
+}
+
+remove(target);
+var manifest = {};
+chaincodeFiles(source, '', []).forEach(function (name) {
+    var to = path.join(target, name);
+    mkdirs(path.dirname(to));
+    fs.writeFileSync(to, fs.readFileSync(path.join(source, name)));
+    manifest[name] = sha256(to);
+});
+fs.writeFileSync(path.join(target, MANIFEST_FILE), JSON.stringify(manifest, null, 2) + '\n');
+console.log('copy-chaincode: ' + source + ' -> ' + target);
@@ -1,7 +0,0 @@
-package main
-
-//Key Prefix
-const SO_KEY = "SO" //SalesOrder Key
-const PO_KEY = "PO" //PurchaseOrder key
-
-const STAR = "***"
@@ -0,0 +1,166 @@
+package chaincode
+
+import (
+	"github.com/lenovo_bc/epcis"
+	"github.com/lenovo_bc/idoc"
+	"github.com/lenovo_bc/model"
+	"github.com/lenovo_bc/schema"
+	"github.com/lenovo_bc/webhook"
+	"reflect"
+)
+
+//go:generate go test -run TestAPIDocuments -update
+
+//Chaincode API described in docs/openapi.json and docs/lenovo_bc.schema.json.
+//TestAPIDocuments keeps the files and this list in sync with the code:
+//	go test -run TestAPIDocuments -update
+func chaincodeAPI(g *schema.Generator) schema.API {
+	typeOf := func(v interface{}) *schema.Schema {
+		return g.Schema(reflect.TypeOf(v))
+	}
+	userRole := schema.Arg{Name: "userRole", Schema: schema.String("Role of the caller, fields are masked unless its role in the config is buyer")}
+	vendorNo := schema.Arg{Name: "vendorNo", Schema: schema.String("Vendor no of the caller, added by the API server")}
+	queryParam := schema.Arg{Name: "query", Schema: schema.JSONString("", typeOf(model.QueryParam{}))}
+	record := schema.OneOf("Record of the keyPrefix",
+		typeOf(model.SalesOrder{}), typeOf(model.PurchaseOrder{}), typeOf(model.ODMPurchaseOrder{}), typeOf(model.SupplierOrder{}))
+	keyRecords := schema.ArrayOf(schema.Object("", map[string]*schema.Schema{
+		"Key":    schema.String("Composite key"),
+		"Record": record,
+	}))
+	writeResults := schema.ArrayOf(typeOf(WriteResult{}))
+	purgeRequest := typeOf(PurgeRequest{})
+	subscription := typeOf(model.WebhookSubscription{})
+	admin := []string{ROLE_BUYER} //Role in the config of the org of the creator, checked by validate
+
+	return schema.API{
+		Title:   "lenovo_bc chaincode",
+		Version: "1.0",
+		Description: "Functions of the lenovo_bc chaincode. Write functions (cr*) take a JSON array of records " +
+			"and the vendor no of the caller and return one WriteResult per record; queries take the role of the caller first.",
+		Error: typeOf(ErrorInfo{}),
+		Functions: []schema.Function{
+			{Name: "crSalesOrderInfo", Summary: "Create or update sales orders",
+				Args: []schema.Arg{{Name: "json", Schema: schema.JSONString("", schema.ArrayOf(typeOf(model.SalesOrder{})))}, vendorNo},
+				TRANSDOC: []schema.Variant{
+					{TRANSDOC: "SO", Description: "Sales order item, billing and GI lines are kept", Fields: []string{"all but BILLINFOS, GIINFOS, PONO, POITEM"}},
+					{TRANSDOC: "BL", Description: "Billing documents of an existing item", Fields: []string{"BILLINFOS"}},
+					{TRANSDOC: "GI", Description: "Goods issues of an existing item", Fields: []string{"GIINFOS"}},
+				},
+				Response: writeResults},
+			{Name: "crCPurchaseOrderInfo", Summary: "Post ODM goods receipts and payments on a customer PO",
+				Args: []schema.Arg{{Name: "json", Schema: schema.JSONString("", schema.ArrayOf(typeOf(model.ODMInfoReq{})))}, vendorNo},
+				TRANSDOC: []schema.Variant{
+					{TRANSDOC: "GR", Description: "ODM goods receipt, added to ODMGRInfos", Fields: []string{"LenDNNO", "PARTNUM", "GRQTY"}},
+					{TRANSDOC: "BL", Description: "ODM payment, added to ODMPayments", Fields: []string{"INVOICENUM", "INVOICESTATUS", "PAYMENTDATE"}},
+				},
+				Response: writeResults},
+			{Name: "crPurchaseOrderInfo", Summary: "Create or update purchase orders",
+				Args: []schema.Arg{{Name: "json", Schema: schema.JSONString("", schema.ArrayOf(typeOf(model.PurchaseOrder{})))}, vendorNo},
+				TRANSDOC: []schema.Variant{
+					{TRANSDOC: "PO", Description: "Purchase order item, follow-on documents are kept", Fields: []string{"all but GRInfos, Confirmation, InboundDelivery, Invoice"}},
+					{TRANSDOC: "GR", Description: "Goods receipts of an existing item", Fields: []string{"GRInfos"}},
+					{TRANSDOC: "POCON", Description: "Confirmations of an existing item", Fields: []string{"Confirmation"}},
+					{TRANSDOC: "INV", Description: "Invoices of an existing item", Fields: []string{"Invoice"}},
+					{TRANSDOC: "INDN", Description: "Inbound deliveries of an existing item", Fields: []string{"InboundDelivery"}},
+				},
+				Response: writeResults},
+			{Name: "crSupplierOrderInfo", Summary: "Post supplier ASNs, or an EDIFACT DESADV/INVOIC interchange",
+				Args: []schema.Arg{{Name: "json", Schema: schema.OneOf("",
+					schema.JSONString("", schema.ArrayOf(typeOf(model.SupplierOrder{}))),
+					schema.String("EDIFACT interchange starting with UNA or UNB"))}, vendorNo},
+				TRANSDOC: []schema.Variant{
+					{TRANSDOC: "", Description: "ASN, also added to the SupplierOrders of the PO item", Fields: []string{"all"}},
+					{TRANSDOC: "UL", Description: "Packing list upload of an existing ASN", Fields: []string{"PackingList"}},
+				},
+				Response: writeResults},
+			{Name: "queryById", Summary: "Read one record", Query: true,
+				Args: []schema.Arg{userRole, queryParam}, Response: record},
+			{Name: "queryHistoryById", Summary: "History of one record", Query: true,
+				Args: []schema.Arg{userRole, queryParam},
+				Response: schema.ArrayOf(schema.Object("", map[string]*schema.Schema{
+					"TxId":      schema.String("Transaction ID"),
+					"Value":     schema.OneOf("Record, null when deleted", record, &schema.Schema{Type: "null"}),
+					"Timestamp": schema.String("Transaction time"),
+					"IsDelete":  schema.Enum("", "true", "false"),
+				}))},
+			{Name: "queryByIdRange", Summary: "Records of keyPrefix from keysStart to keysEnd, or to the last one without keysEnd", Query: true,
+				Args: []schema.Arg{userRole, queryParam}, Response: keyRecords},
+			{Name: "queryByPartialCompositeKey", Summary: "Records starting with keysStart", Query: true,
+				Args: []schema.Arg{userRole, queryParam}, Response: keyRecords},
+			{Name: "getQueryResult", Summary: "CouchDB Mango query, only the buyer role of the config can select or sort on masked fields", Query: true,
+				Args: []schema.Arg{userRole, {Name: "query", Schema: schema.String("Mango selector JSON")},
+					{Name: "includeDeleted", Schema: schema.Enum("", "true", "false"), Optional: true}},
+				Response: keyRecords},
+			{Name: "queryByIds", Summary: "Read several records, deleted ones are left out", Query: true,
+				Args:     []schema.Arg{userRole, {Name: "queries", Schema: schema.JSONString("", schema.ArrayOf(typeOf(model.QueryParam{})))}},
+				Response: schema.ArrayOf(record)},
+			{Name: "removeFromStateByKey", Summary: "Mark the records starting with keysStart as deleted",
+				Args: []schema.Arg{queryParam}, Roles: admin, Response: writeResults},
+			{Name: "setIntegrityRules", Summary: "Set the integrity rule of document types",
+				Args:  []schema.Arg{{Name: "rules", Schema: schema.JSONString("", typeOf(IntegrityRules{}))}},
+				Roles: admin, Response: typeOf(IntegrityRules{})},
+			{Name: "queryIntegrityRules", Summary: "Integrity rules in effect", Query: true,
+				Response: typeOf(IntegrityRules{})},
+			{Name: "auditConsistency", Summary: "Check the links of a batch of records", Query: true,
+				Args: []schema.Arg{{Name: "param", Schema: schema.JSONString("", typeOf(AuditParam{}))}}, Response: typeOf(AuditReport{})},
+			{Name: "repairConsistency", Summary: "Check a batch of records and add missing back-references",
+				Args: []schema.Arg{{Name: "param", Schema: schema.JSONString("", typeOf(AuditParam{}))}}, Roles: admin, Response: typeOf(AuditReport{})},
+			{Name: "setPurgeApprovers", Summary: "Set the orgs approving purges",
+				Args:  []schema.Arg{{Name: "approvers", Schema: schema.JSONString("", schema.ArrayOf(schema.String("")))}},
+				Roles: admin, Response: schema.ArrayOf(schema.String(""))},
+			{Name: "requestPurge", Summary: "Request the deletion of the records starting with keysStart",
+				Args:     []schema.Arg{{Name: "scope", Schema: schema.JSONString("keyPrefix, keysStart and Reason", purgeRequest)}},
+				Response: purgeRequest},
+			{Name: "approvePurge", Summary: "Approve a purge request as the org of the caller",
+				Args:     []schema.Arg{{Name: "requestId", Schema: schema.String("")}},
+				Response: purgeRequest},
+			{Name: "executePurge", Summary: "Delete the records of an approved purge request, as its requester or an approver org",
+				Args: []schema.Arg{{Name: "requestId", Schema: schema.String("")}}, Response: purgeRequest},
+			{Name: "crIDocInfo", Summary: "Post SAP IDocs (ORDERS, DELVRY, INVOIC flat files)",
+				Args: []schema.Arg{{Name: "idoc", Schema: schema.String("IDoc flat file")}, vendorNo}, Response: writeResults},
+			{Name: "setIDocMapping", Summary: "Override the segment mapping of IDoc types",
+				Args:  []schema.Arg{{Name: "mapping", Schema: schema.JSONString("", typeOf(idoc.Mapping{}))}},
+				Roles: admin, Response: typeOf(idoc.Mapping{})},
+			{Name: "queryIDocMapping", Summary: "IDoc mapping in effect", Query: true,
+				Response: typeOf(idoc.Mapping{})},
+			{Name: "crX12Info", Summary: "Post an ANSI X12 interchange (855, 856, 810)",
+				Args: []schema.Arg{{Name: "interchange", Schema: schema.String("X12 interchange")}, vendorNo}, Response: writeResults},
+			{Name: "queryEPCISEvents", Summary: "EPCIS 2.0 JSON-LD events of a sales or purchase order", Query: true,
+				Args: []schema.Arg{userRole, queryParam}, Response: typeOf(epcis.Document{})},
+			{Name: "queryUBLInvoice", Summary: "UBL 2.1 Invoice or CreditNote of a billing document", Query: true,
+				Args: []schema.Arg{userRole, {Name: "billingNo", Schema: schema.String("BILLINGNO")},
+					{Name: "soNumber", Schema: schema.String("SONUMBER, narrows the scan. Required once there are more SOs than Limits.AuditMaxLimit"), Optional: true}},
+				Response: schema.String("UBL XML"), MediaType: "application/xml"},
+			{Name: "setWebhookSubscription", Summary: "Create or update a webhook subscription of the org of the caller",
+				Args: []schema.Arg{{Name: "json", Schema: schema.JSONString("ID empty creates a subscription, Secret empty keeps the secret. "+
+					"Partners other than the buyer filter on one of their vendor nos", subscription)}},
+				Response: subscription},
+			{Name: "removeWebhookSubscription", Summary: "Remove a webhook subscription of the org of the caller",
+				Args:     []schema.Arg{{Name: "id", Schema: schema.String("")}},
+				Response: subscription},
+			{Name: "queryWebhookSubscriptions", Summary: "Webhook subscriptions of the org of the caller, all of them with secrets for the buyer", Query: true,
+				Args:     []schema.Arg{{Name: "partner", Schema: schema.String("Partner org, for the buyer only"), Optional: true}},
+				Response: schema.ArrayOf(subscription)},
+			{Name: "querySchemaMigration", Summary: "Dry run of migrateSchema, the records of a batch below the schema version", Query: true,
+				Args: []schema.Arg{{Name: "param", Schema: schema.JSONString("", typeOf(AuditParam{}))}}, Response: typeOf(MigrationReport{})},
+			{Name: "migrateSchema", Summary: "Migrate a batch of records to the schema version of the chaincode",
+				Args: []schema.Arg{{Name: "param", Schema: schema.JSONString("", typeOf(AuditParam{}))}}, Roles: admin, Response: typeOf(MigrationReport{})},
+			{Name: "getConfig", Summary: "Config in effect: buyer org, roles, limits and features", Query: true,
+				Response: typeOf(Config{})},
+			{Name: "setConfig", Summary: "Store the next version of the config, fields missing from it take their default",
+				Args:  []schema.Arg{{Name: "config", Schema: schema.JSONString("Version is the stored version or 0", typeOf(Config{}))}},
+				Roles: admin, Response: typeOf(Config{})},
+			{Name: "describe", Summary: "Functions of the chaincode: arguments, read or write and roles", Query: true,
+				Response: schema.ArrayOf(typeOf(FunctionInfo{}))},
+		},
+		Webhooks: []schema.Webhook{
+			{Name: "documentsPosted", Summary: "Documents matching a subscription were written, sent by the event listener",
+				Headers: []schema.Arg{
+					{Name: webhook.TIMESTAMP_HEADER, Schema: schema.String("Unix seconds")},
+					{Name: webhook.SIGNATURE_HEADER, Schema: schema.String("sha256= and the hex HMAC-SHA256 of timestamp.body")},
+					{Name: "X-Message-ID", Schema: schema.String("Same for retries")},
+				},
+				Body: typeOf(webhook.Payload{})},
+		},
+	}
+}
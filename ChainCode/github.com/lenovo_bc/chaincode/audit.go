@@ -0,0 +1,490 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/lenovo_bc/model"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+//Audit request
+type AuditParam struct {
+	KeyPrefix string   `json:"keyPrefix"` //keyPrefix
+	KeysStart []string `json:"keysStart"` //keys start, optional
+	KeysEnd   []string `json:"keysEnd"`   //keys end, optional
+	Bookmark  string   `json:"bookmark"`  //NextKey of last batch
+	Limit     int      `json:"limit"`     //records per batch
+}
+
+type AuditIssue struct {
+	Type       string `json:"Type"`       //ORPHAN, ONE_SIDED, MISMATCH, DUPLICATE, QUANTITY
+	Key        string `json:"Key"`        //Record key
+	Field      string `json:"Field"`      //Link field or line list
+	Target     string `json:"Target"`     //Linked record key or duplicate line id
+	Message    string `json:"Message"`    //Description
+	Repairable bool   `json:"Repairable"` //Can be fixed by repairConsistency
+	repair     func() (error, bool)
+}
+
+type AuditReport struct {
+	Scanned  int          `json:"Scanned"`  //Records scanned in this batch
+	NextKey  string       `json:"NextKey"`  //Bookmark of next batch, empty when done
+	Issues   []AuditIssue `json:"Issues"`   //Issues found
+	Repaired []string     `json:"Repaired"` //Keys updated by repairConsistency
+}
+
+//Records of the batch, repairs of earlier records are returned by the
+//pendingStub of Invoke
+type auditContext struct {
+	stub       shim.ChaincodeStubInterface
+	tolerances ConfigTolerances
+}
+
+func newAuditContext(stub shim.ChaincodeStubInterface) (error, *auditContext) {
+	err, cfg := loadConfig(stub)
+	if err != nil {
+		return err, nil
+	}
+	return nil, &auditContext{stub: stub, tolerances: cfg.Tolerances}
+}
+
+func (ctx *auditContext) get(key string, obj interface{}) (error, bool) {
+	valAsbytes, err := ctx.stub.GetState(key)
+	if err != nil {
+		return newError(ERR_INTERNAL, key, "", err.Error()), false
+	}
+	if valAsbytes == nil {
+		return nil, false
+	}
+	err = json.Unmarshal(valAsbytes, obj)
+	if err != nil {
+		return newError(ERR_INTERNAL, key, "", err.Error()), false
+	}
+	return nil, true
+}
+
+func (ctx *auditContext) put(key string, obj interface{}) error {
+	b, _ := json.Marshal(obj)
+	return ctx.stub.PutState(key, b)
+}
+
+func parseAuditParam(stub shim.ChaincodeStubInterface, args []string) (error, AuditParam, string, string) {
+	param := AuditParam{}
+	if len(args) != 1 {
+		return newError(ERR_VALIDATION, "", "", "Incorrect number of arguments."), param, "", ""
+	}
+	err := json.Unmarshal([]byte(args[0]), &param)
+	if err != nil {
+		return newError(ERR_VALIDATION, "", "", err.Error()), param, "", ""
+	}
+	if param.KeyPrefix != SO_KEY && param.KeyPrefix != PO_KEY && param.KeyPrefix != CPO_KEY && param.KeyPrefix != SUPPLIER_KEY {
+		return newError(ERR_VALIDATION, "", "keyPrefix", "Unknown query type '"+param.KeyPrefix+"'"), param, "", ""
+	}
+	err, cfg := loadConfig(stub)
+	if err != nil {
+		return err, param, "", ""
+	}
+	if param.Limit <= 0 {
+		param.Limit = cfg.Limits.AuditLimit
+	}
+	if param.Limit > cfg.Limits.AuditMaxLimit {
+		return newError(ERR_VALIDATION, "", "limit", fmt.Sprintf("Limit can't be more than %d", cfg.Limits.AuditMaxLimit)), param, "", ""
+	}
+	_, prefixKey := generateKey(stub, param.KeyPrefix, []string{})
+	keyStart := prefixKey
+	keyEnd := prefixKey + string(utf8.MaxRune)
+	if len(param.KeysStart) > 0 {
+		_, keyStart = generateKey(stub, param.KeyPrefix, param.KeysStart)
+	}
+	if len(param.KeysEnd) > 0 {
+		_, keyEnd = generateKey(stub, param.KeyPrefix, param.KeysEnd)
+	}
+	if param.Bookmark != "" {
+		if param.Bookmark < keyStart || param.Bookmark >= keyEnd {
+			return newError(ERR_VALIDATION, "", "bookmark", "Bookmark is out of range"), param, "", ""
+		}
+		keyStart = param.Bookmark
+	}
+	return nil, param, keyStart, keyEnd
+}
+
+//Quantity of a record, false if it isn't a number
+func parseQuantity(qty string) (float64, bool) {
+	value, err := strconv.ParseFloat(strings.TrimSpace(qty), 64)
+	return value, err == nil
+}
+
+//Whether qty differs from reference by more than percent of reference.
+//Quantities that aren't numbers are not compared.
+func exceedsTolerance(qty string, reference string, percent float64) bool {
+	value, ok := parseQuantity(qty)
+	referenceValue, referenceOk := parseQuantity(reference)
+	if !ok || !referenceOk {
+		return false
+	}
+	return math.Abs(value-referenceValue) > math.Abs(referenceValue)*percent/100
+}
+
+//扫描一批记录
+func auditRange(ctx *auditContext, param AuditParam, keyStart string, keyEnd string) (error, AuditReport) {
+	report := AuditReport{Issues: []AuditIssue{}, Repaired: []string{}}
+	resultsIterator, err := ctx.stub.GetStateByRange(keyStart, keyEnd)
+	if err != nil {
+		return newError(ERR_INTERNAL, "", "", err.Error()), report
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return newError(ERR_INTERNAL, "", "", err.Error()), report
+		}
+		if report.Scanned == param.Limit {
+			report.NextKey = queryResponse.Key
+			break
+		}
+		report.Scanned++
+		if isDeleted(queryResponse.Value) {
+			continue
+		}
+		var issues []AuditIssue
+		if param.KeyPrefix == SO_KEY {
+			err, issues = auditSalesOrder(ctx, queryResponse.Key, queryResponse.Value)
+		} else if param.KeyPrefix == PO_KEY {
+			err, issues = auditPurchaseOrder(ctx, queryResponse.Key, queryResponse.Value)
+		} else if param.KeyPrefix == CPO_KEY {
+			err, issues = auditCustomerPurchaseOrder(ctx, queryResponse.Key, queryResponse.Value)
+		} else {
+			err, issues = auditSupplierOrder(ctx, queryResponse.Key, queryResponse.Value)
+		}
+		if err != nil {
+			return errorWithKey(err, queryResponse.Key), report
+		}
+		report.Issues = append(report.Issues, issues...)
+	}
+	return nil, report
+}
+
+func findDuplicates(key string, field string, ids []string) []AuditIssue {
+	issues := []AuditIssue{}
+	seen := map[string]bool{}
+	for _, id := range ids {
+		if seen[id] {
+			issues = append(issues, AuditIssue{Type: ISSUE_DUPLICATE, Key: key, Field: field, Target: id, Message: "Duplicate line " + id})
+		}
+		seen[id] = true
+	}
+	return issues
+}
+
+func auditSalesOrder(ctx *auditContext, key string, valAsbytes []byte) (error, []AuditIssue) {
+	salesOrder := model.SalesOrder{}
+	err := json.Unmarshal(valAsbytes, &salesOrder)
+	if err != nil {
+		return newError(ERR_INTERNAL, key, "", err.Error()), nil
+	}
+	var ids []string
+	for _, bill := range salesOrder.BILLINFOS {
+		ids = append(ids, bill.BILLINGNO+"/"+bill.BILLINGITEM)
+	}
+	issues := findDuplicates(key, "BILLINFOS", ids)
+	ids = nil
+	for _, gi := range salesOrder.GIINFOS {
+		ids = append(ids, gi.DNNUMBER+"/"+gi.DNITEM)
+	}
+	issues = append(issues, findDuplicates(key, "GIINFOS", ids)...)
+
+	if salesOrder.PONO != "" {
+		_, poKey := generateKey(ctx.stub, PO_KEY, []string{salesOrder.PONO, salesOrder.POITEM})
+		poOrder := model.PurchaseOrder{}
+		err, exist := ctx.get(poKey, &poOrder)
+		if err != nil {
+			return err, nil
+		}
+		if !exist {
+			issues = append(issues, AuditIssue{Type: ISSUE_ORPHAN, Key: key, Field: "PONO", Target: poKey, Message: "PO " + salesOrder.PONO + "/" + salesOrder.POITEM + " doesn't exist"})
+		} else if poOrder.SONUMBER == "" {
+			issues = append(issues, AuditIssue{Type: ISSUE_ONE_SIDED, Key: key, Field: "PONO", Target: poKey, Message: "PO has no SO number", Repairable: true,
+				repair: func() (error, bool) {
+					poOrder := model.PurchaseOrder{}
+					err, _ := ctx.get(poKey, &poOrder)
+					if err != nil || poOrder.SONUMBER != "" {
+						return err, false
+					}
+					poOrder.SONUMBER = salesOrder.SONUMBER
+					poOrder.SOITEM = salesOrder.SOITEM
+					return ctx.put(poKey, poOrder), true
+				}})
+		} else if poOrder.SONUMBER != salesOrder.SONUMBER || poOrder.SOITEM != salesOrder.SOITEM {
+			issues = append(issues, AuditIssue{Type: ISSUE_MISMATCH, Key: key, Field: "PONO", Target: poKey, Message: "PO refers to SO " + poOrder.SONUMBER + "/" + poOrder.SOITEM})
+		}
+	}
+	if salesOrder.CPONO != "" {
+		_, cpoKey := generateKey(ctx.stub, CPO_KEY, []string{salesOrder.CPONO})
+		cPOOrder := model.ODMPurchaseOrder{}
+		err, exist := ctx.get(cpoKey, &cPOOrder)
+		if err != nil {
+			return err, nil
+		}
+		if !exist {
+			issues = append(issues, AuditIssue{Type: ISSUE_ORPHAN, Key: key, Field: "CPONO", Target: cpoKey, Message: "CPO " + salesOrder.CPONO + " doesn't exist"})
+		} else if cPOOrder.SONUMBER == "" {
+			issues = append(issues, AuditIssue{Type: ISSUE_ONE_SIDED, Key: key, Field: "CPONO", Target: cpoKey, Message: "CPO has no SO number", Repairable: true,
+				repair: func() (error, bool) {
+					cPOOrder := model.ODMPurchaseOrder{}
+					err, _ := ctx.get(cpoKey, &cPOOrder)
+					if err != nil || cPOOrder.SONUMBER != "" {
+						return err, false
+					}
+					cPOOrder.SONUMBER = salesOrder.SONUMBER
+					cPOOrder.SOITEM = salesOrder.SOITEM
+					return ctx.put(cpoKey, cPOOrder), true
+				}})
+		} else if cPOOrder.SONUMBER != salesOrder.SONUMBER || cPOOrder.SOITEM != salesOrder.SOITEM {
+			issues = append(issues, AuditIssue{Type: ISSUE_MISMATCH, Key: key, Field: "CPONO", Target: cpoKey, Message: "CPO refers to SO " + cPOOrder.SONUMBER + "/" + cPOOrder.SOITEM})
+		}
+	}
+	return nil, issues
+}
+
+func auditPurchaseOrder(ctx *auditContext, key string, valAsbytes []byte) (error, []AuditIssue) {
+	poOrder := model.PurchaseOrder{}
+	err := json.Unmarshal(valAsbytes, &poOrder)
+	if err != nil {
+		return newError(ERR_INTERNAL, key, "", err.Error()), nil
+	}
+	var ids []string
+	for _, gr := range poOrder.GRInfos {
+		ids = append(ids, gr.GRNO+"/"+gr.GRItemNO)
+	}
+	issues := findDuplicates(key, "GRInfos", ids)
+	ids = nil
+	for _, cnf := range poOrder.Confirmation {
+		ids = append(ids, cnf.CnfSeqNO)
+	}
+	issues = append(issues, findDuplicates(key, "Confirmation", ids)...)
+	ids = nil
+	for _, inbound := range poOrder.InboundDelivery {
+		ids = append(ids, inbound.IBDNNUMBER+"/"+inbound.IBDNITEM)
+	}
+	issues = append(issues, findDuplicates(key, "InboundDelivery", ids)...)
+	ids = nil
+	for _, inv := range poOrder.Invoice {
+		ids = append(ids, inv.InvNO+"/"+inv.InvItemNO)
+	}
+	issues = append(issues, findDuplicates(key, "Invoice", ids)...)
+	ids = nil
+	for _, supOrder := range poOrder.SupplierOrders {
+		ids = append(ids, supOrder.VendorNO+"/"+supOrder.ASNNumber)
+	}
+	issues = append(issues, findDuplicates(key, "SupplierOrders", ids)...)
+
+	if poOrder.SONUMBER != "" {
+		_, soKey := generateKey(ctx.stub, SO_KEY, []string{poOrder.SONUMBER, poOrder.SOITEM})
+		salesOrder := model.SalesOrder{}
+		err, exist := ctx.get(soKey, &salesOrder)
+		if err != nil {
+			return err, nil
+		}
+		if !exist {
+			issues = append(issues, AuditIssue{Type: ISSUE_ORPHAN, Key: key, Field: "SONUMBER", Target: soKey, Message: "SO " + poOrder.SONUMBER + "/" + poOrder.SOITEM + " doesn't exist"})
+		} else if salesOrder.PONO == "" {
+			issues = append(issues, AuditIssue{Type: ISSUE_ONE_SIDED, Key: key, Field: "SONUMBER", Target: soKey, Message: "SO has no PO number", Repairable: true,
+				repair: func() (error, bool) {
+					salesOrder := model.SalesOrder{}
+					err, _ := ctx.get(soKey, &salesOrder)
+					if err != nil || salesOrder.PONO != "" {
+						return err, false
+					}
+					salesOrder.PONO = poOrder.PONO
+					salesOrder.POITEM = poOrder.POItemNO
+					return ctx.put(soKey, salesOrder), true
+				}})
+		} else if salesOrder.PONO != poOrder.PONO || salesOrder.POITEM != poOrder.POItemNO {
+			issues = append(issues, AuditIssue{Type: ISSUE_MISMATCH, Key: key, Field: "SONUMBER", Target: soKey, Message: "SO refers to PO " + salesOrder.PONO + "/" + salesOrder.POITEM})
+		} else if exceedsTolerance(poOrder.POQty, salesOrder.SOQTY, ctx.tolerances.QtyPercent) {
+			issues = append(issues, AuditIssue{Type: ISSUE_QUANTITY, Key: key, Field: "POQty", Target: soKey,
+				Message: fmt.Sprintf("PO quantity %s differs from SO quantity %s by more than %g%%", poOrder.POQty, salesOrder.SOQTY, ctx.tolerances.QtyPercent)})
+		}
+	}
+	if poQty, ok := parseQuantity(poOrder.POQty); ok && len(poOrder.SupplierOrders) > 0 {
+		shippedQty := 0.0
+		for _, supOrder := range poOrder.SupplierOrders {
+			qty, _ := parseQuantity(supOrder.ShippedQty)
+			shippedQty += qty
+		}
+		if shippedQty > poQty*(1+ctx.tolerances.OverShipPercent/100) {
+			issues = append(issues, AuditIssue{Type: ISSUE_QUANTITY, Key: key, Field: "SupplierOrders", Target: key,
+				Message: fmt.Sprintf("ASNs ship %g, more than %g%% over PO quantity %s", shippedQty, ctx.tolerances.OverShipPercent, poOrder.POQty)})
+		}
+	}
+	for _, supOrder := range poOrder.SupplierOrders {
+		_, supKey := generateKey(ctx.stub, SUPPLIER_KEY, []string{supOrder.VendorNO, supOrder.ASNNumber})
+		err, exist := ctx.get(supKey, &model.SupplierOrder{})
+		if err != nil {
+			return err, nil
+		}
+		if !exist {
+			issues = append(issues, AuditIssue{Type: ISSUE_ORPHAN, Key: key, Field: "SupplierOrders", Target: supKey, Message: "ASN " + supOrder.VendorNO + "/" + supOrder.ASNNumber + " doesn't exist"})
+		}
+	}
+	return nil, issues
+}
+
+func auditCustomerPurchaseOrder(ctx *auditContext, key string, valAsbytes []byte) (error, []AuditIssue) {
+	cPOOrder := model.ODMPurchaseOrder{}
+	err := json.Unmarshal(valAsbytes, &cPOOrder)
+	if err != nil {
+		return newError(ERR_INTERNAL, key, "", err.Error()), nil
+	}
+	var ids []string
+	for _, gr := range cPOOrder.ODMGRInfos {
+		ids = append(ids, gr.LenDNNO+"/"+gr.PARTNUM)
+	}
+	issues := findDuplicates(key, "ODMGRInfos", ids)
+	ids = nil
+	for _, payment := range cPOOrder.ODMPayments {
+		ids = append(ids, payment.BILLINGNO)
+	}
+	issues = append(issues, findDuplicates(key, "ODMPayments", ids)...)
+
+	salesOrder := model.SalesOrder{}
+	if cPOOrder.SONUMBER != "" {
+		_, soKey := generateKey(ctx.stub, SO_KEY, []string{cPOOrder.SONUMBER, cPOOrder.SOITEM})
+		err, exist := ctx.get(soKey, &salesOrder)
+		if err != nil {
+			return err, nil
+		}
+		if !exist {
+			issues = append(issues, AuditIssue{Type: ISSUE_ORPHAN, Key: key, Field: "SONUMBER", Target: soKey, Message: "SO " + cPOOrder.SONUMBER + "/" + cPOOrder.SOITEM + " doesn't exist"})
+		} else if salesOrder.CPONO == "" {
+			issues = append(issues, AuditIssue{Type: ISSUE_ONE_SIDED, Key: key, Field: "SONUMBER", Target: soKey, Message: "SO has no CPO number", Repairable: true,
+				repair: func() (error, bool) {
+					salesOrder := model.SalesOrder{}
+					err, _ := ctx.get(soKey, &salesOrder)
+					if err != nil || salesOrder.CPONO != "" {
+						return err, false
+					}
+					salesOrder.CPONO = cPOOrder.CPONO
+					return ctx.put(soKey, salesOrder), true
+				}})
+		} else if salesOrder.CPONO != cPOOrder.CPONO {
+			issues = append(issues, AuditIssue{Type: ISSUE_MISMATCH, Key: key, Field: "SONUMBER", Target: soKey, Message: "SO refers to CPO " + salesOrder.CPONO})
+		}
+	}
+	if cPOOrder.PONO != "" {
+		_, poKey := generateKey(ctx.stub, PO_KEY, []string{cPOOrder.PONO, cPOOrder.POITEM})
+		poOrder := model.PurchaseOrder{}
+		err, exist := ctx.get(poKey, &poOrder)
+		if err != nil {
+			return err, nil
+		}
+		if !exist {
+			issues = append(issues, AuditIssue{Type: ISSUE_ORPHAN, Key: key, Field: "PONO", Target: poKey, Message: "PO " + cPOOrder.PONO + "/" + cPOOrder.POITEM + " doesn't exist"})
+		} else if poOrder.SONUMBER != cPOOrder.SONUMBER || poOrder.SOITEM != cPOOrder.SOITEM {
+			issues = append(issues, AuditIssue{Type: ISSUE_MISMATCH, Key: key, Field: "PONO", Target: poKey, Message: "PO refers to SO " + poOrder.SONUMBER + "/" + poOrder.SOITEM})
+		}
+	} else if salesOrder.PONO != "" {
+		issues = append(issues, AuditIssue{Type: ISSUE_ONE_SIDED, Key: key, Field: "PONO", Target: key, Message: "CPO has no PO number of its SO " + salesOrder.SONUMBER + "/" + salesOrder.SOITEM, Repairable: true,
+			repair: func() (error, bool) {
+				cPOOrder := model.ODMPurchaseOrder{}
+				err, _ := ctx.get(key, &cPOOrder)
+				if err != nil || cPOOrder.PONO != "" {
+					return err, false
+				}
+				cPOOrder.PONO = salesOrder.PONO
+				cPOOrder.POITEM = salesOrder.POITEM
+				return ctx.put(key, cPOOrder), true
+			}})
+	}
+	return nil, issues
+}
+
+func auditSupplierOrder(ctx *auditContext, key string, valAsbytes []byte) (error, []AuditIssue) {
+	supOrder := model.SupplierOrder{}
+	err := json.Unmarshal(valAsbytes, &supOrder)
+	if err != nil {
+		return newError(ERR_INTERNAL, key, "", err.Error()), nil
+	}
+	issues := []AuditIssue{}
+	_, poKey := generateKey(ctx.stub, PO_KEY, []string{supOrder.PONumber, supOrder.POItem})
+	poOrder := model.PurchaseOrder{}
+	err, exist := ctx.get(poKey, &poOrder)
+	if err != nil {
+		return err, nil
+	}
+	if !exist {
+		issues = append(issues, AuditIssue{Type: ISSUE_ORPHAN, Key: key, Field: "PONumber", Target: poKey, Message: "PO " + supOrder.PONumber + "/" + supOrder.POItem + " doesn't exist"})
+		return nil, issues
+	}
+	for _, order := range poOrder.SupplierOrders {
+		if order.VendorNO == supOrder.VendorNO && order.ASNNumber == supOrder.ASNNumber {
+			return nil, issues
+		}
+	}
+	issues = append(issues, AuditIssue{Type: ISSUE_ONE_SIDED, Key: key, Field: "PONumber", Target: poKey, Message: "PO has no ASN " + supOrder.ASNNumber, Repairable: true,
+		repair: func() (error, bool) {
+			poOrder := model.PurchaseOrder{}
+			err, _ := ctx.get(poKey, &poOrder)
+			if err != nil {
+				return err, false
+			}
+			poOrder.SupplierOrders = append(poOrder.SupplierOrders, supOrder)
+			return ctx.put(poKey, poOrder), true
+		}})
+	return nil, issues
+}
+
+//一致性检查 (只读)
+func auditConsistency(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	err, param, keyStart, keyEnd := parseAuditParam(stub, args)
+	if err != nil {
+		return errorResponse(err)
+	}
+	err, ctx := newAuditContext(stub)
+	if err != nil {
+		return errorResponse(err)
+	}
+	err, report := auditRange(ctx, param, keyStart, keyEnd)
+	if err != nil {
+		return errorResponse(err)
+	}
+	b, _ := json.Marshal(report)
+	return shim.Success(b)
+}
+
+//修复单向关联, 每次最多处理limit条记录
+func repairConsistency(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	err, param, keyStart, keyEnd := parseAuditParam(stub, args)
+	if err != nil {
+		return errorResponse(err)
+	}
+	err, ctx := newAuditContext(stub)
+	if err != nil {
+		return errorResponse(err)
+	}
+	err, report := auditRange(ctx, param, keyStart, keyEnd)
+	if err != nil {
+		return errorResponse(err)
+	}
+	for _, issue := range report.Issues {
+		if issue.repair == nil {
+			continue
+		}
+		fmt.Println("repair data, " + issue.Type + " " + issue.Field + " for - " + issue.Key)
+		err, repaired := issue.repair()
+		if err != nil {
+			return errorResponse(errorWithKey(err, issue.Target))
+		}
+		if repaired {
+			report.Repaired = append(report.Repaired, issue.Target)
+		}
+	}
+	b, _ := json.Marshal(report)
+	return shim.Success(b)
+}
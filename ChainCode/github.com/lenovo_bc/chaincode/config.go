@@ -0,0 +1,290 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"reflect"
+	"sort"
+)
+
+//Settings of the chaincode, stored under CONFIG_KEY. Init sets them when the
+//chaincode is instantiated or upgraded, an admin can change them later with
+//setConfig and anybody can read them with getConfig:
+//
+//	{"Args":["init"]}                     keep the stored config, defaults if none
+//	{"Args":["init","{\"BuyerOrg\":…}"]}  store the config document
+//	{"Args":["init","compat"]}            stored config with the compat feature
+//	{"Args":["init","full"]}              stored config without the compat feature
+//
+//Fields missing from a config document take their default. Every change
+//increases Version, a document with another non-zero Version than the stored
+//one is rejected as stale.
+//
+//This package is the only source of the chaincode, API/artifacts gets a
+//copy from API/app/copy-chaincode.js at deploy time, see TestArtifacts. The
+//compat feature answers queryByIds like the former API copy did, with the
+//records only and without the linked SO/PO of integrateLedger, for clients
+//that still expect it.
+type Config struct {
+	Version    int                 `json:"Version"`   //Increased by every change, 0 until the config is stored
+	BuyerOrg   string              `json:"BuyerOrg"`  //Org of the buyer, default purge approver
+	Roles      map[string]string   `json:"Roles"`     //Role of each org, the userRole of its queries. Partners without one see masked fields
+	Orgs       map[string]string   `json:"Orgs"`      //Org of each MSP ID, the caller of a transaction is the org of its creator
+	VendorNos  map[string][]string `json:"VendorNos"` //Vendor nos of each partner org, its webhook subscriptions filter on them
+	Star       string              `json:"Star"`      //Value of masked fields and secrets
+	Limits     ConfigLimits        `json:"Limits"`
+	Tolerances ConfigTolerances    `json:"Tolerances"`
+	Features   map[string]bool     `json:"Features"` //Enabled features, functions of a disabled one are refused
+}
+
+type ConfigLimits struct {
+	AuditLimit          int `json:"AuditLimit"`          //Default records per audit or migration batch
+	AuditMaxLimit       int `json:"AuditMaxLimit"`       //Max records per audit or migration batch, max SOs queryUBLInvoice scans
+	PurgeMaxKeys        int `json:"PurgeMaxKeys"`        //Max keys deleted by one purge
+	WebhookSecretMinLen int `json:"WebhookSecretMinLen"` //Min length of the HMAC secret
+}
+
+//Quantity differences auditConsistency reports as QUANTITY issues
+type ConfigTolerances struct {
+	QtyPercent      float64 `json:"QtyPercent"`      //Difference allowed between the quantity of a PO and of its SO, percent of the SO quantity
+	OverShipPercent float64 `json:"OverShipPercent"` //Quantity the ASNs of a PO may ship over the PO quantity, percent of it
+}
+
+var configRoles = []string{ROLE_BUYER, ROLE_SUPPLIER, ROLE_ODM}
+
+//Feature of the functions that can be disabled
+var functionFeatures = map[string]string{
+	"setPurgeApprovers":         FEATURE_PURGE,
+	"requestPurge":              FEATURE_PURGE,
+	"approvePurge":              FEATURE_PURGE,
+	"executePurge":              FEATURE_PURGE,
+	"crIDocInfo":                FEATURE_IDOC,
+	"setIDocMapping":            FEATURE_IDOC,
+	"queryIDocMapping":          FEATURE_IDOC,
+	"crX12Info":                 FEATURE_X12,
+	"queryEPCISEvents":          FEATURE_EPCIS,
+	"queryUBLInvoice":           FEATURE_UBL,
+	"setWebhookSubscription":    FEATURE_WEBHOOKS,
+	"removeWebhookSubscription": FEATURE_WEBHOOKS,
+	"queryWebhookSubscriptions": FEATURE_WEBHOOKS,
+}
+
+func defaultConfig() Config {
+	return Config{
+		BuyerOrg:  "lenovo",
+		Roles:     map[string]string{"lenovo": ROLE_BUYER},
+		Orgs:      map[string]string{BUYER_MSP: "lenovo"},
+		VendorNos: map[string][]string{},
+		Star:      STAR,
+		Limits:    ConfigLimits{AuditLimit: AUDIT_LIMIT, AuditMaxLimit: AUDIT_MAX_LIMIT, PurgeMaxKeys: PURGE_MAX_KEYS, WebhookSecretMinLen: WEBHOOK_SECRET_MIN_LEN},
+		Features: map[string]bool{FEATURE_COMPAT: false, FEATURE_PURGE: true, FEATURE_IDOC: true, FEATURE_X12: true,
+			FEATURE_EPCIS: true, FEATURE_UBL: true, FEATURE_WEBHOOKS: true},
+	}
+}
+
+//Config of a document, missing fields take their default. Roles and Orgs
+//replace the default ones, features are merged with them.
+func decodeConfig(valAsbytes []byte) (error, Config) {
+	cfg := defaultConfig()
+	cfg.Roles = nil
+	cfg.Orgs = nil
+	err := json.Unmarshal(valAsbytes, &cfg)
+	if err != nil {
+		return err, cfg
+	}
+	if cfg.Roles == nil {
+		cfg.Roles = map[string]string{cfg.BuyerOrg: ROLE_BUYER}
+	}
+	if cfg.Orgs == nil {
+		cfg.Orgs = map[string]string{BUYER_MSP: cfg.BuyerOrg}
+	}
+	return nil, cfg
+}
+
+func validateConfig(cfg Config) error {
+	defaults := defaultConfig()
+	if cfg.BuyerOrg == "" {
+		return newError(ERR_VALIDATION, CONFIG_KEY, "BuyerOrg", "BuyerOrg is required")
+	}
+	for userRole, role := range cfg.Roles {
+		if userRole == "" || !contains(configRoles, role) {
+			return newError(ERR_VALIDATION, CONFIG_KEY, "Roles", fmt.Sprintf("Unknown role '%s' of '%s', expecting one of %v", role, userRole, configRoles))
+		}
+	}
+	if cfg.Roles[cfg.BuyerOrg] != ROLE_BUYER {
+		return newError(ERR_VALIDATION, CONFIG_KEY, "Roles", "BuyerOrg "+cfg.BuyerOrg+" must have role "+ROLE_BUYER)
+	}
+	buyerMSP := false
+	for mspID, org := range cfg.Orgs {
+		if mspID == "" || org == "" {
+			return newError(ERR_VALIDATION, CONFIG_KEY, "Orgs", fmt.Sprintf("Empty MSP ID or org '%s' of '%s'", org, mspID))
+		}
+		buyerMSP = buyerMSP || org == cfg.BuyerOrg
+	}
+	if !buyerMSP {
+		return newError(ERR_VALIDATION, CONFIG_KEY, "Orgs", "BuyerOrg "+cfg.BuyerOrg+" must be the org of an MSP ID")
+	}
+	for org, vendorNos := range cfg.VendorNos {
+		if org == "" || len(vendorNos) == 0 || contains(vendorNos, "") {
+			return newError(ERR_VALIDATION, CONFIG_KEY, "VendorNos", fmt.Sprintf("Empty org or vendor no %v of '%s'", vendorNos, org))
+		}
+	}
+	if cfg.Star == "" {
+		return newError(ERR_VALIDATION, CONFIG_KEY, "Star", "Star is required")
+	}
+	if cfg.Tolerances.QtyPercent < 0 || cfg.Tolerances.OverShipPercent < 0 {
+		return newError(ERR_VALIDATION, CONFIG_KEY, "Tolerances", "Tolerances can't be negative")
+	}
+	limits := cfg.Limits
+	if limits.AuditLimit <= 0 || limits.AuditMaxLimit < limits.AuditLimit {
+		return newError(ERR_VALIDATION, CONFIG_KEY, "Limits", "AuditLimit must be positive and not more than AuditMaxLimit")
+	}
+	if limits.PurgeMaxKeys <= 0 {
+		return newError(ERR_VALIDATION, CONFIG_KEY, "Limits", "PurgeMaxKeys must be positive")
+	}
+	if limits.WebhookSecretMinLen < WEBHOOK_SECRET_MIN_LEN {
+		return newError(ERR_VALIDATION, CONFIG_KEY, "Limits", fmt.Sprintf("WebhookSecretMinLen can't be less than %d", WEBHOOK_SECRET_MIN_LEN))
+	}
+	for feature := range cfg.Features {
+		if _, ok := defaults.Features[feature]; !ok {
+			return newError(ERR_VALIDATION, CONFIG_KEY, "Features", "Unknown feature '"+feature+"'")
+		}
+	}
+	return nil
+}
+
+//Config in effect, the defaults if it was never stored
+func loadConfig(stub shim.ChaincodeStubInterface) (error, Config) {
+	valAsbytes, err := stub.GetState(CONFIG_KEY)
+	if err != nil {
+		return newError(ERR_INTERNAL, CONFIG_KEY, "", err.Error()), defaultConfig()
+	}
+	if valAsbytes == nil {
+		return nil, defaultConfig()
+	}
+	err, cfg := decodeConfig(valAsbytes)
+	if err != nil {
+		return newError(ERR_INTERNAL, CONFIG_KEY, "", err.Error()), cfg
+	}
+	return nil, cfg
+}
+
+//Stores cfg as the next version of current, nothing is written if it
+//doesn't change anything
+func saveConfig(stub shim.ChaincodeStubInterface, current Config, cfg Config) pb.Response {
+	if cfg.Version != 0 && cfg.Version != current.Version {
+		return errorResp(ERR_STALE_UPDATE, CONFIG_KEY, "Version", fmt.Sprintf("Config version %d is stale, the stored version is %d", cfg.Version, current.Version))
+	}
+	cfg.Version = current.Version
+	if reflect.DeepEqual(cfg, current) {
+		b, _ := json.Marshal(current)
+		return shim.Success(b)
+	}
+	err := validateConfig(cfg)
+	if err != nil {
+		return errorResponse(err)
+	}
+	cfg.Version++
+	b, _ := json.Marshal(cfg)
+	err = stub.PutState(CONFIG_KEY, b)
+	if err != nil {
+		return errorResp(ERR_INTERNAL, CONFIG_KEY, "", err.Error())
+	}
+	return shim.Success(b)
+}
+
+//Stores the config of the Init arguments, see Config
+func initConfig(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) > 1 {
+		return errorResp(ERR_VALIDATION, "", "", "Incorrect number of arguments. Expecting optional config")
+	}
+	err, current := loadConfig(stub)
+	if err != nil {
+		return errorResponse(err)
+	}
+	if len(args) == 0 {
+		b, _ := json.Marshal(current)
+		return shim.Success(b)
+	}
+	var cfg Config
+	if args[0] == MODE_FULL || args[0] == MODE_COMPAT {
+		err, cfg = loadConfig(stub)
+		if err != nil {
+			return errorResponse(err)
+		}
+		cfg.Features[FEATURE_COMPAT] = args[0] == MODE_COMPAT
+	} else {
+		err, cfg = decodeConfig([]byte(args[0]))
+		if err != nil {
+			return errorResp(ERR_VALIDATION, CONFIG_KEY, "config", err.Error())
+		}
+	}
+	return saveConfig(stub, current, cfg)
+}
+
+//修改配置  args: config
+func setConfig(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	err, current := loadConfig(stub)
+	if err != nil {
+		return errorResponse(err)
+	}
+	err, cfg := decodeConfig([]byte(args[0]))
+	if err != nil {
+		return errorResp(ERR_VALIDATION, CONFIG_KEY, "config", err.Error())
+	}
+	return saveConfig(stub, current, cfg)
+}
+
+//查询配置
+func getConfig(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	err, cfg := loadConfig(stub)
+	if err != nil {
+		return errorResponse(err)
+	}
+	b, _ := json.Marshal(cfg)
+	return shim.Success(b)
+}
+
+//userRoles of the roles, sorted
+func (cfg Config) userRoles(roles []string) []string {
+	userRoles := []string{}
+	for userRole, role := range cfg.Roles {
+		if contains(roles, role) {
+			userRoles = append(userRoles, userRole)
+		}
+	}
+	sort.Strings(userRoles)
+	return userRoles
+}
+
+//Refuses the functions of a disabled feature
+func (cfg Config) checkFeature(function string) error {
+	feature := functionFeatures[function]
+	if feature != "" && !cfg.Features[feature] {
+		return newError(ERR_PERMISSION, CONFIG_KEY, "Features", "Feature '"+feature+"' of "+function+" is disabled")
+	}
+	return nil
+}
+
+//Caller of a query. Fields in maskedFields and webhook secrets are replaced
+//by Star unless its role is buyer.
+type viewer struct {
+	UserRole string
+	Buyer    bool
+	Star     string
+}
+
+func (cfg Config) viewer(userRole string) viewer {
+	return viewer{UserRole: userRole, Buyer: cfg.Roles[userRole] == ROLE_BUYER, Star: cfg.Star}
+}
+
+//Viewer of the userRole argument of a query
+func viewerOf(stub shim.ChaincodeStubInterface, userRole string) (error, viewer) {
+	err, cfg := loadConfig(stub)
+	if err != nil {
+		return err, viewer{}
+	}
+	return nil, cfg.viewer(userRole)
+}
@@ -0,0 +1,82 @@
+package chaincode
+
+
+//Key Prefix
+const SO_KEY = "SO"        //SalesOrder Key
+const PO_KEY = "PO"        //PurchaseOrder key
+const CPO_KEY = "CPO"      // ODM Key
+const SUPPLIER_KEY = "SUP" // ODM Key
+const STAR = "***"         //Default Config.Star
+
+//Error Code
+const ERR_VALIDATION = "VALIDATION"     //Wrong arguments or invalid field value
+const ERR_NOT_FOUND = "NOT_FOUND"       //Record doesn't exist in ledger
+const ERR_PERMISSION = "PERMISSION"     //Caller is not allowed to do it
+const ERR_CONFLICT = "CONFLICT"         //Record conflicts with ledger data
+const ERR_STALE_UPDATE = "STALE_UPDATE" //Update is older than ledger data
+const ERR_INTERNAL = "INTERNAL"         //Ledger access or marshal failure
+
+//Integrity Rule
+const INTEGRITY_KEY = "INTEGRITY" //Integrity rules Key
+const RULE_REQUIRED = "REQUIRED"  //Parent is required, transaction fails without it
+const RULE_WARN = "WARN"          //Dangling record is saved with warning
+const RULE_REJECT = "REJECT"      //Dangling record is skipped, others are saved
+
+//Write Result Status
+const RESULT_OK = "OK"
+const RESULT_WARNING = "WARNING"
+const RESULT_REJECTED = "REJECTED"
+
+//Audit Issue Type
+const ISSUE_ORPHAN = "ORPHAN"       //Linked record doesn't exist
+const ISSUE_ONE_SIDED = "ONE_SIDED" //Linked record has no back-reference
+const ISSUE_MISMATCH = "MISMATCH"   //Linked record refers to another record
+const ISSUE_DUPLICATE = "DUPLICATE" //Duplicate line in record
+const ISSUE_QUANTITY = "QUANTITY"   //Quantities of linked records differ beyond Config.Tolerances
+const AUDIT_LIMIT = 100             //Default records per audit batch, see Config.Limits
+const AUDIT_MAX_LIMIT = 1000        //Max records per audit batch, see Config.Limits
+
+//Delete Flag
+const SO_DELETED = "X"  //SalesOrder.DELFLAG of deleted SO
+const PO_DELETED = "L"  //PurchaseOrder.POItemSts of deleted PO item (SAP deletion indicator)
+const DOC_DELETED = "X" //DELFLAG of CPO and supplier ASN deleted by cascade
+
+//Purge
+const PURGE_KEY = "PURGE"                    //PurgeRequest Key
+const PURGE_APPROVERS_KEY = "PURGEAPPROVERS" //Purge approver orgs Key
+const PURGE_EVENT = "PURGE"                  //Event name of executed purge
+const PURGE_MAX_KEYS = 1000                  //Max keys deleted by one purge, see Config.Limits
+const PURGE_PENDING = "PENDING"
+const PURGE_APPROVED = "APPROVED"
+const PURGE_EXECUTED = "EXECUTED"
+
+//IDoc
+const IDOC_MAPPING_KEY = "IDOCMAPPING" //IDoc segment mapping Key
+
+//Posting Event, emitted once per transaction by Invoke. The event listener
+//translates it to SAP outbound messages and partner webhooks.
+const POSTING_EVENT = "POSTED"
+
+//Webhook
+const WEBHOOK_KEY = "WEBHOOK"      //WebhookSubscription Key
+const WEBHOOK_SECRET_MIN_LEN = 16 //Min length of the HMAC secret, Config.Limits can only raise it
+
+//Config, set by Init and setConfig
+const CONFIG_KEY = "CONFIG" //Config Key, absent until the config is changed
+const ROLE_BUYER = "buyer"  //Sees masked fields and webhook secrets
+const ROLE_SUPPLIER = "supplier"
+const ROLE_ODM = "odm"
+const BUYER_MSP = "Org1MSP"     //MSP ID of the buyer org by default, org1 of API/app/network-config.json
+const FEATURE_COMPAT = "compat" //queryByIds answers like the former API/artifacts copy
+const FEATURE_PURGE = "purge"
+const FEATURE_IDOC = "idoc"
+const FEATURE_X12 = "x12"
+const FEATURE_EPCIS = "epcis"
+const FEATURE_UBL = "ubl"
+const FEATURE_WEBHOOKS = "webhooks"
+const MODE_FULL = "full"     //Init argument, disables FEATURE_COMPAT
+const MODE_COMPAT = "compat" //Init argument, enables FEATURE_COMPAT
+
+//Schema Version
+const SCHEMA_VERSION = 2        //Version stamped on the records written by this chaincode
+const SCHEMA_VERSION_LEGACY = 1 //Version of records written before versioning
@@ -0,0 +1,141 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/lenovo_bc/model"
+)
+
+//删除标记, 适用于所有类型的记录
+type deleteFlags struct {
+	DELFLAG   string `json:"DELETEFLAG"` //SO, CPO, Supplier ASN
+	POItemSts string `json:"POItemSts"`  //PO
+}
+
+func isDeleted(valAsbytes []byte) bool {
+	flags := deleteFlags{}
+	err := json.Unmarshal(valAsbytes, &flags)
+	if err != nil {
+		return false
+	}
+	return flags.DELFLAG == SO_DELETED || flags.DELFLAG == DOC_DELETED || flags.POItemSts == PO_DELETED
+}
+
+//SO删除标记级联到CPO
+func cascadeSalesOrderDelete(stub shim.ChaincodeStubInterface, salesOrder model.SalesOrder) error {
+	if salesOrder.CPONO == "" {
+		return nil
+	}
+	_, cpoKey := generateKey(stub, CPO_KEY, []string{salesOrder.CPONO})
+	cpoObjAsbytes, err := stub.GetState(cpoKey)
+	if err != nil {
+		return newError(ERR_INTERNAL, cpoKey, "", err.Error())
+	}
+	if cpoObjAsbytes == nil {
+		return nil
+	}
+	cPOOrder := model.ODMPurchaseOrder{}
+	err = json.Unmarshal(cpoObjAsbytes, &cPOOrder)
+	if err != nil {
+		return newError(ERR_INTERNAL, cpoKey, "", err.Error())
+	}
+	if cPOOrder.SONUMBER != salesOrder.SONUMBER || cPOOrder.SOITEM != salesOrder.SOITEM {
+		return nil
+	}
+	cPOOrder.DELFLAG = ""
+	if salesOrder.DELFLAG == SO_DELETED {
+		cPOOrder.DELFLAG = DOC_DELETED
+	}
+	fmt.Println("write data, SO-CPO delete flag " + cPOOrder.DELFLAG + " for - " + cpoKey)
+	c, _ := json.Marshal(cPOOrder)
+	return stub.PutState(cpoKey, c)
+}
+
+//PO删除标记级联到Supplier ASN
+func cascadePurchaseOrderDelete(stub shim.ChaincodeStubInterface, purchaseOrder model.PurchaseOrder, supplierOrders []model.SupplierOrder) error {
+	for _, order := range supplierOrders {
+		_, supKey := generateKey(stub, SUPPLIER_KEY, []string{order.VendorNO, order.ASNNumber})
+		supObjAsbytes, err := stub.GetState(supKey)
+		if err != nil {
+			return newError(ERR_INTERNAL, supKey, "", err.Error())
+		}
+		if supObjAsbytes == nil {
+			continue
+		}
+		supOrder := model.SupplierOrder{}
+		err = json.Unmarshal(supObjAsbytes, &supOrder)
+		if err != nil {
+			return newError(ERR_INTERNAL, supKey, "", err.Error())
+		}
+		if supOrder.PONumber != purchaseOrder.PONO || supOrder.POItem != purchaseOrder.POItemNO {
+			continue
+		}
+		supOrder.DELFLAG = ""
+		if purchaseOrder.POItemSts == PO_DELETED {
+			supOrder.DELFLAG = DOC_DELETED
+		}
+		fmt.Println("write data, PO-SUP delete flag " + supOrder.DELFLAG + " for - " + supKey)
+		c, _ := json.Marshal(supOrder)
+		err = stub.PutState(supKey, c)
+		if err != nil {
+			return newError(ERR_INTERNAL, supKey, "", err.Error())
+		}
+	}
+	return nil
+}
+
+//设置删除标记并级联
+func markDeleted(stub shim.ChaincodeStubInterface, keyPrefix string, key string, valAsbytes []byte) error {
+	var obj interface{}
+	if keyPrefix == SO_KEY {
+		salesOrder := model.SalesOrder{}
+		err := json.Unmarshal(valAsbytes, &salesOrder)
+		if err != nil {
+			return newError(ERR_INTERNAL, key, "", err.Error())
+		}
+		salesOrder.DELFLAG = SO_DELETED
+		err = cascadeSalesOrderDelete(stub, salesOrder)
+		if err != nil {
+			return err
+		}
+		obj = salesOrder
+	} else if keyPrefix == PO_KEY {
+		purchaseOrder := model.PurchaseOrder{}
+		err := json.Unmarshal(valAsbytes, &purchaseOrder)
+		if err != nil {
+			return newError(ERR_INTERNAL, key, "", err.Error())
+		}
+		purchaseOrder.POItemSts = PO_DELETED
+		err = cascadePurchaseOrderDelete(stub, purchaseOrder, purchaseOrder.SupplierOrders)
+		if err != nil {
+			return err
+		}
+		obj = purchaseOrder
+	} else if keyPrefix == CPO_KEY {
+		cPOOrder := model.ODMPurchaseOrder{}
+		err := json.Unmarshal(valAsbytes, &cPOOrder)
+		if err != nil {
+			return newError(ERR_INTERNAL, key, "", err.Error())
+		}
+		cPOOrder.DELFLAG = DOC_DELETED
+		obj = cPOOrder
+	} else if keyPrefix == SUPPLIER_KEY {
+		supOrder := model.SupplierOrder{}
+		err := json.Unmarshal(valAsbytes, &supOrder)
+		if err != nil {
+			return newError(ERR_INTERNAL, key, "", err.Error())
+		}
+		supOrder.DELFLAG = DOC_DELETED
+		obj = supOrder
+	} else {
+		return newError(ERR_VALIDATION, key, "keyPrefix", "Unknown query type '"+keyPrefix+"'")
+	}
+	fmt.Println("write data, delete flag for - " + key)
+	b, _ := json.Marshal(obj)
+	err := stub.PutState(key, b)
+	if err != nil {
+		return newError(ERR_INTERNAL, key, "", err.Error())
+	}
+	return nil
+}
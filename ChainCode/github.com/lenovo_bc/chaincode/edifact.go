@@ -0,0 +1,73 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/lenovo_bc/edifact"
+	"github.com/lenovo_bc/model"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+//EDIFACT supplier interchange, called by crSupplierOrderInfo: args[0] interchange (DESADV/INVOIC), args[1] vendorNo
+func crEdifactInfo(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	vendorNo := args[1]
+	err, ic := edifact.Parse(args[0])
+	if err != nil {
+		return errorResp(ERR_VALIDATION, "", "", err.Error())
+	}
+	results := []WriteResult{}
+	//ASNs are written by one call after all messages are converted
+	asns := []model.SupplierOrder{}
+	for _, message := range ic.Messages {
+		fmt.Println("write data, EDIFACT " + message.Type() + " " + message.Reference())
+		err, doc := edifact.Convert(message)
+		if err != nil {
+			return errorResp(ERR_VALIDATION, message.Reference(), "UNH", err.Error())
+		}
+		var resp pb.Response
+		if doc.Type == edifact.DESADV {
+			//SupplierOrder holds one PO item per ASN
+			if len(doc.SupplierOrders) != 1 {
+				return errorResp(ERR_VALIDATION, message.Reference(), "LIN", fmt.Sprintf("DESADV must despatch exactly one PO item, got %d", len(doc.SupplierOrders)))
+			}
+			asns = append(asns, doc.SupplierOrders...)
+			continue
+		} else {
+			for i := range doc.PurchaseOrders {
+				for j := range doc.PurchaseOrders[i].Invoice {
+					doc.PurchaseOrders[i].Invoice[j].VendorNO = vendorNo
+				}
+			}
+			err = mergePurchaseOrderItems(stub, doc.PurchaseOrders)
+			if err != nil {
+				return errorResponse(err)
+			}
+			b, _ := json.Marshal(doc.PurchaseOrders)
+			resp = crPurchaseOrderInfo(stub, []string{string(b), vendorNo})
+		}
+		if resp.Status != shim.OK {
+			return resp
+		}
+		written := []WriteResult{}
+		err = json.Unmarshal(resp.Payload, &written)
+		if err != nil {
+			return errorResp(ERR_INTERNAL, message.Reference(), "", err.Error())
+		}
+		results = append(results, written...)
+	}
+	if len(asns) > 0 {
+		b, _ := json.Marshal(asns)
+		resp := crSupplierOrderInfo(stub, []string{string(b), vendorNo})
+		if resp.Status != shim.OK {
+			return resp
+		}
+		written := []WriteResult{}
+		err = json.Unmarshal(resp.Payload, &written)
+		if err != nil {
+			return errorResp(ERR_INTERNAL, "", "", err.Error())
+		}
+		results = append(results, written...)
+	}
+	return writeResultResponse(results)
+}
@@ -0,0 +1,103 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/lenovo_bc/epcis"
+	"github.com/lenovo_bc/model"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+//读取SO/PO并按角色过滤, 不存在或已删除返回nil
+func getOrderForEvents(stub shim.ChaincodeStubInterface, keyPrefix string, keys []string, view viewer, includeDeleted bool) (error, string, []byte) {
+	err, key := generateKey(stub, keyPrefix, keys)
+	if err != nil {
+		return err, key, nil
+	}
+	valAsbytes, err := stub.GetState(key)
+	if err != nil {
+		return newError(ERR_INTERNAL, key, "", "Failed to get state for "+key), key, nil
+	}
+	if valAsbytes == nil || (!includeDeleted && isDeleted(valAsbytes)) {
+		return nil, key, nil
+	}
+	err, valAsbytes = filterByUserRole(valAsbytes, keyPrefix, view)
+	if err != nil {
+		return errorWithKey(err, key), key, nil
+	}
+	return nil, key, valAsbytes
+}
+
+//Order of getOrderForEvents into record, unchanged if there is none
+func unmarshalOrderForEvents(stub shim.ChaincodeStubInterface, keyPrefix string, keys []string, view viewer, includeDeleted bool, record interface{}) error {
+	err, key, valAsbytes := getOrderForEvents(stub, keyPrefix, keys, view, includeDeleted)
+	if err != nil || valAsbytes == nil {
+		return err
+	}
+	err = json.Unmarshal(valAsbytes, record)
+	if err != nil {
+		return newError(ERR_INTERNAL, key, "", err.Error())
+	}
+	return nil
+}
+
+//EPCIS 2.0 JSON-LD events of an order: args[0] userRole, args[1] {"keyPrefix":"SO"|"PO","keysStart":[no,item]}
+func queryEPCISEvents(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	param := model.QueryParam{}
+	err := json.Unmarshal([]byte(args[1]), &param)
+	if err != nil {
+		return errorResp(ERR_VALIDATION, "", "", err.Error())
+	}
+	err, view := viewerOf(stub, args[0])
+	if err != nil {
+		return errorResponse(err)
+	}
+	if param.KeyPrefix != SO_KEY && param.KeyPrefix != PO_KEY {
+		return errorResp(ERR_VALIDATION, "", "keyPrefix", "Events are available for SO and PO only")
+	}
+	if len(param.KeysStart) != 2 {
+		return errorResp(ERR_VALIDATION, "", "keysStart", "Document number and item no are required")
+	}
+	err, key, valAsbytes := getOrderForEvents(stub, param.KeyPrefix, param.KeysStart, view, param.IncludeDeleted)
+	if err != nil {
+		return errorResponse(err)
+	}
+	if valAsbytes == nil {
+		return errorResp(ERR_NOT_FOUND, "", "keysStart", "Failed to get state for "+param.KeyPrefix+" "+param.KeysStart[0]+"/"+param.KeysStart[1])
+	}
+	salesOrder := model.SalesOrder{}
+	purchaseOrder := model.PurchaseOrder{}
+	if param.KeyPrefix == SO_KEY {
+		err = json.Unmarshal(valAsbytes, &salesOrder)
+		if err != nil {
+			return errorResp(ERR_INTERNAL, key, "", err.Error())
+		}
+		if salesOrder.PONO != "" && salesOrder.POITEM != "" {
+			err = unmarshalOrderForEvents(stub, PO_KEY, []string{salesOrder.PONO, salesOrder.POITEM}, view, param.IncludeDeleted, &purchaseOrder)
+		}
+	} else {
+		err = json.Unmarshal(valAsbytes, &purchaseOrder)
+		if err != nil {
+			return errorResp(ERR_INTERNAL, key, "", err.Error())
+		}
+		if purchaseOrder.SONUMBER != "" && purchaseOrder.SOITEM != "" {
+			err = unmarshalOrderForEvents(stub, SO_KEY, []string{purchaseOrder.SONUMBER, purchaseOrder.SOITEM}, view, param.IncludeDeleted, &salesOrder)
+		}
+	}
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	events := []epcis.Event{}
+	if salesOrder.SONUMBER != "" {
+		events = append(events, epcis.SalesOrderEvents(salesOrder)...)
+	}
+	if purchaseOrder.PONO != "" {
+		events = append(events, epcis.PurchaseOrderEvents(purchaseOrder)...)
+	}
+	b, err := json.Marshal(epcis.NewDocument(getTxTime(stub), events))
+	if err != nil {
+		return errorResp(ERR_INTERNAL, "", "", err.Error())
+	}
+	return shim.Success(b)
+}
@@ -0,0 +1,206 @@
+//go:build go1.18
+// +build go1.18
+
+package chaincode
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/lenovo_bc/edifact"
+	"github.com/lenovo_bc/model"
+	"github.com/lenovo_bc/x12"
+)
+
+//Fuzz targets of the write functions, run one with
+//
+//	go test -run '^$' -fuzz FuzzCrPurchaseOrderInfo -fuzztime 1m
+//
+//Every input runs on the stub of seededStub and must keep checkWriteInvariants.
+//Without -fuzz the seeds run as unit tests.
+
+//Invokes a write function on a seeded stub, chaincode output discarded
+func fuzzWrite(t *testing.T, function string, args ...string) {
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devNull.Close()
+	stdout := os.Stdout
+	os.Stdout = devNull
+	defer func() { os.Stdout = stdout }()
+	stub := seededStub(t)
+	invokeArgs := [][]byte{[]byte(function)}
+	for _, arg := range args {
+		invokeArgs = append(invokeArgs, []byte(arg))
+	}
+	checkWriteInvariants(t, stub, stub.MockInvoke("fuzz", invokeArgs))
+}
+
+func FuzzCrSalesOrderInfo(f *testing.F) {
+	for _, seed := range []string{
+		`[{"SONUMBER":"479","SOITEM":"10","CPONO":"C002","SOQTY":"3","TRANSDOC":"SO"}]`,
+		`[{"SONUMBER":"478","SOITEM":"10","CPONO":"C001","DELFLAG":"X","TRANSDOC":"SO"}]`,
+		`[{"SONUMBER":"478","SOITEM":"10","TRANSDOC":"BL","BILLINFOS":[{"BILLINGNO":"90001","BILLINGQTY":"5"}]}]`,
+		`[{"SONUMBER":"478","SOITEM":"10","TRANSDOC":"GI","GIINFOS":[{"DNQTY":"5"}]}]`,
+		`[{"SONUMBER":"478","SOITEM":"10","TRANSDOC":"ZZ"}]`,
+		`[{"SONUMBER":"478"}]`,
+		`[{"SONUMBER":"478\u0000","SOITEM":"10","TRANSDOC":"SO"}]`,
+		`[null]`, `[]`, `{}`, `[{"BILLINFOS":{}}]`,
+	} {
+		f.Add(seed, "1209")
+	}
+	f.Fuzz(func(t *testing.T, jsonStr string, vendorNo string) {
+		fuzzWrite(t, "crSalesOrderInfo", jsonStr, vendorNo)
+	})
+}
+
+func FuzzCrPurchaseOrderInfo(f *testing.F) {
+	for _, seed := range []string{
+		`[{"PONO":"4501","POItemNO":"10","SONUMBER":"478","SOITEM":"10","TRANSDOC":"PO"}]`,
+		`[{"PONO":"4500","POItemNO":"10","POItemSts":"L","TRANSDOC":"PO"}]`,
+		`[{"PONO":"4500","POItemNO":"10","TRANSDOC":"GR","GRInfos":[{"GRQty":"5"}]}]`,
+		`[{"PONO":"4500","POItemNO":"10","TRANSDOC":"POCON","Confirmation":[{"CnfQty":"5"}]}]`,
+		`[{"PONO":"4500","POItemNO":"10","TRANSDOC":"INV","Invoice":[{"InvQty":"5"}]}]`,
+		`[{"PONO":"4500","POItemNO":"10","TRANSDOC":"INDN","InboundDelivery":[{"DlvyQty":"5"}]}]`,
+		`[{"PONO":"4500","POItemNO":"10","TRANSDOC":""}]`,
+		`[{"PONO":"4502","POItemNO":"10","SONUMBER":"\udbff\udfff","SOITEM":"10","TRANSDOC":"PO"}]`,
+		`[null]`, `[]`, `[{"PONO":4500}]`,
+	} {
+		f.Add(seed, "1209")
+	}
+	f.Fuzz(func(t *testing.T, jsonStr string, vendorNo string) {
+		fuzzWrite(t, "crPurchaseOrderInfo", jsonStr, vendorNo)
+	})
+}
+
+func FuzzCrCPurchaseOrderInfo(f *testing.F) {
+	for _, seed := range []string{
+		`[{"CPONO":"C001","TRANSDOC":"GR","PARTNUM":"P1","GRQTY":"5","LenDNNO":"DN1"}]`,
+		`[{"CPONO":"C001","TRANSDOC":"BL","INVOICENUM":"90001","INVOICESTATUS":"PAID"}]`,
+		`[{"CPONO":"C009","TRANSDOC":"GR"}]`,
+		`[{"CPONO":"","TRANSDOC":"GR"}]`,
+		`[null]`, `[]`, `"C001"`,
+	} {
+		f.Add(seed, "1209")
+	}
+	f.Fuzz(func(t *testing.T, jsonStr string, vendorNo string) {
+		fuzzWrite(t, "crCPurchaseOrderInfo", jsonStr, vendorNo)
+	})
+}
+
+func FuzzCrSupplierOrderInfo(f *testing.F) {
+	ic := edifact.NewInterchange("1209", "LENOVO", "1", "180109", "1200")
+	asn := []model.SupplierOrder{{ASNNumber: "ASN2", PONumber: "4500", POItem: "10", ShippedQty: "5", CarrierTrackID: "JD'01"}}
+	po := model.PurchaseOrder{PONO: "4500", POItemNO: "10", Invoice: []model.Invoice{{VenInvNO: "INV1", InvItemNO: "1", InvQty: "5"}}}
+	ic.Messages = append(ic.Messages, edifact.BuildDESADV(asn, "1"), edifact.BuildINVOIC(po, "2"))
+	for _, seed := range []string{
+		`[{"ASNNumber":"ASN1","PONumber":"4500","POItem":"10","ShippedQty":"4"}]`,
+		`[{"ASNNumber":"ASN1","TRANSDOC":"UL","PackingList":{"ID":"f1","Name":"packing.pdf","FileType":"pdf"}}]`,
+		`[{"ASNNumber":"ASN2","PONumber":"4500","POItem":"20"}]`,
+		`[{"ASNNumber":"ASN3"}]`,
+		`[{"ASNNumber":""}]`,
+		`[null]`, `[]`,
+		ic.String(),
+		strings.Replace(ic.String(), "UNZ+2+1", "UNZ+3+1", 1),
+		"UNB+UNOC:3",
+	} {
+		f.Add(seed, "1209")
+	}
+	f.Add(`[{"ASNNumber":"ASN1","PONumber":"4500","POItem":"10"}]`, "")
+	f.Fuzz(func(t *testing.T, jsonStr string, vendorNo string) {
+		fuzzWrite(t, "crSupplierOrderInfo", jsonStr, vendorNo)
+	})
+}
+
+func FuzzCrIDocInfo(f *testing.F) {
+	orders := strings.Join([]string{
+		idocRecord(0, "EDI_DC40", 13, "1001", 39, "ORDERS05", 99, "ORDRSP"),
+		idocRecord(0, "E1EDK01", 63+83, "478"),
+		idocRecord(0, "E1EDK02", 63, "001", 63+3, "CPO-478"),
+		idocRecord(0, "E1EDP01", 63, "10", 63+11, "5"),
+	}, "\n")
+	invoice := strings.Join([]string{
+		idocRecord(0, "EDI_DC40", 13, "1002", 39, "INVOIC02", 99, "INVOIC"),
+		idocRecord(0, "E1EDK01", 63+83, "90001"),
+		idocRecord(0, "E1EDP01", 63, "10", 63+11, "5"),
+		idocRecord(0, "E1EDP02", 63, "002", 63+3, "478", 63+38, "10"),
+	}, "\n")
+	for _, seed := range []string{
+		orders, invoice,
+		orders[:200],
+		idocRecord(0, "EDI_DC40", 13, "1003", 39, "ZORD01", 99, "ZORD"),
+		"EDI_DC40", "",
+	} {
+		f.Add(seed, "1209")
+	}
+	f.Fuzz(func(t *testing.T, idoc string, vendorNo string) {
+		fuzzWrite(t, "crIDocInfo", idoc, vendorNo)
+	})
+}
+
+func FuzzCrX12Info(f *testing.F) {
+	ic := x12.NewInterchange("1209", "LENOVO", 1, "180109", "1200")
+	asn := []model.SupplierOrder{{ASNNumber: "ASN2", PONumber: "4500", POItem: "10", ShippedQty: "5", CarrierTrackID: "1Z999"}}
+	ic.AddGroup("SH", 1, "180109", "1200", []x12.Transaction{x12.Build856(asn, 1)})
+	po := model.PurchaseOrder{PONO: "4500", POItemNO: "10", Invoice: []model.Invoice{{VenInvNO: "INV1", InvItemNO: "1", InvQty: "5"}}}
+	ic.AddGroup("IN", 2, "180109", "1200", []x12.Transaction{x12.Build810(po, 2)})
+	for _, seed := range []string{
+		ic.String(),
+		strings.Replace(ic.String(), "GE*1*2", "GE*1*3", 1),
+		strings.Replace(ic.String(), "4500", "4599", -1),
+		ic.String()[:120],
+		"ISA*00", "",
+	} {
+		f.Add(seed, "1209")
+	}
+	f.Fuzz(func(t *testing.T, interchange string, vendorNo string) {
+		fuzzWrite(t, "crX12Info", interchange, vendorNo)
+	})
+}
+
+//A query key is the composite key of the parameters or a validation error
+func FuzzGenerateQueryKey(f *testing.F) {
+	for _, seed := range []string{
+		`{"keyPrefix":"SO","keysStart":["478","10"]}`,
+		`{"keyPrefix":"PO","keysStart":["4500"],"keysEnd":["4501"]}`,
+		`{"keyPrefix":"","keysStart":["478"]}`,
+		`{"keyPrefix":"SO","keysStart":[]}`,
+		`{"keyPrefix":"SO","keysStart":["4\u00008"]}`,
+		`{"keyPrefix":"SO","keysStart":["478"],"keysEnd":["\udbff\udfff"]}`,
+		`{"keyPrefix":"SO","keysStart":[null]}`,
+		`{"keyPrefix":["SO"]}`, `null`, ``,
+	} {
+		f.Add("lenovo", seed)
+	}
+	f.Fuzz(func(t *testing.T, userRole string, param string) {
+		stub := shim.NewMockStub("fuzz", nil)
+		err, keyStart, keyEnd := generateQueryKey(stub, []string{userRole, param})
+		if err != nil {
+			if e, ok := err.(*ErrorInfo); !ok || e.Code != ERR_VALIDATION {
+				t.Fatalf("unexpected error %v", err)
+			}
+			return
+		}
+		for _, key := range []string{keyStart, keyEnd} {
+			if key == "" || (key == keyEnd && key == prefixRangeEnd(keyPrefixOf(keyStart))) {
+				continue
+			}
+			prefix, attributes, err := stub.SplitCompositeKey(key)
+			if err != nil || prefix == "" || keyPrefixOf(key) != prefix {
+				t.Fatalf("invalid key %q of %s", key, param)
+			}
+			if rebuilt, err := stub.CreateCompositeKey(prefix, attributes); err != nil || rebuilt != key {
+				t.Fatalf("key %q does not round trip: %q %v", key, rebuilt, err)
+			}
+		}
+		if keyStart == "" {
+			t.Fatalf("no start key for %s", param)
+		}
+		if keyEnd == "" || keyEnd > prefixRangeEnd(keyPrefixOf(keyStart)) {
+			t.Fatalf("range %q-%q of %s is not bounded by its prefix", keyStart, keyEnd, param)
+		}
+	})
+}
@@ -0,0 +1,26 @@
+package chaincode
+
+import (
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/msp"
+)
+
+//Org of the transaction creator: the MSP ID of its certificate mapped by
+//Config.Orgs. Org arguments can't be trusted, any client can pass any org.
+func creatorOrg(stub shim.ChaincodeStubInterface, cfg Config) (error, string) {
+	creator, err := stub.GetCreator()
+	if err != nil {
+		return newError(ERR_INTERNAL, "", "", err.Error()), ""
+	}
+	identity := &msp.SerializedIdentity{}
+	err = proto.Unmarshal(creator, identity)
+	if err != nil || identity.Mspid == "" {
+		return newError(ERR_PERMISSION, "", "", "Transaction has no creator identity"), ""
+	}
+	org := cfg.Orgs[identity.Mspid]
+	if org == "" {
+		return newError(ERR_PERMISSION, CONFIG_KEY, "Orgs", "MSP '"+identity.Mspid+"' has no org in the config"), ""
+	}
+	return nil, org
+}
@@ -0,0 +1,119 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/lenovo_bc/idoc"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+//IDoc mapping, ledger entries override the default mapping per IDoc type
+func loadIDocMapping(stub shim.ChaincodeStubInterface) (error, idoc.Mapping) {
+	mapping := idoc.DefaultMapping()
+	valAsbytes, err := stub.GetState(IDOC_MAPPING_KEY)
+	if err != nil {
+		return newError(ERR_INTERNAL, IDOC_MAPPING_KEY, "", err.Error()), nil
+	}
+	if valAsbytes != nil {
+		err, stored := idoc.ParseMapping(valAsbytes)
+		if err != nil {
+			return newError(ERR_INTERNAL, IDOC_MAPPING_KEY, "", err.Error()), nil
+		}
+		for idocType, docMapping := range stored {
+			mapping[idocType] = docMapping
+		}
+	}
+	return nil, mapping
+}
+
+//设置IDoc mapping
+func setIDocMapping(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	err, mapping := idoc.ParseMapping([]byte(args[0]))
+	if err != nil {
+		return errorResp(ERR_VALIDATION, IDOC_MAPPING_KEY, "", err.Error())
+	}
+	stored := idoc.Mapping{}
+	valAsbytes, err := stub.GetState(IDOC_MAPPING_KEY)
+	if err != nil {
+		return errorResp(ERR_INTERNAL, IDOC_MAPPING_KEY, "", err.Error())
+	}
+	if valAsbytes != nil {
+		err, stored = idoc.ParseMapping(valAsbytes)
+		if err != nil {
+			return errorResp(ERR_INTERNAL, IDOC_MAPPING_KEY, "", err.Error())
+		}
+	}
+	for idocType, docMapping := range mapping {
+		stored[idocType] = docMapping
+	}
+	b, _ := json.Marshal(stored)
+	err = stub.PutState(IDOC_MAPPING_KEY, b)
+	if err != nil {
+		return errorResp(ERR_INTERNAL, IDOC_MAPPING_KEY, "", err.Error())
+	}
+	return shim.Success(b)
+}
+
+//查询IDoc mapping
+func queryIDocMapping(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	err, mapping := loadIDocMapping(stub)
+	if err != nil {
+		return errorResponse(err)
+	}
+	b, _ := json.Marshal(mapping)
+	return shim.Success(b)
+}
+
+//写入IDoc: args[0] flat file, args[1] vendorNo
+func crIDocInfo(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	vendorNo := args[1]
+	err, idocs := idoc.Parse(args[0])
+	if err != nil {
+		return errorResp(ERR_VALIDATION, "", "", err.Error())
+	}
+	err, mapping := loadIDocMapping(stub)
+	if err != nil {
+		return errorResponse(err)
+	}
+	results := []WriteResult{}
+	for _, doc := range idocs {
+		fmt.Println("write data, IDoc " + doc.Control.DOCNUM + " " + doc.Control.IDOCTYP + "/" + doc.Control.MESTYP)
+		err, converted := mapping.Convert(doc)
+		if err != nil {
+			return errorResp(ERR_VALIDATION, doc.Control.DOCNUM, "IDOCTYP", err.Error())
+		}
+		var resp pb.Response
+		if len(converted.SalesOrders) > 0 {
+			if converted.TRANSDOC != idoc.TARGET_SO {
+				err = mergeSalesOrderItems(stub, converted.SalesOrders)
+				if err != nil {
+					return errorResponse(err)
+				}
+			}
+			b, _ := json.Marshal(converted.SalesOrders)
+			resp = crSalesOrderInfo(stub, []string{string(b), vendorNo})
+		} else if len(converted.PurchaseOrders) > 0 {
+			if converted.TRANSDOC != idoc.TARGET_PO {
+				err = mergePurchaseOrderItems(stub, converted.PurchaseOrders)
+				if err != nil {
+					return errorResponse(err)
+				}
+			}
+			b, _ := json.Marshal(converted.PurchaseOrders)
+			resp = crPurchaseOrderInfo(stub, []string{string(b), vendorNo})
+		} else {
+			return errorResp(ERR_VALIDATION, doc.Control.DOCNUM, "", "IDoc contains no items")
+		}
+		if resp.Status != shim.OK {
+			return resp
+		}
+		written := []WriteResult{}
+		err = json.Unmarshal(resp.Payload, &written)
+		if err != nil {
+			return errorResp(ERR_INTERNAL, doc.Control.DOCNUM, "", err.Error())
+		}
+		results = append(results, written...)
+	}
+	return writeResultResponse(results)
+}
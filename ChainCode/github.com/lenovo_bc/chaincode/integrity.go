@@ -0,0 +1,137 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+//Integrity rules   Key: "INTEGRITY"    document type (SO/PO/CPO/SUP) -> rule
+type IntegrityRules map[string]string
+
+//Write result of one record
+type WriteResult struct {
+	Key      string      `json:"Key"`      //Record key
+	Status   string      `json:"Status"`   //OK, WARNING, REJECTED
+	Warnings []ErrorInfo `json:"Warnings"` //Integrity warnings
+}
+
+//默认规则
+func defaultIntegrityRules() IntegrityRules {
+	return IntegrityRules{
+		SO_KEY:       RULE_WARN,     //SO.CPONO
+		PO_KEY:       RULE_WARN,     //PO.SONUMBER/SOITEM
+		CPO_KEY:      RULE_REQUIRED, //ODM GR/payment -> CPO
+		SUPPLIER_KEY: RULE_REQUIRED, //Supplier ASN -> PO
+	}
+}
+
+func loadIntegrityRules(stub shim.ChaincodeStubInterface) (error, IntegrityRules) {
+	rules := defaultIntegrityRules()
+	valAsbytes, err := stub.GetState(INTEGRITY_KEY)
+	if err != nil {
+		return newError(ERR_INTERNAL, INTEGRITY_KEY, "", err.Error()), nil
+	}
+	if valAsbytes != nil {
+		stored := IntegrityRules{}
+		err = json.Unmarshal(valAsbytes, &stored)
+		if err != nil {
+			return newError(ERR_INTERNAL, INTEGRITY_KEY, "", err.Error()), nil
+		}
+		for docType, rule := range stored {
+			rules[docType] = rule
+		}
+	}
+	return nil, rules
+}
+
+func newWriteResult(key string) WriteResult {
+	return WriteResult{Key: key, Status: RESULT_OK, Warnings: []ErrorInfo{}}
+}
+
+//按规则处理缺失的上级单据, 返回false表示跳过该记录
+func applyIntegrityRule(rules IntegrityRules, docType string, result *WriteResult, warning *ErrorInfo) (error, bool) {
+	fmt.Println("integrity check failed, " + docType + " rule " + rules[docType] + " - " + warning.Message)
+	if rules[docType] == RULE_WARN {
+		result.Status = RESULT_WARNING
+		result.Warnings = append(result.Warnings, *warning)
+		return nil, true
+	} else if rules[docType] == RULE_REJECT {
+		result.Status = RESULT_REJECTED
+		result.Warnings = append(result.Warnings, *warning)
+		return nil, false
+	}
+	return warning, false
+}
+
+//检查关联字段不为空
+func checkReference(rules IntegrityRules, docType string, result *WriteResult, field string, value string) (error, bool) {
+	if value != "" {
+		return nil, true
+	}
+	return applyIntegrityRule(rules, docType, result, newError(ERR_VALIDATION, result.Key, field, field+" is required"))
+}
+
+//检查上级单据存在
+func checkParent(stub shim.ChaincodeStubInterface, rules IntegrityRules, docType string, result *WriteResult, field string, parentKey string, parentName string) (error, bool) {
+	if parentKey != "" {
+		valAsbytes, err := stub.GetState(parentKey)
+		if err != nil {
+			return newError(ERR_INTERNAL, parentKey, "", err.Error()), false
+		}
+		if valAsbytes != nil {
+			return nil, true
+		}
+	}
+	return applyIntegrityRule(rules, docType, result, newError(ERR_NOT_FOUND, result.Key, field, parentName+" doesn't exist"))
+}
+
+func writeResultResponse(results []WriteResult) pb.Response {
+	b, err := json.Marshal(results)
+	if err != nil {
+		return errorResp(ERR_INTERNAL, "", "", err.Error())
+	}
+	return shim.Success(b)
+}
+
+//设置完整性规则
+func setIntegrityRules(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	rules := IntegrityRules{}
+	err := json.Unmarshal([]byte(args[0]), &rules)
+	if err != nil {
+		return errorResp(ERR_VALIDATION, "", "", err.Error())
+	}
+	defaults := defaultIntegrityRules()
+	for docType, rule := range rules {
+		if _, ok := defaults[docType]; !ok {
+			return errorResp(ERR_VALIDATION, INTEGRITY_KEY, docType, "Unknown document type '"+docType+"'")
+		}
+		if rule != RULE_REQUIRED && rule != RULE_WARN && rule != RULE_REJECT {
+			return errorResp(ERR_VALIDATION, INTEGRITY_KEY, docType, "Unknown integrity rule '"+rule+"'")
+		}
+	}
+	err, stored := loadIntegrityRules(stub)
+	if err != nil {
+		return errorResponse(err)
+	}
+	for docType, rule := range rules {
+		stored[docType] = rule
+	}
+	b, _ := json.Marshal(stored)
+	err = stub.PutState(INTEGRITY_KEY, b)
+	if err != nil {
+		return errorResp(ERR_INTERNAL, INTEGRITY_KEY, "", err.Error())
+	}
+	return shim.Success(b)
+}
+
+//查询完整性规则
+func queryIntegrityRules(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	err, rules := loadIntegrityRules(stub)
+	if err != nil {
+		return errorResponse(err)
+	}
+	b, _ := json.Marshal(rules)
+	return shim.Success(b)
+}
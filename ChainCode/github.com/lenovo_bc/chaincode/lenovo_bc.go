@@ -0,0 +1,66 @@
+
+
+package chaincode
+
+
+import (
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+type SmartContract struct {
+}
+
+
+
+func (t *SmartContract) Init(stub shim.ChaincodeStubInterface) pb.Response  {
+	_, args := stub.GetFunctionAndParameters()
+	return initConfig(stub, args)
+}
+
+func (t *SmartContract) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
+	function, args := stub.GetFunctionAndParameters()
+	fmt.Println(" ")
+	fmt.Println("starting invoke, for - " + function)
+	fmt.Println("starting invoke, args - ", args)
+	writes := newPendingStub(stub)
+	schema := &schemaStub{ChaincodeStubInterface: writes}
+	postings := newPostingStub(schema)
+	resp := t.invoke(postings, function, args)
+	if resp.Status < shim.ERRORTHRESHOLD && schema.err != nil {
+		resp = errorResponse(schema.err)
+	}
+	if resp.Status < shim.ERRORTHRESHOLD {
+		err := writes.flush()
+		if err != nil {
+			return errorResponse(err)
+		}
+		err = postings.emit()
+		if err != nil {
+			return errorResponse(err)
+		}
+	}
+	return resp
+}
+
+func (t *SmartContract) invoke(stub shim.ChaincodeStubInterface, function string, args []string) pb.Response {
+	f := registry[function]
+	if f == nil {
+		fmt.Println("Received unknown invoke function name - " + function)
+		return errorResp(ERR_VALIDATION, "", "function", "Received unknown invoke function name - '"+function+"'")
+	}
+	err, cfg := loadConfig(stub)
+	if err != nil {
+		return errorResponse(err)
+	}
+	err = f.validate(stub, cfg, args)
+	if err != nil {
+		return errorResponse(err)
+	}
+	return f.handler(stub, args)
+}
+
+func (t *SmartContract) query(stub shim.ChaincodeStubInterface) pb.Response {
+	return shim.Error("Unknown supported call - Query()")
+}
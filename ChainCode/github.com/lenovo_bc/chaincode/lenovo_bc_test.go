@@ -0,0 +1,1811 @@
+package chaincode
+
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/quick"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.com/lenovo_bc/client"
+	"github.com/lenovo_bc/edifact"
+	"github.com/lenovo_bc/epcis"
+	"github.com/lenovo_bc/mockstub"
+	"github.com/lenovo_bc/model"
+	"github.com/lenovo_bc/outbound"
+	"github.com/lenovo_bc/schema"
+	"github.com/lenovo_bc/ubl"
+	"github.com/lenovo_bc/webhook"
+	"github.com/lenovo_bc/x12"
+)
+
+func checkInit(t *testing.T, stub *mockstub.Stub) {
+	res := stub.MockInit("1", nil)
+	if res.Status != shim.OK {
+		fmt.Println("Init failed", string(res.Message))
+		t.FailNow()
+	}
+}
+
+func checkState(t *testing.T, stub *mockstub.Stub, name string, value string) {
+	bytes := stub.State[name]
+	if bytes == nil {
+		fmt.Println("State", name, "failed to get value")
+		t.FailNow()
+	}
+	if string(bytes) != value {
+		fmt.Println("State value", name, "was not", value, "as expected")
+		t.FailNow()
+	}
+}
+
+func checkQuery(t *testing.T, stub *mockstub.Stub, funcName string, args ...string) {
+	invokeArgs := [][]byte{[]byte(funcName)}
+	for _, arg := range args {
+		invokeArgs = append(invokeArgs, []byte(arg))
+	}
+	res := stub.MockInvoke("1", invokeArgs)
+	if res.Status != shim.OK {
+		fmt.Println(string(res.Message))
+		t.FailNow()
+	}
+	if res.Payload == nil {
+		fmt.Println("Query","", "failed to get value")
+		t.FailNow()
+	}
+	
+}
+
+func checkInvoke(t *testing.T, stub *mockstub.Stub, args [][]byte) {
+	res := stub.MockInvoke("1", args)
+	if res.Status != shim.OK {
+		fmt.Println("Invoke", args, "failed", string(res.Message))
+		t.FailNow()
+	}
+}
+
+
+func TestExample02_Init(t *testing.T) {
+	scc := new(SmartContract)
+	stub := mockstub.NewStub("ex02", scc)
+
+	// Init A=123 B=234
+	checkInit(t, stub)
+}
+
+
+func TestExample02_Invoke(t *testing.T) {
+	scc := new(SmartContract)
+	stub := mockstub.NewStub("ex02", scc)
+
+	// Init A=567 B=678
+	checkInit(t, stub)
+
+	// Invoke A->B for 123
+	args:= "[{\"SONUMBER\":\"478\",\"SOITEM\":\"1209\",\"SOCDATE\":\"478\",\"SOCTIME\":\"22222\",\"NETPRICE\":\"07\",\"TRANSDOC\":\"SO\"}]"
+	checkInvoke(t, stub, [][]byte{[]byte("crSalesOrderInfo"), []byte(args), []byte("1209")})
+	
+	args= "[{\"PONO\":\"478\",\"TRANSDOC\":\"PO\",\"VendorNO\":\"1209\",\"VendorName\":\"478\",\"PODate\":\"22222\",\"POItemNO\":\"07\",\"SONUMBER\":\"478\",\"SOITEM\":\"1209\"}]"
+	checkInvoke(t, stub, [][]byte{[]byte("crPurchaseOrderInfo"), []byte(args), []byte("1209")})
+}
+
+func checkError(t *testing.T, stub *mockstub.Stub, args [][]byte, code string, key string) {
+	res := stub.MockInvoke("1", args)
+	if res.Status == shim.OK {
+		fmt.Println("Invoke", string(args[0]), "should fail with", code)
+		t.FailNow()
+	}
+	errInfo := ErrorInfo{}
+	if err := json.Unmarshal([]byte(res.Message), &errInfo); err != nil {
+		fmt.Println("Error message is not json", res.Message)
+		t.FailNow()
+	}
+	if errInfo.Code != code || errInfo.Key != key {
+		fmt.Println("Error", res.Message, "was not", code, key, "as expected")
+		t.FailNow()
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	scc := new(SmartContract)
+	stub := mockstub.NewStub("ex02", scc)
+	checkInit(t, stub)
+
+	checkError(t, stub, [][]byte{[]byte("crSalesOrderInfo"), []byte("[]")}, ERR_VALIDATION, "")
+	checkError(t, stub, [][]byte{[]byte("unknownFunction")}, ERR_VALIDATION, "")
+
+	cpoKey, _ := stub.CreateCompositeKey(CPO_KEY, []string{"C001"})
+	args := "[{\"CPONO\":\"C001\",\"TRANSDOC\":\"GR\",\"GRQTY\":\"1\"}]"
+	checkError(t, stub, [][]byte{[]byte("crCPurchaseOrderInfo"), []byte(args), []byte("1209")}, ERR_NOT_FOUND, cpoKey)
+
+	soKey, _ := stub.CreateCompositeKey(SO_KEY, []string{"478", "1209"})
+	checkError(t, stub, [][]byte{[]byte("queryById"), []byte("lenovo"), []byte("{\"keyPrefix\":\"SO\",\"keysStart\":[\"478\",\"1209\"]}")}, ERR_NOT_FOUND, soKey)
+}
+
+
+func checkWriteResult(t *testing.T, stub *mockstub.Stub, args [][]byte, status string) {
+	res := stub.MockInvoke("1", args)
+	if res.Status != shim.OK {
+		fmt.Println("Invoke", string(args[0]), "failed", res.Message)
+		t.FailNow()
+	}
+	var results []WriteResult
+	json.Unmarshal(res.Payload, &results)
+	if len(results) != 1 || results[0].Status != status {
+		fmt.Println("Write result", string(res.Payload), "was not", status, "as expected")
+		t.FailNow()
+	}
+}
+
+func TestIntegrityRules(t *testing.T) {
+	scc := new(SmartContract)
+	stub := mockstub.NewStub("ex02", scc)
+	checkInit(t, stub)
+	stub.SetCreator(BUYER_MSP)
+
+	// SO without CPONO is saved with warning and no CPO stub
+	args := "[{\"SONUMBER\":\"478\",\"SOITEM\":\"10\",\"TRANSDOC\":\"SO\"}]"
+	checkWriteResult(t, stub, [][]byte{[]byte("crSalesOrderInfo"), []byte(args), []byte("1209")}, RESULT_WARNING)
+	cpoKey, _ := stub.CreateCompositeKey(CPO_KEY, []string{""})
+	if stub.State[cpoKey] != nil {
+		fmt.Println("CPO stub was created for empty CPONO")
+		t.FailNow()
+	}
+
+	// PO pointing to a missing SO
+	args = "[{\"PONO\":\"4500\",\"POItemNO\":\"10\",\"TRANSDOC\":\"PO\",\"SONUMBER\":\"999\",\"SOITEM\":\"10\"}]"
+	checkWriteResult(t, stub, [][]byte{[]byte("crPurchaseOrderInfo"), []byte(args), []byte("1209")}, RESULT_WARNING)
+	checkInvoke(t, stub, [][]byte{[]byte("setIntegrityRules"), []byte("{\"PO\":\"REJECT\"}")})
+	args = "[{\"PONO\":\"4501\",\"POItemNO\":\"10\",\"TRANSDOC\":\"PO\",\"SONUMBER\":\"999\",\"SOITEM\":\"10\"}]"
+	checkWriteResult(t, stub, [][]byte{[]byte("crPurchaseOrderInfo"), []byte(args), []byte("1209")}, RESULT_REJECTED)
+	poKey, _ := stub.CreateCompositeKey(PO_KEY, []string{"4501", "10"})
+	if stub.State[poKey] != nil {
+		fmt.Println("Rejected PO was saved")
+		t.FailNow()
+	}
+
+	// ASN for a missing PO fails by default
+	supKey, _ := stub.CreateCompositeKey(SUPPLIER_KEY, []string{"1209", "ASN1"})
+	args = "[{\"ASNNumber\":\"ASN1\",\"PONumber\":\"4501\",\"POItem\":\"10\"}]"
+	checkError(t, stub, [][]byte{[]byte("crSupplierOrderInfo"), []byte(args), []byte("1209")}, ERR_NOT_FOUND, supKey)
+	checkError(t, stub, [][]byte{[]byte("setIntegrityRules"), []byte("{\"SUP\":\"IGNORE\"}")}, ERR_VALIDATION, INTEGRITY_KEY)
+}
+
+func checkAudit(t *testing.T, stub *mockstub.Stub, function string, param string) AuditReport {
+	res := stub.MockInvoke("1", [][]byte{[]byte(function), []byte(param)})
+	if res.Status != shim.OK {
+		fmt.Println(function, "failed", res.Message)
+		t.FailNow()
+	}
+	report := AuditReport{}
+	json.Unmarshal(res.Payload, &report)
+	return report
+}
+
+func TestAuditConsistency(t *testing.T) {
+	scc := new(SmartContract)
+	stub := mockstub.NewStub("ex02", scc)
+	checkInit(t, stub)
+	stub.SetCreator(BUYER_MSP)
+
+	// PO is created before its SO, so the SO has no PO number
+	args := "[{\"PONO\":\"4500\",\"POItemNO\":\"10\",\"TRANSDOC\":\"PO\",\"SONUMBER\":\"478\",\"SOITEM\":\"10\"}]"
+	checkInvoke(t, stub, [][]byte{[]byte("crPurchaseOrderInfo"), []byte(args), []byte("1209")})
+	args = "[{\"SONUMBER\":\"478\",\"SOITEM\":\"10\",\"CPONO\":\"C001\",\"TRANSDOC\":\"SO\"}]"
+	checkInvoke(t, stub, [][]byte{[]byte("crSalesOrderInfo"), []byte(args), []byte("1209")})
+	args = "[{\"PONO\":\"4500\",\"POItemNO\":\"10\",\"TRANSDOC\":\"GR\",\"GRInfos\":[{\"GRNO\":\"5000\",\"GRItemNO\":\"1\"},{\"GRNO\":\"5000\",\"GRItemNO\":\"1\"}]}]"
+	checkInvoke(t, stub, [][]byte{[]byte("crPurchaseOrderInfo"), []byte(args), []byte("1209")})
+
+	report := checkAudit(t, stub, "auditConsistency", "{\"keyPrefix\":\"PO\"}")
+	if report.Scanned != 1 || len(report.Issues) != 2 {
+		fmt.Println("Audit report was not as expected", report)
+		t.FailNow()
+	}
+	if report.Issues[0].Type != ISSUE_DUPLICATE || report.Issues[1].Type != ISSUE_ONE_SIDED {
+		fmt.Println("Audit issues were not as expected", report.Issues)
+		t.FailNow()
+	}
+
+	report = checkAudit(t, stub, "repairConsistency", "{\"keyPrefix\":\"PO\",\"limit\":10}")
+	soKey, _ := stub.CreateCompositeKey(SO_KEY, []string{"478", "10"})
+	if len(report.Repaired) != 1 || report.Repaired[0] != soKey {
+		fmt.Println("Repair report was not as expected", report)
+		t.FailNow()
+	}
+	report = checkAudit(t, stub, "auditConsistency", "{\"keyPrefix\":\"SO\"}")
+	if len(report.Issues) != 0 {
+		fmt.Println("SO still has issues after repair", report.Issues)
+		t.FailNow()
+	}
+}
+
+func TestSoftDelete(t *testing.T) {
+	scc := new(SmartContract)
+	stub := mockstub.NewStub("ex02", scc)
+	checkInit(t, stub)
+	stub.SetCreator(BUYER_MSP)
+
+	args := "[{\"SONUMBER\":\"478\",\"SOITEM\":\"10\",\"CPONO\":\"C001\",\"TRANSDOC\":\"SO\"}]"
+	checkInvoke(t, stub, [][]byte{[]byte("crSalesOrderInfo"), []byte(args), []byte("1209")})
+	args = "[{\"SONUMBER\":\"478\",\"SOITEM\":\"10\",\"CPONO\":\"C001\",\"TRANSDOC\":\"SO\",\"DELETEFLAG\":\"X\"}]"
+	checkInvoke(t, stub, [][]byte{[]byte("crSalesOrderInfo"), []byte(args), []byte("1209")})
+
+	soKey, _ := stub.CreateCompositeKey(SO_KEY, []string{"478", "10"})
+	query := "{\"keyPrefix\":\"SO\",\"keysStart\":[\"478\",\"10\"]}"
+	checkError(t, stub, [][]byte{[]byte("queryById"), []byte("lenovo"), []byte(query)}, ERR_NOT_FOUND, soKey)
+	query = "{\"keyPrefix\":\"SO\",\"keysStart\":[\"478\",\"10\"],\"includeDeleted\":true}"
+	checkQuery(t, stub, "queryById", "lenovo", query)
+	cpoKey, _ := stub.CreateCompositeKey(CPO_KEY, []string{"C001"})
+	if !isDeleted(stub.State[cpoKey]) {
+		fmt.Println("SO delete flag was not cascaded to CPO")
+		t.FailNow()
+	}
+
+	args = "[{\"PONO\":\"4500\",\"POItemNO\":\"10\",\"TRANSDOC\":\"PO\"}]"
+	checkInvoke(t, stub, [][]byte{[]byte("crPurchaseOrderInfo"), []byte(args), []byte("1209")})
+	args = "[{\"ASNNumber\":\"ASN1\",\"PONumber\":\"4500\",\"POItem\":\"10\"}]"
+	checkInvoke(t, stub, [][]byte{[]byte("crSupplierOrderInfo"), []byte(args), []byte("1209")})
+	checkInvoke(t, stub, [][]byte{[]byte("removeFromStateByKey"), []byte("{\"keyPrefix\":\"PO\",\"keysStart\":[\"4500\"]}")})
+	poKey, _ := stub.CreateCompositeKey(PO_KEY, []string{"4500", "10"})
+	supKey, _ := stub.CreateCompositeKey(SUPPLIER_KEY, []string{"1209", "ASN1"})
+	if !isDeleted(stub.State[poKey]) || !isDeleted(stub.State[supKey]) {
+		fmt.Println("PO was not soft deleted with its ASN")
+		t.FailNow()
+	}
+	res := stub.MockInvoke("1", [][]byte{[]byte("queryByPartialCompositeKey"), []byte("lenovo"), []byte("{\"keyPrefix\":\"PO\",\"keysStart\":[\"4500\"]}")})
+	if string(res.Payload) != "[]" {
+		fmt.Println("Deleted PO was returned by default query", string(res.Payload))
+		t.FailNow()
+	}
+	//Deleted records aren't audited, even if their links are gone
+	delete(stub.State, cpoKey)
+	report := checkAudit(t, stub, "auditConsistency", "{\"keyPrefix\":\"SO\"}")
+	if report.Scanned != 1 || len(report.Issues) != 0 {
+		fmt.Println("Deleted SO was audited", report)
+		t.FailNow()
+	}
+}
+
+//SO writes keep the GR and billing infos of their CPO
+func TestSalesOrderKeepsCPO(t *testing.T) {
+	stub := seededStub(t)
+	checkStubInvoke(t, stub, "1", "crCPurchaseOrderInfo", `[{"CPONO":"C001","TRANSDOC":"GR","PARTNUM":"P1","GRQTY":"5","LenDNNO":"8001"}]`, "1209")
+	checkStubInvoke(t, stub, "2", "crSalesOrderInfo", `[{"SONUMBER":"478","SOITEM":"10","CPONO":"C001","SOQTY":"6","TRANSDOC":"SO"}]`, "1209")
+	cpoKey, _ := stub.CreateCompositeKey(CPO_KEY, []string{"C001"})
+	cpo := model.ODMPurchaseOrder{}
+	json.Unmarshal(stub.State[cpoKey], &cpo)
+	if cpo.SONUMBER != "478" || cpo.SOITEM != "10" || len(cpo.ODMGRInfos) != 1 || cpo.ODMGRInfos[0].LenDNNO != "8001" {
+		t.Fatalf("SO update replaced CPO %+v", cpo)
+	}
+
+	//An SO sharing the CPO leaves it linked to the first SO
+	checkStubInvoke(t, stub, "3", "crSalesOrderInfo", `[{"SONUMBER":"480","SOITEM":"10","CPONO":"C001","TRANSDOC":"SO"}]`, "1209")
+	cpo = model.ODMPurchaseOrder{}
+	json.Unmarshal(stub.State[cpoKey], &cpo)
+	if cpo.SONUMBER != "478" || len(cpo.ODMGRInfos) != 1 {
+		t.Fatalf("shared CPO was relinked %+v", cpo)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	scc := new(SmartContract)
+	stub := mockstub.NewStub("ex02", scc)
+	checkInit(t, stub)
+	stub.SetCreator(BUYER_MSP)
+
+	args := "[{\"PONO\":\"4500\",\"POItemNO\":\"10\",\"TRANSDOC\":\"PO\"},{\"PONO\":\"4500\",\"POItemNO\":\"20\",\"TRANSDOC\":\"PO\"}]"
+	checkInvoke(t, stub, [][]byte{[]byte("crPurchaseOrderInfo"), []byte(args), []byte("1209")})
+	checkInvoke(t, stub, [][]byte{[]byte("setConfig"), []byte("{\"Orgs\":{\"Org1MSP\":\"lenovo\",\"Org2MSP\":\"flex\",\"Org3MSP\":\"supplier\"}}")})
+	checkInvoke(t, stub, [][]byte{[]byte("setPurgeApprovers"), []byte("[\"lenovo\",\"flex\"]")})
+
+	//the requester and the approvers are the orgs of the creators, not arguments
+	checkError(t, stub, [][]byte{[]byte("requestPurge"), []byte("{\"keyPrefix\":\"PO\",\"keysStart\":[\"4500\"],\"Reason\":\"test data\"}"), []byte("lenovo")}, ERR_VALIDATION, "")
+	stub.SetCreator("Org9MSP")
+	checkError(t, stub, [][]byte{[]byte("requestPurge"), []byte("{\"keyPrefix\":\"PO\",\"keysStart\":[\"4500\"],\"Reason\":\"test data\"}")}, ERR_PERMISSION, CONFIG_KEY)
+	stub.SetCreator(BUYER_MSP)
+	res := stub.MockInvoke("purge1", [][]byte{[]byte("requestPurge"), []byte("{\"keyPrefix\":\"PO\",\"keysStart\":[\"4500\"],\"Reason\":\"test data\"}")})
+	request := PurgeRequest{}
+	json.Unmarshal(res.Payload, &request)
+	if res.Status != shim.OK || request.Requester != "lenovo" {
+		fmt.Println("requestPurge failed", res.Message, string(res.Payload))
+		t.FailNow()
+	}
+	purgeKey, _ := stub.CreateCompositeKey(PURGE_KEY, []string{"purge1"})
+	checkError(t, stub, [][]byte{[]byte("executePurge"), []byte("purge1")}, ERR_PERMISSION, purgeKey)
+	stub.SetCreator("Org3MSP")
+	checkError(t, stub, [][]byte{[]byte("approvePurge"), []byte("purge1")}, ERR_PERMISSION, purgeKey)
+	stub.SetCreator(BUYER_MSP)
+	checkInvoke(t, stub, [][]byte{[]byte("approvePurge"), []byte("purge1")})
+	checkError(t, stub, [][]byte{[]byte("approvePurge"), []byte("purge1")}, ERR_CONFLICT, purgeKey)
+	stub.SetCreator("Org2MSP")
+	checkInvoke(t, stub, [][]byte{[]byte("approvePurge"), []byte("purge1")})
+
+	//an approved purge is executed by the requester or an approver only
+	stub.SetCreator("Org3MSP")
+	checkError(t, stub, [][]byte{[]byte("executePurge"), []byte("purge1")}, ERR_PERMISSION, purgeKey)
+	poKey, _ := stub.CreateCompositeKey(PO_KEY, []string{"4500", "10"})
+	if stub.State[poKey] == nil {
+		fmt.Println("PO was purged by an org that is no approver")
+		t.FailNow()
+	}
+	stub.SetCreator("Org2MSP")
+	res = stub.MockInvoke("purge2", [][]byte{[]byte("executePurge"), []byte("purge1")})
+	request = PurgeRequest{}
+	json.Unmarshal(res.Payload, &request)
+	if res.Status != shim.OK || request.Status != PURGE_EXECUTED || len(request.Manifest) != 2 || request.ManifestHash == "" {
+		fmt.Println("executePurge was not as expected", res.Message, string(res.Payload))
+		t.FailNow()
+	}
+	if stub.State[poKey] != nil {
+		fmt.Println("PO was not purged")
+		t.FailNow()
+	}
+}
+
+//IDoc定长记录, values: offset, value ...
+func idocRecord(values ...interface{}) string {
+	b := []byte(strings.Repeat(" ", 1000))
+	for i := 0; i+1 < len(values); i += 2 {
+		copy(b[values[i].(int):], values[i+1].(string))
+	}
+	return string(b)
+}
+
+func TestIDoc(t *testing.T) {
+	scc := new(SmartContract)
+	stub := mockstub.NewStub("ex02", scc)
+	checkInit(t, stub)
+	stub.SetCreator(BUYER_MSP)
+
+	orders := strings.Join([]string{
+		idocRecord(0, "EDI_DC40", 13, "1001", 39, "ORDERS05", 99, "ORDRSP"),
+		idocRecord(0, "E1EDK01", 63+83, "478"),
+		idocRecord(0, "E1EDK02", 63, "001", 63+3, "CPO-478"),
+		idocRecord(0, "E1EDP01", 63, "10", 63+11, "5"),
+	}, "\n")
+	checkWriteResult(t, stub, [][]byte{[]byte("crIDocInfo"), []byte(orders), []byte("1209")}, RESULT_OK)
+
+	for _, billingNo := range []string{"90001", "90002"} {
+		invoice := strings.Join([]string{
+			idocRecord(0, "EDI_DC40", 13, "1002", 39, "INVOIC02", 99, "INVOIC"),
+			idocRecord(0, "E1EDK01", 63+83, billingNo),
+			idocRecord(0, "E1EDP01", 63, "10", 63+11, "5"),
+			idocRecord(0, "E1EDP02", 63, "002", 63+3, "478", 63+38, "10"),
+		}, "\n")
+		checkWriteResult(t, stub, [][]byte{[]byte("crIDocInfo"), []byte(invoice), []byte("1209")}, RESULT_OK)
+	}
+	soKey, _ := stub.CreateCompositeKey(SO_KEY, []string{"478", "10"})
+	salesOrder := model.SalesOrder{}
+	json.Unmarshal(stub.State[soKey], &salesOrder)
+	if salesOrder.CPONO != "CPO-478" || salesOrder.SOQTY != "5" || len(salesOrder.BILLINFOS) != 2 {
+		fmt.Println("IDoc data was not merged into SO", string(stub.State[soKey]))
+		t.FailNow()
+	}
+
+	//the IDocs of one file are posted in one transaction, the second one
+	//must not overwrite the billing of the first
+	invoices := []string{}
+	for _, billingNo := range []string{"90003", "90004"} {
+		invoices = append(invoices, idocRecord(0, "EDI_DC40", 13, "1004", 39, "INVOIC02", 99, "INVOIC"),
+			idocRecord(0, "E1EDK01", 63+83, billingNo),
+			idocRecord(0, "E1EDP01", 63, "10", 63+11, "5"),
+			idocRecord(0, "E1EDP02", 63, "002", 63+3, "478", 63+38, "10"))
+	}
+	results := []WriteResult{}
+	json.Unmarshal(checkStubInvoke(t, stub, "1", "crIDocInfo", strings.Join(invoices, "\n"), "1209"), &results)
+	salesOrder = model.SalesOrder{}
+	json.Unmarshal(stub.State[soKey], &salesOrder)
+	if len(results) != 2 || len(salesOrder.BILLINFOS) != 4 || salesOrder.BILLINFOS[2].BILLINGNO != "90003" || salesOrder.BILLINFOS[3].BILLINGNO != "90004" {
+		fmt.Println("IDocs of one file were not merged into SO", string(stub.State[soKey]))
+		t.FailNow()
+	}
+
+	unknown := idocRecord(0, "EDI_DC40", 13, "1003", 39, "ZORD01", 99, "ZORD")
+	checkError(t, stub, [][]byte{[]byte("crIDocInfo"), []byte(unknown), []byte("1209")}, ERR_VALIDATION, "1003")
+	mapping := "{\"ZORD01\":{\"TRANSDOC\":\"SO\",\"ItemSegment\":\"Z1ITEM\",\"Fields\":[{\"Segment\":\"Z1ITEM\",\"Offset\":0,\"Length\":3,\"Field\":\"SONUMBER\"},{\"Segment\":\"Z1ITEM\",\"Offset\":3,\"Length\":2,\"Field\":\"SOITEM\"}]}}"
+	checkInvoke(t, stub, [][]byte{[]byte("setIDocMapping"), []byte(mapping)})
+	custom := unknown + "\n" + idocRecord(0, "Z1ITEM", 63, "47920")
+	checkWriteResult(t, stub, [][]byte{[]byte("crIDocInfo"), []byte(custom), []byte("1209")}, RESULT_WARNING)
+}
+
+func TestX12(t *testing.T) {
+	scc := new(SmartContract)
+	stub := mockstub.NewStub("ex02", scc)
+	checkInit(t, stub)
+
+	args := "[{\"PONO\":\"4500\",\"POItemNO\":\"10\",\"TRANSDOC\":\"PO\"}]"
+	checkInvoke(t, stub, [][]byte{[]byte("crPurchaseOrderInfo"), []byte(args), []byte("1209")})
+
+	ic := x12.NewInterchange("1209", "LENOVO", 1, "180109", "1200")
+	asn := []model.SupplierOrder{{ASNNumber: "ASN1", PONumber: "4500", POItem: "10", ShippedQty: "5", CarrierTrackID: "1Z999", CountryOfOrigin: "CN"}}
+	ic.AddGroup("SH", 1, "180109", "1200", []x12.Transaction{x12.Build856(asn, 1)})
+	po := model.PurchaseOrder{PONO: "4500", POItemNO: "10", Invoice: []model.Invoice{{VenInvNO: "INV1", InvItemNO: "1", InvQty: "5"}}}
+	ic.AddGroup("IN", 2, "180109", "1200", []x12.Transaction{x12.Build810(po, 2)})
+	checkInvoke(t, stub, [][]byte{[]byte("crX12Info"), []byte(ic.String()), []byte("1209")})
+	checkInvoke(t, stub, [][]byte{[]byte("crX12Info"), []byte(ic.String()), []byte("1209")})
+
+	poKey, _ := stub.CreateCompositeKey(PO_KEY, []string{"4500", "10"})
+	purchaseOrder := model.PurchaseOrder{}
+	json.Unmarshal(stub.State[poKey], &purchaseOrder)
+	if len(purchaseOrder.SupplierOrders) != 1 || purchaseOrder.SupplierOrders[0].CarrierTrackID != "1Z999" ||
+		len(purchaseOrder.Invoice) != 1 || purchaseOrder.Invoice[0].VendorNO != "1209" {
+		fmt.Println("X12 data was not written to PO", string(stub.State[poKey]))
+		t.FailNow()
+	}
+
+	//the invoices of one interchange are posted in one transaction, the
+	//second one must not overwrite the first
+	invoiceIC := x12.NewInterchange("1209", "LENOVO", 2, "180110", "1200")
+	invoices := []x12.Transaction{}
+	for i, invNo := range []string{"INV2", "INV3"} {
+		po := model.PurchaseOrder{PONO: "4500", POItemNO: "10", Invoice: []model.Invoice{{VenInvNO: invNo, InvItemNO: "1", InvQty: "1"}}}
+		invoices = append(invoices, x12.Build810(po, i+1))
+	}
+	invoiceIC.AddGroup("IN", 3, "180110", "1200", invoices)
+	checkInvoke(t, stub, [][]byte{[]byte("crX12Info"), []byte(invoiceIC.String()), []byte("1209")})
+	purchaseOrder = model.PurchaseOrder{}
+	json.Unmarshal(stub.State[poKey], &purchaseOrder)
+	if len(purchaseOrder.SupplierOrders) != 1 || len(purchaseOrder.Invoice) != 3 {
+		fmt.Println("X12 invoices of one interchange were not merged into PO", string(stub.State[poKey]))
+		t.FailNow()
+	}
+
+	broken := strings.Replace(ic.String(), "GE*1*2", "GE*1*3", 1)
+	checkError(t, stub, [][]byte{[]byte("crX12Info"), []byte(broken), []byte("1209")}, ERR_VALIDATION, "")
+}
+
+func TestEdifact(t *testing.T) {
+	scc := new(SmartContract)
+	stub := mockstub.NewStub("ex02", scc)
+	checkInit(t, stub)
+
+	args := "[{\"PONO\":\"4500\",\"POItemNO\":\"10\",\"TRANSDOC\":\"PO\"}]"
+	checkInvoke(t, stub, [][]byte{[]byte("crPurchaseOrderInfo"), []byte(args), []byte("1209")})
+
+	ic := edifact.NewInterchange("1209", "LENOVO", "1", "180109", "1200")
+	asn := []model.SupplierOrder{{ASNNumber: "ASN1", PONumber: "4500", POItem: "10", ShippedQty: "5", CarrierTrackID: "JD'01", CountryOfOrigin: "DE"}}
+	po := model.PurchaseOrder{PONO: "4500", POItemNO: "10", Invoice: []model.Invoice{{VenInvNO: "INV1", InvItemNO: "1", InvQty: "5"}}}
+	ic.Messages = append(ic.Messages, edifact.BuildDESADV(asn, "1"), edifact.BuildINVOIC(po, "2"))
+	checkInvoke(t, stub, [][]byte{[]byte("crSupplierOrderInfo"), []byte(ic.String()), []byte("1209")})
+
+	poKey, _ := stub.CreateCompositeKey(PO_KEY, []string{"4500", "10"})
+	purchaseOrder := model.PurchaseOrder{}
+	json.Unmarshal(stub.State[poKey], &purchaseOrder)
+	if len(purchaseOrder.SupplierOrders) != 1 || purchaseOrder.SupplierOrders[0].CarrierTrackID != "JD'01" ||
+		purchaseOrder.SupplierOrders[0].CountryOfOrigin != "DE" || len(purchaseOrder.Invoice) != 1 {
+		fmt.Println("EDIFACT data was not written to PO", string(stub.State[poKey]))
+		t.FailNow()
+	}
+	broken := strings.Replace(ic.String(), "UNZ+2+1", "UNZ+3+1", 1)
+	checkError(t, stub, [][]byte{[]byte("crSupplierOrderInfo"), []byte(broken), []byte("1209")}, ERR_VALIDATION, "")
+
+	//the messages of one interchange are posted in one transaction, later
+	//ones must not overwrite the ASNs and invoices of earlier ones
+	more := edifact.NewInterchange("1209", "LENOVO", "2", "180110", "1200")
+	for i, no := range []string{"2", "3"} {
+		asn := []model.SupplierOrder{{ASNNumber: "ASN" + no, PONumber: "4500", POItem: "10", ShippedQty: "1"}}
+		po := model.PurchaseOrder{PONO: "4500", POItemNO: "10", Invoice: []model.Invoice{{VenInvNO: "INV" + no, InvItemNO: "1", InvQty: "1"}}}
+		more.Messages = append(more.Messages, edifact.BuildDESADV(asn, strconv.Itoa(2*i+1)), edifact.BuildINVOIC(po, strconv.Itoa(2*i+2)))
+	}
+	checkInvoke(t, stub, [][]byte{[]byte("crSupplierOrderInfo"), []byte(more.String()), []byte("1209")})
+	purchaseOrder = model.PurchaseOrder{}
+	json.Unmarshal(stub.State[poKey], &purchaseOrder)
+	if len(purchaseOrder.SupplierOrders) != 3 || len(purchaseOrder.Invoice) != 3 {
+		fmt.Println("EDIFACT messages of one interchange were not merged into PO", string(stub.State[poKey]))
+		t.FailNow()
+	}
+}
+
+func TestEPCISEvents(t *testing.T) {
+	scc := new(SmartContract)
+	stub := mockstub.NewStub("ex02", scc)
+	checkInit(t, stub)
+
+	args := "[{\"SONUMBER\":\"478\",\"SOITEM\":\"10\",\"TRANSDOC\":\"SO\",\"CPONO\":\"C1\",\"SOCDATE\":\"20180105\",\"COUNTRY_WE\":\"CN\"}]"
+	checkInvoke(t, stub, [][]byte{[]byte("crSalesOrderInfo"), []byte(args), []byte("1209")})
+	args = "[{\"PONO\":\"4500\",\"POItemNO\":\"10\",\"TRANSDOC\":\"PO\",\"SONUMBER\":\"478\",\"SOITEM\":\"10\",\"Plant\":\"CN01\"}]"
+	checkInvoke(t, stub, [][]byte{[]byte("crPurchaseOrderInfo"), []byte(args), []byte("1209")})
+	args = "[{\"PONO\":\"4500\",\"POItemNO\":\"10\",\"TRANSDOC\":\"GR\",\"GRInfos\":[{\"GRNO\":\"5000\",\"GRDate\":\"20180112\",\"GRQty\":\"5\"}]}]"
+	checkInvoke(t, stub, [][]byte{[]byte("crPurchaseOrderInfo"), []byte(args), []byte("1209")})
+
+	res := stub.MockInvoke("1", [][]byte{[]byte("queryEPCISEvents"), []byte("supplier"), []byte("{\"keyPrefix\":\"SO\",\"keysStart\":[\"478\",\"10\"]}")})
+	doc := epcis.Document{}
+	json.Unmarshal(res.Payload, &doc)
+	if res.Status != shim.OK || len(doc.EPCISBody.EventList) != 2 || doc.EPCISBody.EventList[1].BizStep != "receiving" {
+		fmt.Println("Unexpected EPCIS document", res.Message, string(res.Payload))
+		t.FailNow()
+	}
+	checkError(t, stub, [][]byte{[]byte("queryEPCISEvents"), []byte("supplier"), []byte("{\"keyPrefix\":\"CPO\",\"keysStart\":[\"C1\"]}")}, ERR_VALIDATION, "")
+
+	//a record that doesn't parse fails the query with its key
+	poKey, _ := stub.CreateCompositeKey(PO_KEY, []string{"4500", "10"})
+	stub.MockTransactionStart("corrupt")
+	stub.MockStub.PutState(poKey, []byte(`{"PONO":"4500","POItemNO":"10","GRInfos":"5000"}`))
+	stub.MockTransactionEnd("corrupt")
+	checkError(t, stub, [][]byte{[]byte("queryEPCISEvents"), []byte("supplier"), []byte("{\"keyPrefix\":\"SO\",\"keysStart\":[\"478\",\"10\"]}")}, ERR_INTERNAL, poKey)
+	checkError(t, stub, [][]byte{[]byte("queryEPCISEvents"), []byte("supplier"), []byte("{\"keyPrefix\":\"PO\",\"keysStart\":[\"4500\",\"10\"]}")}, ERR_INTERNAL, poKey)
+}
+
+func TestUBLInvoice(t *testing.T) {
+	scc := new(SmartContract)
+	stub := mockstub.NewStub("ex02", scc)
+	checkInit(t, stub)
+
+	args := "[{\"SONUMBER\":\"478\",\"SOITEM\":\"10\",\"TRANSDOC\":\"SO\",\"CPONO\":\"C1\",\"SOLDTO\":\"C100\"}]"
+	checkInvoke(t, stub, [][]byte{[]byte("crSalesOrderInfo"), []byte(args), []byte("1209")})
+	args = "[{\"SONUMBER\":\"478\",\"SOITEM\":\"10\",\"TRANSDOC\":\"BL\",\"BILLINFOS\":[{\"BILLINGNO\":\"9001\",\"BILLINGITEM\":\"10\",\"CATEGORY\":\"M\",\"BPOSTDATE\":\"20180120\",\"BILLINGQTY\":\"5\",\"UNIT\":\"EA\",\"NETVALUE\":\"100\",\"TAXAMOUNT\":\"17\",\"CURRENCY\":\"CNY\",\"DNNUMBER\":\"800001\",\"DNITEM\":\"10\"}]}]"
+	checkInvoke(t, stub, [][]byte{[]byte("crSalesOrderInfo"), []byte(args), []byte("1209")})
+
+	res := stub.MockInvoke("1", [][]byte{[]byte("queryUBLInvoice"), []byte("lenovo"), []byte("9001")})
+	err, doc := ubl.Parse(res.Payload)
+	if res.Status != shim.OK || err != nil || len(doc.InvoiceLines) != 1 || doc.OrderReference.ID != "C1" || doc.LegalMonetaryTotal.PayableAmount.Value != "117.00" {
+		fmt.Println("Unexpected UBL invoice", res.Message, string(res.Payload))
+		t.FailNow()
+	}
+	checkError(t, stub, [][]byte{[]byte("queryUBLInvoice"), []byte("lenovo"), []byte("9002"), []byte("478")}, ERR_NOT_FOUND, "")
+
+	//without SONUMBER the scan is bounded by AuditMaxLimit
+	args = "[{\"SONUMBER\":\"479\",\"SOITEM\":\"10\",\"TRANSDOC\":\"SO\"}]"
+	checkInvoke(t, stub, [][]byte{[]byte("crSalesOrderInfo"), []byte(args), []byte("1209")})
+	stub.SetCreator(BUYER_MSP)
+	checkInvoke(t, stub, [][]byte{[]byte("setConfig"), []byte("{\"Limits\":{\"AuditLimit\":1,\"AuditMaxLimit\":1,\"PurgeMaxKeys\":10,\"WebhookSecretMinLen\":16}}")})
+	checkError(t, stub, [][]byte{[]byte("queryUBLInvoice"), []byte("lenovo"), []byte("9001")}, ERR_VALIDATION, "")
+	res = stub.MockInvoke("2", [][]byte{[]byte("queryUBLInvoice"), []byte("lenovo"), []byte("9001"), []byte("478")})
+	if res.Status != shim.OK {
+		fmt.Println("UBL invoice of an SONUMBER was not returned", res.Message)
+		t.FailNow()
+	}
+}
+
+func TestPostingEvents(t *testing.T) {
+	scc := new(SmartContract)
+	stub := mockstub.NewStub("ex02", scc)
+	checkInit(t, stub)
+
+	args := "[{\"SONUMBER\":\"478\",\"SOITEM\":\"10\",\"TRANSDOC\":\"SO\",\"CPONO\":\"C1\"}]"
+	checkInvoke(t, stub, [][]byte{[]byte("crSalesOrderInfo"), []byte(args), []byte("1209")})
+	args = "[{\"PONO\":\"4500\",\"POItemNO\":\"10\",\"TRANSDOC\":\"PO\"}]"
+	checkInvoke(t, stub, [][]byte{[]byte("crPurchaseOrderInfo"), []byte(args), []byte("1209")})
+	args = "[{\"ASNNumber\":\"ASN1\",\"PONumber\":\"4500\",\"POItem\":\"10\",\"ShippedQty\":\"5\"}]"
+	checkInvoke(t, stub, [][]byte{[]byte("crSupplierOrderInfo"), []byte(args), []byte("1209")})
+	args = "[{\"CPONO\":\"C1\",\"TRANSDOC\":\"GR\",\"LenDNNO\":\"800001\",\"GRQTY\":\"5\"},{\"CPONO\":\"C1\",\"TRANSDOC\":\"BL\",\"INVOICENUM\":\"9001\"}]"
+	checkInvoke(t, stub, [][]byte{[]byte("crCPurchaseOrderInfo"), []byte(args), []byte("1209")})
+
+	//one POSTED event per transaction
+	postings := []model.PostingEvent{}
+	for len(stub.ChaincodeEventsChannel) > 0 {
+		event := <-stub.ChaincodeEventsChannel
+		posting := model.PostingEvent{}
+		json.Unmarshal(event.Payload, &posting)
+		if event.EventName != POSTING_EVENT || posting.VendorNO != "1209" || posting.TxID != "1" {
+			fmt.Println("Unexpected event", event.EventName, string(event.Payload))
+			t.FailNow()
+		}
+		postings = append(postings, posting)
+	}
+	if len(postings) != 4 || len(postings[0].Documents) != 1 || postings[0].Documents[0].Fields["CPONO"] != "C1" {
+		fmt.Println("Unexpected postings", postings)
+		t.FailNow()
+	}
+	asn, gr := postings[2], postings[3]
+	if len(asn.SupplierOrders) != 1 || len(asn.Documents) != 2 || asn.Documents[1].Entity != SUPPLIER_KEY || asn.Documents[1].Fields["PONumber"] != "4500" {
+		fmt.Println("Unexpected ASN posting", asn)
+		t.FailNow()
+	}
+	if len(gr.ODMGRInfos) != 1 || len(gr.Documents) != 1 || gr.Documents[0].Keys[0] != "C1" || gr.Documents[0].Fields["TRANSDOC"] != "BL" {
+		fmt.Println("Unexpected ODM GR posting", gr)
+		t.FailNow()
+	}
+}
+
+func TestWebhookSubscriptions(t *testing.T) {
+	scc := new(SmartContract)
+	stub := mockstub.NewStub("ex02", scc)
+	checkInit(t, stub)
+	stub.SetCreator(BUYER_MSP)
+	checkInvoke(t, stub, [][]byte{[]byte("setConfig"), []byte(`{"Orgs":{"Org1MSP":"lenovo","Org2MSP":"1209","Org3MSP":"1300"},"VendorNos":{"1209":["1209"],"1300":["1300"]}}`)})
+
+	//the partner is the org of the creator, it can only filter on its vendor nos
+	stub.SetCreator("Org2MSP")
+	sub := `{"Entity":"SUP","FilterField":"VendorNO","FilterValue":"1209","URL":"https://partner.example/hook","Secret":"0123456789abcdef"}`
+	newKey, _ := stub.CreateCompositeKey(WEBHOOK_KEY, []string{"1209", "1"})
+	checkError(t, stub, [][]byte{[]byte("setWebhookSubscription"), []byte(strings.Replace(sub, "VendorNO", "CPONO", 1))}, ERR_VALIDATION, newKey)
+	checkError(t, stub, [][]byte{[]byte("setWebhookSubscription"), []byte(strings.Replace(sub, "0123456789", "", 1))}, ERR_VALIDATION, newKey)
+	checkError(t, stub, [][]byte{[]byte("setWebhookSubscription"), []byte(strings.Replace(sub, "\"1209\"", "\"1300\"", 1))}, ERR_PERMISSION, newKey)
+	checkError(t, stub, [][]byte{[]byte("setWebhookSubscription"), []byte(strings.Replace(sub, "VendorNO", "PONumber", 1))}, ERR_PERMISSION, newKey)
+	checkError(t, stub, [][]byte{[]byte("setWebhookSubscription"), []byte(sub), []byte("1300")}, ERR_VALIDATION, "")
+	res := stub.MockInvoke("hook1", [][]byte{[]byte("setWebhookSubscription"), []byte(sub)})
+	saved := model.WebhookSubscription{}
+	json.Unmarshal(res.Payload, &saved)
+	if res.Status != shim.OK || saved.ID != "hook1" || saved.Partner != "1209" || saved.Secret != STAR {
+		fmt.Println("Unexpected subscription", res.Message, string(res.Payload))
+		t.FailNow()
+	}
+	event := <-stub.ChaincodeEventsChannel
+	posting := model.PostingEvent{}
+	json.Unmarshal(event.Payload, &posting)
+	if len(posting.Subscriptions) != 1 || posting.Subscriptions[0].Secret != "" || !posting.Subscriptions[0].SecretChanged ||
+		bytes.Contains(event.Payload, []byte("0123456789abcdef")) {
+		fmt.Println("Unexpected event", string(event.Payload))
+		t.FailNow()
+	}
+
+	//another partner can't change it, the secret is kept on update
+	update := `{"ID":"hook1","Entity":"SUP","FilterField":"VendorNO","FilterValue":"1209","URL":"https://partner.example/hook2"}`
+	otherKey, _ := stub.CreateCompositeKey(WEBHOOK_KEY, []string{"1300", "hook1"})
+	stub.SetCreator("Org3MSP")
+	checkError(t, stub, [][]byte{[]byte("setWebhookSubscription"), []byte(update)}, ERR_NOT_FOUND, otherKey)
+	stub.SetCreator("Org2MSP")
+	checkInvoke(t, stub, [][]byte{[]byte("setWebhookSubscription"), []byte(update)})
+	event = <-stub.ChaincodeEventsChannel
+	posting = model.PostingEvent{}
+	json.Unmarshal(event.Payload, &posting)
+	if posting.Subscriptions[0].Secret != "" || posting.Subscriptions[0].SecretChanged {
+		fmt.Println("Unexpected event", string(event.Payload))
+		t.FailNow()
+	}
+
+	var subs []model.WebhookSubscription
+	res = stub.MockInvoke("1", [][]byte{[]byte("queryWebhookSubscriptions")})
+	json.Unmarshal(res.Payload, &subs)
+	if len(subs) != 1 || subs[0].URL != "https://partner.example/hook2" || subs[0].Secret != STAR {
+		fmt.Println("Unexpected subscriptions", string(res.Payload))
+		t.FailNow()
+	}
+	checkError(t, stub, [][]byte{[]byte("queryWebhookSubscriptions"), []byte("1300")}, ERR_PERMISSION, "")
+	stub.SetCreator("Org3MSP")
+	res = stub.MockInvoke("1", [][]byte{[]byte("queryWebhookSubscriptions")})
+	if string(res.Payload) != "[]" {
+		fmt.Println("Subscriptions of another partner", string(res.Payload))
+		t.FailNow()
+	}
+	stub.SetCreator(BUYER_MSP)
+	res = stub.MockInvoke("1", [][]byte{[]byte("queryWebhookSubscriptions")})
+	json.Unmarshal(res.Payload, &subs)
+	if len(subs) != 1 || subs[0].Secret != "0123456789abcdef" {
+		fmt.Println("Unexpected subscriptions", string(res.Payload))
+		t.FailNow()
+	}
+
+	//generic queries don't read the subscriptions
+	checkError(t, stub, [][]byte{[]byte("queryById"), []byte("lenovo"), []byte(`{"keyPrefix":"WEBHOOK","keysStart":["1209","hook1"]}`)}, ERR_VALIDATION, "")
+	checkError(t, stub, [][]byte{[]byte("queryByPartialCompositeKey"), []byte("lenovo"), []byte(`{"keyPrefix":"WEBHOOK","keysStart":["1209"]}`)}, ERR_VALIDATION, "")
+	res = stub.MockInvoke("1", [][]byte{[]byte("getQueryResult"), []byte("lenovo"), []byte(`{"selector":{"URL":{"$gt":""}}}`)})
+	if res.Status != shim.OK || string(res.Payload) != "[]" {
+		fmt.Println("Subscriptions in query result", res.Message, string(res.Payload))
+		t.FailNow()
+	}
+
+	stub.SetCreator("Org3MSP")
+	checkError(t, stub, [][]byte{[]byte("removeWebhookSubscription"), []byte("hook1")}, ERR_NOT_FOUND, otherKey)
+	stub.SetCreator("Org2MSP")
+	checkInvoke(t, stub, [][]byte{[]byte("removeWebhookSubscription"), []byte("hook1")})
+	event = <-stub.ChaincodeEventsChannel
+	json.Unmarshal(event.Payload, &posting)
+	if !posting.Subscriptions[0].Removed || posting.Subscriptions[0].Secret != "" {
+		fmt.Println("Unexpected event", string(event.Payload))
+		t.FailNow()
+	}
+	res = stub.MockInvoke("1", [][]byte{[]byte("queryWebhookSubscriptions")})
+	if string(res.Payload) != "[]" {
+		fmt.Println("Subscription not removed", string(res.Payload))
+		t.FailNow()
+	}
+}
+
+//Event listener side of a subscription: the POSTED events carry no secret,
+//the registry queries it as the buyer org before the first signed delivery
+//and again after the partner changes it
+func TestWebhookDelivery(t *testing.T) {
+	stub := mockstub.NewStub("ex02", new(SmartContract))
+	checkInit(t, stub)
+	stub.SetCreator(BUYER_MSP)
+	checkStubInvoke(t, stub, "cfg", "setConfig", `{"Orgs":{"Org1MSP":"lenovo","Org2MSP":"1209"},"VendorNos":{"1209":["1209"]}}`)
+
+	dir, err := ioutil.TempDir("", "webhook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	received := filepath.Join(dir, "received")
+	os.MkdirAll(received, 0755)
+	partner := &webhook.Stub{Secret: "0123456789abcdef", Dir: received}
+	server := httptest.NewServer(partner)
+	defer server.Close()
+	_, registry := webhook.OpenRegistry(filepath.Join(dir, "subscriptions.json"))
+	registry.Source = func() (error, []byte) {
+		stub.SetCreator(BUYER_MSP)
+		res := stub.MockInvoke("query", [][]byte{[]byte("queryWebhookSubscriptions"), []byte("")})
+		if res.Status != shim.OK {
+			return errors.New(res.Message), nil
+		}
+		return nil, res.Payload
+	}
+	_, outbox := outbound.NewOutbox(filepath.Join(dir, "outbox"), webhook.NewSink(registry, nil))
+	outbox.MaxAttempts = 1
+
+	//invoke as creator and hand the POSTED event to the listener
+	deliver := func(txID string, creator string, args ...string) outbound.FlushResult {
+		stub.SetCreator(creator)
+		checkStubInvoke(t, stub, txID, args...)
+		event := <-stub.ChaincodeEventsChannel
+		err, messages := webhook.Translate(registry, event.EventName, event.Payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range messages {
+			outbox.Enqueue(m)
+		}
+		err, result := outbox.Flush()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+	deliver("hook1", "Org2MSP", "setWebhookSubscription", `{"Entity":"SUP","FilterField":"VendorNO","FilterValue":"1209","URL":"`+server.URL+`","Secret":"0123456789abcdef"}`)
+	deliver("po1", BUYER_MSP, "crPurchaseOrderInfo", `[{"PONO":"4500","POItemNO":"10","POQty":"10","TRANSDOC":"PO"}]`, "1209")
+	result := deliver("asn1", BUYER_MSP, "crSupplierOrderInfo", `[{"ASNNumber":"ASN1","PONumber":"4500","POItem":"10","ShippedQty":"5"}]`, "1209")
+	if result.Sent != 1 || result.Dead != 0 {
+		t.Fatalf("unexpected delivery %+v", result)
+	}
+	if _, err := os.Stat(filepath.Join(received, "asn1-hook1")); err != nil {
+		t.Fatal(err)
+	}
+
+	partner.Secret = "fedcba9876543210"
+	deliver("hook2", "Org2MSP", "setWebhookSubscription", `{"ID":"hook1","Entity":"SUP","FilterField":"VendorNO","FilterValue":"1209","URL":"`+server.URL+`","Secret":"fedcba9876543210"}`)
+	result = deliver("asn2", BUYER_MSP, "crSupplierOrderInfo", `[{"ASNNumber":"ASN2","PONumber":"4500","POItem":"10","ShippedQty":"5"}]`, "1209")
+	if result.Sent != 1 || result.Dead != 0 {
+		t.Fatalf("unexpected delivery after the secret changed %+v", result)
+	}
+}
+
+var update = flag.Bool("update", false, "rewrite the API documents in docs/ and the golden files in testdata/")
+
+//Generated API documents, file name -> content
+func apiDocuments(t *testing.T) map[string][]byte {
+	err, comments := schema.Comments(".", "../model", "../idoc", "../epcis", "../webhook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := schema.NewGenerator("#/components/schemas/", comments)
+	openapi, _ := json.MarshalIndent(chaincodeAPI(g).OpenAPI(g), "", "  ")
+	d := schema.NewGenerator("#/$defs/", comments)
+	chaincodeAPI(d)
+	types, _ := json.MarshalIndent(d.Document("lenovo_bc.schema.json", "lenovo_bc chaincode types"), "", "  ")
+	return map[string][]byte{
+		"openapi.json":          append(openapi, '\n'),
+		"lenovo_bc.schema.json": append(types, '\n'),
+	}
+}
+
+func TestAPIDocuments(t *testing.T) {
+	documented := map[string]bool{}
+	for _, f := range chaincodeAPI(schema.NewGenerator("", nil)).Functions {
+		documented[f.Name] = true
+	}
+	for name := range handlers {
+		if !documented[name] {
+			t.Errorf("%s is not described in chaincodeAPI", name)
+		}
+	}
+	for name := range documented {
+		if handlers[name] == nil {
+			t.Errorf("%s is described in chaincodeAPI but has no handler", name)
+		}
+	}
+
+	for name, b := range apiDocuments(t) {
+		path := filepath.Join("docs", name)
+		if *update {
+			os.MkdirAll("docs", 0755)
+			if err := ioutil.WriteFile(path, b, 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		old, err := ioutil.ReadFile(path)
+		if err != nil || !bytes.Equal(old, b) {
+			t.Errorf("%s is out of date, run go test -run TestAPIDocuments -update", path)
+		}
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	stub := mockstub.NewStub("ex02", new(SmartContract))
+	functions := []FunctionInfo{}
+	if err := json.Unmarshal(checkStubInvoke(t, stub, "1", "describe"), &functions); err != nil {
+		t.Fatal(err)
+	}
+	described := map[string]FunctionInfo{}
+	for _, f := range functions {
+		described[f.Name] = f
+	}
+	if len(described) != len(handlers) {
+		t.Fatalf("describe lists %d functions, %d are registered", len(described), len(handlers))
+	}
+	po := described["crPurchaseOrderInfo"]
+	if po.Query || len(po.Args) != 2 || !po.Args[0].JSON || po.Args[1].Name != "vendorNo" || len(po.TRANSDOC) != 5 {
+		t.Fatalf("unexpected crPurchaseOrderInfo %+v", po)
+	}
+	if ubl := described["queryUBLInvoice"]; !ubl.Query || !ubl.Args[2].Optional {
+		t.Fatalf("unexpected queryUBLInvoice %+v", ubl)
+	}
+	if rules := described["setIntegrityRules"]; len(rules.Roles) != 1 || rules.Roles[0] != "lenovo" {
+		t.Fatalf("unexpected setIntegrityRules %+v", rules)
+	}
+}
+
+//Arguments are checked against chaincodeAPI before the handler runs
+func TestValidateArguments(t *testing.T) {
+	stub := mockstub.NewStub("ex02", new(SmartContract))
+	for _, c := range []struct {
+		args  []string
+		code  string
+		field string
+	}{
+		{[]string{"crSalesOrderInfo", "[]"}, ERR_VALIDATION, ""},
+		{[]string{"crSalesOrderInfo", "[]", "1209", "x"}, ERR_VALIDATION, ""},
+		{[]string{"crSalesOrderInfo", "[{", "1209"}, ERR_VALIDATION, "json"},
+		{[]string{"queryUBLInvoice", "lenovo"}, ERR_VALIDATION, ""},
+		{[]string{"queryIntegrityRules", "x"}, ERR_VALIDATION, ""},
+		{[]string{"setPurgeApprovers", "lenovo"}, ERR_VALIDATION, "approvers"},
+		{[]string{"unknown"}, ERR_VALIDATION, "function"},
+	} {
+		invokeArgs := [][]byte{}
+		for _, arg := range c.args {
+			invokeArgs = append(invokeArgs, []byte(arg))
+		}
+		res := stub.MockInvoke("1", invokeArgs)
+		errInfo := ErrorInfo{}
+		json.Unmarshal([]byte(res.Message), &errInfo)
+		if res.Status == shim.OK || errInfo.Code != c.code || errInfo.Field != c.field {
+			t.Errorf("%v: unexpected response %d %s", c.args, res.Status, res.Message)
+		}
+	}
+	checkError(t, stub, [][]byte{[]byte("queryUBLInvoice"), []byte("lenovo"), []byte("90001")}, ERR_NOT_FOUND, "")
+	stub.SetCreator(BUYER_MSP)
+	checkInvoke(t, stub, [][]byte{[]byte("queryWebhookSubscriptions"), []byte("lenovo")})
+
+	//roles are those of the creator's org, whatever the userRole argument
+	f := *registry["queryById"]
+	f.Roles = []string{ROLE_BUYER}
+	cfg := defaultConfig()
+	cfg.Orgs["Org2MSP"] = "supplier"
+	if err := f.validate(stub, cfg, []string{"supplier", "{}"}); err != nil {
+		t.Fatal(err)
+	}
+	stub.SetCreator("Org2MSP")
+	err := f.validate(stub, cfg, []string{"lenovo", "{}"})
+	if e, ok := err.(*ErrorInfo); !ok || e.Code != ERR_PERMISSION {
+		t.Fatalf("unexpected error %v", err)
+	}
+	stub.Creator = nil
+	err = f.validate(stub, cfg, []string{"lenovo", "{}"})
+	if e, ok := err.(*ErrorInfo); !ok || e.Code != ERR_PERMISSION {
+		t.Fatalf("unexpected error %v", err)
+	}
+	checkError(t, stub, [][]byte{[]byte("setIntegrityRules"), []byte(`{"PO":"REJECT"}`)}, ERR_PERMISSION, "")
+}
+
+//queryByIds returns the linked records unless Init enabled the compat feature
+func TestCompatMode(t *testing.T) {
+	stub := seededStub(t)
+	query := `[{"keyPrefix":"SO","keysStart":["478","10"]}]`
+	full := []model.POAndSOOrder{}
+	json.Unmarshal(checkStubInvoke(t, stub, "q1", "queryByIds", "supplier", query), &full)
+	if len(full) != 1 || full[0].SalesOrder.NETPRICE != STAR || full[0].PurchaseOrder.PONO != "4500" {
+		t.Fatalf("unexpected full response %+v", full)
+	}
+
+	if res := stub.MockInit("upgrade1", [][]byte{[]byte("init"), []byte(MODE_COMPAT)}); res.Status != shim.OK {
+		t.Fatalf("init failed %s", res.Message)
+	}
+	payload := checkStubInvoke(t, stub, "q2", "queryByIds", "supplier", query)
+	compat := []model.SalesOrder{}
+	json.Unmarshal(payload, &compat)
+	if len(compat) != 1 || compat[0].SONUMBER != "478" || compat[0].NETPRICE != STAR || bytes.Contains(payload, []byte("PurchaseOrder")) {
+		t.Fatalf("unexpected compat response %s", payload)
+	}
+
+	if res := stub.MockInit("upgrade2", [][]byte{[]byte("init"), []byte("legacy")}); res.Status == shim.OK {
+		t.Fatal("unknown mode was accepted")
+	}
+	if res := stub.MockInit("upgrade3", [][]byte{[]byte("init")}); res.Status != shim.OK || !bytes.Contains(res.Payload, []byte(`"compat":true`)) {
+		t.Fatalf("compat feature was not kept %s", res.Message)
+	}
+	if res := stub.MockInit("upgrade4", [][]byte{[]byte("init"), []byte(MODE_FULL)}); res.Status != shim.OK || !bytes.Contains(res.Payload, []byte(`"compat":false`)) {
+		t.Fatalf("full mode was not restored %s", res.Message)
+	}
+}
+
+//Init and setConfig store validated versions of the config, the functions
+//read the buyer org, star, limits and features from it
+func TestConfig(t *testing.T) {
+	stub := seededStub(t)
+	cfg := Config{}
+	json.Unmarshal(checkStubInvoke(t, stub, "c1", "getConfig"), &cfg)
+	if cfg.Version != 0 || cfg.BuyerOrg != "lenovo" || cfg.Star != STAR || cfg.Limits.AuditMaxLimit != AUDIT_MAX_LIMIT || !cfg.Features[FEATURE_UBL] {
+		t.Fatalf("unexpected default config %+v", cfg)
+	}
+
+	res := stub.MockInit("upgrade1", [][]byte{[]byte("init"), []byte(`{"BuyerOrg":"acme","Roles":{"acme":"buyer","flex":"odm"},"Star":"###"}`)})
+	if res.Status != shim.OK {
+		t.Fatalf("init failed %s", res.Message)
+	}
+	cfg = Config{}
+	json.Unmarshal(checkStubInvoke(t, stub, "c2", "getConfig"), &cfg)
+	if cfg.Version != 1 || cfg.BuyerOrg != "acme" || cfg.Roles["lenovo"] != "" || cfg.Limits.PurgeMaxKeys != PURGE_MAX_KEYS {
+		t.Fatalf("unexpected config %+v", cfg)
+	}
+	query := `{"keyPrefix":"SO","keysStart":["478","10"]}`
+	for userRole, netPrice := range map[string]string{"acme": "7", "lenovo": "###", "flex": "###"} {
+		so := model.SalesOrder{}
+		json.Unmarshal(checkStubInvoke(t, stub, "c3", "queryById", userRole, query), &so)
+		if so.NETPRICE != netPrice {
+			t.Errorf("%s sees NETPRICE %s", userRole, so.NETPRICE)
+		}
+	}
+	if res := stub.MockInit("upgrade2", [][]byte{[]byte("init")}); res.Status != shim.OK || !bytes.Contains(res.Payload, []byte(`"Version":1`)) {
+		t.Fatalf("config was not kept %s", res.Payload)
+	}
+
+	for _, c := range []struct {
+		config string
+		code   string
+		field  string
+	}{
+		{`{"Version":3}`, ERR_STALE_UPDATE, "Version"},
+		{`{"BuyerOrg":"acme","Roles":{"acme":"admin"}}`, ERR_VALIDATION, "Roles"},
+		{`{"BuyerOrg":"acme","Roles":{"lenovo":"buyer"}}`, ERR_VALIDATION, "Roles"},
+		{`{"Orgs":{"Org1MSP":"flex"}}`, ERR_VALIDATION, "Orgs"},
+		{`{"Orgs":{"Org1MSP":"acme","Org2MSP":""}}`, ERR_VALIDATION, "Orgs"},
+		{`{"VendorNos":{"flex":[]}}`, ERR_VALIDATION, "VendorNos"},
+		{`{"VendorNos":{"flex":["1209",""]}}`, ERR_VALIDATION, "VendorNos"},
+		{`{"Tolerances":{"QtyPercent":-1}}`, ERR_VALIDATION, "Tolerances"},
+		{`{"Limits":{"AuditLimit":2000}}`, ERR_VALIDATION, "Limits"},
+		{`{"Limits":{"WebhookSecretMinLen":8}}`, ERR_VALIDATION, "Limits"},
+		{`{"Features":{"edifact":true}}`, ERR_VALIDATION, "Features"},
+		{`{"Star":""}`, ERR_VALIDATION, "Star"},
+	} {
+		res := stub.MockInvoke("c4", [][]byte{[]byte("setConfig"), []byte(c.config)})
+		errInfo := ErrorInfo{}
+		json.Unmarshal([]byte(res.Message), &errInfo)
+		if res.Status == shim.OK || errInfo.Code != c.code || errInfo.Field != c.field || errInfo.Key != CONFIG_KEY {
+			t.Errorf("%s: unexpected response %d %s", c.config, res.Status, res.Message)
+		}
+	}
+
+	cfg = Config{}
+	json.Unmarshal(checkStubInvoke(t, stub, "c5", "setConfig", `{"Version":1,"BuyerOrg":"acme","Features":{"ubl":false},"Limits":{"AuditLimit":1}}`), &cfg)
+	if cfg.Version != 2 || cfg.Features[FEATURE_UBL] || !cfg.Features[FEATURE_EPCIS] || cfg.Star != STAR {
+		t.Fatalf("unexpected config %+v", cfg)
+	}
+	res = stub.MockInvoke("c6", [][]byte{[]byte("queryUBLInvoice"), []byte("acme"), []byte("90001")})
+	if res.Status == shim.OK || !strings.Contains(res.Message, ERR_PERMISSION) {
+		t.Fatalf("disabled feature was called %s", res.Message)
+	}
+	if bytes.Contains(checkStubInvoke(t, stub, "c7", "describe"), []byte("queryUBLInvoice")) {
+		t.Fatal("describe lists a function of a disabled feature")
+	}
+	checkStubInvoke(t, stub, "c8", "crSalesOrderInfo", `[{"SONUMBER":"479","SOITEM":"10","SOQTY":"1","TRANSDOC":"SO"}]`, "1209")
+	report := AuditReport{}
+	json.Unmarshal(checkStubInvoke(t, stub, "c8", "auditConsistency", `{"keyPrefix":"SO"}`), &report)
+	if report.Scanned != 1 || report.NextKey == "" {
+		t.Fatalf("audit limit was not applied %+v", report)
+	}
+	if payload := checkStubInvoke(t, stub, "c9", "setConfig", `{"BuyerOrg":"acme","Features":{"ubl":false},"Limits":{"AuditLimit":1}}`); !bytes.Contains(payload, []byte(`"Version":2`)) {
+		t.Fatalf("unchanged config was stored again %s", payload)
+	}
+
+	//only the buyer changes the config, init is only run by the peer
+	checkStubInvoke(t, stub, "c10", "setConfig", `{"BuyerOrg":"acme","Orgs":{"Org1MSP":"acme","Org2MSP":"flex"}}`)
+	stub.SetCreator("Org2MSP")
+	checkError(t, stub, [][]byte{[]byte("setConfig"), []byte(`{"BuyerOrg":"flex","Orgs":{"Org2MSP":"flex"}}`)}, ERR_PERMISSION, "")
+	checkError(t, stub, [][]byte{[]byte("init"), []byte(`{"BuyerOrg":"flex"}`)}, ERR_VALIDATION, "")
+}
+
+//Quantity differences beyond Config.Tolerances are audit issues
+func TestAuditTolerances(t *testing.T) {
+	stub := seededStub(t)
+	if report := checkAudit(t, stub, "auditConsistency", `{"keyPrefix":"PO"}`); report.Scanned != 1 || len(report.Issues) != 0 {
+		t.Fatalf("unexpected issues %+v", report)
+	}
+	poKey, _ := stub.CreateCompositeKey(PO_KEY, []string{"4500", "10"})
+	po := model.PurchaseOrder{}
+	json.Unmarshal(stub.State[poKey], &po)
+	po.POQty = "4"
+	b, _ := json.Marshal(po)
+	stub.MockTransactionStart("qty")
+	stub.MockStub.PutState(poKey, b)
+	stub.MockTransactionEnd("qty")
+
+	report := checkAudit(t, stub, "auditConsistency", `{"keyPrefix":"PO"}`)
+	if len(report.Issues) != 2 || report.Issues[0].Type != ISSUE_QUANTITY || report.Issues[0].Field != "POQty" ||
+		report.Issues[1].Type != ISSUE_QUANTITY || report.Issues[1].Field != "SupplierOrders" {
+		t.Fatalf("unexpected issues %+v", report.Issues)
+	}
+	checkStubInvoke(t, stub, "tol1", "setConfig", `{"Tolerances":{"QtyPercent":20,"OverShipPercent":25}}`)
+	if report = checkAudit(t, stub, "auditConsistency", `{"keyPrefix":"PO"}`); len(report.Issues) != 0 {
+		t.Fatalf("issues within tolerance %+v", report.Issues)
+	}
+}
+
+//Script copying the chaincode to API/artifacts at deploy time
+var copyScript = filepath.Join("..", "..", "..", "..", "API", "app", "copy-chaincode.js")
+
+//Go files of the chaincode package and of its subpackages, tests, testdata
+//and cmd left out, by path relative to dir
+func deployedFiles(t *testing.T, dir string) map[string][]byte {
+	files := map[string][]byte{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && (info.Name() == "testdata" || info.Name() == "cmd") {
+			return filepath.SkipDir
+		}
+		if info.IsDir() || filepath.Ext(path) != ".go" || strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		name, _ := filepath.Rel(dir, path)
+		files[filepath.ToSlash(name)] = b
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+//The API server deploys a copy of ChainCode/github.com/lenovo_bc made by
+//API/app/copy-chaincode.js, never another source
+func TestArtifacts(t *testing.T) {
+	if _, err := os.Stat(copyScript); err != nil {
+		t.Skip("API/app not found next to ChainCode")
+	}
+	if _, err := exec.LookPath("node"); err != nil {
+		t.Skip("node not found")
+	}
+	dir, err := ioutil.TempDir("", "artifacts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	target := filepath.Join(dir, "lenovo_bc")
+	if out, err := exec.Command("node", copyScript, target, "..").CombinedOutput(); err != nil {
+		t.Fatalf("copy failed %s\n%s", err, out)
+	}
+	files := deployedFiles(t, "..")
+	copied := deployedFiles(t, target)
+	if copied["main.go"] == nil || copied["chaincode/lenovo_bc.go"] == nil {
+		t.Fatalf("chaincode not copied to %s", target)
+	}
+	for name, b := range files {
+		if !bytes.Equal(copied[name], b) {
+			t.Errorf("%s differs from the chaincode", name)
+		}
+	}
+	for name := range copied {
+		if files[name] == nil {
+			t.Errorf("%s is not part of the chaincode", name)
+		}
+	}
+
+	//without the source the copy is kept only if it is unchanged
+	missing := filepath.Join(dir, "missing")
+	if out, err := exec.Command("node", copyScript, target, missing).CombinedOutput(); err != nil {
+		t.Fatalf("unchanged copy rejected %s\n%s", err, out)
+	}
+	err = ioutil.WriteFile(filepath.Join(target, "main.go"), []byte("package main\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command("node", copyScript, target, missing).CombinedOutput(); err == nil {
+		t.Fatalf("stale copy kept\n%s", out)
+	}
+	if out, err := exec.Command("node", copyScript, filepath.Join(dir, "none"), missing).CombinedOutput(); err == nil {
+		t.Fatalf("missing copy accepted\n%s", out)
+	}
+}
+
+//Legacy records are migrated in batches, writes stamp the schema version
+func TestSchemaMigration(t *testing.T) {
+	stub := mockstub.NewStub("ex02", new(SmartContract))
+	stub.SetCreator(BUYER_MSP)
+	legacy := map[string]string{}
+	for _, po := range []string{"4500", "4501", "4502"} {
+		key, _ := stub.CreateCompositeKey(PO_KEY, []string{po, "10"})
+		legacy[key] = `{"PONO":"` + po + `","POItemNO":"10","TRANSDOC":"PO","GRInfos":[{"GRNO":"5000","ComCode":"1000"}],"Invoice":[{"InvNO":"6000","GRNO":"5000"}]}`
+	}
+	stub.MockTransactionStart("legacy")
+	for key, value := range legacy {
+		stub.MockStub.PutState(key, []byte(value))
+	}
+	stub.MockTransactionEnd("legacy")
+	checkStubInvoke(t, stub, "1", "crPurchaseOrderInfo", `[{"PONO":"4502","POItemNO":"10","TRANSDOC":"POCON","Confirmation":[{"CnfSeqNO":"1"}]}]`, "1209")
+
+	report := MigrationReport{}
+	json.Unmarshal(checkStubInvoke(t, stub, "2", "querySchemaMigration", `{"keyPrefix":"PO","limit":1}`), &report)
+	if !report.DryRun || report.Scanned != 1 || len(report.Migrated) != 1 || report.Migrated[0].From != SCHEMA_VERSION_LEGACY || len(report.Migrated[0].Steps) != 0 || report.NextKey == "" {
+		t.Fatalf("unexpected dry run %+v", report)
+	}
+	//the comCode of the invoice was never stored, the one of the GR is no substitute
+	if lost := report.Migrated[0].Unrecoverable; len(lost) != 1 || lost[0] != "Invoice[0].comCode" {
+		t.Fatalf("unexpected dry run %+v", report)
+	}
+	for key, value := range legacy {
+		if !strings.Contains(key, "4502") && string(stub.State[key]) != value {
+			t.Fatalf("dry run wrote %q", key)
+		}
+	}
+
+	migrated := []string{}
+	param := AuditParam{KeyPrefix: PO_KEY, Limit: 2}
+	for i := 0; i < 5; i++ {
+		b, _ := json.Marshal(param)
+		report = MigrationReport{}
+		json.Unmarshal(checkStubInvoke(t, stub, "m"+strconv.Itoa(i), "migrateSchema", string(b)), &report)
+		for _, record := range report.Migrated {
+			migrated = append(migrated, record.Key)
+		}
+		if param.Bookmark = report.NextKey; param.Bookmark == "" {
+			break
+		}
+	}
+	if len(migrated) != 2 {
+		t.Fatalf("migrated %q, the written PO was already at the schema version", migrated)
+	}
+	for key := range legacy {
+		po := model.PurchaseOrder{}
+		json.Unmarshal(stub.State[key], &po)
+		if po.SchemaVersion != SCHEMA_VERSION || po.Invoice[0].ComCode != "" {
+			t.Fatalf("%q was not migrated %s", key, stub.State[key])
+		}
+	}
+	report = MigrationReport{}
+	json.Unmarshal(checkStubInvoke(t, stub, "3", "querySchemaMigration", `{"keyPrefix":"PO"}`), &report)
+	if report.Scanned != 3 || len(report.Migrated) != 0 {
+		t.Fatalf("records left to migrate %+v", report)
+	}
+
+	//a record of a newer chaincode is neither migrated nor written
+	future, _ := stub.CreateCompositeKey(PO_KEY, []string{"4503", "10"})
+	newer := fmt.Sprintf(`{"PONO":"4503","POItemNO":"10","TRANSDOC":"PO","SchemaVersion":%d}`, SCHEMA_VERSION+1)
+	stub.MockTransactionStart("future")
+	stub.MockStub.PutState(future, []byte(newer))
+	stub.MockTransactionEnd("future")
+	checkError(t, stub, [][]byte{[]byte("migrateSchema"), []byte(`{"keyPrefix":"PO"}`)}, ERR_CONFLICT, future)
+	checkError(t, stub, [][]byte{[]byte("crPurchaseOrderInfo"), []byte(`[{"PONO":"4503","POItemNO":"10","TRANSDOC":"POCON","Confirmation":[{"CnfSeqNO":"1"}]}]`), []byte("1209")}, ERR_CONFLICT, future)
+	if string(stub.State[future]) != newer {
+		t.Fatalf("newer record was written %s", stub.State[future])
+	}
+}
+
+func TestClient(t *testing.T) {
+	err, mock := client.NewMock("ex02", new(SmartContract))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock.Stub.SetCreator(BUYER_MSP)
+	c := client.New(mock, "lenovo")
+	err, res := c.CreateSalesOrders([]model.SalesOrder{{SONUMBER: "478", SOITEM: "10", CPONO: "C1", NETPRICE: "7", TRANSDOC: "SO"}}, "1209")
+	soKey, _ := mock.Stub.CreateCompositeKey(SO_KEY, []string{"478", "10"})
+	if err != nil || len(res.Results) != 1 || res.Results[0].Key != soKey || res.Results[0].Status != RESULT_OK {
+		t.Fatalf("unexpected write %v %+v", err, res)
+	}
+	err, res = c.CreatePurchaseOrders([]model.PurchaseOrder{{PONO: "4500", POItemNO: "10", VendorNO: "1209", SONUMBER: "478", SOITEM: "10", TRANSDOC: "PO"}}, "1209")
+	if err != nil || res.Results[0].Status != RESULT_OK {
+		t.Fatalf("unexpected write %v %+v", err, res)
+	}
+	if len(mock.Events) != 2 || mock.Events[1].EventName != POSTING_EVENT {
+		t.Fatalf("unexpected events %v", mock.Events)
+	}
+
+	err, so := c.SalesOrder("478", "10")
+	if err != nil || so.CPONO != "C1" || so.NETPRICE != "7" {
+		t.Fatalf("unexpected sales order %v %+v", err, so)
+	}
+	c.Role = "supplier"
+	err, so = c.SalesOrder("478", "10")
+	if err != nil || so.NETPRICE != STAR {
+		t.Fatalf("price not masked %v %+v", err, so)
+	}
+	err, records := c.QueryByPartialKey(PO_KEY, []string{"4500"})
+	if err != nil || len(records) != 1 {
+		t.Fatalf("unexpected records %v %+v", err, records)
+	}
+	po := model.PurchaseOrder{}
+	if err := json.Unmarshal(records[0].Record, &po); err != nil || po.SONUMBER != "478" {
+		t.Fatalf("unexpected purchase order %v %+v", err, po)
+	}
+
+	err, res = c.Remove(SO_KEY, []string{"478", "10"})
+	if err != nil || len(res.Results) != 1 {
+		t.Fatalf("unexpected remove %v %+v", err, res)
+	}
+	err, _ = c.SalesOrder("478", "10")
+	if e, ok := err.(*client.Error); !ok || e.Code != ERR_NOT_FOUND || e.Key != soKey {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+//Invoke with string arguments, failing the test with the error message
+func checkStubInvoke(t *testing.T, stub *mockstub.Stub, txID string, args ...string) []byte {
+	invokeArgs := [][]byte{}
+	for _, arg := range args {
+		invokeArgs = append(invokeArgs, []byte(arg))
+	}
+	res := stub.MockInvoke(txID, invokeArgs)
+	if res.Status != shim.OK {
+		t.Fatalf("%s failed %s", args[0], res.Message)
+	}
+	return res.Payload
+}
+
+//Key and record of getQueryResult output, keys with "|" for U+0000
+func queryResultKeys(t *testing.T, payload []byte) []string {
+	records := []struct{ Key string }{}
+	if err := json.Unmarshal(bytes.Replace(payload, []byte{0}, []byte("|"), -1), &records); err != nil {
+		t.Fatalf("invalid result %s", payload)
+	}
+	keys := []string{}
+	for _, record := range records {
+		keys = append(keys, record.Key)
+	}
+	return keys
+}
+
+func TestGetQueryResult(t *testing.T) {
+	stub := mockstub.NewStub("ex02", new(SmartContract))
+	stub.SetCreator(BUYER_MSP)
+	stub.MockInit("tx1", nil)
+	orders := `[{"SONUMBER":"478","SOITEM":"10","CPONO":"C1","SOQTY":"5","TRANSDOC":"SO"},
+		{"SONUMBER":"478","SOITEM":"20","CPONO":"C2","SOQTY":"12","TRANSDOC":"SO"},
+		{"SONUMBER":"479","SOITEM":"10","CPONO":"C1","SOQTY":"8","TRANSDOC":"SO"}]`
+	checkStubInvoke(t, stub, "tx2", "crSalesOrderInfo", orders, "1209")
+	checkStubInvoke(t, stub, "tx3", "crSalesOrderInfo",
+		`[{"SONUMBER":"478","SOITEM":"10","TRANSDOC":"BL","BILLINFOS":[{"BILLINGNO":"9001","BILLINGITEM":"10"}]}]`, "1209")
+
+	cases := []struct {
+		query string
+		keys  string
+	}{
+		{`{"selector":{"CPONO":"C1"}}`, "|CPO|C1|,|SO|478|10|,|SO|479|10|"},
+		{`{"selector":{"CPONO":"C1","SOQTY":{"$exists":true}}}`, "|SO|478|10|,|SO|479|10|"},
+		{`{"selector":{"SONUMBER":"478","SOITEM":{"$gt":"10"}}}`, "|CPO|C2|,|SO|478|20|"},
+		{`{"selector":{"SOQTY":{"$regex":"^1"}}}`, "|SO|478|20|"},
+		{`{"selector":{"BILLINFOS":{"$elemMatch":{"BILLINGNO":"9001"}}}}`, "|SO|478|10|"},
+		{`{"selector":{"SONUMBER":{"$in":["478","479"]}},"sort":[{"SOQTY":"desc"}],"limit":2}`, "|SO|479|10|,|SO|478|10|"},
+		{`{"selector":{"$or":[{"SOITEM":"20"},{"CPONO":"C2","SONUMBER":{"$exists":false}}]}}`, "|CPO|C2|,|SO|478|20|"},
+	}
+	for i, c := range cases {
+		payload := checkStubInvoke(t, stub, "q"+strconv.Itoa(i), "getQueryResult", "lenovo", c.query)
+		if keys := strings.Join(queryResultKeys(t, payload), ","); keys != c.keys {
+			t.Errorf("%s returned %s, expected %s", c.query, keys, c.keys)
+		}
+	}
+
+	//soft deleted records only with includeDeleted
+	checkStubInvoke(t, stub, "tx4", "removeFromStateByKey", `{"keyPrefix":"SO","keysStart":["479"]}`)
+	query := `{"selector":{"SOQTY":{"$exists":true}}}`
+	if keys := queryResultKeys(t, checkStubInvoke(t, stub, "q10", "getQueryResult", "lenovo", query)); len(keys) != 2 {
+		t.Fatalf("deleted record returned %v", keys)
+	}
+	if keys := queryResultKeys(t, checkStubInvoke(t, stub, "q11", "getQueryResult", "lenovo", query, "true")); len(keys) != 3 {
+		t.Fatalf("deleted record not returned %v", keys)
+	}
+
+	res := stub.MockInvoke("q12", [][]byte{[]byte("getQueryResult"), []byte("lenovo"), []byte(`{"selector":{"SOQTY":{"$near":1}}}`)})
+	errInfo := ErrorInfo{}
+	if res.Status == shim.OK || json.Unmarshal([]byte(res.Message), &errInfo) != nil || errInfo.Code != ERR_INTERNAL {
+		t.Fatalf("invalid query was accepted %d %s", res.Status, res.Message)
+	}
+	res = stub.MockInvoke("q13", [][]byte{[]byte("getQueryResult"), []byte("lenovo")})
+	if res.Status == shim.OK {
+		t.Fatal("missing query was accepted")
+	}
+}
+
+//An open-ended range stops at the end of its prefix, it never returns the
+//records of the next prefixes or the webhook subscriptions
+func TestQueryByIdRangePrefix(t *testing.T) {
+	stub := seededStub(t)
+	checkStubInvoke(t, stub, "hook1", "setWebhookSubscription", `{"Entity":"SUP","FilterField":"VendorNO","FilterValue":"1209","URL":"https://partner.example/hook","Secret":"0123456789abcdef"}`)
+	for prefix, role := range map[string]string{PO_KEY: "1209", SUPPLIER_KEY: "1209", SO_KEY: "lenovo"} {
+		payload := checkStubInvoke(t, stub, "q", "queryByIdRange", role, `{"keyPrefix":"`+prefix+`","keysStart":["0"]}`)
+		keys := queryResultKeys(t, payload)
+		if len(keys) != 1 {
+			t.Fatalf("unexpected %s keys %v", prefix, keys)
+		}
+		for _, key := range keys {
+			if !strings.HasPrefix(key, "|"+prefix+"|") {
+				t.Fatalf("%s range returned %s", prefix, key)
+			}
+		}
+		if bytes.Contains(payload, []byte("0123456789abcdef")) || (role != "lenovo" && bytes.Contains(payload, []byte(`"NETPRICE":"7"`))) {
+			t.Fatalf("%s range leaked %s", prefix, payload)
+		}
+	}
+}
+
+func TestQueryHistoryById(t *testing.T) {
+	stub := mockstub.NewStub("ex02", new(SmartContract))
+	stub.SetCreator(BUYER_MSP)
+	stub.MockInit("tx1", nil)
+	checkStubInvoke(t, stub, "tx2", "crSalesOrderInfo", `[{"SONUMBER":"478","SOITEM":"10","NETPRICE":"7","TRANSDOC":"SO"}]`, "1209")
+	checkStubInvoke(t, stub, "tx3", "crSalesOrderInfo",
+		`[{"SONUMBER":"478","SOITEM":"10","TRANSDOC":"BL","BILLINFOS":[{"BILLINGNO":"9001","BILLINGITEM":"10"}]}]`, "1209")
+	checkStubInvoke(t, stub, "tx4", "removeFromStateByKey", `{"keyPrefix":"SO","keysStart":["478","10"]}`)
+	checkStubInvoke(t, stub, "tx5", "setPurgeApprovers", `["lenovo"]`)
+	checkStubInvoke(t, stub, "purge1", "requestPurge", `{"keyPrefix":"SO","keysStart":["478"],"Reason":"test data"}`)
+	checkStubInvoke(t, stub, "tx6", "approvePurge", "purge1")
+	checkStubInvoke(t, stub, "tx7", "executePurge", "purge1")
+
+	type entry struct {
+		TxId      string
+		Value     *model.SalesOrder
+		Timestamp string
+		IsDelete  string
+	}
+	history := []entry{}
+	payload := checkStubInvoke(t, stub, "q1", "queryHistoryById", "lenovo", `{"keyPrefix":"SO","keysStart":["478","10"]}`)
+	if err := json.Unmarshal(payload, &history); err != nil {
+		t.Fatalf("invalid history %s", payload)
+	}
+	if len(history) != 4 {
+		t.Fatalf("unexpected history %s", payload)
+	}
+	for i, txID := range []string{"tx2", "tx3", "tx4", "tx7"} {
+		if history[i].TxId != txID || history[i].Timestamp == "" {
+			t.Fatalf("unexpected history %s", payload)
+		}
+	}
+	if history[0].Value.NETPRICE != "7" || len(history[0].Value.BILLINFOS) != 0 || len(history[1].Value.BILLINFOS) != 1 ||
+		history[2].Value.DELFLAG != SO_DELETED || history[2].IsDelete != "false" {
+		t.Fatalf("unexpected history %s", payload)
+	}
+	if history[3].Value != nil || history[3].IsDelete != "true" {
+		t.Fatalf("purge not in history %s", payload)
+	}
+
+	payload = checkStubInvoke(t, stub, "q2", "queryHistoryById", "lenovo", `{"keyPrefix":"SO","keysStart":["478","20"]}`)
+	if string(payload) != "[]" {
+		t.Fatalf("history of a missing key %s", payload)
+	}
+}
+
+//Call of a scenario: function and arguments, Code of the expected error
+type scenarioStep struct {
+	Args []string
+	Code string
+}
+
+func step(args ...string) scenarioStep {
+	return scenarioStep{Args: args}
+}
+
+func failingStep(code string, args ...string) scenarioStep {
+	return scenarioStep{Args: args, Code: code}
+}
+
+//Golden file of a scenario, testdata/scenarios/<name>.json
+type scenarioGolden struct {
+	Steps []scenarioResult
+	State []scenarioEntry //World state at the end, in key order
+}
+
+type scenarioResult struct {
+	Args     []string
+	TxID     string          `json:",omitempty"`
+	Error    *client.Error   `json:",omitempty"`
+	Response json.RawMessage `json:",omitempty"`
+	Events   []scenarioEvent `json:",omitempty"`
+}
+
+type scenarioEvent struct {
+	Name    string
+	Payload json.RawMessage
+}
+
+type scenarioEntry struct {
+	Key   string //Composite key attributes separated by spaces
+	Value json.RawMessage
+}
+
+//JSON of a payload or ledger value, a JSON string if it is not JSON
+func goldenJSON(b []byte) json.RawMessage {
+	var raw json.RawMessage
+	b = bytes.Replace(b, []byte{0}, []byte(`\u0000`), -1)
+	if json.Unmarshal(b, &raw) == nil {
+		return raw
+	}
+	s, _ := json.Marshal(string(b))
+	return s
+}
+
+//Event payload without the transaction time, it changes on every run
+func goldenEvent(payload []byte) json.RawMessage {
+	event := map[string]interface{}{}
+	if json.Unmarshal(payload, &event) != nil {
+		return goldenJSON(payload)
+	}
+	if _, ok := event["Time"]; ok {
+		event["Time"] = ""
+	}
+	b, _ := json.Marshal(event)
+	return b
+}
+
+func runScenario(t *testing.T, name string, steps []scenarioStep) scenarioGolden {
+	err, mock := client.NewMock("lenovo_bc", new(SmartContract))
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden := scenarioGolden{State: []scenarioEntry{}}
+	for _, s := range steps {
+		events := len(mock.Events)
+		err, res := mock.Invoke(s.Args[0], s.Args[1:])
+		result := scenarioResult{Args: s.Args, TxID: res.TxID}
+		if err != nil {
+			e, ok := err.(*client.Error)
+			if !ok {
+				t.Fatalf("%s: %s failed %v", name, s.Args[0], err)
+			}
+			result.Error = e
+			if e.Code != s.Code {
+				t.Errorf("%s: %s failed %v, expected %q", name, s.Args[0], err, s.Code)
+			}
+		} else if s.Code != "" {
+			t.Errorf("%s: %s succeeded, expected %s", name, s.Args[0], s.Code)
+		}
+		if len(res.Payload) > 0 {
+			result.Response = goldenJSON(res.Payload)
+		}
+		for _, event := range mock.Events[events:] {
+			result.Events = append(result.Events, scenarioEvent{Name: event.EventName, Payload: goldenEvent(event.Payload)})
+		}
+		golden.Steps = append(golden.Steps, result)
+	}
+	keys := []string{}
+	for key := range mock.Stub.State {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		parts := strings.Split(strings.Trim(key, "\x00"), "\x00")
+		golden.State = append(golden.State, scenarioEntry{Key: strings.Join(parts, " "), Value: goldenJSON(mock.Stub.State[key])})
+	}
+	return golden
+}
+
+//Write and query paths of the TRANSDOC types. The responses, events and the
+//final world state are compared with testdata/scenarios, rewrite them with
+//go test -run TestScenarios -update after an intended change.
+func TestScenarios(t *testing.T) {
+	so := `[{"SONUMBER":"478","SOITEM":"10","CPONO":"C001","PARTSNO":"P1","SOQTY":"5","NETPRICE":"7","NETVALUE":"35","TRANSDOC":"SO"}]`
+	po := `[{"PONO":"4500","POItemNO":"10","VendorNO":"1209","SONUMBER":"478","SOITEM":"10","POQty":"5","POItemChgDate":"20180102","TRANSDOC":"PO"}]`
+	soKey := `{"keyPrefix":"SO","keysStart":["478","10"]}`
+	poKey := `{"keyPrefix":"PO","keysStart":["4500","10"]}`
+	scenarios := []struct {
+		name  string
+		steps []scenarioStep
+	}{
+		{"sales_order", []scenarioStep{
+			step("crSalesOrderInfo", so, "1209"),
+			step("crSalesOrderInfo", `[{"SONUMBER":"478","SOITEM":"10","TRANSDOC":"BL","BILLINFOS":[{"BILLINGNO":"9001","BILLINGITEM":"10","BILLINGQTY":"5","NETVALUE":"35"}]}]`, "1209"),
+			step("crSalesOrderInfo", `[{"SONUMBER":"478","SOITEM":"10","TRANSDOC":"GI","GIINFOS":[{"DNNUMBER":"8001","DNITEM":"10","DNQTY":"5","GISTATUS":"C"}]}]`, "1209"),
+			//SO keeps the billing and GI lines
+			step("crSalesOrderInfo", `[{"SONUMBER":"478","SOITEM":"10","CPONO":"C001","PARTSNO":"P1","SOQTY":"6","NETPRICE":"7","NETVALUE":"42","TRANSDOC":"SO"}]`, "1209"),
+			//a second BL replaces the billing lines
+			step("crSalesOrderInfo", `[{"SONUMBER":"478","SOITEM":"10","TRANSDOC":"BL","BILLINFOS":[{"BILLINGNO":"9002","BILLINGITEM":"10","BILLINGQTY":"6","NETVALUE":"42"}]}]`, "1209"),
+			step("queryById", "lenovo", soKey),
+			step("queryById", "supplier", soKey),
+			step("queryByPartialCompositeKey", "supplier", `{"keyPrefix":"SO","keysStart":["478"]}`),
+		}},
+		{"purchase_order", []scenarioStep{
+			step("crSalesOrderInfo", so, "1209"),
+			step("crPurchaseOrderInfo", po, "1209"),
+			step("crPurchaseOrderInfo", `[{"PONO":"4500","POItemNO":"10","TRANSDOC":"GR","GRInfos":[{"GRNO":"5001","FiscalYear":"2018","GRItemNO":"1","GRQty":"5"}]}]`, "1209"),
+			step("crPurchaseOrderInfo", `[{"PONO":"4500","POItemNO":"10","TRANSDOC":"POCON","Confirmation":[{"CnfSeqNO":"1","CnfQty":"5","CnfDlvryDate":"20180110"}]}]`, "1209"),
+			step("crPurchaseOrderInfo", `[{"PONO":"4500","POItemNO":"10","TRANSDOC":"INV","Invoice":[{"InvNO":"5105","FiscalYear":"2018","InvQty":"5","GRNO":"5001"}]}]`, "1209"),
+			step("crPurchaseOrderInfo", `[{"PONO":"4500","POItemNO":"10","TRANSDOC":"INDN","InboundDelivery":[{"IBDNNUMBER":"1801","IBDNITEM":"10","ASNNO":"ASN1","DlvyQty":"5"}]}]`, "1209"),
+			//PO keeps the follow-on documents
+			step("crPurchaseOrderInfo", `[{"PONO":"4500","POItemNO":"10","VendorNO":"1209","SONUMBER":"478","SOITEM":"10","POQty":"6","POItemChgDate":"20180103","TRANSDOC":"PO"}]`, "1209"),
+			step("queryById", "lenovo", poKey),
+			step("queryById", "supplier", poKey),
+			step("queryById", "supplier", soKey),
+			step("queryByIdRange", "lenovo", `{"keyPrefix":"PO","keysStart":["4500"],"keysEnd":["4501"]}`),
+		}},
+		{"odm", []scenarioStep{
+			step("crSalesOrderInfo", so, "1209"),
+			step("crPurchaseOrderInfo", po, "1209"),
+			step("crCPurchaseOrderInfo", `[{"CPONO":"C001","TRANSDOC":"GR","PARTNUM":"P1","GRQTY":"5","LenDNNO":"8001"}]`, "1300"),
+			step("crCPurchaseOrderInfo", `[{"CPONO":"C001","TRANSDOC":"BL","INVOICENUM":"7001","INVOICESTATUS":"PAID","PAYMENTDATE":"20180120"}]`, "1300"),
+			step("queryById", "odm", `{"keyPrefix":"CPO","keysStart":["C001"]}`),
+			step("queryByPartialCompositeKey", "odm", `{"keyPrefix":"CPO","keysStart":["C001"]}`),
+			//the SO gets the ODM GRs and payments of its CPO
+			step("queryByPartialCompositeKey", "lenovo", `{"keyPrefix":"SO","keysStart":["478"]}`),
+		}},
+		{"supplier_asn", []scenarioStep{
+			step("crSalesOrderInfo", so, "1209"),
+			step("crPurchaseOrderInfo", po, "1209"),
+			step("crSupplierOrderInfo", `[{"ASNNumber":"ASN1","PONumber":"4500","POItem":"10","ShippedQty":"5","ASNDate":"20180105","CarrierID":"DHL"}]`, "1209"),
+			//UL only replaces the packing list
+			step("crSupplierOrderInfo", `[{"ASNNumber":"ASN1","TRANSDOC":"UL","ShippedQty":"9","PackingList":{"ID":"f1","Name":"packing.pdf","FileType":"pdf"}}]`, "1209"),
+			step("queryById", "supplier", `{"keyPrefix":"SUP","keysStart":["1209","ASN1"]}`),
+			step("queryByPartialCompositeKey", "supplier", `{"keyPrefix":"SUP","keysStart":["1209"]}`),
+			step("queryById", "lenovo", poKey),
+		}},
+		{"errors", []scenarioStep{
+			failingStep(ERR_VALIDATION, "crSalesOrderInfo", `[{"SOITEM":"10","TRANSDOC":"SO"}]`, "1209"),
+			failingStep(ERR_VALIDATION, "crPurchaseOrderInfo", `{"PONO":"4500"}`, "1209"),
+			failingStep(ERR_VALIDATION, "crSupplierOrderInfo", `[{"PONumber":"4500"}]`, "1209"),
+			failingStep(ERR_VALIDATION, "crCPurchaseOrderInfo", `[{"TRANSDOC":"GR"}]`, "1300"),
+			failingStep(ERR_NOT_FOUND, "queryById", "lenovo", soKey),
+			failingStep(ERR_VALIDATION, "queryById", "lenovo"),
+		}},
+	}
+
+	for _, s := range scenarios {
+		b, _ := json.MarshalIndent(runScenario(t, s.name, s.steps), "", "  ")
+		b = append(b, '\n')
+		path := filepath.Join("testdata", "scenarios", s.name+".json")
+		if *update {
+			os.MkdirAll(filepath.Dir(path), 0755)
+			if err := ioutil.WriteFile(path, b, 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		old, err := ioutil.ReadFile(path)
+		if err != nil || !bytes.Equal(old, b) {
+			t.Errorf("%s is out of date, run go test -run TestScenarios -update and review the diff", path)
+		}
+	}
+}
+
+//Model of the records written under a key prefix
+var recordTypes = map[string]func() interface{}{
+	SO_KEY:       func() interface{} { return &model.SalesOrder{} },
+	PO_KEY:       func() interface{} { return &model.PurchaseOrder{} },
+	CPO_KEY:      func() interface{} { return &model.ODMPurchaseOrder{} },
+	SUPPLIER_KEY: func() interface{} { return &model.SupplierOrder{} },
+}
+
+//Stub with SO 478/10 of CPO C001, PO 4500/10 of the SO and ASN1 of vendor 1209
+func seededStub(t *testing.T) *mockstub.Stub {
+	stub := mockstub.NewStub("lenovo_bc", new(SmartContract))
+	if res := stub.MockInit("init", nil); res.Status != shim.OK {
+		t.Fatalf("init failed %s", res.Message)
+	}
+	checkStubInvoke(t, stub, "seed1", "crSalesOrderInfo", `[{"SONUMBER":"478","SOITEM":"10","CPONO":"C001","SOQTY":"5","NETPRICE":"7","TRANSDOC":"SO"}]`, "1209")
+	checkStubInvoke(t, stub, "seed2", "crPurchaseOrderInfo", `[{"PONO":"4500","POItemNO":"10","SONUMBER":"478","SOITEM":"10","POQty":"5","TRANSDOC":"PO"}]`, "1209")
+	checkStubInvoke(t, stub, "seed3", "crSupplierOrderInfo", `[{"ASNNumber":"ASN1","PONumber":"4500","POItem":"10","ShippedQty":"5"}]`, "1209")
+	stub.SetCreator(BUYER_MSP)
+	return stub
+}
+
+//Invariants of a write function, whatever its arguments: it fails with an
+//ErrorInfo of a caller error, or writes records of its model under valid
+//composite keys and returns the WriteResults
+func checkWriteInvariants(t *testing.T, stub *mockstub.Stub, res pb.Response) {
+	if res.Status >= shim.ERRORTHRESHOLD {
+		errInfo := ErrorInfo{}
+		if err := json.Unmarshal([]byte(res.Message), &errInfo); err != nil {
+			t.Fatalf("error message is not json: %q", res.Message)
+		}
+		switch errInfo.Code {
+		case ERR_VALIDATION, ERR_NOT_FOUND, ERR_PERMISSION, ERR_CONFLICT, ERR_STALE_UPDATE:
+		default:
+			t.Fatalf("unexpected error %s", res.Message)
+		}
+		return
+	}
+	for _, key := range stub.Written {
+		value, ok := stub.State[key]
+		if !ok {
+			continue
+		}
+		prefix := keyPrefixOf(key)
+		newRecord, known := recordTypes[prefix]
+		if !known {
+			t.Fatalf("unexpected key %q written", key)
+		}
+		if err := json.Unmarshal(value, newRecord()); err != nil || value == nil {
+			t.Fatalf("invalid %s record %q: %v", prefix, value, err)
+		}
+	}
+	results := []WriteResult{}
+	if err := json.Unmarshal(res.Payload, &results); err != nil {
+		t.Fatalf("invalid write results %q", res.Payload)
+	}
+	for _, result := range results {
+		if result.Status != RESULT_OK && result.Status != RESULT_WARNING && result.Status != RESULT_REJECTED {
+			t.Fatalf("unexpected write result %+v", result)
+		}
+	}
+}
+
+//Key attribute made from a random string
+func quickKey(s string) string {
+	key := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' || r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' {
+			return r
+		}
+		return -1
+	}, s)
+	if key == "" {
+		return "1"
+	}
+	return key
+}
+
+func storedFields(t *testing.T, stub *mockstub.Stub, prefix string, keys []string) map[string]json.RawMessage {
+	_, key := generateKey(stub, prefix, keys)
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(stub.State[key], &fields); err != nil {
+		t.Fatalf("invalid record %q", stub.State[key])
+	}
+	return fields
+}
+
+//A follow-on document replaces the list of its TRANSDOC and nothing else:
+//a PO update with TRANSDOC=GR never changes POQty
+func TestFollowOnDocumentProperty(t *testing.T) {
+	type list struct{ Field, Qty string }
+	orders := []struct {
+		Function  string
+		Prefix    string
+		KeyFields []string
+		TRANSDOC  string
+		Qty       string
+		Lists     map[string]list //TRANSDOC -> list field, quantity field of its lines
+	}{
+		{"crPurchaseOrderInfo", PO_KEY, []string{"PONO", "POItemNO"}, "PO", "POQty", map[string]list{
+			"GR": {"GRInfos", "GRQty"}, "POCON": {"Confirmation", "CnfQty"}, "INV": {"Invoice", "InvQty"}, "INDN": {"InboundDelivery", "DlvyQty"}}},
+		{"crSalesOrderInfo", SO_KEY, []string{"SONUMBER", "SOITEM"}, "SO", "SOQTY", map[string]list{
+			"BL": {"BILLINFOS", "BILLINGQTY"}, "GI": {"GIINFOS", "DNQTY"}}},
+	}
+	for _, order := range orders {
+		order := order
+		transdocs := []string{}
+		for transdoc := range order.Lists {
+			transdocs = append(transdocs, transdoc)
+		}
+		sort.Strings(transdocs)
+		property := func(number string, qty uint16, doc uint8, newQty uint16, lines []uint16) bool {
+			stub := mockstub.NewStub("lenovo_bc", new(SmartContract))
+			stub.MockInit("init", nil)
+			keys := []string{quickKey(number), "10"}
+			record := map[string]interface{}{order.KeyFields[0]: keys[0], order.KeyFields[1]: keys[1],
+				"TRANSDOC": order.TRANSDOC, order.Qty: strconv.Itoa(int(qty))}
+			b, _ := json.Marshal([]interface{}{record})
+			checkStubInvoke(t, stub, "create", order.Function, string(b), "1209")
+			before := storedFields(t, stub, order.Prefix, keys)
+
+			transdoc := transdocs[int(doc)%len(transdocs)]
+			items := []map[string]string{}
+			for _, line := range lines {
+				items = append(items, map[string]string{order.Lists[transdoc].Qty: strconv.Itoa(int(line))})
+			}
+			record["TRANSDOC"] = transdoc
+			record[order.Qty] = strconv.Itoa(int(newQty))
+			record[order.Lists[transdoc].Field] = items
+			b, _ = json.Marshal([]interface{}{record})
+			res := stub.MockInvoke("update", [][]byte{[]byte(order.Function), b, []byte("1209")})
+			checkWriteInvariants(t, stub, res)
+			after := storedFields(t, stub, order.Prefix, keys)
+			for name, value := range before {
+				if name != order.Lists[transdoc].Field && !bytes.Equal(value, after[name]) {
+					t.Logf("%s %s changed %s from %s to %s", order.Prefix, transdoc, name, value, after[name])
+					return false
+				}
+			}
+			written := []json.RawMessage{}
+			json.Unmarshal(after[order.Lists[transdoc].Field], &written)
+			return len(written) == len(lines)
+		}
+		if err := quick.Check(property, nil); err != nil {
+			t.Errorf("%s: %v", order.Function, err)
+		}
+	}
+}
+
+//NETPRICE and NETVALUE of an SO reach no other role than lenovo, whatever
+//query returns the SO or a record integrating it
+func TestMaskingProperty(t *testing.T) {
+	queries := func(role string, so string) [][]string {
+		return [][]string{
+			{"queryById", role, `{"keyPrefix":"SO","keysStart":["` + so + `","10"]}`},
+			{"queryByIds", role, `[{"keyPrefix":"SO","keysStart":["` + so + `","10"]}]`},
+			{"queryByIdRange", role, `{"keyPrefix":"SO","keysStart":["` + so + `"],"keysEnd":["` + so + `~"]}`},
+			{"queryByPartialCompositeKey", role, `{"keyPrefix":"SO","keysStart":["` + so + `"]}`},
+			{"queryByPartialCompositeKey", role, `{"keyPrefix":"PO","keysStart":["P` + so + `"]}`},
+			{"queryByPartialCompositeKey", role, `{"keyPrefix":"CPO","keysStart":["C` + so + `"]}`},
+			{"queryByPartialCompositeKey", role, `{"keyPrefix":"SUP","keysStart":["1209"]}`},
+			{"queryHistoryById", role, `{"keyPrefix":"SO","keysStart":["` + so + `","10"]}`},
+			{"getQueryResult", role, `{"selector":{"SONUMBER":"` + so + `"}}`},
+			{"getQueryResult", role, `{"selector":{"SONUMBER":"` + so + `"},"fields":["SONUMBER","NETPRICE"]}`},
+		}
+	}
+	leaks := func(role string, number string, price uint32) []string {
+		so := quickKey(number)
+		netPrice := "NP" + strconv.FormatUint(uint64(price), 10) + "Z"
+		netValue := "NV" + strconv.FormatUint(uint64(price), 10) + "Z"
+		stub := mockstub.NewStub("lenovo_bc", new(SmartContract))
+		stub.MockInit("init", nil)
+		checkStubInvoke(t, stub, "so", "crSalesOrderInfo", `[{"SONUMBER":"`+so+`","SOITEM":"10","CPONO":"C`+so+`","NETPRICE":"`+netPrice+`","NETVALUE":"`+netValue+`","TRANSDOC":"SO"}]`, "1209")
+		checkStubInvoke(t, stub, "po", "crPurchaseOrderInfo", `[{"PONO":"P`+so+`","POItemNO":"10","SONUMBER":"`+so+`","SOITEM":"10","TRANSDOC":"PO"}]`, "1209")
+		checkStubInvoke(t, stub, "sup", "crSupplierOrderInfo", `[{"ASNNumber":"A`+so+`","PONumber":"P`+so+`","POItem":"10"}]`, "1209")
+		checkStubInvoke(t, stub, "bl", "crSalesOrderInfo", `[{"SONUMBER":"`+so+`","SOITEM":"10","TRANSDOC":"BL","BILLINFOS":[{"BILLINGQTY":"1"}]}]`, "1209")
+		found := []string{}
+		for i, query := range queries(role, so) {
+			args := [][]byte{}
+			for _, arg := range query {
+				args = append(args, []byte(arg))
+			}
+			res := stub.MockInvoke("q"+strconv.Itoa(i), args)
+			output := string(res.Payload) + res.Message
+			if strings.Contains(output, netPrice) || strings.Contains(output, netValue) {
+				found = append(found, query[0]+" "+query[2])
+			}
+		}
+		return found
+	}
+	property := func(role string, number string, price uint32) bool {
+		if role == "lenovo" {
+			role = "odm"
+		}
+		found := leaks(role, number, price)
+		for _, query := range found {
+			t.Logf("role %q: %s", role, query)
+		}
+		return len(found) == 0
+	}
+	if err := quick.Check(property, nil); err != nil {
+		t.Error(err)
+	}
+	//the property is not vacuous
+	if found := leaks("lenovo", "478", 7); len(found) != len(queries("lenovo", "478")) {
+		t.Fatalf("lenovo did not get NETPRICE from %v", found)
+	}
+}
+
+func TestMaskedQueryFields(t *testing.T) {
+	stub := seededStub(t)
+	for _, query := range []string{
+		`{"selector":{"NETPRICE":{"$gt":"5"}}}`,
+		`{"selector":{"$or":[{"SOQTY":"5"},{"NETVALUE":"35"}]}}`,
+		`{"selector":{"SOQTY":"5"},"sort":[{"NETPRICE":"asc"}]}`,
+		`{"selector":{"PONO":"4500"},"fields":["POItemChgDate"]}`,
+	} {
+		res := stub.MockInvoke("q", [][]byte{[]byte("getQueryResult"), []byte("supplier"), []byte(query)})
+		errInfo := ErrorInfo{}
+		json.Unmarshal([]byte(res.Message), &errInfo)
+		if res.Status == shim.OK || errInfo.Code != ERR_VALIDATION {
+			t.Fatalf("%s was not rejected: %s %s", query, res.Payload, res.Message)
+		}
+	}
+	payload := checkStubInvoke(t, stub, "q", "getQueryResult", "lenovo", `{"selector":{"NETPRICE":{"$gt":"5"}}}`)
+	if keys := queryResultKeys(t, payload); len(keys) != 1 {
+		t.Fatalf("unexpected lenovo result %s", payload)
+	}
+}
@@ -0,0 +1,154 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/lenovo_bc/model"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"strings"
+)
+
+//Error Info, returned as json in shim.Error message
+type ErrorInfo struct {
+	Code    string `json:"Code"`  //Error code, ERR_xxx
+	Message string `json:"Error"` //Error message
+	Key     string `json:"Key"`   //Record key
+	Field   string `json:"Field"` //Field name
+}
+
+func (e *ErrorInfo) Error() string {
+	b, _ := json.Marshal(e)
+	return string(b)
+}
+
+func newError(code string, key string, field string, message string) *ErrorInfo {
+	return &ErrorInfo{Code: code, Message: message, Key: key, Field: field}
+}
+
+//生成错误返回
+func errorResponse(err error) pb.Response {
+	if e, ok := err.(*ErrorInfo); ok {
+		return shim.Error(e.Error())
+	}
+	return shim.Error(newError(ERR_INTERNAL, "", "", err.Error()).Error())
+}
+
+func errorResp(code string, key string, field string, message string) pb.Response {
+	return shim.Error(newError(code, key, field, message).Error())
+}
+
+//补充错误Key
+func errorWithKey(err error, key string) error {
+	if e, ok := err.(*ErrorInfo); ok && e.Key == "" {
+		e.Key = key
+	}
+	return err
+}
+
+//生成Key
+func generateKey(stub shim.ChaincodeStubInterface, keyPrefix string, keyArray []string) (error, string) {
+	if keyPrefix == "" {
+		return newError(ERR_VALIDATION, "", "keyPrefix", "Invalid object name"), ""
+	}
+	key, err := stub.CreateCompositeKey(keyPrefix, keyArray)
+	if err != nil {
+		return newError(ERR_VALIDATION, "", "", err.Error()), ""
+	}
+	return nil, key
+}
+
+//Object name of a composite key, "" for other keys
+func keyPrefixOf(key string) string {
+	if !strings.HasPrefix(key, "\x00") {
+		return ""
+	}
+	return strings.SplitN(key[1:], "\x00", 2)[0]
+}
+
+//End of a range over every key of the prefix, composite keys are
+//\x00prefix\x00attributes... so the range stops before the next prefix
+func prefixRangeEnd(keyPrefix string) string {
+	return "\x00" + keyPrefix + "\x01"
+}
+
+//Records read by the generic queries. Other keys, like the webhook
+//subscriptions with their secrets, are only read by their own functions.
+func isRecordPrefix(keyPrefix string) bool {
+	return newRecord(keyPrefix) != nil
+}
+
+//生成查询Key
+func generateQueryKey(stub shim.ChaincodeStubInterface, args []string) (error, string, string) {
+
+	keyStart := ""
+	keyEnd := ""
+
+	if len(args) != 2 {
+		return newError(ERR_VALIDATION, "", "", "Incorrect number of arguments."), keyStart, keyEnd
+	}
+
+	jsonStr := args[1]
+	param := model.QueryParam{}
+	err := json.Unmarshal([]byte(jsonStr), &param)
+	if err != nil {
+		return newError(ERR_VALIDATION, "", "", err.Error()), keyStart, keyEnd
+	}
+
+	if param.KeyPrefix == "" {
+		return newError(ERR_VALIDATION, "", "keyPrefix", "Invalid object name"), keyStart, keyEnd
+	}
+	if !isRecordPrefix(param.KeyPrefix) {
+		return newError(ERR_VALIDATION, "", "keyPrefix", "Unknown query type '"+param.KeyPrefix+"'"), keyStart, keyEnd
+	}
+	if len(param.KeysStart) > 0 {
+		k, err := stub.CreateCompositeKey(param.KeyPrefix, param.KeysStart)
+		if err != nil {
+			return newError(ERR_VALIDATION, "", "keysStart", err.Error()), "", ""
+		}
+		keyStart = k
+	} else {
+		return newError(ERR_VALIDATION, "", "keysStart", "Keys start is required"), keyStart, keyEnd
+	}
+	if len(param.KeysEnd) > 0 {
+		k, err := stub.CreateCompositeKey(param.KeyPrefix, param.KeysEnd)
+		if err != nil {
+			return newError(ERR_VALIDATION, "", "keysEnd", err.Error()), "", ""
+		}
+		keyEnd = k
+	} else {
+		keyEnd = prefixRangeEnd(param.KeyPrefix)
+	}
+	return nil, keyStart, keyEnd
+}
+
+func generateQueryKey2(stub shim.ChaincodeStubInterface, keyPrefix string, keysStart []string, keysEnd []string) (error, string, string) {
+
+	keyStart := ""
+	keyEnd := ""
+
+	if keyPrefix == "" {
+		return newError(ERR_VALIDATION, "", "keyPrefix", "Invalid object name"), keyStart, keyEnd
+	}
+	if !isRecordPrefix(keyPrefix) {
+		return newError(ERR_VALIDATION, "", "keyPrefix", "Unknown query type '"+keyPrefix+"'"), keyStart, keyEnd
+	}
+	if len(keysStart) > 0 {
+		k, err := stub.CreateCompositeKey(keyPrefix, keysStart)
+		if err != nil {
+			return newError(ERR_VALIDATION, "", "keysStart", err.Error()), "", ""
+		}
+		keyStart = k
+	} else {
+		return newError(ERR_VALIDATION, "", "keysStart", "Keys start is required"), keyStart, keyEnd
+	}
+	if len(keysEnd) > 0 {
+		k, err := stub.CreateCompositeKey(keyPrefix, keysEnd)
+		if err != nil {
+			return newError(ERR_VALIDATION, "", "keysEnd", err.Error()), "", ""
+		}
+		keyEnd = k
+	} else {
+		keyEnd = prefixRangeEnd(keyPrefix)
+	}
+	return nil,keyStart, keyEnd
+}
@@ -0,0 +1,227 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/lenovo_bc/model"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+//Schema versions of the records. Invoke writes every record at
+//SCHEMA_VERSION, running the migration steps the record misses first.
+//Records nobody writes keep their version until an admin migrates them in
+//batches, with the parameters of auditConsistency:
+//
+//	querySchemaMigration {"keyPrefix":"PO","limit":100}  dry run, report only
+//	migrateSchema        {"keyPrefix":"PO","limit":100}  migrate the batch
+//
+//NextKey of the report is the bookmark of the next batch. To change the
+//schema, add a step with From = SCHEMA_VERSION and increase SCHEMA_VERSION.
+
+//Record model with a schema version, see model.Versioned
+type versionedRecord interface {
+	SetSchemaVersion(version int)
+	GetSchemaVersion() int
+}
+
+//Empty record of a key prefix, nil for keys other than records
+func newRecord(keyPrefix string) versionedRecord {
+	switch keyPrefix {
+	case SO_KEY:
+		return &model.SalesOrder{}
+	case PO_KEY:
+		return &model.PurchaseOrder{}
+	case CPO_KEY:
+		return &model.ODMPurchaseOrder{}
+	case SUPPLIER_KEY:
+		return &model.SupplierOrder{}
+	}
+	return nil
+}
+
+//Migration of the records of KeyPrefix from version From to From+1.
+//Steps run again on records of unknown version, so they must be idempotent.
+type migrationStep struct {
+	From        int
+	KeyPrefix   string
+	Description string
+	migrate     func(record versionedRecord) bool     //false if the record didn't change, nil if the step only reports
+	lost        func(record versionedRecord) []string //Fields that can't be recovered, left empty, nil if none
+}
+
+var migrationSteps = []migrationStep{
+	{From: 1, KeyPrefix: PO_KEY, Description: "Invoice comCode wasn't stored before version 2, it is left empty", lost: lostInvoiceComCode},
+}
+
+//The comCode of an invoice isn't the one of its GR, there is no source to
+//restore it from
+func lostInvoiceComCode(record versionedRecord) []string {
+	purchaseOrder := record.(*model.PurchaseOrder)
+	lost := []string{}
+	for i, invoice := range purchaseOrder.Invoice {
+		if invoice.ComCode == "" {
+			lost = append(lost, fmt.Sprintf("Invoice[%d].comCode", i))
+		}
+	}
+	return lost
+}
+
+//Version of a stored record. Records without one were written before
+//versioning. A version above SCHEMA_VERSION was written by a newer chaincode,
+//writing it again would drop the fields this one doesn't know.
+func recordVersion(record versionedRecord) (error, int) {
+	version := record.GetSchemaVersion()
+	if version > SCHEMA_VERSION {
+		return newError(ERR_CONFLICT, "", "SchemaVersion", fmt.Sprintf("Record has schema version %d, this chaincode only knows up to %d", version, SCHEMA_VERSION)), version
+	}
+	if version < SCHEMA_VERSION_LEGACY {
+		return nil, SCHEMA_VERSION_LEGACY
+	}
+	return nil, version
+}
+
+//Runs the steps a record misses and stamps SCHEMA_VERSION. Returns the
+//version it had, the steps that changed it and the fields it lost.
+func migrateRecord(keyPrefix string, record versionedRecord) (error, int, []string, []string) {
+	err, from := recordVersion(record)
+	if err != nil {
+		return err, from, nil, nil
+	}
+	steps := []string{}
+	lost := []string{}
+	for _, step := range migrationSteps {
+		if step.From < from || step.From >= SCHEMA_VERSION || step.KeyPrefix != keyPrefix {
+			continue
+		}
+		if step.lost != nil {
+			lost = append(lost, step.lost(record)...)
+		}
+		if step.migrate != nil && step.migrate(record) {
+			steps = append(steps, step.Description)
+		}
+	}
+	record.SetSchemaVersion(SCHEMA_VERSION)
+	return nil, from, steps, lost
+}
+
+//Stub handed to the functions by Invoke, records are written at SCHEMA_VERSION.
+//Most functions ignore the errors of PutState, Invoke fails the transaction
+//with the first one.
+type schemaStub struct {
+	shim.ChaincodeStubInterface
+	err error
+}
+
+func (s *schemaStub) PutState(key string, value []byte) error {
+	err := s.putState(key, value)
+	if err != nil && s.err == nil {
+		s.err = err
+	}
+	return err
+}
+
+func (s *schemaStub) putState(key string, value []byte) error {
+	keyPrefix := keyPrefixOf(key)
+	record := newRecord(keyPrefix)
+	if record == nil {
+		return s.ChaincodeStubInterface.PutState(key, value)
+	}
+	err := json.Unmarshal(value, record)
+	if err != nil {
+		return newError(ERR_INTERNAL, key, "", err.Error())
+	}
+	err, _, _, _ = migrateRecord(keyPrefix, record)
+	if err != nil {
+		return errorWithKey(err, key)
+	}
+	b, err := json.Marshal(record)
+	if err != nil {
+		return newError(ERR_INTERNAL, key, "", err.Error())
+	}
+	return s.ChaincodeStubInterface.PutState(key, b)
+}
+
+//Record below SCHEMA_VERSION
+type MigratedRecord struct {
+	Key           string   `json:"Key"`           //Record key
+	From          int      `json:"From"`          //Version of the stored record
+	Steps         []string `json:"Steps"`         //Steps that change the record, the version is stamped anyway
+	Unrecoverable []string `json:"Unrecoverable"` //Fields lost before the stored version, left empty
+}
+
+type MigrationReport struct {
+	Version  int              `json:"Version"`  //SCHEMA_VERSION
+	DryRun   bool             `json:"DryRun"`   //Nothing was written
+	Scanned  int              `json:"Scanned"`  //Records scanned in this batch
+	NextKey  string           `json:"NextKey"`  //Bookmark of next batch, empty when done
+	Migrated []MigratedRecord `json:"Migrated"` //Records migrated, or to migrate in a dry run
+}
+
+//迁移一批记录
+func migrateRange(stub shim.ChaincodeStubInterface, param AuditParam, keyStart string, keyEnd string, dryRun bool) (error, MigrationReport) {
+	report := MigrationReport{Version: SCHEMA_VERSION, DryRun: dryRun, Migrated: []MigratedRecord{}}
+	resultsIterator, err := stub.GetStateByRange(keyStart, keyEnd)
+	if err != nil {
+		return newError(ERR_INTERNAL, "", "", err.Error()), report
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return newError(ERR_INTERNAL, "", "", err.Error()), report
+		}
+		if report.Scanned == param.Limit {
+			report.NextKey = queryResponse.Key
+			break
+		}
+		report.Scanned++
+		record := newRecord(param.KeyPrefix)
+		err = json.Unmarshal(queryResponse.Value, record)
+		if err != nil {
+			return newError(ERR_INTERNAL, queryResponse.Key, "", err.Error()), report
+		}
+		if record.GetSchemaVersion() == SCHEMA_VERSION {
+			continue
+		}
+		err, from, steps, lost := migrateRecord(param.KeyPrefix, record)
+		if err != nil {
+			return errorWithKey(err, queryResponse.Key), report
+		}
+		report.Migrated = append(report.Migrated, MigratedRecord{Key: queryResponse.Key, From: from, Steps: steps, Unrecoverable: lost})
+		if dryRun {
+			continue
+		}
+		fmt.Println("migrate data, from version", from, "for - "+queryResponse.Key)
+		b, _ := json.Marshal(record)
+		err = stub.PutState(queryResponse.Key, b)
+		if err != nil {
+			return errorWithKey(err, queryResponse.Key), report
+		}
+	}
+	return nil, report
+}
+
+func schemaMigration(stub shim.ChaincodeStubInterface, args []string, dryRun bool) pb.Response {
+	err, param, keyStart, keyEnd := parseAuditParam(stub, args)
+	if err != nil {
+		return errorResponse(err)
+	}
+	err, report := migrateRange(stub, param, keyStart, keyEnd, dryRun)
+	if err != nil {
+		return errorResponse(err)
+	}
+	b, _ := json.Marshal(report)
+	return shim.Success(b)
+}
+
+//迁移预览 (只读)
+func querySchemaMigration(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	return schemaMigration(stub, args, true)
+}
+
+//迁移一批记录到SCHEMA_VERSION
+func migrateSchema(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	return schemaMigration(stub, args, false)
+}
@@ -0,0 +1,62 @@
+package chaincode
+
+import (
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//Stub keeping the writes of a transaction until Invoke succeeds. The peer
+//doesn't show a transaction its own writes and keeps only the last write of
+//a key, so a function posting several documents of one order, like an
+//interchange with an 810 and an 856 of the same PO, would keep only the last
+//document. GetState here returns the pending value and flush writes every
+//key once. Range and rich queries read the committed state like on the peer.
+type pendingStub struct {
+	shim.ChaincodeStubInterface
+	values  map[string][]byte //Pending value of each key, nil if deleted
+	written []string          //Keys in the order of their first write
+}
+
+func newPendingStub(stub shim.ChaincodeStubInterface) *pendingStub {
+	return &pendingStub{ChaincodeStubInterface: stub, values: map[string][]byte{}}
+}
+
+func (s *pendingStub) GetState(key string) ([]byte, error) {
+	if value, ok := s.values[key]; ok {
+		return value, nil
+	}
+	return s.ChaincodeStubInterface.GetState(key)
+}
+
+//A nil value deletes the key like on the peer
+func (s *pendingStub) PutState(key string, value []byte) error {
+	s.pend(key, value)
+	return nil
+}
+
+func (s *pendingStub) DelState(key string) error {
+	s.pend(key, nil)
+	return nil
+}
+
+func (s *pendingStub) pend(key string, value []byte) {
+	if _, ok := s.values[key]; !ok {
+		s.written = append(s.written, key)
+	}
+	s.values[key] = value
+}
+
+//写入账本, 每个Key一次
+func (s *pendingStub) flush() error {
+	for _, key := range s.written {
+		var err error
+		if value := s.values[key]; value == nil {
+			err = s.ChaincodeStubInterface.DelState(key)
+		} else {
+			err = s.ChaincodeStubInterface.PutState(key, value)
+		}
+		if err != nil {
+			return newError(ERR_INTERNAL, key, "", err.Error())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/lenovo_bc/model"
+)
+
+//Stub handed to the functions by Invoke. Fabric keeps only one event per
+//transaction, so the postings of all functions called in the transaction are
+//collected here and emitted as one POSTED event when Invoke succeeds.
+type postingStub struct {
+	shim.ChaincodeStubInterface
+	event model.PostingEvent
+}
+
+func newPostingStub(stub shim.ChaincodeStubInterface) *postingStub {
+	return &postingStub{ChaincodeStubInterface: stub}
+}
+
+//Posting event of the transaction, a throwaway one if stub doesn't come from Invoke
+func postingOf(stub shim.ChaincodeStubInterface, vendorNo string) *model.PostingEvent {
+	s, ok := stub.(*postingStub)
+	if !ok {
+		return &model.PostingEvent{VendorNO: vendorNo}
+	}
+	if s.event.VendorNO == "" {
+		s.event.VendorNO = vendorNo
+	}
+	return &s.event
+}
+
+//记录写入的单据, 同一单据只记一次. Fields: TRANSDOC and the webhook filter fields
+func addDocument(stub shim.ChaincodeStubInterface, vendorNo string, entity string, keys []string, record interface{}) {
+	b, _ := json.Marshal(record)
+	values := map[string]interface{}{}
+	json.Unmarshal(b, &values)
+	fields := map[string]string{}
+	for _, name := range append([]string{"TRANSDOC"}, webhookFilterFields[entity]...) {
+		if value, ok := values[name].(string); ok && value != "" {
+			fields[name] = value
+		}
+	}
+	event := postingOf(stub, vendorNo)
+	document := model.DocumentRef{Entity: entity, Keys: keys, Fields: fields}
+	for i, d := range event.Documents {
+		if d.Entity == entity && equalKeys(d.Keys, keys) {
+			event.Documents[i] = document
+			return
+		}
+	}
+	event.Documents = append(event.Documents, document)
+}
+
+func equalKeys(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+//发出事件, 没有记录时不发
+func (s *postingStub) emit() error {
+	event := s.event
+	if len(event.Documents) == 0 && len(event.SupplierOrders) == 0 && len(event.ODMGRInfos) == 0 && len(event.Subscriptions) == 0 {
+		return nil
+	}
+	event.TxID = s.GetTxID()
+	event.Time = getTxTime(s)
+	e, _ := json.Marshal(event)
+	err := s.SetEvent(POSTING_EVENT, e)
+	if err != nil {
+		return newError(ERR_INTERNAL, "", "", err.Error())
+	}
+	return nil
+}
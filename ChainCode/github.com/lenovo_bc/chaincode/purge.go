@@ -0,0 +1,272 @@
+package chaincode
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"time"
+)
+
+//Purge request   Key: "PURGE" + RequestID
+type PurgeRequest struct {
+	RequestID    string          `json:"RequestID"`    //Transaction ID of request
+	KeyPrefix    string          `json:"keyPrefix"`    //keyPrefix
+	KeysStart    []string        `json:"keysStart"`    //partial composite keys
+	Reason       string          `json:"Reason"`       //Reason of purge
+	Requester    string          `json:"Requester"`    //Requester org
+	RequestTime  string          `json:"RequestTime"`  //Request time
+	Status       string          `json:"Status"`       //PENDING, APPROVED, EXECUTED
+	Approvers    []string        `json:"Approvers"`    //Orgs required to approve
+	Approvals    []PurgeApproval `json:"Approvals"`    //Approvals
+	Manifest     []PurgeManifest `json:"Manifest"`     //Deleted keys
+	ManifestHash string          `json:"ManifestHash"` //sha256 of manifest
+	ExecuteTime  string          `json:"ExecuteTime"`  //Execute time
+}
+
+type PurgeApproval struct {
+	Org          string `json:"Org"`          //Approver org
+	ApprovalTime string `json:"ApprovalTime"` //Approval time
+}
+
+type PurgeManifest struct {
+	Key       string `json:"Key"`       //Deleted key
+	ValueHash string `json:"ValueHash"` //sha256 of deleted value
+}
+
+func getTxTime(stub shim.ChaincodeStubInterface) string {
+	ts, err := stub.GetTxTimestamp()
+	if err != nil || ts == nil {
+		return ""
+	}
+	return time.Unix(ts.Seconds, int64(ts.Nanos)).UTC().Format(time.RFC3339)
+}
+
+//Approvers set by setPurgeApprovers, the buyer org if none
+func loadPurgeApprovers(stub shim.ChaincodeStubInterface) (error, []string) {
+	err, cfg := loadConfig(stub)
+	if err != nil {
+		return err, nil
+	}
+	approvers := []string{cfg.BuyerOrg}
+	valAsbytes, err := stub.GetState(PURGE_APPROVERS_KEY)
+	if err != nil {
+		return newError(ERR_INTERNAL, PURGE_APPROVERS_KEY, "", err.Error()), nil
+	}
+	if valAsbytes != nil {
+		err = json.Unmarshal(valAsbytes, &approvers)
+		if err != nil {
+			return newError(ERR_INTERNAL, PURGE_APPROVERS_KEY, "", err.Error()), nil
+		}
+	}
+	return nil, approvers
+}
+
+func loadPurgeRequest(stub shim.ChaincodeStubInterface, requestId string) (error, string, PurgeRequest) {
+	request := PurgeRequest{}
+	err, key := generateKey(stub, PURGE_KEY, []string{requestId})
+	if err != nil {
+		return err, key, request
+	}
+	valAsbytes, err := stub.GetState(key)
+	if err != nil {
+		return newError(ERR_INTERNAL, key, "", err.Error()), key, request
+	}
+	if valAsbytes == nil {
+		return newError(ERR_NOT_FOUND, key, "RequestID", "Purge request doesn't exist"), key, request
+	}
+	err = json.Unmarshal(valAsbytes, &request)
+	if err != nil {
+		return newError(ERR_INTERNAL, key, "", err.Error()), key, request
+	}
+	return nil, key, request
+}
+
+func savePurgeRequest(stub shim.ChaincodeStubInterface, key string, request PurgeRequest) pb.Response {
+	b, _ := json.Marshal(request)
+	err := stub.PutState(key, b)
+	if err != nil {
+		return errorResp(ERR_INTERNAL, key, "", err.Error())
+	}
+	return shim.Success(b)
+}
+
+//设置清除审批组织
+func setPurgeApprovers(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var approvers []string
+	err := json.Unmarshal([]byte(args[0]), &approvers)
+	if err != nil {
+		return errorResp(ERR_VALIDATION, "", "", err.Error())
+	}
+	if len(approvers) == 0 {
+		return errorResp(ERR_VALIDATION, PURGE_APPROVERS_KEY, "", "At least one approver org is required")
+	}
+	for _, org := range approvers {
+		if org == "" {
+			return errorResp(ERR_VALIDATION, PURGE_APPROVERS_KEY, "", "Approver org can't be empty")
+		}
+	}
+	b, _ := json.Marshal(approvers)
+	err = stub.PutState(PURGE_APPROVERS_KEY, b)
+	if err != nil {
+		return errorResp(ERR_INTERNAL, PURGE_APPROVERS_KEY, "", err.Error())
+	}
+	return shim.Success(b)
+}
+
+//申请清除  args: purge scope json, the requester is the org of the creator
+func requestPurge(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	request := PurgeRequest{}
+	err := json.Unmarshal([]byte(args[0]), &request)
+	if err != nil {
+		return errorResp(ERR_VALIDATION, "", "", err.Error())
+	}
+	if request.KeyPrefix != SO_KEY && request.KeyPrefix != PO_KEY && request.KeyPrefix != CPO_KEY && request.KeyPrefix != SUPPLIER_KEY {
+		return errorResp(ERR_VALIDATION, "", "keyPrefix", "Unknown query type '"+request.KeyPrefix+"'")
+	}
+	if len(request.KeysStart) == 0 {
+		return errorResp(ERR_VALIDATION, "", "keysStart", "Query keys are required")
+	}
+	if request.Reason == "" {
+		return errorResp(ERR_VALIDATION, "", "Reason", "Reason is required")
+	}
+	err, cfg := loadConfig(stub)
+	if err != nil {
+		return errorResponse(err)
+	}
+	err, requester := creatorOrg(stub, cfg)
+	if err != nil {
+		return errorResponse(err)
+	}
+	err, approvers := loadPurgeApprovers(stub)
+	if err != nil {
+		return errorResponse(err)
+	}
+	request.RequestID = stub.GetTxID()
+	request.Requester = requester
+	request.RequestTime = getTxTime(stub)
+	request.Status = PURGE_PENDING
+	request.Approvers = approvers
+	request.Approvals = []PurgeApproval{}
+	request.Manifest = []PurgeManifest{}
+	request.ManifestHash = ""
+	request.ExecuteTime = ""
+	err, key := generateKey(stub, PURGE_KEY, []string{request.RequestID})
+	if err != nil {
+		return errorResponse(err)
+	}
+	fmt.Println("write data, purge request for - " + key)
+	return savePurgeRequest(stub, key, request)
+}
+
+//审批清除  args: request id, the approver is the org of the creator
+func approvePurge(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	err, cfg := loadConfig(stub)
+	if err != nil {
+		return errorResponse(err)
+	}
+	err, org := creatorOrg(stub, cfg)
+	if err != nil {
+		return errorResponse(err)
+	}
+	err, key, request := loadPurgeRequest(stub, args[0])
+	if err != nil {
+		return errorResponse(err)
+	}
+	if request.Status == PURGE_EXECUTED {
+		return errorResp(ERR_CONFLICT, key, "Status", "Purge request is already executed")
+	}
+	allowed := false
+	for _, approver := range request.Approvers {
+		if approver == org {
+			allowed = true
+		}
+	}
+	if !allowed {
+		return errorResp(ERR_PERMISSION, key, "Approvals", "Org '"+org+"' is not a purge approver")
+	}
+	for _, approval := range request.Approvals {
+		if approval.Org == org {
+			return errorResp(ERR_CONFLICT, key, "Approvals", "Org '"+org+"' has already approved")
+		}
+	}
+	request.Approvals = append(request.Approvals, PurgeApproval{Org: org, ApprovalTime: getTxTime(stub)})
+	if len(request.Approvals) == len(request.Approvers) {
+		request.Status = PURGE_APPROVED
+	}
+	fmt.Println("write data, purge approval of " + org + " for - " + key)
+	return savePurgeRequest(stub, key, request)
+}
+
+//执行清除, 删除前记录每个Key的hash. Only the requester or an approver org can execute
+func executePurge(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	err, cfg := loadConfig(stub)
+	if err != nil {
+		return errorResponse(err)
+	}
+	err, org := creatorOrg(stub, cfg)
+	if err != nil {
+		return errorResponse(err)
+	}
+	err, key, request := loadPurgeRequest(stub, args[0])
+	if err != nil {
+		return errorResponse(err)
+	}
+	allowed := org == request.Requester
+	for _, approver := range request.Approvers {
+		if approver == org {
+			allowed = true
+		}
+	}
+	if !allowed {
+		return errorResp(ERR_PERMISSION, key, "Requester", "Org '"+org+"' is neither the requester nor a purge approver")
+	}
+	if request.Status != PURGE_APPROVED {
+		return errorResp(ERR_PERMISSION, key, "Status", "Purge request is "+request.Status+", approval is required")
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(request.KeyPrefix, request.KeysStart)
+	if err != nil {
+		return errorResponse(err)
+	}
+	defer resultsIterator.Close()
+	manifestHash := sha256.New()
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return errorResponse(err)
+		}
+		if len(request.Manifest) == cfg.Limits.PurgeMaxKeys {
+			return errorResp(ERR_VALIDATION, key, "keysStart", fmt.Sprintf("Purge scope has more than %d keys", cfg.Limits.PurgeMaxKeys))
+		}
+		valueHash := sha256.Sum256(queryResponse.Value)
+		item := PurgeManifest{Key: queryResponse.Key, ValueHash: hex.EncodeToString(valueHash[:])}
+		request.Manifest = append(request.Manifest, item)
+		manifestHash.Write([]byte(item.Key))
+		manifestHash.Write([]byte(item.ValueHash))
+		err = stub.DelState(queryResponse.Key)
+		if err != nil {
+			return errorResp(ERR_INTERNAL, queryResponse.Key, "", err.Error())
+		}
+	}
+	request.Status = PURGE_EXECUTED
+	request.ManifestHash = hex.EncodeToString(manifestHash.Sum(nil))
+	request.ExecuteTime = getTxTime(stub)
+	fmt.Println("write data, purge executed " + request.ManifestHash + " for - " + key)
+
+	event := map[string]interface{}{
+		"RequestID":    request.RequestID,
+		"keyPrefix":    request.KeyPrefix,
+		"keysStart":    request.KeysStart,
+		"Count":        len(request.Manifest),
+		"ManifestHash": request.ManifestHash,
+	}
+	e, _ := json.Marshal(event)
+	err = stub.SetEvent(PURGE_EVENT, e)
+	if err != nil {
+		return errorResp(ERR_INTERNAL, key, "", err.Error())
+	}
+	return savePurgeRequest(stub, key, request)
+}
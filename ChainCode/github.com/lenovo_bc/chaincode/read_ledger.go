@@ -1,95 +1,166 @@
-package main
+package chaincode
 
 import (
 	// "github.com/hyperledger/fabric/core/chaincode/lib/cid"
 	// "encoding/pem"
 	// "crypto/x509"
-	"errors"
 	"encoding/json"
 	"bytes"
 	"strconv"
+	"strings"
 	"time"
 	"fmt"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/lenovo_bc/model"
 	pb "github.com/hyperledger/fabric/protos/peer"
 )
 
-func filterByUserRole(valAsbytes []byte, KeyPrefix string, userRole string) (error, []byte) {
-	fmt.Println("filterByUserRole,KeyPrefix=" + KeyPrefix + ",userRole=" + userRole)
+func filterByUserRole(valAsbytes []byte, KeyPrefix string, view viewer) (error, []byte) {
+	fmt.Println("filterByUserRole,KeyPrefix=" + KeyPrefix + ",userRole=" + view.UserRole)
 	if KeyPrefix == SO_KEY {
-		return filterSalesOrder(valAsbytes, userRole);
+		return filterSalesOrder(valAsbytes, view);
 	} else if KeyPrefix == PO_KEY {
-		return filterPurchaseOrder(valAsbytes, userRole);
+		return filterPurchaseOrder(valAsbytes, view);
 	} else {
 		return nil, valAsbytes
 	}
-	return errors.New("Unknown query type '" + KeyPrefix + "'"), nil
+	return newError(ERR_VALIDATION, "", "keyPrefix", "Unknown query type '"+KeyPrefix+"'"), nil
 }
 
-func filterSalesOrder(valAsbytes []byte, userRole string) (error, []byte) {
-	salesOrder := SalesOrder{}
+func filterSalesOrder(valAsbytes []byte, view viewer) (error, []byte) {
+	salesOrder := model.SalesOrder{}
 	err := json.Unmarshal(valAsbytes, &salesOrder)
 	if err != nil {
-		return errors.New(err.Error()), nil
+		return newError(ERR_INTERNAL, "", "", err.Error()), nil
 	}
-	if userRole != "lenovo" {
-		salesOrder.NETPRICE = STAR;
-		salesOrder.NETVALUE = STAR;
+	if !view.Buyer {
+		salesOrder.NETPRICE = view.Star;
+		salesOrder.NETVALUE = view.Star;
 	}
 	b, err := json.Marshal(salesOrder)
 	if err != nil {
-		return errors.New(err.Error()), nil
+		return newError(ERR_INTERNAL, "", "", err.Error()), nil
 	}
 	return nil, b
 }
 
-func filterPurchaseOrder(valAsbytes []byte, userRole string) (error, []byte) {
-	fmt.Println("filterPurchaseOrder,userRole=" + userRole)
-	purchaseOrder := PurchaseOrder{}
+func filterPurchaseOrder(valAsbytes []byte, view viewer) (error, []byte) {
+	fmt.Println("filterPurchaseOrder,userRole=" + view.UserRole)
+	purchaseOrder := model.PurchaseOrder{}
 	err := json.Unmarshal(valAsbytes, &purchaseOrder)
 	if err != nil {
-		return errors.New(err.Error()), nil
+		return newError(ERR_INTERNAL, "", "", err.Error()), nil
 	}
-	if userRole != "lenovo" {
-		purchaseOrder.POItemChgDate = STAR;
+	if !view.Buyer {
+		purchaseOrder.POItemChgDate = view.Star;
 	}
 	b, err := json.Marshal(purchaseOrder)
 	if err != nil {
-		return errors.New(err.Error()), nil
+		return newError(ERR_INTERNAL, "", "", err.Error()), nil
 	}
 	return nil, b
 }
 
-func integrateLedger(stub shim.ChaincodeStubInterface, valAsbytes []byte, KeyPrefix string, userRole string) (error, []byte) {
-	fmt.Println("integrateLedger,KeyPrefix=" + KeyPrefix + ",userRole=" + userRole)
+//Fields hidden from roles other than buyer, as filterSalesOrder and
+//filterPurchaseOrder do
+var maskedFields = map[string][]string{
+	SO_KEY: {"NETPRICE", "NETVALUE"},
+	PO_KEY: {"POItemChgDate"},
+}
+
+//Masks the fields of a record for the viewer, keeping the other fields as
+//they are. Used for the records of rich queries, which may be projections,
+//and of the history.
+func maskRecord(valAsbytes []byte, KeyPrefix string, view viewer) (error, []byte) {
+	fields := maskedFields[KeyPrefix]
+	if view.Buyer || len(fields) == 0 {
+		return nil, valAsbytes
+	}
+	record := map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader(valAsbytes))
+	decoder.UseNumber()
+	err := decoder.Decode(&record)
+	if err != nil {
+		return newError(ERR_INTERNAL, "", "", err.Error()), nil
+	}
+	for _, field := range fields {
+		if _, ok := record[field]; ok {
+			record[field] = view.Star
+		}
+	}
+	b, err := json.Marshal(record)
+	if err != nil {
+		return newError(ERR_INTERNAL, "", "", err.Error()), nil
+	}
+	return nil, b
+}
+
+//Masked field referenced by a rich query, "" if none. Selecting or sorting
+//on a masked field would reveal its value through the matched records.
+func maskedQueryField(query interface{}) string {
+	switch v := query.(type) {
+	case map[string]interface{}:
+		for name, value := range v {
+			if field := maskedFieldName(name); field != "" {
+				return field
+			}
+			if field := maskedQueryField(value); field != "" {
+				return field
+			}
+		}
+	case []interface{}:
+		for _, value := range v {
+			if field := maskedQueryField(value); field != "" {
+				return field
+			}
+		}
+	case string:
+		return maskedFieldName(v)
+	}
+	return ""
+}
+
+func maskedFieldName(name string) string {
+	for _, fields := range maskedFields {
+		for _, field := range fields {
+			if name == field || strings.HasPrefix(name, field+".") {
+				return field
+			}
+		}
+	}
+	return ""
+}
+
+func integrateLedger(stub shim.ChaincodeStubInterface, valAsbytes []byte, KeyPrefix string, view viewer) (error, []byte) {
+	fmt.Println("integrateLedger,KeyPrefix=" + KeyPrefix + ",userRole=" + view.UserRole)
 	if KeyPrefix == SO_KEY {
-		return integrateSalesOrderLedger(stub, valAsbytes, userRole);
+		return integrateSalesOrderLedger(stub, valAsbytes, view);
 	} else if KeyPrefix == PO_KEY {
-		return integratePurchaseOrderLedger(stub, valAsbytes, userRole);
+		return integratePurchaseOrderLedger(stub, valAsbytes, view);
 	} else if KeyPrefix == CPO_KEY {
-		return integrateCustomerPurchaseOrderLedger(stub, valAsbytes, userRole);
+		return integrateCustomerPurchaseOrderLedger(stub, valAsbytes, view);
 	} else if KeyPrefix == SUPPLIER_KEY {
-		return integrateSupplierOrderLedger(stub, valAsbytes, userRole);
+		return integrateSupplierOrderLedger(stub, valAsbytes, view);
 	} else {
 		return nil, valAsbytes
 	}
-	return errors.New("Unknown query type '" + KeyPrefix + "'"), nil
+	return newError(ERR_VALIDATION, "", "keyPrefix", "Unknown query type '"+KeyPrefix+"'"), nil
 }
 
-func integrateSalesOrderLedger(stub shim.ChaincodeStubInterface, valAsbytes []byte, userRole string) (error, []byte) {
+func integrateSalesOrderLedger(stub shim.ChaincodeStubInterface, valAsbytes []byte, view viewer) (error, []byte) {
 
-	salesOrder := SalesOrder{}
+	salesOrder := model.SalesOrder{}
 	err := json.Unmarshal(valAsbytes, &salesOrder)
 	if err != nil {
-		return errors.New(err.Error()), nil
+		return newError(ERR_INTERNAL, "", "", err.Error()), nil
 	}
-	order := POAndSOOrder{}
+	order := model.POAndSOOrder{}
 	order.SONUMBER = salesOrder.SONUMBER
 	order.SOITEM = salesOrder.SOITEM
 	order.PONO = salesOrder.PONO
 	order.POITEM = salesOrder.POITEM
 	var c []byte
-	cPOOrder := ODMPurchaseOrder{}
+	cPOOrder := model.ODMPurchaseOrder{}
 	err, cpoKey := generateKey(stub, CPO_KEY, []string{salesOrder.CPONO})
 	fmt.Println("get CPO object in SO,CPO key:" + cpoKey)
 	if err == nil {
@@ -100,13 +171,13 @@ func integrateSalesOrderLedger(stub shim.ChaincodeStubInterface, valAsbytes []by
 			salesOrder.ODMGRInfos = cPOOrder.ODMGRInfos
 		}
 	}
-	POOrder := PurchaseOrder{}
+	POOrder := model.PurchaseOrder{}
 	err, poKey := generateKey(stub, PO_KEY, []string{salesOrder.PONO, salesOrder.POITEM})
 	fmt.Println("get PO object in SO,PO key:" + poKey)
 	if err == nil {
 		poObjAsbytes, err := stub.GetState(poKey)
 		if err == nil {
-			err, poObjAsbytes = filterByUserRole(poObjAsbytes, PO_KEY, userRole)
+			err, poObjAsbytes = filterByUserRole(poObjAsbytes, PO_KEY, view)
 			err = json.Unmarshal(poObjAsbytes, &POOrder)
 			order.PurchaseOrder = POOrder
 		}
@@ -115,26 +186,26 @@ func integrateSalesOrderLedger(stub shim.ChaincodeStubInterface, valAsbytes []by
 	c, _ = json.Marshal(order)
 	return nil, c
 }
-func integratePurchaseOrderLedger(stub shim.ChaincodeStubInterface, valAsbytes []byte, userRole string) (error, []byte) {
-	purchaseOrder := PurchaseOrder{}
+func integratePurchaseOrderLedger(stub shim.ChaincodeStubInterface, valAsbytes []byte, view viewer) (error, []byte) {
+	purchaseOrder := model.PurchaseOrder{}
 	err := json.Unmarshal(valAsbytes, &purchaseOrder)
 	if err != nil {
-		return errors.New(err.Error()), nil
+		return newError(ERR_INTERNAL, "", "", err.Error()), nil
 	}
 	var c []byte
-	order := POAndSOOrder{}
+	order := model.POAndSOOrder{}
 	order.SONUMBER = purchaseOrder.SONUMBER
 	order.SOITEM = purchaseOrder.SOITEM
 	order.PONO = purchaseOrder.PONO
 	order.POITEM = purchaseOrder.POItemNO
 
-	salesOrder := SalesOrder{}
+	salesOrder := model.SalesOrder{}
 	err, soKey := generateKey(stub, SO_KEY, []string{purchaseOrder.SONUMBER, purchaseOrder.SOITEM})
 	fmt.Println("get SO object in PO,SO key:" + soKey)
 	if err == nil {
 		soObjAsbytes, err := stub.GetState(soKey)
 		if err == nil {
-			err, soObjAsbytes = filterByUserRole(soObjAsbytes, SO_KEY, userRole)
+			err, soObjAsbytes = filterByUserRole(soObjAsbytes, SO_KEY, view)
 			err = json.Unmarshal(soObjAsbytes, &salesOrder)
 			order.SalesOrder = salesOrder
 		}
@@ -143,31 +214,31 @@ func integratePurchaseOrderLedger(stub shim.ChaincodeStubInterface, valAsbytes [
 	c, _ = json.Marshal(order)
 	return nil, c
 }
-func integrateCustomerPurchaseOrderLedger(stub shim.ChaincodeStubInterface, valAsbytes []byte, userRole string) (error, []byte) {
-	cPoOrder := ODMPurchaseOrder{}
+func integrateCustomerPurchaseOrderLedger(stub shim.ChaincodeStubInterface, valAsbytes []byte, view viewer) (error, []byte) {
+	cPoOrder := model.ODMPurchaseOrder{}
 	err := json.Unmarshal(valAsbytes, &cPoOrder)
 	if err != nil {
-		return errors.New(err.Error()), nil
+		return newError(ERR_INTERNAL, "", "", err.Error()), nil
 	}
 	var c []byte
-	soOrder := SalesOrder{}
+	soOrder := model.SalesOrder{}
 	err, soKey := generateKey(stub, SO_KEY, []string{cPoOrder.SONUMBER, cPoOrder.SOITEM})
 	fmt.Println("get SO object in CPO, sokey:" + soKey)
 	if err == nil {
 		soObjAsbytes, err := stub.GetState(soKey)
 		if err == nil {
-			err, soObjAsbytes = filterByUserRole(soObjAsbytes, SO_KEY, userRole)
+			err, soObjAsbytes = filterByUserRole(soObjAsbytes, SO_KEY, view)
 			err = json.Unmarshal(soObjAsbytes, &soOrder)
 			cPoOrder.SalesOrder = soOrder
 		}
 	}
-	poOrder := PurchaseOrder{}
+	poOrder := model.PurchaseOrder{}
 	err, poKey := generateKey(stub, PO_KEY, []string{cPoOrder.PONO, cPoOrder.POITEM})
 	fmt.Println("get PO object in CPO, poKey:" + poKey)
 	if err == nil {
 		poObjAsbytes, err := stub.GetState(poKey)
 		if err == nil {
-			err, poObjAsbytes = filterByUserRole(poObjAsbytes, PO_KEY, userRole)
+			err, poObjAsbytes = filterByUserRole(poObjAsbytes, PO_KEY, view)
 			err = json.Unmarshal(poObjAsbytes, &poOrder)
 			cPoOrder.PurchaseOrder = poOrder
 		}
@@ -175,31 +246,31 @@ func integrateCustomerPurchaseOrderLedger(stub shim.ChaincodeStubInterface, valA
 	c, _ = json.Marshal(cPoOrder)
 	return nil, c
 }
-func integrateSupplierOrderLedger(stub shim.ChaincodeStubInterface, valAsbytes []byte, userRole string) (error, []byte) {
-	supOrder := SupplierOrder{}
+func integrateSupplierOrderLedger(stub shim.ChaincodeStubInterface, valAsbytes []byte, view viewer) (error, []byte) {
+	supOrder := model.SupplierOrder{}
 	err := json.Unmarshal(valAsbytes, &supOrder)
 	if err != nil {
-		return errors.New(err.Error()), nil
+		return newError(ERR_INTERNAL, "", "", err.Error()), nil
 	}
 	var c []byte
 
-	poOrder := PurchaseOrder{}
+	poOrder := model.PurchaseOrder{}
 	err, poKey := generateKey(stub, PO_KEY, []string{supOrder.PONumber, supOrder.POItem})
 	fmt.Println("get PO object in Supplier, poKey:" + poKey)
 	if err == nil {
 		poObjAsbytes, err := stub.GetState(poKey)
 		if err == nil {
-			err, poObjAsbytes = filterByUserRole(poObjAsbytes, PO_KEY, userRole)
+			err, poObjAsbytes = filterByUserRole(poObjAsbytes, PO_KEY, view)
 			err = json.Unmarshal(poObjAsbytes, &poOrder)
 			supOrder.PurchaseOrder = poOrder
 
-			soOrder := SalesOrder{}
+			soOrder := model.SalesOrder{}
 			err, soKey := generateKey(stub, SO_KEY, []string{poOrder.SONUMBER, poOrder.SOITEM})
 			fmt.Println("get SO object in Supplier, sokey:" + soKey)
 			if err == nil {
 				soObjAsbytes, err := stub.GetState(soKey)
 				if err == nil {
-					err, soObjAsbytes = filterByUserRole(soObjAsbytes, SO_KEY, userRole)
+					err, soObjAsbytes = filterByUserRole(soObjAsbytes, SO_KEY, view)
 					err = json.Unmarshal(soObjAsbytes, &soOrder)
 					supOrder.SalesOrder = soOrder
 				}
@@ -215,25 +286,32 @@ func queryById(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 
 	err, keyStart, _ := generateQueryKey(stub, args)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
 	jsonStr := args[1]
-	param := QueryParam{}
+	param := model.QueryParam{}
 	json.Unmarshal([]byte(jsonStr), &param)
 	keyPrefix := param.KeyPrefix
-	userRole := args[0]
+	err, view := viewerOf(stub, args[0])
+	if err != nil {
+		return errorResponse(err)
+	}
 
 	valAsbytes, err := stub.GetState(keyStart)
 	if err != nil {
-		jsonResp := "{\"Error\":\"Failed to get state for " + keyStart + "\"}"
-		return shim.Error(jsonResp)
+		return errorResp(ERR_INTERNAL, keyStart, "", "Failed to get state for "+keyStart)
+	}
+	if valAsbytes == nil {
+		return errorResp(ERR_NOT_FOUND, keyStart, "", "Failed to get state for "+keyStart)
+	}
+	if !param.IncludeDeleted && isDeleted(valAsbytes) {
+		return errorResp(ERR_NOT_FOUND, keyStart, "", "Record is deleted "+keyStart)
 	}
 
-	err, valAsbytes = filterByUserRole(valAsbytes, keyPrefix, userRole)
+	err, valAsbytes = filterByUserRole(valAsbytes, keyPrefix, view)
 	if err != nil {
-		jsonResp := "{\"Error\":\"Failed to get state for " + keyStart + "\"}"
-		return shim.Error(jsonResp)
+		return errorResp(ERR_INTERNAL, keyStart, "", "Failed to get state for "+keyStart)
 	}
 	fmt.Println("- end read")
 	return shim.Success(valAsbytes)
@@ -243,24 +321,27 @@ func getQueryResultById(stub shim.ChaincodeStubInterface, queryKey string) (erro
 	valAsbytes, err := stub.GetState(queryKey)
 	fmt.Println("query data, key - " + queryKey)
 	if err != nil {
-		return errors.New("\"Error\":\"Failed to get state for " + queryKey + "\""), nil
+		return newError(ERR_INTERNAL, queryKey, "", "Failed to get state for "+queryKey), nil
+	}
+	if valAsbytes == nil {
+		return newError(ERR_NOT_FOUND, queryKey, "", "Failed to get state for "+queryKey), nil
 	}
 	fmt.Println("query data, data - " + string(valAsbytes))
 	return nil, valAsbytes
 }
 
 func queryByIds(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	if len(args) != 2 {
-		return shim.Error("Incorrect number of arguments.")
-	}
-
-	var params []QueryParam
+	var params []model.QueryParam
 	jsonStr := args[1]
-	userRole := args[0]
 	err := json.Unmarshal([]byte(jsonStr), &params)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResp(ERR_VALIDATION, "", "", err.Error())
+	}
+	err, cfg := loadConfig(stub)
+	if err != nil {
+		return errorResponse(err)
 	}
+	view := cfg.viewer(args[0])
 
 	var buffer bytes.Buffer
 	buffer.WriteString("[")
@@ -272,11 +353,14 @@ func queryByIds(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 		keysEnd := param.KeysEnd
 		err, keyStart, _ := generateQueryKey2(stub, keyPrefix, keysStart, keysEnd)
 		if err != nil {
-			return shim.Error(err.Error())
+			return errorResponse(err)
 		}
 		err, valAsbytes := getQueryResultById(stub, keyStart)
 		if err != nil {
-			return shim.Error(err.Error())
+			return errorResponse(err)
+		}
+		if !param.IncludeDeleted && isDeleted(valAsbytes) {
+			continue
 		}
 		if bArrayMemberAlreadyWritten == true {
 			buffer.WriteString(",")
@@ -284,14 +368,16 @@ func queryByIds(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 		fmt.Println("query data, before filterByUserRole ")
 		// buffer.WriteString("\"Record\":")
 		// Record is a JSON object, so we write as-is
-		err, valAsbytes = filterByUserRole(valAsbytes, keyPrefix, userRole)
+		err, valAsbytes = filterByUserRole(valAsbytes, keyPrefix, view)
 		if err != nil {
-			return shim.Error(err.Error())
+			return errorResponse(errorWithKey(err, keyStart))
 		}
-		fmt.Println("query data, before integrateLedger ")
-		err, valAsbytes = integrateLedger(stub, valAsbytes, keyPrefix, userRole)
-		if err != nil {
-			return shim.Error(err.Error())
+		if !cfg.Features[FEATURE_COMPAT] {
+			fmt.Println("query data, before integrateLedger ")
+			err, valAsbytes = integrateLedger(stub, valAsbytes, keyPrefix, view)
+			if err != nil {
+				return errorResponse(errorWithKey(err, keyStart))
+			}
 		}
 		fmt.Println("query data, after integrateLedger " + string(valAsbytes))
 		buffer.WriteString(string(valAsbytes))
@@ -307,12 +393,17 @@ func queryHistoryById(stub shim.ChaincodeStubInterface, args []string) pb.Respon
 
 	err, keyStart, _ := generateQueryKey(stub, args)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
+	}
+	err, view := viewerOf(stub, args[0])
+	if err != nil {
+		return errorResponse(err)
 	}
+	keyPrefix := keyPrefixOf(keyStart)
 
 	resultsIterator, err := stub.GetHistoryForKey(keyStart)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 	defer resultsIterator.Close()
 
@@ -324,7 +415,7 @@ func queryHistoryById(stub shim.ChaincodeStubInterface, args []string) pb.Respon
 	for resultsIterator.HasNext() {
 		response, err := resultsIterator.Next()
 		if err != nil {
-			return shim.Error(err.Error())
+			return errorResponse(err)
 		}
 
 		if bArrayMemberAlreadyWritten == true {
@@ -341,7 +432,11 @@ func queryHistoryById(stub shim.ChaincodeStubInterface, args []string) pb.Respon
 		if response.IsDelete {
 			buffer.WriteString("null")
 		} else {
-			buffer.WriteString(string(response.Value))
+			err, value := maskRecord(response.Value, keyPrefix, view)
+			if err != nil {
+				return errorResponse(errorWithKey(err, keyStart))
+			}
+			buffer.WriteString(string(value))
 		}
 		buffer.WriteString(", \"Timestamp\":")
 		buffer.WriteString("\"")
@@ -368,18 +463,21 @@ func queryByIdRange(stub shim.ChaincodeStubInterface, args []string) pb.Response
 	fmt.Println("starting read")
 	err, keyStart, keyEnd := generateQueryKey(stub, args)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
 	jsonStr := args[1]
-	param := QueryParam{}
+	param := model.QueryParam{}
 	json.Unmarshal([]byte(jsonStr), &param)
 	keyPrefix := param.KeyPrefix
-	userRole := args[0]
+	err, view := viewerOf(stub, args[0])
+	if err != nil {
+		return errorResponse(err)
+	}
 
 	resultsIterator, err := stub.GetStateByRange(keyStart, keyEnd)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 	defer resultsIterator.Close()
 
@@ -390,7 +488,14 @@ func queryByIdRange(stub shim.ChaincodeStubInterface, args []string) pb.Response
 	for resultsIterator.HasNext() {
 		queryResponse, err := resultsIterator.Next()
 		if err != nil {
-			return shim.Error(err.Error())
+			return errorResponse(err)
+		}
+		//only records of the prefix, masked by its rules
+		if keyPrefixOf(queryResponse.Key) != keyPrefix {
+			continue
+		}
+		if !param.IncludeDeleted && isDeleted(queryResponse.Value) {
+			continue
 		}
 		// Add a comma before array members, suppress it for the first array member
 		if bArrayMemberAlreadyWritten == true {
@@ -403,8 +508,14 @@ func queryByIdRange(stub shim.ChaincodeStubInterface, args []string) pb.Response
 
 		buffer.WriteString(", \"Record\":")
 		// Record is a JSON object, so we write as-is
-		err, valAsbytes := filterByUserRole(queryResponse.Value, keyPrefix, userRole)
-		err, valAsbytes = integrateLedger(stub, valAsbytes, keyPrefix, userRole)
+		err, valAsbytes := filterByUserRole(queryResponse.Value, keyPrefix, view)
+		if err != nil {
+			return errorResponse(errorWithKey(err, queryResponse.Key))
+		}
+		err, valAsbytes = integrateLedger(stub, valAsbytes, keyPrefix, view)
+		if err != nil {
+			return errorResponse(errorWithKey(err, queryResponse.Key))
+		}
 		buffer.WriteString(string(valAsbytes))
 		buffer.WriteString("}")
 		bArrayMemberAlreadyWritten = true
@@ -419,30 +530,32 @@ func queryByIdRange(stub shim.ChaincodeStubInterface, args []string) pb.Response
 // query by compositeKey
 func queryByPartialCompositeKey(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 
-	if len(args) != 2 {
-		return shim.Error("Incorrect number of arguments.")
-	}
-
 	jsonStr := args[1]
-	param := QueryParam{}
+	param := model.QueryParam{}
 	err := json.Unmarshal([]byte(jsonStr), &param)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResp(ERR_VALIDATION, "", "", err.Error())
 	}
 
 	if param.KeyPrefix == "" {
-		return shim.Error("Invalid object name")
+		return errorResp(ERR_VALIDATION, "", "keyPrefix", "Invalid object name")
+	}
+	if !isRecordPrefix(param.KeyPrefix) {
+		return errorResp(ERR_VALIDATION, "", "keyPrefix", "Unknown query type '"+param.KeyPrefix+"'")
 	}
 
 	if len(param.KeysStart) == 0 {
-		return shim.Error("Query keys are required")
+		return errorResp(ERR_VALIDATION, "", "keysStart", "Query keys are required")
 	}
 
-	userRole := args[0]
+	err, view := viewerOf(stub, args[0])
+	if err != nil {
+		return errorResponse(err)
+	}
 
 	resultsIterator, err := stub.GetStateByPartialCompositeKey(param.KeyPrefix, param.KeysStart)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 	defer resultsIterator.Close()
 
@@ -453,7 +566,10 @@ func queryByPartialCompositeKey(stub shim.ChaincodeStubInterface, args []string)
 	for resultsIterator.HasNext() {
 		queryResponse, err := resultsIterator.Next()
 		if err != nil {
-			return shim.Error(err.Error())
+			return errorResponse(err)
+		}
+		if !param.IncludeDeleted && isDeleted(queryResponse.Value) {
+			continue
 		}
 		// Add a comma before array members, suppress it for the first array member
 		if bArrayMemberAlreadyWritten == true {
@@ -466,8 +582,14 @@ func queryByPartialCompositeKey(stub shim.ChaincodeStubInterface, args []string)
 
 		buffer.WriteString(", \"Record\":")
 		// Record is a JSON object, so we write as-is
-		err, valAsbytes := filterByUserRole(queryResponse.Value, param.KeyPrefix, userRole)
-		err, valAsbytes = integrateLedger(stub, valAsbytes, param.KeyPrefix, userRole)
+		err, valAsbytes := filterByUserRole(queryResponse.Value, param.KeyPrefix, view)
+		if err != nil {
+			return errorResponse(errorWithKey(err, queryResponse.Key))
+		}
+		err, valAsbytes = integrateLedger(stub, valAsbytes, param.KeyPrefix, view)
+		if err != nil {
+			return errorResponse(errorWithKey(err, queryResponse.Key))
+		}
 		buffer.WriteString(string(valAsbytes))
 		buffer.WriteString("}")
 		bArrayMemberAlreadyWritten = true
@@ -480,16 +602,26 @@ func queryByPartialCompositeKey(stub shim.ChaincodeStubInterface, args []string)
 // get query with mango query -- support CouchDB
 func getQueryResult(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 
-	if len(args) != 2 {
-		return shim.Error("Incorrect number of arguments.")
-	}
-
 	queryString := args[1]
-	// userRole:= args[0]
+	includeDeleted := len(args) == 3 && args[2] == "true"
+	err, view := viewerOf(stub, args[0])
+	if err != nil {
+		return errorResponse(err)
+	}
+	if !view.Buyer {
+		var query interface{}
+		err := json.Unmarshal([]byte(queryString), &query)
+		if err != nil {
+			return errorResp(ERR_VALIDATION, "", "", err.Error())
+		}
+		if field := maskedQueryField(query); field != "" {
+			return errorResp(ERR_VALIDATION, "", field, "Field "+field+" is not available to role "+view.UserRole)
+		}
+	}
 
 	resultsIterator, err := stub.GetQueryResult(queryString)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 	defer resultsIterator.Close()
 
@@ -500,7 +632,10 @@ func getQueryResult(stub shim.ChaincodeStubInterface, args []string) pb.Response
 	for resultsIterator.HasNext() {
 		queryResponse, err := resultsIterator.Next()
 		if err != nil {
-			return shim.Error(err.Error())
+			return errorResponse(err)
+		}
+		if !isRecordPrefix(keyPrefixOf(queryResponse.Key)) || (!includeDeleted && isDeleted(queryResponse.Value)) {
+			continue
 		}
 		// Add a comma before array members, suppress it for the first array member
 		if bArrayMemberAlreadyWritten == true {
@@ -513,7 +648,11 @@ func getQueryResult(stub shim.ChaincodeStubInterface, args []string) pb.Response
 
 		buffer.WriteString(", \"Record\":")
 		// Record is a JSON object, so we write as-is
-		buffer.WriteString(string(queryResponse.Value))
+		err, value := maskRecord(queryResponse.Value, keyPrefixOf(queryResponse.Key), view)
+		if err != nil {
+			return errorResponse(errorWithKey(err, queryResponse.Key))
+		}
+		buffer.WriteString(string(value))
 		buffer.WriteString("}")
 		bArrayMemberAlreadyWritten = true
 	}
@@ -0,0 +1,176 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.com/lenovo_bc/schema"
+	"strings"
+)
+
+//Chaincode function, args without the function name
+type handler func(stub shim.ChaincodeStubInterface, args []string) pb.Response
+
+//Handlers of the functions described in chaincodeAPI
+var handlers = map[string]handler{
+	"crSalesOrderInfo":           crSalesOrderInfo,
+	"crCPurchaseOrderInfo":       crCPurchaseOrderInfo,
+	"crPurchaseOrderInfo":        crPurchaseOrderInfo,
+	"crSupplierOrderInfo":        crSupplierOrderInfo,
+	"queryById":                  queryById,
+	"queryHistoryById":           queryHistoryById,
+	"queryByIdRange":             queryByIdRange,
+	"queryByPartialCompositeKey": queryByPartialCompositeKey,
+	"getQueryResult":             getQueryResult,
+	"queryByIds":                 queryByIds,
+	"removeFromStateByKey":       removeFromStateByKey,
+	"setIntegrityRules":          setIntegrityRules,
+	"queryIntegrityRules":        queryIntegrityRules,
+	"auditConsistency":           auditConsistency,
+	"repairConsistency":          repairConsistency,
+	"setPurgeApprovers":          setPurgeApprovers,
+	"requestPurge":               requestPurge,
+	"approvePurge":               approvePurge,
+	"executePurge":               executePurge,
+	"crIDocInfo":                 crIDocInfo,
+	"setIDocMapping":             setIDocMapping,
+	"queryIDocMapping":           queryIDocMapping,
+	"crX12Info":                  crX12Info,
+	"queryEPCISEvents":           queryEPCISEvents,
+	"queryUBLInvoice":            queryUBLInvoice,
+	"setWebhookSubscription":     setWebhookSubscription,
+	"removeWebhookSubscription":  removeWebhookSubscription,
+	"queryWebhookSubscriptions":  queryWebhookSubscriptions,
+	"querySchemaMigration":       querySchemaMigration,
+	"migrateSchema":              migrateSchema,
+	"getConfig":                  getConfig,
+	"setConfig":                  setConfig,
+	"describe":                   describe,
+}
+
+//Registered function: declaration from chaincodeAPI and handler
+type registeredFunction struct {
+	schema.Function
+	handler handler
+}
+
+//Functions callable by Invoke, by name
+var registry = newRegistry()
+
+func newRegistry() map[string]*registeredFunction {
+	functions := map[string]*registeredFunction{}
+	for _, f := range chaincodeAPI(schema.NewGenerator("", nil)).Functions {
+		if h, ok := handlers[f.Name]; ok {
+			functions[f.Name] = &registeredFunction{Function: f, handler: h}
+		}
+	}
+	return functions
+}
+
+//Checks the arguments against the declaration and cfg before the handler
+//runs: the feature of the function, argument count, JSON arguments and, for
+//functions with Roles, the role of the creator's org. The userRole argument
+//is passed by the client and only selects the masking of queries.
+func (f *registeredFunction) validate(stub shim.ChaincodeStubInterface, cfg Config, args []string) error {
+	err := cfg.checkFeature(f.Name)
+	if err != nil {
+		return err
+	}
+	required := 0
+	names := []string{}
+	for _, arg := range f.Args {
+		if !arg.Optional {
+			required++
+			names = append(names, arg.Name)
+		} else {
+			names = append(names, "optional "+arg.Name)
+		}
+	}
+	if len(args) < required || len(args) > len(f.Args) {
+		message := "Incorrect number of arguments. Expecting no arguments"
+		if len(names) > 0 {
+			message = "Incorrect number of arguments. Expecting " + strings.Join(names, ", ")
+		}
+		return newError(ERR_VALIDATION, "", "", message)
+	}
+	for i, arg := range args {
+		declared := f.Args[i]
+		if declared.Schema.ContentMediaType == "application/json" {
+			var raw json.RawMessage
+			err := json.Unmarshal([]byte(arg), &raw)
+			if err != nil {
+				return newError(ERR_VALIDATION, "", declared.Name, err.Error())
+			}
+		}
+	}
+	if len(f.Roles) > 0 {
+		err, org := creatorOrg(stub, cfg)
+		if err != nil {
+			return err
+		}
+		if !contains(f.Roles, cfg.Roles[org]) {
+			return newError(ERR_PERMISSION, "", "", "Org '"+org+"' can't call "+f.Name)
+		}
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+//Argument of a function in the describe response
+type ArgInfo struct {
+	Name        string `json:"Name"`
+	Description string `json:"Description"`
+	Optional    bool   `json:"Optional"` //Trailing arguments only
+	JSON        bool   `json:"JSON"`     //The string holds a JSON document
+}
+
+//Function in the describe response, docs/openapi.json has the full schemas
+type FunctionInfo struct {
+	Name     string    `json:"Name"`
+	Summary  string    `json:"Summary"`
+	Query    bool      `json:"Query"` //Read only, false for write functions
+	Args     []ArgInfo `json:"Args"`
+	Roles    []string  `json:"Roles"`    //Orgs allowed to call it by the config, any org if empty
+	TRANSDOC []string  `json:"TRANSDOC"` //TRANSDOC values of the records of a write function
+}
+
+//Functions of the chaincode in chaincodeAPI order, for clients to discover
+//what the deployed version supports. Functions of disabled features are left
+//out.
+func describe(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	err, cfg := loadConfig(stub)
+	if err != nil {
+		return errorResponse(err)
+	}
+	functions := []FunctionInfo{}
+	for _, f := range chaincodeAPI(schema.NewGenerator("", nil)).Functions {
+		if cfg.checkFeature(f.Name) != nil {
+			continue
+		}
+		info := FunctionInfo{Name: f.Name, Summary: f.Summary, Query: f.Query, Args: []ArgInfo{}, Roles: []string{}, TRANSDOC: []string{}}
+		if len(f.Roles) > 0 {
+			info.Roles = cfg.userRoles(f.Roles)
+		}
+		for _, arg := range f.Args {
+			info.Args = append(info.Args, ArgInfo{Name: arg.Name, Description: arg.Schema.Description,
+				Optional: arg.Optional, JSON: arg.Schema.ContentMediaType == "application/json"})
+		}
+		for _, variant := range f.TRANSDOC {
+			info.TRANSDOC = append(info.TRANSDOC, variant.TRANSDOC)
+		}
+		functions = append(functions, info)
+	}
+	b, err := json.Marshal(functions)
+	if err != nil {
+		return errorResp(ERR_INTERNAL, "", "", err.Error())
+	}
+	return shim.Success(b)
+}
@@ -0,0 +1,77 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/lenovo_bc/model"
+	"github.com/lenovo_bc/ubl"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+//UBL 2.1 Invoice/CreditNote of a billing document: args[0] userRole, args[1] BILLINGNO, args[2] SONUMBER (optional, narrows the scan).
+//The scan stops at Limits.AuditMaxLimit sales orders, larger ledgers need the SONUMBER
+func queryUBLInvoice(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	billingNo := args[1]
+	if billingNo == "" {
+		return errorResp(ERR_VALIDATION, "", "BILLINGNO", "Billing no is required")
+	}
+	keys := []string{}
+	if len(args) == 3 && args[2] != "" {
+		keys = append(keys, args[2])
+	}
+
+	err, cfg := loadConfig(stub)
+	if err != nil {
+		return errorResponse(err)
+	}
+	err, view := viewerOf(stub, args[0])
+	if err != nil {
+		return errorResponse(err)
+	}
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(SO_KEY, keys)
+	if err != nil {
+		return errorResponse(err)
+	}
+	defer resultsIterator.Close()
+
+	orders := []model.SalesOrder{}
+	scanned := 0
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return errorResponse(err)
+		}
+		if scanned == cfg.Limits.AuditMaxLimit {
+			return errorResp(ERR_VALIDATION, "", "SONUMBER", fmt.Sprintf("More than %d sales orders to scan, SONUMBER is required", cfg.Limits.AuditMaxLimit))
+		}
+		scanned++
+		if isDeleted(queryResponse.Value) {
+			continue
+		}
+		err, valAsbytes := filterByUserRole(queryResponse.Value, SO_KEY, view)
+		if err != nil {
+			return errorResponse(errorWithKey(err, queryResponse.Key))
+		}
+		salesOrder := model.SalesOrder{}
+		err = json.Unmarshal(valAsbytes, &salesOrder)
+		if err != nil {
+			return errorResp(ERR_INTERNAL, queryResponse.Key, "", err.Error())
+		}
+		for _, billing := range salesOrder.BILLINFOS {
+			if billing.BILLINGNO == billingNo {
+				orders = append(orders, salesOrder)
+				break
+			}
+		}
+	}
+	if len(orders) == 0 {
+		return errorResp(ERR_NOT_FOUND, "", "BILLINGNO", "Billing document "+billingNo+" not found")
+	}
+
+	err, b := ubl.FromBilling(orders, billingNo).Marshal()
+	if err != nil {
+		return errorResp(ERR_INTERNAL, "", "", err.Error())
+	}
+	return shim.Success(b)
+}
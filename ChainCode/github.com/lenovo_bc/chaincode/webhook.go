@@ -0,0 +1,218 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/lenovo_bc/model"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"net/url"
+)
+
+//Fields a subscription can filter on, per entity. They are copied to the
+//DocumentRef of the POSTED event, see addDocument.
+var webhookFilterFields = map[string][]string{
+	SO_KEY:       {"CPONO", "VENDORNO", "SOLDTO", "SHIPTO"},
+	PO_KEY:       {"VendorNO", "Plant", "SONUMBER"},
+	CPO_KEY:      {"CPONO"},
+	SUPPLIER_KEY: {"VendorNO", "PONumber"},
+}
+
+func validateWebhookSubscription(sub model.WebhookSubscription, limits ConfigLimits) error {
+	fields, ok := webhookFilterFields[sub.Entity]
+	if !ok {
+		return newError(ERR_VALIDATION, "", "Entity", "Entity must be one of SO, PO, CPO, SUP")
+	}
+	found := false
+	for _, field := range fields {
+		if field == sub.FilterField {
+			found = true
+		}
+	}
+	if !found {
+		return newError(ERR_VALIDATION, "", "FilterField", fmt.Sprintf("%s can be filtered by %v", sub.Entity, fields))
+	}
+	if sub.FilterValue == "" {
+		return newError(ERR_VALIDATION, "", "FilterValue", "FilterValue is required")
+	}
+	u, err := url.Parse(sub.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return newError(ERR_VALIDATION, "", "URL", "URL must be an absolute http(s) URL")
+	}
+	if len(sub.Secret) < limits.WebhookSecretMinLen {
+		return newError(ERR_VALIDATION, "", "Secret", fmt.Sprintf("Secret must have at least %d characters", limits.WebhookSecretMinLen))
+	}
+	return nil
+}
+
+func loadWebhookSubscription(stub shim.ChaincodeStubInterface, partner string, id string) (error, string, *model.WebhookSubscription) {
+	err, key := generateKey(stub, WEBHOOK_KEY, []string{partner, id})
+	if err != nil {
+		return err, key, nil
+	}
+	valAsbytes, err := stub.GetState(key)
+	if err != nil {
+		return newError(ERR_INTERNAL, key, "", err.Error()), key, nil
+	}
+	if valAsbytes == nil {
+		return nil, key, nil
+	}
+	sub := model.WebhookSubscription{}
+	err = json.Unmarshal(valAsbytes, &sub)
+	if err != nil {
+		return newError(ERR_INTERNAL, key, "", err.Error()), key, nil
+	}
+	return nil, key, &sub
+}
+
+//Subscriptions of a partner other than the buyer may only filter on the
+//vendor no of the documents, with one of the vendor nos of the partner in
+//the config. Other fields such as CPONO don't tell whose document it is.
+func checkWebhookOwner(sub model.WebhookSubscription, cfg Config) error {
+	if cfg.Roles[sub.Partner] == ROLE_BUYER {
+		return nil
+	}
+	if sub.FilterField != "VENDORNO" && sub.FilterField != "VendorNO" {
+		return newError(ERR_PERMISSION, "", "FilterField", "Partner "+sub.Partner+" can only filter on its vendor no")
+	}
+	if !contains(cfg.VendorNos[sub.Partner], sub.FilterValue) {
+		return newError(ERR_PERMISSION, "", "FilterValue", "Vendor no '"+sub.FilterValue+"' isn't one of partner "+sub.Partner)
+	}
+	return nil
+}
+
+//创建，修改webhook订阅  args: subscription json, the partner is the org of the creator
+//ID empty creates a subscription, Secret empty keeps the old secret.
+func setWebhookSubscription(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	sub := model.WebhookSubscription{}
+	err := json.Unmarshal([]byte(args[0]), &sub)
+	if err != nil {
+		return errorResp(ERR_VALIDATION, "", "", err.Error())
+	}
+	err, cfg := loadConfig(stub)
+	if err != nil {
+		return errorResponse(err)
+	}
+	err, sub.Partner = creatorOrg(stub, cfg)
+	if err != nil {
+		return errorResponse(err)
+	}
+	secretChanged := true
+	if sub.ID == "" {
+		sub.ID = stub.GetTxID()
+	} else {
+		err, key, old := loadWebhookSubscription(stub, sub.Partner, sub.ID)
+		if err != nil {
+			return errorResponse(err)
+		}
+		if old == nil {
+			return errorResp(ERR_NOT_FOUND, key, "ID", "Webhook subscription doesn't exist for partner "+sub.Partner)
+		}
+		if sub.Secret == "" {
+			sub.Secret = old.Secret
+		}
+		secretChanged = sub.Secret != old.Secret
+	}
+	err, key := generateKey(stub, WEBHOOK_KEY, []string{sub.Partner, sub.ID})
+	if err != nil {
+		return errorResponse(err)
+	}
+	err = validateWebhookSubscription(sub, cfg.Limits)
+	if err == nil {
+		err = checkWebhookOwner(sub, cfg)
+	}
+	if err != nil {
+		return errorResponse(errorWithKey(err, key))
+	}
+	sub.UpdateTime = getTxTime(stub)
+	sub.Removed = false
+	b, _ := json.Marshal(sub)
+	err = stub.PutState(key, b)
+	if err != nil {
+		return errorResp(ERR_INTERNAL, key, "", err.Error())
+	}
+	//事件对所有组织可见, 不带secret
+	changed := sub
+	changed.Secret, changed.SecretChanged = "", secretChanged
+	event := postingOf(stub, "")
+	event.Subscriptions = append(event.Subscriptions, changed)
+	sub.Secret = cfg.Star
+	b, _ = json.Marshal(sub)
+	return shim.Success(b)
+}
+
+//删除webhook订阅  args: subscription ID, the partner is the org of the creator
+func removeWebhookSubscription(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	err, cfg := loadConfig(stub)
+	if err != nil {
+		return errorResponse(err)
+	}
+	err, partner := creatorOrg(stub, cfg)
+	if err != nil {
+		return errorResponse(err)
+	}
+	err, key, sub := loadWebhookSubscription(stub, partner, args[0])
+	if err != nil {
+		return errorResponse(err)
+	}
+	if sub == nil {
+		return errorResp(ERR_NOT_FOUND, key, "ID", "Webhook subscription doesn't exist for partner "+partner)
+	}
+	err = stub.DelState(key)
+	if err != nil {
+		return errorResp(ERR_INTERNAL, key, "", err.Error())
+	}
+	sub.Secret, sub.Removed, sub.UpdateTime = "", true, getTxTime(stub)
+	event := postingOf(stub, "")
+	event.Subscriptions = append(event.Subscriptions, *sub)
+	b, _ := json.Marshal(sub)
+	return shim.Success(b)
+}
+
+//查询webhook订阅  args: partner org (optional, buyer only)
+//Partners get their own subscriptions with masked secrets. The buyer, which
+//runs the event listener, gets those of every partner or of the given one
+//with their secrets.
+func queryWebhookSubscriptions(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	err, cfg := loadConfig(stub)
+	if err != nil {
+		return errorResponse(err)
+	}
+	err, org := creatorOrg(stub, cfg)
+	if err != nil {
+		return errorResponse(err)
+	}
+	buyer := cfg.Roles[org] == ROLE_BUYER
+	keys := []string{}
+	if len(args) == 1 && args[0] != "" {
+		if !buyer && args[0] != org {
+			return errorResp(ERR_PERMISSION, "", "Partner", "Org "+org+" can't query the subscriptions of partner "+args[0])
+		}
+		keys = append(keys, args[0])
+	} else if !buyer {
+		keys = append(keys, org)
+	}
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(WEBHOOK_KEY, keys)
+	if err != nil {
+		return errorResp(ERR_INTERNAL, "", "", err.Error())
+	}
+	defer resultsIterator.Close()
+	subs := []model.WebhookSubscription{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return errorResp(ERR_INTERNAL, "", "", err.Error())
+		}
+		sub := model.WebhookSubscription{}
+		err = json.Unmarshal(queryResponse.Value, &sub)
+		if err != nil {
+			return errorResp(ERR_INTERNAL, queryResponse.Key, "", err.Error())
+		}
+		if !buyer {
+			sub.Secret = cfg.Star
+		}
+		subs = append(subs, sub)
+	}
+	b, _ := json.Marshal(subs)
+	return shim.Success(b)
+}
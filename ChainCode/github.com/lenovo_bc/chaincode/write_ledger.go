@@ -0,0 +1,676 @@
+package chaincode
+
+import (
+	// "bytes"
+	"fmt"
+	// "encoding/pem"
+	// "crypto/x509"
+	"encoding/json"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/lenovo_bc/edifact"
+	"github.com/lenovo_bc/model"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// update PO
+func updatePurchaseOrderBySupplier(stub shim.ChaincodeStubInterface, valAsbytes []byte) (error, string, []byte) {
+	supOrder := model.SupplierOrder{}
+	err := json.Unmarshal(valAsbytes, &supOrder)
+	if err != nil {
+		return newError(ERR_VALIDATION, "", "", err.Error()), "", valAsbytes
+	}
+	err, key := generateKey(stub, PO_KEY, []string{supOrder.PONumber, supOrder.POItem})
+	if err != nil {
+		return err, "", valAsbytes
+	}
+	fmt.Println("write data,SUP - PO for - " + key)
+	//business control
+	//get SO object from ledger
+	poAsbytes, err := stub.GetState(key)
+	var b []byte
+	if err == nil && poAsbytes != nil {
+		var oldPoObj = model.PurchaseOrder{}
+		err = json.Unmarshal(poAsbytes, &oldPoObj)
+		if err != nil {
+			return newError(ERR_INTERNAL, key, "", err.Error()), "", valAsbytes
+		}
+		exist := false
+		for i := range oldPoObj.SupplierOrders {
+			order := &oldPoObj.SupplierOrders[i]
+			if order.ASNNumber == supOrder.ASNNumber && order.VendorNO == supOrder.VendorNO {
+				exist = true
+				fmt.Println("update data,SUP - PO for - " + key)
+				order.ShippedQty = supOrder.ShippedQty
+				order.ASNDate = supOrder.ASNDate
+				order.PromisedDate = supOrder.PromisedDate
+				order.CarrierID = supOrder.CarrierID
+				order.CarrierTrackID = supOrder.CarrierTrackID
+				order.TransporatationMode = supOrder.TransporatationMode
+				order.CountryOfOrigin = supOrder.CountryOfOrigin
+				order.PackingList = supOrder.PackingList
+			}
+		}
+		if !exist {
+			fmt.Println("insert data,SUP - PO for - " + key)
+			oldPoObj.SupplierOrders = append(oldPoObj.SupplierOrders, supOrder)
+		}
+		b, _ = json.Marshal(oldPoObj)
+		return nil, key, b
+	} else if err != nil {
+		return newError(ERR_INTERNAL, key, "", err.Error()), "", nil
+	} else {
+		return newError(ERR_NOT_FOUND, key, "PONumber", "PO data doesn't exist!"), "", nil
+	}
+
+}
+
+//Links the CPO of an SO to it, creating the CPO when it doesn't exist. An
+//existing CPO keeps its GR and billing infos and the SO it was linked to first,
+//like cascadeSalesOrderDelete only changes the CPO of that SO.
+func linkCPurchaseOrder(stub shim.ChaincodeStubInterface, salesOrder model.SalesOrder) error {
+	if salesOrder.CPONO == "" {
+		return nil
+	}
+	err, cpoKey := generateKey(stub, CPO_KEY, []string{salesOrder.CPONO})
+	if err != nil {
+		return err
+	}
+	cpoObjAsbytes, err := stub.GetState(cpoKey)
+	if err != nil {
+		return newError(ERR_INTERNAL, cpoKey, "", err.Error())
+	}
+	cPOOrder := model.ODMPurchaseOrder{}
+	if cpoObjAsbytes != nil {
+		err = json.Unmarshal(cpoObjAsbytes, &cPOOrder)
+		if err != nil {
+			return newError(ERR_INTERNAL, cpoKey, "", err.Error())
+		}
+		if cPOOrder.SONUMBER != "" || cPOOrder.SOITEM != "" {
+			return nil
+		}
+	} else {
+		cPOOrder.CPONO = salesOrder.CPONO
+	}
+	fmt.Println("write data, SO-CPO for - " + cpoKey)
+	cPOOrder.SONUMBER = salesOrder.SONUMBER
+	cPOOrder.SOITEM = salesOrder.SOITEM
+	if salesOrder.DELFLAG == SO_DELETED {
+		cPOOrder.DELFLAG = DOC_DELETED
+	}
+	c, _ := json.Marshal(cPOOrder)
+	return stub.PutState(cpoKey, c)
+}
+
+//创建，修改SO信息
+func crSalesOrderInfo(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	fmt.Println(" update SO crSalesOrderInfo  ")
+	fmt.Println("write data, crSalesOrderInfo for - ", args)
+	jsonStr := args[0]
+	vendorNo := args[1]
+	fmt.Println("write data, SO data - "+vendorNo, jsonStr)
+
+	var salesOrders [] model.SalesOrder
+	err := json.Unmarshal([]byte(jsonStr), &salesOrders)
+	if err != nil {
+		return errorResp(ERR_VALIDATION, "", "", err.Error())
+	}
+	err, rules := loadIntegrityRules(stub)
+	if err != nil {
+		return errorResponse(err)
+	}
+	results := []WriteResult{}
+	for _, salesOrder := range salesOrders {
+		if salesOrder.SONUMBER != "" && salesOrder.SOITEM != "" {
+			err, key := generateKey(stub, SO_KEY, []string{salesOrder.SONUMBER, salesOrder.SOITEM})
+			if err != nil {
+				return errorResponse(err)
+			}
+			fmt.Println("write data, SO for - " + key)
+			result := newWriteResult(key)
+
+			//business control
+			//get SO object from ledger
+			valAsbytes, err := stub.GetState(key)
+
+			var b []byte
+			if err == nil && valAsbytes != nil {
+				var oldSalesOrder = model.SalesOrder{}
+				err = json.Unmarshal(valAsbytes, &oldSalesOrder)
+				if err != nil {
+					return errorResp(ERR_INTERNAL, key, "", err.Error())
+				}
+
+				if salesOrder.TRANSDOC == "SO" {
+					err, ok := checkReference(rules, SO_KEY, &result, "CPONO", salesOrder.CPONO)
+					if err != nil {
+						return errorResponse(err)
+					}
+					if !ok {
+						results = append(results, result)
+						continue
+					}
+					salesOrder.PONO = oldSalesOrder.PONO
+					salesOrder.POITEM = oldSalesOrder.POITEM
+					salesOrder.BILLINFOS = oldSalesOrder.BILLINFOS
+					salesOrder.GIINFOS = oldSalesOrder.GIINFOS
+					err = linkCPurchaseOrder(stub, salesOrder)
+					if err != nil {
+						return errorResponse(err)
+					}
+					if salesOrder.DELFLAG != oldSalesOrder.DELFLAG {
+						err = cascadeSalesOrderDelete(stub, salesOrder)
+						if err != nil {
+							return errorResponse(err)
+						}
+					}
+					b, _ = json.Marshal(salesOrder)
+				} else if salesOrder.TRANSDOC == "BL" {
+					oldSalesOrder.BILLINFOS = salesOrder.BILLINFOS
+					b, _ = json.Marshal(oldSalesOrder)
+				} else if salesOrder.TRANSDOC == "GI" {
+					oldSalesOrder.GIINFOS = salesOrder.GIINFOS
+					b, _ = json.Marshal(oldSalesOrder)
+				} else {
+					return errorResp(ERR_VALIDATION, key, "TRANSDOC", "Unknown TRANSDOC "+salesOrder.TRANSDOC+" for an existing SO")
+				}
+			} else {
+				err, ok := checkReference(rules, SO_KEY, &result, "CPONO", salesOrder.CPONO)
+				if err != nil {
+					return errorResponse(err)
+				}
+				if !ok {
+					results = append(results, result)
+					continue
+				}
+				err = linkCPurchaseOrder(stub, salesOrder)
+				if err != nil {
+					return errorResponse(err)
+				}
+				b, _ = json.Marshal(salesOrder)
+			}
+			stub.PutState(key, b)
+			addDocument(stub, vendorNo, SO_KEY, []string{salesOrder.SONUMBER, salesOrder.SOITEM}, json.RawMessage(b))
+			results = append(results, result)
+		} else {
+			return errorResp(ERR_VALIDATION, "", "SONUMBER", "SalesOrder's number and item no is required")
+		}
+	}
+	return writeResultResponse(results)
+}
+
+//创建，修改PO信息
+func crPurchaseOrderInfo(stub shim.ChaincodeStubInterface, args [] string) pb.Response {
+	jsonStr := args[0]
+	vendorNo := args[1]
+	fmt.Println("write data, PO data - "+vendorNo, jsonStr)
+	var objs []model.PurchaseOrder
+	// obj := model.PurchaseOrder{}
+	err := json.Unmarshal([]byte(jsonStr), &objs)
+	if err != nil {
+		return errorResp(ERR_VALIDATION, "", "", err.Error())
+	}
+	err, rules := loadIntegrityRules(stub)
+	if err != nil {
+		return errorResponse(err)
+	}
+	results := []WriteResult{}
+	for _, obj := range objs {
+		if obj.PONO != "" && obj.POItemNO != "" {
+			err, key := generateKey(stub, PO_KEY, []string{obj.PONO, obj.POItemNO})
+			if err != nil {
+				return errorResponse(err)
+			}
+			fmt.Println("write data,PO for - " + key)
+			result := newWriteResult(key)
+			if obj.TRANSDOC == "PO" {
+				soKey := ""
+				if obj.SONUMBER != "" && obj.SOITEM != "" {
+					_, soKey = generateKey(stub, SO_KEY, []string{obj.SONUMBER, obj.SOITEM})
+				}
+				err, ok := checkParent(stub, rules, PO_KEY, &result, "SONUMBER", soKey, "SO "+obj.SONUMBER+"/"+obj.SOITEM)
+				if err != nil {
+					return errorResponse(err)
+				}
+				if !ok {
+					results = append(results, result)
+					continue
+				}
+			}
+			//business control
+			//get SO object from ledger
+			valAsbytes, err := stub.GetState(key)
+			var b []byte
+			if err == nil && valAsbytes != nil {
+				var oldPoObj = model.PurchaseOrder{}
+				err = json.Unmarshal(valAsbytes, &oldPoObj)
+				if err != nil {
+					return errorResp(ERR_INTERNAL, key, "", err.Error())
+				}
+				fmt.Println("write data, for obj.TRANSDOC- " + obj.TRANSDOC)
+				//fmt.Println(obj)
+
+				if obj.TRANSDOC == "PO" {
+					obj.GRInfos = oldPoObj.GRInfos
+					obj.Confirmation = oldPoObj.Confirmation
+					obj.InboundDelivery = oldPoObj.InboundDelivery
+					obj.Invoice = oldPoObj.Invoice
+					if obj.POItemSts != oldPoObj.POItemSts {
+						err = cascadePurchaseOrderDelete(stub, obj, oldPoObj.SupplierOrders)
+						if err != nil {
+							return errorResponse(err)
+						}
+					}
+					b, _ = json.Marshal(obj)
+					//update SO
+					// fmt.Println("SO no is "+obj.SONUMBER )
+					// fmt.Println("SO item is "+obj.SOITEM )
+					// if(obj.SONUMBER != "" && obj.SOITEM != ""){
+					// 	err,soKey:= generateKey(stub,SO_KEY,[]string{obj.SONUMBER,obj.SOITEM})
+					// 	if err != nil {
+					// 		return shim.Error(err.Error())
+					// 	}
+					// 	// fmt.Println("SO soKey is "+soKey )
+					// 	valAsbytes, err = stub.GetState(soKey)
+					// 	// fmt.Println("valAsbytesSO  is "+string(valAsbytes) )
+					// 	if err == nil && valAsbytes !=nil {
+					// 		var oldSalesOrder = model.SalesOrder{}
+					// 		err = json.Unmarshal(valAsbytes,&oldSalesOrder)
+					// 		if err == nil {
+					// 			oldSalesOrder.PONO = obj.PONO
+					// 			oldSalesOrder.POITEM = obj.POItemNO
+					// 			soByte,_ := json.Marshal(oldSalesOrder)
+					// 			stub.PutState (soKey,soByte)
+					// 		}
+					// 	}
+					// }
+				} else if obj.TRANSDOC == "GR" {
+					oldPoObj.GRInfos = obj.GRInfos
+					b, _ = json.Marshal(oldPoObj)
+
+				} else if obj.TRANSDOC == "POCON" {
+					oldPoObj.Confirmation = obj.Confirmation
+					b, _ = json.Marshal(oldPoObj)
+
+				} else if obj.TRANSDOC == "INV" {
+					oldPoObj.Invoice = obj.Invoice
+					b, _ = json.Marshal(oldPoObj)
+
+				} else if obj.TRANSDOC == "INDN" {
+					oldPoObj.InboundDelivery = obj.InboundDelivery
+					b, _ = json.Marshal(oldPoObj)
+				} else {
+					return errorResp(ERR_VALIDATION, key, "TRANSDOC", "Unknown TRANSDOC "+obj.TRANSDOC+" for an existing PO")
+				}
+			} else {
+				if obj.TRANSDOC == "PO" {
+					//update SO
+					if (obj.SONUMBER != "" && obj.SOITEM != "") {
+						err, soKey := generateKey(stub, SO_KEY, []string{obj.SONUMBER, obj.SOITEM})
+						if err != nil {
+							return errorResponse(err)
+						}
+						fmt.Println("SO soKey is " + soKey)
+						valAsbytes, err = stub.GetState(soKey)
+						// fmt.Println("valAsbytesSO  is "+string(valAsbytes) )
+						if err == nil && valAsbytes != nil {
+							var oldSalesOrder = model.SalesOrder{}
+							err = json.Unmarshal(valAsbytes, &oldSalesOrder)
+							if err == nil {
+								oldSalesOrder.PONO = obj.PONO
+								oldSalesOrder.POITEM = obj.POItemNO
+								soByte, _ := json.Marshal(oldSalesOrder)
+								stub.PutState(soKey, soByte)
+
+								//update CPO Info
+								var c []byte
+								cPOOrder := model.ODMPurchaseOrder{}
+								err, cpoKey := generateKey(stub, CPO_KEY, []string{oldSalesOrder.CPONO})
+								if err != nil {
+									return errorResponse(err)
+								}
+								fmt.Println("CPO Key is " + cpoKey)
+								cpoObjAsbytes, err := stub.GetState(cpoKey)
+								err = json.Unmarshal(cpoObjAsbytes, &cPOOrder)
+								if err == nil {
+									fmt.Println("write data, PO-SO-CPO for - " + cpoKey)
+									cPOOrder.PONO = oldSalesOrder.PONO
+									cPOOrder.POITEM = oldSalesOrder.POITEM
+									c, _ = json.Marshal(cPOOrder)
+									stub.PutState(cpoKey, c)
+								}
+
+							}
+						}
+					}
+				}
+				b, _ = json.Marshal(obj)
+			}
+			stub.PutState(key, b)
+			addDocument(stub, vendorNo, PO_KEY, []string{obj.PONO, obj.POItemNO}, json.RawMessage(b))
+			results = append(results, result)
+		} else {
+			return errorResp(ERR_VALIDATION, "", "PONO", "PurchaseOrder's number and  item no is required")
+		}
+	}
+	return writeResultResponse(results)
+}
+
+//修改 CPO信息
+func crCPurchaseOrderInfo(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	jsonStr := args[0]
+	vendorNo := args[1]
+	fmt.Println("write data, CPONO data - "+vendorNo, jsonStr)
+	var cPOrders [] model.ODMInfoReq
+
+	err := json.Unmarshal([]byte(jsonStr), &cPOrders)
+	if err != nil {
+		return errorResp(ERR_VALIDATION, "", "", err.Error())
+	}
+	err, rules := loadIntegrityRules(stub)
+	if err != nil {
+		return errorResponse(err)
+	}
+	results := []WriteResult{}
+	event := postingOf(stub, vendorNo)
+	for _, order := range cPOrders {
+		if order.CPONO != "" {
+			err, cpoKey := generateKey(stub, CPO_KEY, []string{order.CPONO})
+			fmt.Println("write data, CPO for - " + cpoKey)
+			if err != nil {
+				return errorResponse(err)
+			}
+			result := newWriteResult(cpoKey)
+			err, ok := checkParent(stub, rules, CPO_KEY, &result, "CPONO", cpoKey, "CPO "+order.CPONO)
+			if err != nil {
+				return errorResponse(err)
+			}
+			if !ok {
+				results = append(results, result)
+				continue
+			}
+			cpoObjAsbytes, err := stub.GetState(cpoKey)
+			if err == nil {
+				var c []byte
+				cPOOrder := model.ODMPurchaseOrder{}
+				if cpoObjAsbytes != nil {
+					err = json.Unmarshal(cpoObjAsbytes, &cPOOrder)
+					if err != nil {
+						return errorResp(ERR_INTERNAL, cpoKey, "", err.Error())
+					}
+				} else {
+					cPOOrder.CPONO = order.CPONO
+				}
+				if order.TRANSDOC == "GR" {
+					var cpoGrObj = model.ODMGRInfo{}
+					cpoGrObj.LenDNNO = order.LenDNNO
+					cpoGrObj.PARTNUM = order.PARTNUM
+					cpoGrObj.GRQTY = order.GRQTY
+					cPOOrder.ODMGRInfos = append(cPOOrder.ODMGRInfos, cpoGrObj)
+				} else if order.TRANSDOC == "BL" {
+					var cpoBLObj = model.ODMPayment{}
+					cpoBLObj.BILLINGNO = order.INVOICENUM
+					cpoBLObj.INVOICESTATUS = order.INVOICESTATUS
+					cpoBLObj.PAYMENTDATE = order.PAYMENTDATE
+					cPOOrder.ODMPayments = append(cPOOrder.ODMPayments, cpoBLObj)
+				}
+				c, _ = json.Marshal(cPOOrder)
+				stub.PutState(cpoKey, c)
+				addDocument(stub, vendorNo, CPO_KEY, []string{order.CPONO}, order)
+				if order.TRANSDOC == "GR" {
+					event.ODMGRInfos = append(event.ODMGRInfos, order)
+				}
+				results = append(results, result)
+			} else {
+				return errorResp(ERR_INTERNAL, cpoKey, "", err.Error())
+			}
+		} else {
+			return errorResp(ERR_VALIDATION, "", "CPONO", "PO number is required")
+		}
+	}
+	return writeResultResponse(results)
+}
+
+//修改 Supplier信息
+func crSupplierOrderInfo(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	jsonStr := args[0]
+	vendorNo := args[1]
+	fmt.Println("write data, SO data - "+vendorNo, jsonStr)
+	//EDIFACT DESADV/INVOIC
+	if edifact.IsInterchange(jsonStr) {
+		return crEdifactInfo(stub, args)
+	}
+
+	var supOrders [] model.SupplierOrder
+
+	err := json.Unmarshal([]byte(jsonStr), &supOrders)
+	if err != nil {
+		return errorResp(ERR_VALIDATION, "", "", err.Error())
+	}
+	err, rules := loadIntegrityRules(stub)
+	if err != nil {
+		return errorResponse(err)
+	}
+	results := []WriteResult{}
+	event := postingOf(stub, vendorNo)
+	for _, order := range supOrders {
+		order.VendorNO = vendorNo
+		if order.VendorNO != "" && order.ASNNumber != "" {
+			err, sup_key := generateKey(stub, SUPPLIER_KEY, []string{order.VendorNO, order.ASNNumber})
+			fmt.Println("write data, Suplier part for - " + sup_key)
+			if err != nil {
+				return errorResponse(err)
+			}
+			supObjAsbytes, err := stub.GetState(sup_key)
+			var c []byte
+			if err == nil && supObjAsbytes != nil {
+				supOrder := model.SupplierOrder{}
+				err = json.Unmarshal(supObjAsbytes, &supOrder)
+				if err != nil {
+					return errorResp(ERR_INTERNAL, sup_key, "", err.Error())
+				}
+				if order.TRANSDOC == "UL" { // upload
+					supOrder.PackingList = order.PackingList
+				}
+				c, _ = json.Marshal(supOrder)
+			} else {
+				c, _ = json.Marshal(order)
+			}
+			result := newWriteResult(sup_key)
+			supOrder := model.SupplierOrder{}
+			json.Unmarshal(c, &supOrder)
+			poKey := ""
+			if supOrder.PONumber != "" && supOrder.POItem != "" {
+				_, poKey = generateKey(stub, PO_KEY, []string{supOrder.PONumber, supOrder.POItem})
+			}
+			err, ok := checkParent(stub, rules, SUPPLIER_KEY, &result, "PONumber", poKey, "PO "+supOrder.PONumber+"/"+supOrder.POItem)
+			if err != nil {
+				return errorResponse(err)
+			}
+			if !ok {
+				results = append(results, result)
+				continue
+			}
+			if result.Status == RESULT_OK {
+				err, poKey, b := updatePurchaseOrderBySupplier(stub, c)
+				if err != nil {
+					return errorResponse(err)
+				}
+				if b == nil {
+					return errorResp(ERR_NOT_FOUND, poKey, "POItem", "PO item NO is not correct")
+				}
+				stub.PutState(poKey, b)
+				addDocument(stub, vendorNo, PO_KEY, []string{supOrder.PONumber, supOrder.POItem}, json.RawMessage(b))
+			}
+			stub.PutState(sup_key, c)
+			addDocument(stub, vendorNo, SUPPLIER_KEY, []string{supOrder.VendorNO, supOrder.ASNNumber}, supOrder)
+			if order.TRANSDOC != "UL" {
+				event.SupplierOrders = append(event.SupplierOrders, supOrder)
+			}
+			results = append(results, result)
+		} else {
+			return errorResp(ERR_VALIDATION, "", "ASNNumber", "ASNNumber is required")
+		}
+	}
+	return writeResultResponse(results)
+}
+
+func removeFromStateByKey(stub shim.ChaincodeStubInterface, args [] string) pb.Response {
+
+	jsonStr := args[0]
+	param := model.QueryParam{}
+	err := json.Unmarshal([]byte(jsonStr), &param)
+	if err != nil {
+		return errorResp(ERR_VALIDATION, "", "", err.Error())
+	}
+
+	if param.KeyPrefix == "" {
+		return errorResp(ERR_VALIDATION, "", "keyPrefix", "Invalid object name")
+	}
+
+	if len(param.KeysStart) == 0 {
+		return errorResp(ERR_VALIDATION, "", "keysStart", "Query keys are required")
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(param.KeyPrefix, param.KeysStart)
+	if err != nil {
+		return errorResponse(err)
+	}
+	defer resultsIterator.Close()
+	results := []WriteResult{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return errorResponse(err)
+		}
+		//soft delete, record is kept in ledger and history
+		err = markDeleted(stub, param.KeyPrefix, queryResponse.Key, queryResponse.Value)
+		if err != nil {
+			return errorResponse(err)
+		}
+		results = append(results, newWriteResult(queryResponse.Key))
+	}
+	return writeResultResponse(results)
+}
+
+// func  testCertificate(stub shim.ChaincodeStubInterface, args []string) pb.Response{
+// 	creatorByte,_:= stub.GetCreator()
+// 	certStart := bytes.IndexAny(creatorByte, "-----BEGIN")
+// 	if certStart == -1 {
+// 	   fmt.Errorf("No certificate found")
+// 	}
+// 	certText := creatorByte[certStart:]
+// 	bl, _ := pem.Decode(certText)
+// 	if bl == nil {
+// 	   fmt.Errorf("Could not decode the PEM structure")
+// 	}
+
+// 	cert, err := x509.ParseCertificate(bl.Bytes)
+// 	if err != nil {
+// 	   fmt.Errorf("ParseCertificate failed")
+// 	}
+// 	uname:=cert.Subject.CommonName
+// 	fmt.Println("Name:"+uname)
+// 	return shim.Success([]byte("Called testCertificate "+uname))
+//  }
+
+//IDoc/EDI只带本次的明细, 合并账本中已有的billing/GI
+func mergeSalesOrderItems(stub shim.ChaincodeStubInterface, orders []model.SalesOrder) error {
+	for i := range orders {
+		err, key := generateKey(stub, SO_KEY, []string{orders[i].SONUMBER, orders[i].SOITEM})
+		if err != nil {
+			return err
+		}
+		valAsbytes, err := stub.GetState(key)
+		if err != nil {
+			return newError(ERR_INTERNAL, key, "", err.Error())
+		}
+		if valAsbytes == nil {
+			continue
+		}
+		oldSalesOrder := model.SalesOrder{}
+		err = json.Unmarshal(valAsbytes, &oldSalesOrder)
+		if err != nil {
+			return newError(ERR_INTERNAL, key, "", err.Error())
+		}
+		billings := oldSalesOrder.BILLINFOS
+		for _, billing := range orders[i].BILLINFOS {
+			found := false
+			for j := range billings {
+				if billings[j].BILLINGNO == billing.BILLINGNO && billings[j].BILLINGITEM == billing.BILLINGITEM {
+					billings[j] = billing
+					found = true
+				}
+			}
+			if !found {
+				billings = append(billings, billing)
+			}
+		}
+		gis := oldSalesOrder.GIINFOS
+		for _, gi := range orders[i].GIINFOS {
+			found := false
+			for j := range gis {
+				if gis[j].DNNUMBER == gi.DNNUMBER && gis[j].DNITEM == gi.DNITEM {
+					gis[j] = gi
+					found = true
+				}
+			}
+			if !found {
+				gis = append(gis, gi)
+			}
+		}
+		orders[i].BILLINFOS = billings
+		orders[i].GIINFOS = gis
+	}
+	return nil
+}
+
+//合并账本中已有的inbound delivery/invoice
+func mergePurchaseOrderItems(stub shim.ChaincodeStubInterface, orders []model.PurchaseOrder) error {
+	for i := range orders {
+		err, key := generateKey(stub, PO_KEY, []string{orders[i].PONO, orders[i].POItemNO})
+		if err != nil {
+			return err
+		}
+		valAsbytes, err := stub.GetState(key)
+		if err != nil {
+			return newError(ERR_INTERNAL, key, "", err.Error())
+		}
+		if valAsbytes == nil {
+			continue
+		}
+		oldPoObj := model.PurchaseOrder{}
+		err = json.Unmarshal(valAsbytes, &oldPoObj)
+		if err != nil {
+			return newError(ERR_INTERNAL, key, "", err.Error())
+		}
+		inbounds := oldPoObj.InboundDelivery
+		for _, inbound := range orders[i].InboundDelivery {
+			found := false
+			for j := range inbounds {
+				if inbounds[j].IBDNNUMBER == inbound.IBDNNUMBER && inbounds[j].IBDNITEM == inbound.IBDNITEM {
+					inbounds[j] = inbound
+					found = true
+				}
+			}
+			if !found {
+				inbounds = append(inbounds, inbound)
+			}
+		}
+		invoices := oldPoObj.Invoice
+		for _, invoice := range orders[i].Invoice {
+			found := false
+			for j := range invoices {
+				if invoices[j].InvNO == invoice.InvNO && invoices[j].VenInvNO == invoice.VenInvNO && invoices[j].InvItemNO == invoice.InvItemNO {
+					invoices[j] = invoice
+					found = true
+				}
+			}
+			if !found {
+				invoices = append(invoices, invoice)
+			}
+		}
+		orders[i].InboundDelivery = inbounds
+		orders[i].Invoice = invoices
+	}
+	return nil
+}
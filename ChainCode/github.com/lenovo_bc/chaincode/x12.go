@@ -0,0 +1,77 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/lenovo_bc/model"
+	"github.com/lenovo_bc/x12"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+//写入X12 interchange: args[0] interchange (855/856/810), args[1] vendorNo
+func crX12Info(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	vendorNo := args[1]
+	err, ic := x12.Parse(args[0])
+	if err != nil {
+		return errorResp(ERR_VALIDATION, "", "", err.Error())
+	}
+	results := []WriteResult{}
+	//ASNs are written by one call after all messages are converted
+	asns := []model.SupplierOrder{}
+	for _, group := range ic.Groups {
+		for _, transaction := range group.Transactions {
+			fmt.Println("write data, X12 " + transaction.Code() + " " + transaction.ControlNumber())
+			err, doc := x12.Convert(transaction)
+			if err != nil {
+				return errorResp(ERR_VALIDATION, transaction.ControlNumber(), "ST01", err.Error())
+			}
+			var resp pb.Response
+			if doc.Code == x12.SHIP_NOTICE {
+				//SupplierOrder holds one PO item per ASN
+				if len(doc.SupplierOrders) != 1 {
+					return errorResp(ERR_VALIDATION, transaction.ControlNumber(), "LIN", fmt.Sprintf("ASN must ship exactly one PO item, got %d", len(doc.SupplierOrders)))
+				}
+				asns = append(asns, doc.SupplierOrders...)
+				continue
+			} else {
+				if doc.Code == x12.INVOICE {
+					for i := range doc.PurchaseOrders {
+						for j := range doc.PurchaseOrders[i].Invoice {
+							doc.PurchaseOrders[i].Invoice[j].VendorNO = vendorNo
+						}
+					}
+					err = mergePurchaseOrderItems(stub, doc.PurchaseOrders)
+					if err != nil {
+						return errorResponse(err)
+					}
+				}
+				b, _ := json.Marshal(doc.PurchaseOrders)
+				resp = crPurchaseOrderInfo(stub, []string{string(b), vendorNo})
+			}
+			if resp.Status != shim.OK {
+				return resp
+			}
+			written := []WriteResult{}
+			err = json.Unmarshal(resp.Payload, &written)
+			if err != nil {
+				return errorResp(ERR_INTERNAL, transaction.ControlNumber(), "", err.Error())
+			}
+			results = append(results, written...)
+		}
+	}
+	if len(asns) > 0 {
+		b, _ := json.Marshal(asns)
+		resp := crSupplierOrderInfo(stub, []string{string(b), vendorNo})
+		if resp.Status != shim.OK {
+			return resp
+		}
+		written := []WriteResult{}
+		err = json.Unmarshal(resp.Payload, &written)
+		if err != nil {
+			return errorResp(ERR_INTERNAL, "", "", err.Error())
+		}
+		results = append(results, written...)
+	}
+	return writeResultResponse(results)
+}
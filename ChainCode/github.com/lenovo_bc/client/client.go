@@ -0,0 +1,257 @@
+// Package client calls the lenovo_bc chaincode with typed requests and
+// responses instead of hand built [][]byte arguments. The calls go through a
+// Backend: Gateway talks to the API server (API/app.js), Mock runs the
+// chaincode in process on a mockstub.Stub for tests.
+//
+//	err, mock := client.NewMock("lenovo_bc", chaincode)
+//	c := client.New(mock, "lenovo")
+//	err, res := c.CreateSalesOrders(orders, "1209")
+//	err, so := c.SalesOrder("478", "10")
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/lenovo_bc/model"
+	"strconv"
+	"strings"
+)
+
+//Key prefixes of the ledger records
+const (
+	SO_KEY       = "SO"  //model.SalesOrder, keys SONUMBER, SOITEM
+	PO_KEY       = "PO"  //model.PurchaseOrder, keys PONO, POItemNO
+	CPO_KEY      = "CPO" //model.ODMPurchaseOrder, key CPONO
+	SUPPLIER_KEY = "SUP" //model.SupplierOrder, keys VendorNO, ASNNumber
+)
+
+//Chaincode error, the JSON message of shim.Error
+type Error struct {
+	Code    string `json:"Code"`  //Error code, VALIDATION, NOT_FOUND...
+	Message string `json:"Error"` //Error message
+	Key     string `json:"Key"`   //Record key
+	Field   string `json:"Field"` //Field name
+}
+
+func (e *Error) Error() string {
+	b, _ := json.Marshal(e)
+	return string(b)
+}
+
+//Error of a failed call: *Error if the message holds the chaincode error,
+//the message as it is otherwise
+func parseError(message string) error {
+	start, end := strings.Index(message, "{"), strings.LastIndex(message, "}")
+	if start >= 0 && end > start {
+		e := &Error{}
+		if json.Unmarshal([]byte(message[start:end+1]), e) == nil && e.Code != "" {
+			return e
+		}
+	}
+	return fmt.Errorf("%s", message)
+}
+
+//Result of one record of a write function
+type WriteResult struct {
+	Key      string  `json:"Key"`      //Record key
+	Status   string  `json:"Status"`   //OK, WARNING, REJECTED
+	Warnings []Error `json:"Warnings"` //Integrity warnings
+}
+
+//Transaction of a write function. Results is empty if the backend only
+//returns the transaction ID (Gateway).
+type WriteResponse struct {
+	TxID    string
+	Results []WriteResult
+}
+
+//Record of a range, partial key or rich query
+type KeyRecord struct {
+	Key    string          `json:"Key"`
+	Record json.RawMessage `json:"Record"`
+}
+
+//Version of a record returned by queryHistoryById
+type HistoryEntry struct {
+	TxId      string          `json:"TxId"`
+	Value     json.RawMessage `json:"Value"` //null when deleted
+	Timestamp string          `json:"Timestamp"`
+	IsDelete  string          `json:"IsDelete"` //"true" or "false"
+}
+
+//Chaincode response of a transaction
+type Response struct {
+	TxID    string
+	Payload []byte
+}
+
+//Calls the chaincode, args are the arguments after the function name
+type Backend interface {
+	Invoke(function string, args []string) (error, Response)
+	Query(function string, args []string) (error, []byte)
+}
+
+type Client struct {
+	Backend Backend
+	Role    string //userRole of the queries, fields are masked unless lenovo
+}
+
+func New(backend Backend, role string) *Client {
+	return &Client{Backend: backend, Role: role}
+}
+
+//Calls a function with raw arguments
+func (c *Client) Invoke(function string, args ...string) (error, Response) {
+	return c.Backend.Invoke(function, args)
+}
+
+//Calls a query function with raw arguments, the role is not added
+func (c *Client) Query(function string, args ...string) (error, []byte) {
+	return c.Backend.Query(function, args)
+}
+
+func (c *Client) write(function string, records interface{}, vendorNo string) (error, WriteResponse) {
+	b, err := json.Marshal(records)
+	if err != nil {
+		return err, WriteResponse{}
+	}
+	err, res := c.Backend.Invoke(function, []string{string(b), vendorNo})
+	if err != nil {
+		return err, WriteResponse{}
+	}
+	written := WriteResponse{TxID: res.TxID}
+	if len(res.Payload) > 0 {
+		err = json.Unmarshal(res.Payload, &written.Results)
+		if err != nil {
+			return fmt.Errorf("%s: %s", function, err.Error()), written
+		}
+	}
+	return nil, written
+}
+
+func (c *Client) CreateSalesOrders(orders []model.SalesOrder, vendorNo string) (error, WriteResponse) {
+	return c.write("crSalesOrderInfo", orders, vendorNo)
+}
+
+//ODM goods receipts (TRANSDOC GR) and payments (BL) of customer POs
+func (c *Client) CreateODMInfos(infos []model.ODMInfoReq, vendorNo string) (error, WriteResponse) {
+	return c.write("crCPurchaseOrderInfo", infos, vendorNo)
+}
+
+func (c *Client) CreatePurchaseOrders(orders []model.PurchaseOrder, vendorNo string) (error, WriteResponse) {
+	return c.write("crPurchaseOrderInfo", orders, vendorNo)
+}
+
+func (c *Client) CreateSupplierOrders(orders []model.SupplierOrder, vendorNo string) (error, WriteResponse) {
+	return c.write("crSupplierOrderInfo", orders, vendorNo)
+}
+
+//Marks the records starting with keys as deleted
+func (c *Client) Remove(prefix string, keys []string) (error, WriteResponse) {
+	b, _ := json.Marshal(model.QueryParam{KeyPrefix: prefix, KeysStart: keys})
+	err, res := c.Backend.Invoke("removeFromStateByKey", []string{string(b)})
+	if err != nil {
+		return err, WriteResponse{}
+	}
+	written := WriteResponse{TxID: res.TxID}
+	if len(res.Payload) > 0 {
+		err = json.Unmarshal(res.Payload, &written.Results)
+	}
+	return err, written
+}
+
+func (c *Client) query(function string, arg interface{}, v interface{}) error {
+	b, err := json.Marshal(arg)
+	if err != nil {
+		return err
+	}
+	err, payload := c.Backend.Query(function, []string{c.Role, string(b)})
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(compositeKeys(payload), v)
+	if err != nil {
+		return fmt.Errorf("%s: %s", function, err.Error())
+	}
+	return nil
+}
+
+//The queries write the Key of the records as it is, escape the U+0000
+//separators of the composite keys so the payload is valid JSON
+func compositeKeys(payload []byte) []byte {
+	return bytes.Replace(payload, []byte{0}, []byte(`\u0000`), -1)
+}
+
+//Reads one record into v, the model struct of the prefix
+func (c *Client) QueryByID(prefix string, keys []string, v interface{}) error {
+	return c.query("queryById", model.QueryParam{KeyPrefix: prefix, KeysStart: keys}, v)
+}
+
+func (c *Client) SalesOrder(soNumber string, soItem string) (error, model.SalesOrder) {
+	order := model.SalesOrder{}
+	err := c.QueryByID(SO_KEY, []string{soNumber, soItem}, &order)
+	return err, order
+}
+
+func (c *Client) PurchaseOrder(poNo string, poItem string) (error, model.PurchaseOrder) {
+	order := model.PurchaseOrder{}
+	err := c.QueryByID(PO_KEY, []string{poNo, poItem}, &order)
+	return err, order
+}
+
+func (c *Client) ODMPurchaseOrder(cpoNo string) (error, model.ODMPurchaseOrder) {
+	order := model.ODMPurchaseOrder{}
+	err := c.QueryByID(CPO_KEY, []string{cpoNo}, &order)
+	return err, order
+}
+
+func (c *Client) SupplierOrder(vendorNo string, asnNumber string) (error, model.SupplierOrder) {
+	order := model.SupplierOrder{}
+	err := c.QueryByID(SUPPLIER_KEY, []string{vendorNo, asnNumber}, &order)
+	return err, order
+}
+
+//Reads several records into v, a slice of the model struct; deleted records
+//are left out unless IncludeDeleted
+func (c *Client) QueryByIDs(params []model.QueryParam, v interface{}) error {
+	return c.query("queryByIds", params, v)
+}
+
+func (c *Client) History(prefix string, keys []string) (error, []HistoryEntry) {
+	entries := []HistoryEntry{}
+	err := c.query("queryHistoryById", model.QueryParam{KeyPrefix: prefix, KeysStart: keys}, &entries)
+	return err, entries
+}
+
+//Records from start to end, end excluded
+func (c *Client) QueryByRange(prefix string, start []string, end []string) (error, []KeyRecord) {
+	records := []KeyRecord{}
+	err := c.query("queryByIdRange", model.QueryParam{KeyPrefix: prefix, KeysStart: start, KeysEnd: end}, &records)
+	return err, records
+}
+
+//Records whose keys start with keys
+func (c *Client) QueryByPartialKey(prefix string, keys []string) (error, []KeyRecord) {
+	records := []KeyRecord{}
+	err := c.query("queryByPartialCompositeKey", model.QueryParam{KeyPrefix: prefix, KeysStart: keys}, &records)
+	return err, records
+}
+
+//CouchDB Mango query, selector is the query JSON
+func (c *Client) QueryResult(selector string, includeDeleted bool) (error, []KeyRecord) {
+	args := []string{c.Role, selector}
+	if includeDeleted {
+		args = append(args, strconv.FormatBool(includeDeleted))
+	}
+	err, payload := c.Backend.Query("getQueryResult", args)
+	if err != nil {
+		return err, nil
+	}
+	records := []KeyRecord{}
+	err = json.Unmarshal(compositeKeys(payload), &records)
+	if err != nil {
+		return fmt.Errorf("getQueryResult: %s", err.Error()), nil
+	}
+	return nil, records
+}
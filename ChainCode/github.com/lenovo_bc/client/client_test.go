@@ -0,0 +1,116 @@
+package client
+
+import (
+	"encoding/json"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.com/lenovo_bc/model"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+//Chaincode answering like lenovo_bc for one sales order
+type fakeChaincode struct{}
+
+func (cc *fakeChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
+	return shim.Success(nil)
+}
+
+func (cc *fakeChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
+	function, args := stub.GetFunctionAndParameters()
+	if function == "crSalesOrderInfo" {
+		orders := []model.SalesOrder{}
+		json.Unmarshal([]byte(args[0]), &orders)
+		stub.PutState("SO", []byte(args[0]))
+		stub.SetEvent("POSTED", []byte(args[1]))
+		return shim.Success([]byte(`[{"Key":"SO` + orders[0].SONUMBER + `","Status":"OK","Warnings":[]}]`))
+	} else if function == "queryById" && args[0] == "lenovo" {
+		b, _ := stub.GetState("SO")
+		orders := []model.SalesOrder{}
+		json.Unmarshal(b, &orders)
+		b, _ = json.Marshal(orders[0])
+		return shim.Success(b)
+	}
+	return shim.Error(`{"Code":"NOT_FOUND","Error":"Unknown","Key":"","Field":""}`)
+}
+
+func TestMock(t *testing.T) {
+	err, mock := NewMock("test", &fakeChaincode{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := New(mock, "lenovo")
+	err, res := c.CreateSalesOrders([]model.SalesOrder{{SONUMBER: "478", SOITEM: "10", TRANSDOC: "SO"}}, "1209")
+	if err != nil || res.TxID != "tx2" || len(res.Results) != 1 || res.Results[0].Status != "OK" {
+		t.Fatalf("unexpected write %v %+v", err, res)
+	}
+	if len(mock.Events) != 1 || string(mock.Events[0].Payload) != "1209" {
+		t.Fatalf("unexpected events %v", mock.Events)
+	}
+	err, so := c.SalesOrder("478", "10")
+	if err != nil || so.SONUMBER != "478" {
+		t.Fatalf("unexpected order %v %+v", err, so)
+	}
+	c.Role = "supplier"
+	err, _ = c.SalesOrder("478", "10")
+	if e, ok := err.(*Error); !ok || e.Code != "NOT_FOUND" {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestGateway(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := map[string]interface{}{}
+		json.NewDecoder(r.Body).Decode(&body)
+		if r.URL.Path == "/users" {
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "token": "jwt", "roleId": "lenovo"})
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer jwt" {
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "Failed to authenticate token"})
+			return
+		}
+		switch r.URL.Path {
+		case "/lenovo/channels/mychannel/chaincodes/lenovo_bc":
+			if records, ok := body["args"].([]interface{}); !ok || len(records) != 1 || body["fcn"] != "crSalesOrderInfo" {
+				t.Errorf("unexpected invoke %v", body)
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "transactionId": "abc"})
+		case "/lenovo/channels/mychannel/chaincodes/lenovo_bc/query":
+			if body["fcn"] == "queryById" {
+				json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": `{"SONUMBER":"478"}`})
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false,
+				"message": `Error: chaincode error (status: 500, message: {"Code":"VALIDATION","Error":"Invalid","Key":"","Field":"keyPrefix"})`})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	g := NewGateway(server.URL+"/", "mychannel", "lenovo_bc")
+	if err := g.Login("admin", "secret"); err != nil || g.Role != "lenovo" {
+		t.Fatalf("login failed %v %+v", err, g)
+	}
+	c := New(g, g.Role)
+	err, res := c.CreateSalesOrders([]model.SalesOrder{{SONUMBER: "478", SOITEM: "10", TRANSDOC: "SO"}}, "")
+	if err != nil || res.TxID != "abc" || res.Results != nil {
+		t.Fatalf("unexpected write %v %+v", err, res)
+	}
+	err, so := c.SalesOrder("478", "10")
+	if err != nil || so.SONUMBER != "478" {
+		t.Fatalf("unexpected order %v %+v", err, so)
+	}
+	err, _ = c.QueryByPartialKey("", nil)
+	if e, ok := err.(*Error); !ok || e.Field != "keyPrefix" {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err, _ = c.Invoke("setPurgeApprovers", `["Org1"]`); err == nil {
+		t.Fatal("gateway invoked a function without vendor no")
+	}
+	if err, _ = c.QueryResult(`{"selector":{}}`, true); err == nil {
+		t.Fatal("gateway passed three query arguments")
+	}
+}
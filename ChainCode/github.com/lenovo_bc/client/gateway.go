@@ -0,0 +1,125 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+//Backend calling the REST API server (API/app.js). The server adds the
+//caller's vendor no from the token to the write functions and only passes
+//[role, arg] to queries, so functions with other argument lists can't be
+//called through it.
+type Gateway struct {
+	URL       string //http://host:4000
+	Channel   string
+	Chaincode string
+	Role      string   //Company of the user, set by Login
+	Token     string   //JWT of the user, set by Login
+	Peers     []string //Endorsing peers of transactions, all if empty
+	Client    *http.Client
+}
+
+func NewGateway(url string, channel string, chaincode string) *Gateway {
+	return &Gateway{URL: strings.TrimRight(url, "/"), Channel: channel, Chaincode: chaincode, Client: http.DefaultClient}
+}
+
+//Body of the API server responses
+type gatewayResponse struct {
+	Success       bool        `json:"success"`
+	Message       string      `json:"message"`
+	TransactionID string      `json:"transactionId"`
+	Data          interface{} `json:"data"`
+	Token         string      `json:"token"`
+	RoleID        string      `json:"roleId"`
+}
+
+func (g *Gateway) post(path string, body interface{}) (error, gatewayResponse) {
+	res := gatewayResponse{}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err, res
+	}
+	req, err := http.NewRequest("POST", g.URL+path, bytes.NewReader(b))
+	if err != nil {
+		return err, res
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if g.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+g.Token)
+	}
+	resp, err := g.Client.Do(req)
+	if err != nil {
+		return err, res
+	}
+	defer resp.Body.Close()
+	b, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err, res
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s %s", path, resp.Status, string(b)), res
+	}
+	err = json.Unmarshal(b, &res)
+	if err != nil {
+		return fmt.Errorf("%s: %s", path, err.Error()), res
+	}
+	if !res.Success {
+		return parseError(res.Message), res
+	}
+	return nil, res
+}
+
+//Logs in and keeps the token and role of the user
+func (g *Gateway) Login(username string, password string) error {
+	err, res := g.post("/users", map[string]string{"username": username, "password": password})
+	if err != nil {
+		return err
+	}
+	g.Token = res.Token
+	g.Role = res.RoleID
+	return nil
+}
+
+func (g *Gateway) chaincodePath() string {
+	return "/" + g.Role + "/channels/" + g.Channel + "/chaincodes/" + g.Chaincode
+}
+
+//Write function taking [json, vendorNo]. The vendor no is replaced by the
+//one of the token, Response has the transaction ID only.
+func (g *Gateway) Invoke(function string, args []string) (error, Response) {
+	var records json.RawMessage
+	if len(args) != 2 || json.Unmarshal([]byte(args[0]), &records) != nil {
+		return fmt.Errorf("%s: the API server only invokes functions taking a JSON document and the vendor no", function), Response{}
+	}
+	body := map[string]interface{}{"fcn": function, "args": records}
+	if len(g.Peers) > 0 {
+		body["peers"] = g.Peers
+	}
+	err, res := g.post(g.chaincodePath(), body)
+	if err != nil {
+		return err, Response{}
+	}
+	return nil, Response{TxID: res.TransactionID}
+}
+
+//Query function taking [userRole, arg]
+func (g *Gateway) Query(function string, args []string) (error, []byte) {
+	if len(args) != 2 {
+		return fmt.Errorf("%s: the API server only passes the role and one argument to queries", function), nil
+	}
+	path := "/" + args[0] + "/channels/" + g.Channel + "/chaincodes/" + g.Chaincode + "/query"
+	err, res := g.post(path, map[string]interface{}{"fcn": function, "args": []string{args[1]}})
+	if err != nil {
+		return err, nil
+	}
+	//the server returns the payload as a string
+	if s, ok := res.Data.(string); ok {
+		return nil, []byte(s)
+	}
+	b, err := json.Marshal(res.Data)
+	return err, b
+}
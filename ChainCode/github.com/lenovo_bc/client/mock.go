@@ -0,0 +1,66 @@
+package client
+
+import (
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.com/lenovo_bc/mockstub"
+	"strconv"
+)
+
+//In process backend running the chaincode on a mockstub.Stub. Queries are
+//transactions too, the MockStub has no read only calls.
+type Mock struct {
+	Stub   *mockstub.Stub
+	Events []*pb.ChaincodeEvent //Events set by the transactions, oldest first
+	tx     int
+}
+
+//Mock backend with the chaincode initialized
+func NewMock(name string, cc shim.Chaincode) (error, *Mock) {
+	m := &Mock{Stub: mockstub.NewStub(name, cc)}
+	res := m.Stub.MockInit(m.nextTxID(), nil)
+	if res.Status != shim.OK {
+		return parseError(res.Message), nil
+	}
+	m.drainEvents()
+	return nil, m
+}
+
+func (m *Mock) nextTxID() string {
+	m.tx++
+	return "tx" + strconv.Itoa(m.tx)
+}
+
+//The MockStub channel is buffered, keep it empty so SetEvent never blocks
+func (m *Mock) drainEvents() {
+	for len(m.Stub.ChaincodeEventsChannel) > 0 {
+		m.Events = append(m.Events, <-m.Stub.ChaincodeEventsChannel)
+	}
+}
+
+func (m *Mock) call(function string, args []string) (error, Response) {
+	invokeArgs := [][]byte{[]byte(function)}
+	for _, arg := range args {
+		invokeArgs = append(invokeArgs, []byte(arg))
+	}
+	txID := m.nextTxID()
+	res := m.Stub.MockInvoke(txID, invokeArgs)
+	m.drainEvents()
+	if res.Status >= shim.ERRORTHRESHOLD {
+		return parseError(res.Message), Response{}
+	}
+	if res.Status != shim.OK {
+		return fmt.Errorf("%s: status %d %s", function, res.Status, res.Message), Response{}
+	}
+	return nil, Response{TxID: txID, Payload: res.Payload}
+}
+
+func (m *Mock) Invoke(function string, args []string) (error, Response) {
+	return m.call(function, args)
+}
+
+func (m *Mock) Query(function string, args []string) (error, []byte) {
+	err, res := m.call(function, args)
+	return err, res.Payload
+}
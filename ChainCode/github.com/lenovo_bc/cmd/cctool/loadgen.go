@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/lenovo_bc/chaincode"
+	"github.com/lenovo_bc/client"
+	"github.com/lenovo_bc/model"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+//Load generator, writes synthetic SO/PO/GR/ASN volumes and measures the calls:
+//
+//	cctool loadgen [-orders 100] [-items 5] [-grs 2] [-asns 1] [-vendors 10]
+//	    [-batch 50] [-queries 100] [-seed 1] [-v] [-api http://host:4000 -user u -password p]
+//
+//Each of the -orders sales orders has -items SO items, each SO item its CPO
+//and a PO item with -grs goods receipts and -asns supplier ASNs of one of
+//-vendors vendors. Records are written in batches of -batch per transaction,
+//then every query function is called -queries times on random records.
+//
+//The chaincode runs on a mockstub.Stub unless -api is given. Per function the
+//report lists calls, errors, records per call, state reads and writes per
+//call (mockstub only), request and response bytes per call and the latency
+//percentiles. Latencies on the mockstub are the chaincode time alone, and
+//its getQueryResult scans the whole state where CouchDB would use an index.
+type LoadConfig struct {
+	Orders  int   //Sales orders
+	Items   int   //SO items per order, each with a CPO and a PO item
+	GRs     int   //Goods receipts per PO item
+	ASNs    int   //Supplier ASNs per PO item
+	Vendors int   //Vendors the PO items are spread over
+	Batch   int   //Records per write transaction
+	Queries int   //Calls per query function
+	Seed    int64 //Seed of the random quantities and query keys
+}
+
+//Measurements of one function
+type CallStats struct {
+	Function  string
+	Calls     int
+	Errors    int
+	Records   int //Records written or read
+	Reads     int //State reads, mockstub only
+	Writes    int //State writes, mockstub only
+	Request   int //Bytes of the arguments
+	Response  int //Bytes of the payloads
+	Latencies []time.Duration
+}
+
+type durations []time.Duration
+
+func (d durations) Len() int           { return len(d) }
+func (d durations) Less(i, j int) bool { return d[i] < d[j] }
+func (d durations) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+
+//Latency at the percentile p (0-100) of the calls, nearest rank
+func (s *CallStats) Percentile(p float64) time.Duration {
+	if len(s.Latencies) == 0 {
+		return 0
+	}
+	sorted := append(durations{}, s.Latencies...)
+	sort.Sort(sorted)
+	rank := int(p/100*float64(len(sorted))+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+type LoadGenerator struct {
+	Config  LoadConfig
+	Backend client.Backend
+	Mock    *client.Mock //nil for the API server
+	Role    string       //userRole of the queries
+	Log     *os.File     //Chaincode output, os.Stdout while calling
+	Stats   []*CallStats //In order of the first call
+	rand    *rand.Rand
+}
+
+func NewLoadGenerator(config LoadConfig, backend client.Backend) *LoadGenerator {
+	g := &LoadGenerator{Config: config, Backend: backend, Role: "lenovo", rand: rand.New(rand.NewSource(config.Seed))}
+	g.Mock, _ = backend.(*client.Mock)
+	return g
+}
+
+func (g *LoadGenerator) stats(function string) *CallStats {
+	for _, s := range g.Stats {
+		if s.Function == function {
+			return s
+		}
+	}
+	s := &CallStats{Function: function}
+	g.Stats = append(g.Stats, s)
+	return s
+}
+
+//Calls the backend and records the call under name
+func (g *LoadGenerator) call(name string, function string, query bool, records int, args ...string) error {
+	s := g.stats(name)
+	for _, arg := range args {
+		s.Request += len(arg)
+	}
+	var err error
+	var payload []byte
+	start := time.Now()
+	quiet(g.Log, func() {
+		if query {
+			err, payload = g.Backend.Query(function, args)
+		} else {
+			var res client.Response
+			err, res = g.Backend.Invoke(function, args)
+			payload = res.Payload
+		}
+	})
+	s.Latencies = append(s.Latencies, time.Since(start))
+	s.Calls++
+	s.Records += records
+	s.Response += len(payload)
+	if g.Mock != nil {
+		s.Reads += g.Mock.Stub.Reads
+		s.Writes += g.Mock.Stub.Writes
+		g.Mock.Events = nil
+	}
+	if err != nil {
+		s.Errors++
+		return err
+	}
+	if query {
+		//records returned by the list queries, keys contain U+0000
+		list := []json.RawMessage{}
+		if json.Unmarshal(bytes.Replace(payload, []byte{0}, []byte(`\u0000`), -1), &list) == nil {
+			s.Records += len(list)
+		} else if len(payload) > 0 {
+			s.Records++
+		}
+	}
+	return nil
+}
+
+//Writes the records in batches, name tells the batches apart in the report
+func (g *LoadGenerator) write(name string, function string, vendorNo func(i int) string, records []interface{}) error {
+	for start := 0; start < len(records); start += g.Config.Batch {
+		end := start + g.Config.Batch
+		if end > len(records) {
+			end = len(records)
+		}
+		//a batch is posted by the vendor of its first record
+		b, err := json.Marshal(records[start:end])
+		if err != nil {
+			return err
+		}
+		err = g.call(name, function, false, end-start, string(b), vendorNo(start))
+		if err != nil {
+			return fmt.Errorf("%s: %s", name, err.Error())
+		}
+	}
+	return nil
+}
+
+func (g *LoadGenerator) soNumber(order int) string {
+	return strconv.Itoa(40000000 + order)
+}
+
+func (g *LoadGenerator) poNumber(order int) string {
+	return strconv.Itoa(4500000000 + order)
+}
+
+func (g *LoadGenerator) item(item int) string {
+	return fmt.Sprintf("%06d", (item+1)*10)
+}
+
+func (g *LoadGenerator) vendor(line int) string {
+	return strconv.Itoa(1000 + line%g.Config.Vendors)
+}
+
+func (g *LoadGenerator) quantity() string {
+	return strconv.Itoa(1 + g.rand.Intn(500))
+}
+
+//Writes the synthetic documents
+func (g *LoadGenerator) Load() error {
+	c := g.Config
+	lenovo := func(int) string { return "LENOVO" }
+	salesOrders := []interface{}{}
+	purchaseOrders := []interface{}{}
+	for order := 0; order < c.Orders; order++ {
+		for item := 0; item < c.Items; item++ {
+			qty := g.quantity()
+			salesOrders = append(salesOrders, model.SalesOrder{SONUMBER: g.soNumber(order), SOITEM: g.item(item), TRANSDOC: "SO",
+				SOTYPE: "ZOR", PARTSNO: "PN" + strconv.Itoa(g.rand.Intn(10000)), SOQTY: qty, UNIT: "EA",
+				CPONO: "CPO" + g.soNumber(order) + g.item(item), NETPRICE: strconv.Itoa(10 + g.rand.Intn(990)), CURRENCY: "USD"})
+			purchaseOrders = append(purchaseOrders, model.PurchaseOrder{PONO: g.poNumber(order), POItemNO: g.item(item), TRANSDOC: "PO",
+				VendorNO: g.vendor(order*c.Items + item), SONUMBER: g.soNumber(order), SOITEM: g.item(item), POQty: qty})
+		}
+	}
+	err := g.write("crSalesOrderInfo SO", "crSalesOrderInfo", lenovo, salesOrders)
+	if err != nil {
+		return err
+	}
+	err = g.write("crPurchaseOrderInfo PO", "crPurchaseOrderInfo", g.vendor, purchaseOrders)
+	if err != nil {
+		return err
+	}
+
+	goodsReceipts := []interface{}{}
+	asns := []interface{}{}
+	for line, record := range purchaseOrders {
+		po := record.(model.PurchaseOrder)
+		gr := model.PurchaseOrder{PONO: po.PONO, POItemNO: po.POItemNO, TRANSDOC: "GR"}
+		for i := 0; i < c.GRs; i++ {
+			gr.GRInfos = append(gr.GRInfos, model.GRInfo{GRQty: g.quantity()})
+		}
+		if c.GRs > 0 {
+			goodsReceipts = append(goodsReceipts, gr)
+		}
+		for i := 0; i < c.ASNs; i++ {
+			asns = append(asns, model.SupplierOrder{ASNNumber: "ASN" + po.PONO + po.POItemNO + strconv.Itoa(i), PONumber: po.PONO,
+				POItem: po.POItemNO, ShippedQty: g.quantity(), CarrierID: "UPS", CarrierTrackID: "1Z" + strconv.Itoa(line*c.ASNs+i)})
+		}
+	}
+	err = g.write("crPurchaseOrderInfo GR", "crPurchaseOrderInfo", g.vendor, goodsReceipts)
+	if err != nil {
+		return err
+	}
+	//the ASN key is vendor + ASN number, one vendor per batch
+	return g.write("crSupplierOrderInfo ASN", "crSupplierOrderInfo", func(i int) string { return g.vendor(i / c.ASNs) }, asns)
+}
+
+//Calls every query function -queries times on random records
+func (g *LoadGenerator) Query() error {
+	c := g.Config
+	if c.Orders == 0 || c.Items == 0 {
+		return nil
+	}
+	param := func(prefix string, start []string, end []string) string {
+		b, _ := json.Marshal(model.QueryParam{KeyPrefix: prefix, KeysStart: start, KeysEnd: end})
+		return string(b)
+	}
+	for i := 0; i < c.Queries; i++ {
+		order := g.rand.Intn(c.Orders)
+		item := g.item(g.rand.Intn(c.Items))
+		queries := [][]string{
+			{"queryById", param(chaincode.SO_KEY, []string{g.soNumber(order), item}, nil)},
+			{"queryByIdRange", param(chaincode.SO_KEY, []string{g.soNumber(order)}, []string{g.soNumber(order + 1)})},
+			{"queryByPartialCompositeKey", param(chaincode.PO_KEY, []string{g.poNumber(order)}, nil)},
+			{"queryHistoryById", param(chaincode.PO_KEY, []string{g.poNumber(order), item}, nil)},
+			{"getQueryResult", `{"selector":{"PONO":"` + g.poNumber(order) + `","POItemNO":"` + item + `"}}`},
+		}
+		for _, query := range queries {
+			err := g.call(query[0], query[0], true, 0, g.Role, query[1])
+			if err != nil {
+				return fmt.Errorf("%s: %s", query[0], err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+func perCall(total int, calls int) string {
+	if calls == 0 {
+		return "-"
+	}
+	return strconv.FormatFloat(float64(total)/float64(calls), 'f', 1, 64)
+}
+
+func (g *LoadGenerator) Report(out io.Writer) {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "function\tcalls\terrors\trecords/call\treads/call\twrites/call\treq B/call\tresp B/call\tp50\tp90\tp99\tmax")
+	for _, s := range g.Stats {
+		reads, writes := "-", "-"
+		if g.Mock != nil {
+			reads, writes = perCall(s.Reads, s.Calls), perCall(s.Writes, s.Calls)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", s.Function, s.Calls, s.Errors,
+			perCall(s.Records, s.Calls), reads, writes, perCall(s.Request, s.Calls), perCall(s.Response, s.Calls),
+			s.Percentile(50), s.Percentile(90), s.Percentile(99), s.Percentile(100))
+	}
+	w.Flush()
+}
+
+func loadgen(args []string) int {
+	flags := flag.NewFlagSet("loadgen", flag.ExitOnError)
+	config := LoadConfig{}
+	flags.IntVar(&config.Orders, "orders", 100, "sales orders")
+	flags.IntVar(&config.Items, "items", 5, "SO items per order, each with a CPO and a PO item")
+	flags.IntVar(&config.GRs, "grs", 2, "goods receipts per PO item")
+	flags.IntVar(&config.ASNs, "asns", 1, "supplier ASNs per PO item")
+	flags.IntVar(&config.Vendors, "vendors", 10, "vendors of the PO items")
+	flags.IntVar(&config.Batch, "batch", 50, "records per write transaction")
+	flags.IntVar(&config.Queries, "queries", 100, "calls per query function")
+	flags.Int64Var(&config.Seed, "seed", 1, "random seed")
+	verbose := flags.Bool("v", false, "print the chaincode logs")
+	api := flags.String("api", "", "API server URL, the chaincode runs on a mockstub without it")
+	channel := flags.String("channel", "mychannel", "channel of the API server")
+	ccName := flags.String("chaincode", "lenovo_bc", "chaincode name of the API server")
+	user := flags.String("user", "", "API server user")
+	password := flags.String("password", "", "API server password")
+	flags.Parse(args)
+	if flags.NArg() != 0 || config.Orders < 0 || config.Items < 0 || config.GRs < 0 || config.ASNs < 0 ||
+		config.Vendors < 1 || config.Batch < 1 || config.Queries < 0 {
+		fmt.Fprintln(os.Stderr, "usage: cctool loadgen [-orders n] [-items n] [-grs n] [-asns n] [-vendors n] [-batch n] [-queries n] [-seed n] [-v] [-api url -user u -password p]")
+		return 2
+	}
+
+	var backend client.Backend
+	role := "lenovo"
+	if *api != "" {
+		gateway := client.NewGateway(*api, *channel, *ccName)
+		err := gateway.Login(*user, *password)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return 1
+		}
+		backend = gateway
+		role = gateway.Role
+	} else {
+		err, mock := client.NewMock("lenovo_bc", new(chaincode.SmartContract))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return 1
+		}
+		mock.Stub.SetCreator(chaincode.BUYER_MSP)
+		backend = mock
+	}
+	g := NewLoadGenerator(config, backend)
+	g.Role = role
+	if !*verbose {
+		devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return 1
+		}
+		defer devNull.Close()
+		g.Log = devNull
+	}
+	start := time.Now()
+	err := g.Load()
+	if err == nil {
+		err = g.Query()
+	}
+	g.Report(os.Stdout)
+	calls := 0
+	for _, s := range g.Stats {
+		calls += s.Calls
+	}
+	elapsed := time.Since(start)
+	fmt.Fprintf(os.Stdout, "%d calls in %s, %.1f calls/s\n", calls, elapsed, float64(calls)/elapsed.Seconds())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/lenovo_bc/chaincode"
+	"github.com/lenovo_bc/client"
+	"github.com/lenovo_bc/model"
+)
+
+func TestLoadGenerator(t *testing.T) {
+	err, mock := client.NewMock("lenovo_bc", new(chaincode.SmartContract))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := NewLoadGenerator(LoadConfig{Orders: 3, Items: 2, GRs: 2, ASNs: 2, Vendors: 2, Batch: 4, Queries: 3, Seed: 1}, mock)
+	devNull, _ := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	defer devNull.Close()
+	g.Log = devNull
+	if err := g.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Query(); err != nil {
+		t.Fatal(err)
+	}
+	calls := map[string]*CallStats{}
+	for _, s := range g.Stats {
+		calls[s.Function] = s
+		if s.Errors != 0 || len(s.Latencies) != s.Calls || s.Reads == 0 {
+			t.Fatalf("unexpected stats %+v", s)
+		}
+	}
+	if s := calls["crSalesOrderInfo SO"]; s == nil || s.Calls != 2 || s.Records != 6 || s.Writes != 12 {
+		t.Fatalf("unexpected SO stats %+v", s)
+	}
+	if s := calls["crSupplierOrderInfo ASN"]; s == nil || s.Calls != 3 || s.Records != 12 {
+		t.Fatalf("unexpected ASN stats %+v", s)
+	}
+	//2 items of the order, integrated with PO, CPO and ASNs
+	if s := calls["queryByIdRange"]; s == nil || s.Calls != 3 || s.Records != 6 || s.Reads <= 6 {
+		t.Fatalf("unexpected range stats %+v", s)
+	}
+	poKey, _ := mock.Stub.CreateCompositeKey(chaincode.PO_KEY, []string{"4500000000", "000010"})
+	purchaseOrder := model.PurchaseOrder{}
+	json.Unmarshal(mock.Stub.State[poKey], &purchaseOrder)
+	if len(purchaseOrder.GRInfos) != 2 || len(purchaseOrder.SupplierOrders) != 2 || purchaseOrder.VendorNO != "1000" {
+		t.Fatalf("unexpected PO %s", mock.Stub.State[poKey])
+	}
+
+	out := bytes.Buffer{}
+	g.Report(&out)
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != 10 || !strings.HasPrefix(lines[5], "queryById ") {
+		t.Fatalf("unexpected report\n%s", out.String())
+	}
+
+	s := CallStats{}
+	for i := 100; i > 0; i-- {
+		s.Latencies = append(s.Latencies, time.Duration(i)*time.Millisecond)
+	}
+	if s.Percentile(50) != 50*time.Millisecond || s.Percentile(99) != 99*time.Millisecond || s.Percentile(100) != 100*time.Millisecond {
+		t.Fatalf("unexpected percentiles %s %s %s", s.Percentile(50), s.Percentile(99), s.Percentile(100))
+	}
+}
+
+//Mock backend loaded with orders sales orders by the load generator
+func loadedMock(b *testing.B, orders int, log *os.File) *client.Mock {
+	err, mock := client.NewMock("lenovo_bc", new(chaincode.SmartContract))
+	if err != nil {
+		b.Fatal(err)
+	}
+	g := NewLoadGenerator(LoadConfig{Orders: orders, Items: 5, GRs: 2, ASNs: 1, Vendors: 10, Batch: 100, Seed: 1}, mock)
+	g.Log = log
+	if err := g.Load(); err != nil {
+		b.Fatal(err)
+	}
+	return mock
+}
+
+//Runs the call b.N times, chaincode output discarded
+func benchmarkCall(b *testing.B, mock *client.Mock, log *os.File, args ...string) {
+	invokeArgs := [][]byte{}
+	for _, arg := range args {
+		invokeArgs = append(invokeArgs, []byte(arg))
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	quiet(log, func() {
+		for i := 0; i < b.N; i++ {
+			res := mock.Stub.MockInvoke("bench", invokeArgs)
+			if res.Status != shim.OK {
+				b.Fatalf("%s failed %s", args[0], res.Message)
+			}
+			b.SetBytes(int64(len(res.Payload)))
+			mock.Events = nil
+			for len(mock.Stub.ChaincodeEventsChannel) > 0 {
+				<-mock.Stub.ChaincodeEventsChannel
+			}
+		}
+	})
+}
+
+//queryByIdRange over all SO items, each integrated with its PO item, CPO and
+//ASN. MB/s is the response size.
+func BenchmarkQueryByIdRange(b *testing.B) {
+	devNull, _ := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	defer devNull.Close()
+	for _, orders := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprintf("items=%d", orders*5), func(b *testing.B) {
+			mock := loadedMock(b, orders, devNull)
+			benchmarkCall(b, mock, devNull, "queryByIdRange", "lenovo", `{"keyPrefix":"SO","keysStart":["0"],"keysEnd":["9"]}`)
+		})
+	}
+}
+
+//crPurchaseOrderInfo batches updating existing PO items. MB/s is the
+//response size.
+func BenchmarkCrPurchaseOrderInfo(b *testing.B) {
+	devNull, _ := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	defer devNull.Close()
+	for _, batch := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprintf("batch=%d", batch), func(b *testing.B) {
+			mock := loadedMock(b, batch/5, devNull)
+			orders := []model.PurchaseOrder{}
+			for i := 0; i < batch; i++ {
+				orders = append(orders, model.PurchaseOrder{PONO: strconv.Itoa(4500000000 + i/5), POItemNO: fmt.Sprintf("%06d", (i%5+1)*10),
+					TRANSDOC: "PO", SONUMBER: strconv.Itoa(40000000 + i/5), SOITEM: fmt.Sprintf("%06d", (i%5+1)*10), POQty: "5"})
+			}
+			records, _ := json.Marshal(orders)
+			benchmarkCall(b, mock, devNull, "crPurchaseOrderInfo", string(records), "1000")
+		})
+	}
+}
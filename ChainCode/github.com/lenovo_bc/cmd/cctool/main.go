@@ -0,0 +1,32 @@
+// Command cctool runs the lenovo_bc chaincode on a mockstub.Stub, without a
+// network, to try transactions, replay production logs and measure load.
+//
+//	cctool simulate [flags] [script]   offline simulator, see simulator.go
+//	cctool replay [flags] replay.log   replays a txlog export, see replay.go
+//	cctool loadgen [flags]             load generator, see loadgen.go
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: cctool simulate|replay|loadgen [flags]")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	switch os.Args[1] {
+	case "simulate":
+		os.Exit(simulate(os.Args[2:]))
+	case "replay":
+		os.Exit(replay(os.Args[2:]))
+	case "loadgen":
+		os.Exit(loadgen(os.Args[2:]))
+	}
+	usage()
+}
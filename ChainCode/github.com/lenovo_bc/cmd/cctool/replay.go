@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.com/lenovo_bc/chaincode"
+	"github.com/lenovo_bc/mockstub"
+	"github.com/lenovo_bc/txlog"
+	"io"
+	"os"
+	"sort"
+)
+
+//Replays a transaction log against the current chaincode on a mockstub.Stub:
+//
+//	cctool replay [-from start.json] [-state snapshot.json] [-v] [-all] replay.log
+//
+//The log is written by eventlistener (-txlog or extract). Transactions run
+//with their production ID, time and creator; invalid ones are skipped like the
+//committer did. The writes and the event of each transaction are compared
+//with the recorded ones, the final world state with the -state snapshot or,
+//without one, with the state the recorded writes produce. -from restores the
+//state the log starts from, needed when it doesn't start with the first
+//block. State files are in the simulate save format.
+type Replayer struct {
+	Stub     *mockstub.Stub
+	Out      io.Writer
+	Log      *os.File          //Chaincode output, os.Stdout while calling
+	All      bool              //Report every transaction, not only differing ones
+	Expected map[string][]byte //Production state: the start state and the recorded writes
+	Replayed int
+	Skipped  int
+	Differ   int //Transactions whose writes, event or result differ
+}
+
+func NewReplayer(out io.Writer, log *os.File) (error, *Replayer) {
+	r := &Replayer{Out: out, Log: log, Expected: map[string][]byte{}}
+	r.Stub = mockstub.NewStub("lenovo_bc", new(chaincode.SmartContract))
+	var res pb.Response
+	quiet(log, func() {
+		res = r.Stub.MockInit("init", nil)
+	})
+	if res.Status >= shim.ERRORTHRESHOLD {
+		return fmt.Errorf("init: %s", res.Message), nil
+	}
+	r.drainEvents()
+	return nil, r
+}
+
+func (r *Replayer) drainEvents() []*pb.ChaincodeEvent {
+	events := []*pb.ChaincodeEvent{}
+	for len(r.Stub.ChaincodeEventsChannel) > 0 {
+		events = append(events, <-r.Stub.ChaincodeEventsChannel)
+	}
+	return events
+}
+
+//Writes the start state to the stub and to the expected state
+func (r *Replayer) Restore(entries []StateEntry) {
+	r.Stub.MockTransactionStart("restore")
+	defer r.Stub.MockTransactionEnd("restore")
+	for _, entry := range entries {
+		r.Stub.MockStub.PutState(entry.Key, entry.Data())
+		r.Expected[entry.Key] = entry.Data()
+	}
+}
+
+//Value for the report, nil is shown as deleted
+func replayValue(value []byte) string {
+	if value == nil {
+		return "(deleted)"
+	}
+	return string(bytes.Replace(value, []byte{0}, []byte(`\u0000`), -1))
+}
+
+//Runs one transaction of the log, returns the differences found
+func (r *Replayer) Replay(entry txlog.Entry) []string {
+	if !entry.Valid {
+		r.Skipped++
+		return nil
+	}
+	if len(entry.Args) == 0 {
+		r.Differ++
+		fmt.Fprintf(r.Out, "block %d tx %s: no function\n", entry.Block, entry.TxID)
+		return []string{"no function"}
+	}
+	r.Replayed++
+	differences := []string{}
+	err, ts := entry.Time()
+	if err != nil {
+		differences = append(differences, err.Error())
+	}
+	var res pb.Response
+	r.Stub.SetCreator(entry.Creator)
+	quiet(r.Log, func() {
+		res = r.Stub.MockInvokeAt(entry.TxID, ts, entry.ArgsBytes())
+	})
+	events := r.drainEvents()
+	if res.Status >= shim.ERRORTHRESHOLD {
+		differences = append(differences, fmt.Sprintf("failed: %s", res.Message))
+	}
+
+	recorded := map[string][]byte{}
+	keys := []string{}
+	for _, w := range entry.Writes {
+		if _, ok := recorded[w.Key]; !ok {
+			keys = append(keys, w.Key)
+		}
+		recorded[w.Key] = w.Data()
+	}
+	for _, key := range r.Stub.Written {
+		if _, ok := recorded[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		expected, written := recorded[key]
+		actual, ok := r.Stub.State[key]
+		if !ok {
+			actual = nil
+		} else if actual == nil {
+			actual = []byte{}
+		}
+		if !written {
+			differences = append(differences, fmt.Sprintf("%s: not written in production, replay %s", displayKey(key), replayValue(actual)))
+		} else if !bytes.Equal(expected, actual) || (expected == nil) != (actual == nil) {
+			differences = append(differences, fmt.Sprintf("%s: production %s, replay %s", displayKey(key), replayValue(expected), replayValue(actual)))
+		}
+	}
+
+	//Fabric keeps the last event of a transaction
+	var event *pb.ChaincodeEvent
+	if len(events) > 0 {
+		event = events[len(events)-1]
+	}
+	if entry.Event == nil && event != nil {
+		differences = append(differences, fmt.Sprintf("event: none in production, replay %s", event.EventName))
+	} else if entry.Event != nil && event == nil {
+		differences = append(differences, fmt.Sprintf("event: production %s, none in replay", entry.Event.Name))
+	} else if entry.Event != nil && (entry.Event.Name != event.EventName || !bytes.Equal(entry.Event.Data(), event.Payload)) {
+		differences = append(differences, fmt.Sprintf("event: production %s %s, replay %s %s", entry.Event.Name, entry.Event.Data(), event.EventName, event.Payload))
+	}
+
+	txlog.Apply(r.Expected, entry)
+	if len(differences) > 0 {
+		r.Differ++
+	}
+	if len(differences) > 0 || r.All {
+		fmt.Fprintf(r.Out, "block %d tx %s %s: %d differences\n", entry.Block, entry.TxID, entry.Args[0], len(differences))
+		for _, d := range differences {
+			fmt.Fprintf(r.Out, "  %s\n", d)
+		}
+	}
+	return differences
+}
+
+//Compares the replayed world state with the expected one, returns the
+//number of differing keys
+func (r *Replayer) Compare(expected map[string][]byte) int {
+	differences := txlog.Diff(expected, r.Stub.State)
+	for _, d := range differences {
+		fmt.Fprintf(r.Out, "state %s: production %s, replay %s\n", displayKey(d.Key), replayValue(d.Expected), replayValue(d.Actual))
+	}
+	return len(differences)
+}
+
+func replay(args []string) int {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	from := flags.String("from", "", "world state file the log starts from")
+	state := flags.String("state", "", "production world state file compared with the replayed state")
+	verbose := flags.Bool("v", false, "print the chaincode logs")
+	all := flags.Bool("all", false, "list every transaction, not only differing ones")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: cctool replay [-from start.json] [-state snapshot.json] [-v] [-all] replay.log")
+		return 2
+	}
+
+	log := (*os.File)(nil)
+	if !*verbose {
+		devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return 1
+		}
+		defer devNull.Close()
+		log = devNull
+	}
+	err, entries := txlog.Read(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+	err, r := NewReplayer(os.Stdout, log)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+	r.All = *all
+	if *from != "" {
+		err, start := readState(*from)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return 1
+		}
+		r.Restore(start)
+	}
+	for _, entry := range entries {
+		r.Replay(entry)
+	}
+
+	expected := r.Expected
+	if *state != "" {
+		err, snapshot := readState(*state)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return 1
+		}
+		expected = map[string][]byte{}
+		for _, entry := range snapshot {
+			expected[entry.Key] = entry.Data()
+		}
+	}
+	keys := r.Compare(expected)
+	fmt.Fprintf(os.Stdout, "%d transactions replayed, %d invalid skipped, %d differ; %d keys of the final state differ\n", r.Replayed, r.Skipped, r.Differ, keys)
+	if r.Differ > 0 || keys > 0 {
+		return 1
+	}
+	return 0
+}
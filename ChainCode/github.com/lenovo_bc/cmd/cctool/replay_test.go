@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/lenovo_bc/chaincode"
+	"github.com/lenovo_bc/mockstub"
+	"github.com/lenovo_bc/txlog"
+)
+
+//Runs the calls on a stub like the peer would and records them as a log
+func productionLog(t *testing.T, calls [][]string) []txlog.Entry {
+	stub := mockstub.NewStub("lenovo_bc", new(chaincode.SmartContract))
+	stub.MockInit("init", nil)
+	stub.SetCreator(chaincode.BUYER_MSP)
+	entries := []txlog.Entry{}
+	for i, call := range calls {
+		entry := txlog.Entry{Block: uint64(i + 1), TxID: fmt.Sprintf("prod%d", i), Valid: true, Chaincode: "lenovo_bc", Creator: chaincode.BUYER_MSP, Args: call,
+			Timestamp: fmt.Sprintf("2018-01-02T03:04:%02d.5Z", i)}
+		err, ts := entry.Time()
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := stub.MockInvokeAt(entry.TxID, ts, entry.ArgsBytes())
+		if res.Status != shim.OK {
+			t.Fatalf("%s failed %s", call[0], res.Message)
+		}
+		for _, key := range stub.Written {
+			value, ok := stub.State[key]
+			entry.Writes = append(entry.Writes, txlog.NewWrite(key, value, !ok))
+		}
+		for len(stub.ChaincodeEventsChannel) > 0 {
+			event := <-stub.ChaincodeEventsChannel
+			entry.Event = txlog.NewEvent(event.EventName, event.Payload)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestReplay(t *testing.T) {
+	entries := productionLog(t, [][]string{
+		{"crSalesOrderInfo", `[{"SONUMBER":"478","SOITEM":"10","CPONO":"C001","NETPRICE":"7","TRANSDOC":"SO"}]`, "1209"},
+		{"crPurchaseOrderInfo", `[{"PONO":"4500","POItemNO":"10","VendorNO":"1209","SONUMBER":"478","SOITEM":"10","TRANSDOC":"PO"}]`, "1209"},
+		{"setPurgeApprovers", `["lenovo"]`},
+		//the request ID and time come from the transaction
+		{"requestPurge", `{"keyPrefix":"PO","keysStart":["4500"],"Reason":"test data"}`},
+		{"removeFromStateByKey", `{"keyPrefix":"SO","keysStart":["478","10"]}`},
+	})
+	//rejected by the committer, nothing was written
+	entries = append(entries[:2], append([]txlog.Entry{{Block: 2, TxNum: 1, TxID: "mvcc", Valid: false, Chaincode: "lenovo_bc",
+		Args: []string{"crSalesOrderInfo", `[{"SONUMBER":"999","SOITEM":"10","TRANSDOC":"SO"}]`, "1209"}}}, entries[2:]...)...)
+
+	var out bytes.Buffer
+	err, r := NewReplayer(&out, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if differences := r.Replay(entry); len(differences) > 0 {
+			t.Fatalf("replay of %s differs %v", entry.TxID, differences)
+		}
+	}
+	if r.Replayed != 5 || r.Skipped != 1 || r.Differ != 0 || r.Compare(r.Expected) != 0 {
+		t.Fatalf("unexpected replay %d %d %d\n%s", r.Replayed, r.Skipped, r.Differ, out.String())
+	}
+
+	//production wrote another price and had no event for the PO
+	out.Reset()
+	err, r = NewReplayer(&out, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	soKey, _ := r.Stub.CreateCompositeKey(chaincode.SO_KEY, []string{"478", "10"})
+	last := entries[len(entries)-1]
+	for i, w := range last.Writes {
+		if w.Key == soKey {
+			last.Writes[i] = txlog.NewWrite(soKey, bytes.Replace(w.Data(), []byte(`"7"`), []byte(`"8"`), 1), false)
+		}
+	}
+	entries[1].Event = nil
+	for _, entry := range entries {
+		r.Replay(entry)
+	}
+	if r.Differ != 2 || !strings.Contains(out.String(), "block 5 tx prod4 removeFromStateByKey: 1 differences\n  SO 478 10: production") ||
+		!strings.Contains(out.String(), "event: none in production, replay POSTED") {
+		t.Fatalf("unexpected report\n%s", out.String())
+	}
+	out.Reset()
+	if r.Compare(r.Expected) != 1 || !strings.HasPrefix(out.String(), "state SO 478 10: production") {
+		t.Fatalf("unexpected state report %q", out.String())
+	}
+	snapshot := map[string][]byte{}
+	for key, value := range r.Stub.State {
+		snapshot[key] = value
+	}
+	delete(snapshot, soKey)
+	if r.Compare(snapshot) != 1 {
+		t.Fatal("missing key not reported")
+	}
+}
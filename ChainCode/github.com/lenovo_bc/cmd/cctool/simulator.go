@@ -0,0 +1,459 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/lenovo_bc/chaincode"
+	"github.com/lenovo_bc/client"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+//Offline simulator, runs the chaincode on a mockstub.Stub without a network:
+//
+//	cctool simulate [-fixtures f.json] [-state s.json] [-v] [-e] [script]
+//
+//Commands are read from the script, or from a prompt without one:
+//
+//	invoke crSalesOrderInfo @so.json 1209     @file is replaced by the file content
+//	invoke {"Args":["crSalesOrderInfo","[...]","1209"]}   peer CLI and csvtool import form
+//	query queryById lenovo {"keyPrefix":"SO","keysStart":["478","10"]}
+//	get SO 478 10        ledger value as stored, not filtered by role
+//	keys [SO]            keys of the world state
+//	load fixtures.json   runs the write batches of a fixture file
+//	save s.json / restore s.json   world state to and from disk
+//	events               chaincode events since the last events command
+//
+//Arguments are separated by spaces, JSON arguments may contain spaces; use
+//the peer CLI form or @file for other arguments with spaces.
+//Chaincode logs are discarded unless -v. Transactions are created by an
+//identity of the buyer MSP, so admin functions can be called.
+const SIMULATOR_HELP = `commands:
+  invoke <function> <arg>...   transaction, @file args are read from the file
+  invoke {"Args":[...]}        peer CLI form
+  query <function> <arg>...    query, same arguments as invoke
+  get <prefix> [key]...        ledger value of the composite key
+  keys [prefix]                keys of the world state
+  load <fixtures.json>         write batches [{"function","vendorNo","records"}]
+  save <state.json>            write the world state
+  restore <state.json>         replace the world state
+  events                       chaincode events since the last call
+  help, exit`
+
+//Write batch of a fixture file, one transaction each
+type Fixture struct {
+	Function string          `json:"function"` //crSalesOrderInfo, crPurchaseOrderInfo...
+	VendorNo string          `json:"vendorNo"`
+	Records  json.RawMessage `json:"records"` //JSON array of the records
+}
+
+//World state entry of a saved state file
+type StateEntry struct {
+	Key   string          `json:"Key"`             //Composite key, separators as \u0000
+	Value json.RawMessage `json:"Value,omitempty"` //JSON values
+	Bytes []byte          `json:"Bytes,omitempty"` //Other values
+}
+
+type Simulator struct {
+	Mock   *client.Mock
+	Out    io.Writer //Command output
+	Log    *os.File  //Chaincode output, os.Stdout while calling
+	Dir    string    //Base of relative paths in commands, the script directory
+	events int
+}
+
+func NewSimulator(out io.Writer, log *os.File) (error, *Simulator) {
+	s := &Simulator{Out: out, Log: log}
+	return s.reset(), s
+}
+
+func (s *Simulator) reset() error {
+	err, mock := client.NewMock("lenovo_bc", new(chaincode.SmartContract))
+	if err != nil {
+		return err
+	}
+	mock.Stub.SetCreator(chaincode.BUYER_MSP)
+	s.Mock = mock
+	s.events = 0
+	return nil
+}
+
+//Runs f with os.Stdout sent to the log, the chaincode prints to stdout
+func quiet(log *os.File, f func()) {
+	if log == nil {
+		f()
+		return
+	}
+	stdout := os.Stdout
+	os.Stdout = log
+	defer func() { os.Stdout = stdout }()
+	f()
+}
+
+func (s *Simulator) quiet(f func()) {
+	quiet(s.Log, f)
+}
+
+//Composite key as its attributes separated by spaces, "SO 478 10"
+func displayKey(key string) string {
+	//composite keys are \x00prefix\x00key\x00...
+	return strings.Join(strings.Split(strings.Trim(key, "\x00"), "\x00"), " ")
+}
+
+func (s *Simulator) path(name string) string {
+	if s.Dir == "" || strings.HasPrefix(name, "/") {
+		return name
+	}
+	return s.Dir + "/" + name
+}
+
+//Arguments of invoke and query: the peer CLI JSON, or words with @file
+func (s *Simulator) arguments(line string) (error, string, []string) {
+	if strings.HasPrefix(line, "{") {
+		call := struct{ Args []string }{}
+		if err := json.Unmarshal([]byte(line), &call); err != nil {
+			return err, "", nil
+		}
+		if len(call.Args) == 0 {
+			return fmt.Errorf("Args is empty"), "", nil
+		}
+		return nil, call.Args[0], call.Args[1:]
+	}
+	words := []string{}
+	for rest := line; rest != ""; {
+		i := strings.IndexAny(rest, " \t")
+		//JSON arguments may contain spaces
+		if rest[0] == '{' || rest[0] == '[' {
+			var raw json.RawMessage
+			if json.NewDecoder(strings.NewReader(rest)).Decode(&raw) == nil {
+				i = len(raw)
+			}
+		}
+		if i < 0 || i >= len(rest) {
+			words = append(words, rest)
+			break
+		}
+		words = append(words, rest[:i])
+		rest = strings.TrimSpace(rest[i:])
+	}
+	if len(words) == 0 {
+		return fmt.Errorf("function is missing"), "", nil
+	}
+	args := words[1:]
+	for i, arg := range args {
+		if strings.HasPrefix(arg, "@") {
+			b, err := ioutil.ReadFile(s.path(arg[1:]))
+			if err != nil {
+				return err, "", nil
+			}
+			args[i] = strings.TrimSpace(string(b))
+		}
+	}
+	return nil, words[0], args
+}
+
+func (s *Simulator) print(payload []byte) {
+	if len(payload) == 0 {
+		fmt.Fprintln(s.Out, "OK")
+		return
+	}
+	var b bytes.Buffer
+	if json.Indent(&b, bytes.Replace(payload, []byte{0}, []byte(`\u0000`), -1), "", "  ") != nil {
+		fmt.Fprintln(s.Out, string(payload))
+		return
+	}
+	fmt.Fprintln(s.Out, b.String())
+}
+
+func (s *Simulator) call(function string, args []string, invoke bool) error {
+	var err error
+	var payload []byte
+	s.quiet(func() {
+		if invoke {
+			var res client.Response
+			err, res = s.Mock.Invoke(function, args)
+			payload = res.Payload
+		} else {
+			err, payload = s.Mock.Query(function, args)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	s.print(payload)
+	return nil
+}
+
+func (s *Simulator) load(name string) error {
+	b, err := ioutil.ReadFile(s.path(name))
+	if err != nil {
+		return err
+	}
+	fixtures := []Fixture{}
+	err = json.Unmarshal(b, &fixtures)
+	if err != nil {
+		return fmt.Errorf("%s: %s", name, err.Error())
+	}
+	for i, fixture := range fixtures {
+		var res client.Response
+		s.quiet(func() {
+			err, res = s.Mock.Invoke(fixture.Function, []string{string(fixture.Records), fixture.VendorNo})
+		})
+		if err != nil {
+			return fmt.Errorf("%s[%d] %s: %s", name, i, fixture.Function, err.Error())
+		}
+		results := []chaincode.WriteResult{}
+		json.Unmarshal(res.Payload, &results)
+		rejected := 0
+		for _, result := range results {
+			if result.Status == chaincode.RESULT_REJECTED {
+				rejected++
+			}
+		}
+		fmt.Fprintf(s.Out, "%s[%d] %s: %d records, %d rejected\n", name, i, fixture.Function, len(results), rejected)
+	}
+	return nil
+}
+
+func (s *Simulator) save(name string) error {
+	keys := []string{}
+	for key := range s.Mock.Stub.State {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	//one entry per line, values kept as they are: JSON values are only
+	//written as JSON if encoding/json writes them back unchanged
+	var buffer bytes.Buffer
+	buffer.WriteString("[")
+	for i, key := range keys {
+		entry := StateEntry{Key: key}
+		value := s.Mock.Stub.State[key]
+		if b, err := json.Marshal(json.RawMessage(value)); err == nil && bytes.Equal(b, value) {
+			entry.Value = value
+		} else {
+			entry.Bytes = value
+		}
+		if i > 0 {
+			buffer.WriteString(",")
+		}
+		b, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		buffer.WriteString("\n")
+		buffer.Write(b)
+	}
+	buffer.WriteString("\n]\n")
+	err := ioutil.WriteFile(s.path(name), buffer.Bytes(), 0644)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(s.Out, "%d keys saved to %s\n", len(keys), name)
+	return nil
+}
+
+//Entries of a state file written by save
+func readState(path string) (error, []StateEntry) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err, nil
+	}
+	entries := []StateEntry{}
+	err = json.Unmarshal(b, &entries)
+	if err != nil {
+		return fmt.Errorf("%s: %s", path, err.Error()), nil
+	}
+	return nil, entries
+}
+
+//Ledger value of the entry
+func (e StateEntry) Data() []byte {
+	if e.Bytes != nil {
+		return e.Bytes
+	}
+	return []byte(e.Value)
+}
+
+func (s *Simulator) restore(name string) error {
+	err, entries := readState(s.path(name))
+	if err != nil {
+		return err
+	}
+	err = s.reset()
+	if err != nil {
+		return err
+	}
+	stub := s.Mock.Stub
+	stub.MockTransactionStart("restore")
+	defer stub.MockTransactionEnd("restore")
+	for _, entry := range entries {
+		//no history, the saved state has none
+		err = stub.MockStub.PutState(entry.Key, entry.Data())
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(s.Out, "%d keys restored from %s\n", len(entries), name)
+	return nil
+}
+
+//Runs one command line
+func (s *Simulator) Exec(line string) error {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+	command, rest := line, ""
+	if i := strings.IndexAny(line, " \t"); i > 0 {
+		command, rest = line[:i], strings.TrimSpace(line[i:])
+	}
+	words := strings.Fields(rest)
+	switch command {
+	case "invoke", "query":
+		err, function, args := s.arguments(rest)
+		if err != nil {
+			return err
+		}
+		return s.call(function, args, command == "invoke")
+	case "get":
+		if len(words) == 0 {
+			return fmt.Errorf("usage: get <prefix> [key]...")
+		}
+		key, _ := s.Mock.Stub.CreateCompositeKey(words[0], words[1:])
+		value, ok := s.Mock.Stub.State[key]
+		if !ok {
+			return &chaincode.ErrorInfo{Code: chaincode.ERR_NOT_FOUND, Key: key, Message: "No state for " + strings.Join(words, " ")}
+		}
+		s.print(value)
+	case "keys":
+		keys := []string{}
+		for key := range s.Mock.Stub.State {
+			display := displayKey(key)
+			if len(words) > 0 && strings.SplitN(display, " ", 2)[0] != words[0] {
+				continue
+			}
+			keys = append(keys, display)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintln(s.Out, key)
+		}
+	case "load", "save", "restore":
+		if len(words) != 1 {
+			return fmt.Errorf("usage: %s <file>", command)
+		}
+		if command == "load" {
+			return s.load(words[0])
+		} else if command == "save" {
+			return s.save(words[0])
+		}
+		return s.restore(words[0])
+	case "events":
+		for _, event := range s.Mock.Events[s.events:] {
+			fmt.Fprintln(s.Out, event.EventName)
+			s.print(event.Payload)
+		}
+		s.events = len(s.Mock.Events)
+	case "help":
+		fmt.Fprintln(s.Out, SIMULATOR_HELP)
+	default:
+		return fmt.Errorf("unknown command %s, try help", command)
+	}
+	return nil
+}
+
+//Runs the commands of r until exit, returns the number of failed commands.
+//With stopOnError the first failure ends the run.
+func (s *Simulator) Run(r io.Reader, prompt bool, stopOnError bool) int {
+	failed := 0
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for {
+		if prompt {
+			fmt.Fprint(s.Out, "> ")
+		}
+		if !scanner.Scan() {
+			break
+		}
+		line := scanner.Text()
+		if t := strings.TrimSpace(line); t == "exit" || t == "quit" {
+			break
+		}
+		if err := s.Exec(line); err != nil {
+			failed++
+			fmt.Fprintln(s.Out, "error: "+err.Error())
+			if stopOnError {
+				break
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		failed++
+		fmt.Fprintln(s.Out, "error: "+err.Error())
+	}
+	return failed
+}
+
+//cctool simulate, returns the exit status
+func simulate(args []string) int {
+	flags := flag.NewFlagSet("simulate", flag.ExitOnError)
+	fixtures := flags.String("fixtures", "", "fixture file loaded first")
+	state := flags.String("state", "", "world state file restored first")
+	verbose := flags.Bool("v", false, "print the chaincode logs")
+	stopOnError := flags.Bool("e", false, "stop at the first failed command")
+	flags.Parse(args)
+
+	log := (*os.File)(nil)
+	if !*verbose {
+		devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return 1
+		}
+		defer devNull.Close()
+		log = devNull
+	}
+	err, sim := NewSimulator(os.Stdout, log)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+	if *state != "" {
+		if err := sim.restore(*state); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return 1
+		}
+	}
+	if *fixtures != "" {
+		if err := sim.load(*fixtures); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return 1
+		}
+	}
+
+	in, prompt := io.Reader(os.Stdin), flags.NArg() == 0
+	if flags.NArg() > 0 && flags.Arg(0) != "-" {
+		f, err := os.Open(flags.Arg(0))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return 1
+		}
+		defer f.Close()
+		in = f
+		sim.Dir = filepath.Dir(flags.Arg(0))
+	}
+	if prompt {
+		fmt.Fprintln(os.Stdout, "lenovo_bc simulator, help lists the commands")
+	}
+	if sim.Run(in, prompt, *stopOnError) > 0 && !prompt {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/lenovo_bc/chaincode"
+	"github.com/lenovo_bc/model"
+)
+
+func TestSimulator(t *testing.T) {
+	var out bytes.Buffer
+	err, sim := NewSimulator(&out, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script, err := os.Open("testdata/transdoc.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer script.Close()
+	sim.Dir = "testdata"
+	if err := sim.Exec("load fixtures.json"); err != nil {
+		t.Fatal(err)
+	}
+	if failed := sim.Run(script, false, true); failed != 0 {
+		t.Fatalf("script failed\n%s", out.String())
+	}
+	//the second BL replaced the billing lines, the SO kept them
+	record, _ := sim.Mock.Stub.CreateCompositeKey(chaincode.SO_KEY, []string{"478", "10"})
+	so := model.SalesOrder{}
+	json.Unmarshal(sim.Mock.Stub.State[record], &so)
+	if len(so.BILLINFOS) != 1 || so.BILLINFOS[0].BILLINGNO != "9002" || so.NETPRICE != "8" || so.PONO != "4500" {
+		t.Fatalf("unexpected sales order %+v", so)
+	}
+	if !strings.Contains(out.String(), `"NETPRICE": "***"`) {
+		t.Fatalf("supplier query not masked\n%s", out.String())
+	}
+
+	dir, err := ioutil.TempDir("", "simulator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	state := map[string][]byte{}
+	for key, value := range sim.Mock.Stub.State {
+		state[key] = value
+	}
+	sim.Dir = dir
+	if err := sim.Exec("save state.json"); err != nil {
+		t.Fatal(err)
+	}
+	sim.Exec("invoke removeFromStateByKey {\"keyPrefix\":\"SO\",\"keysStart\":[\"478\"]}")
+	if err := sim.Exec("restore state.json"); err != nil {
+		t.Fatal(err)
+	}
+	if len(sim.Mock.Stub.State) != len(state) {
+		t.Fatalf("restored %d keys, expected %d", len(sim.Mock.Stub.State), len(state))
+	}
+	for key, value := range state {
+		if !bytes.Equal(sim.Mock.Stub.State[key], value) {
+			t.Fatalf("%q restored as %s", key, sim.Mock.Stub.State[key])
+		}
+	}
+	out.Reset()
+	sim.Exec("keys PO")
+	if out.String() != "PO 4500 10\n" {
+		t.Fatalf("unexpected keys %q", out.String())
+	}
+	if sim.Exec("get SO 1") == nil || sim.Exec("unknown") == nil {
+		t.Fatal("bad commands did not fail")
+	}
+}
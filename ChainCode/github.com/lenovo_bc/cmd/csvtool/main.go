@@ -0,0 +1,128 @@
+// Command csvtool converts spreadsheet corrections to chaincode batches and
+// ledger query output back to CSV.
+//
+//	csvtool import -entity GR [-map mapping.json] [-batch 100] [-vendor 1209] gr.csv
+//	csvtool export -entity GR [-map mapping.json] query.json
+//	csvtool columns -entity GR
+//
+// import writes one JSON batch per line. With -vendor each line is the
+// {"Args":[function, batch, vendor]} argument of "peer chaincode invoke -c".
+// export reads queryByIdRange output from the file or stdin.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/lenovo_bc/csvio"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: csvtool import|export|columns -entity <"+strings.Join(csvio.Names(), "|")+"> [flags] [file]")
+	os.Exit(2)
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err.Error())
+	os.Exit(1)
+}
+
+func loadMapping(path string) (error, csvio.Mapping) {
+	mapping := csvio.Mapping{}
+	if path == "" {
+		return nil, mapping
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err, nil
+	}
+	err = json.Unmarshal(b, &mapping)
+	if err != nil {
+		return fmt.Errorf("%s: %s", path, err.Error()), nil
+	}
+	return nil, mapping
+}
+
+func input(flags *flag.FlagSet) (error, io.ReadCloser) {
+	if flags.NArg() == 0 || flags.Arg(0) == "-" {
+		return nil, os.Stdin
+	}
+	f, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err, nil
+	}
+	return nil, f
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	command := os.Args[1]
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	entityName := flags.String("entity", "", "entity: "+strings.Join(csvio.Names(), ", "))
+	mappingPath := flags.String("map", "", "JSON file mapping CSV headers to columns")
+	batch := flags.Int("batch", 100, "records per batch, 0 for one batch (import)")
+	vendor := flags.String("vendor", "", "vendor no, writes peer invoke arguments (import)")
+	flags.Parse(os.Args[2:])
+
+	entity, ok := csvio.Entities[strings.ToUpper(*entityName)]
+	if !ok {
+		usage()
+	}
+	err, mapping := loadMapping(*mappingPath)
+	if err != nil {
+		fail(err)
+	}
+
+	switch command {
+	case "columns":
+		fmt.Println(strings.Join(entity.Columns(), ","))
+	case "import":
+		err, r := input(flags)
+		if err != nil {
+			fail(err)
+		}
+		defer r.Close()
+		errs, records := entity.Import(r, mapping)
+		if errs != nil {
+			for _, err := range errs {
+				fmt.Fprintln(os.Stderr, err.Error())
+			}
+			os.Exit(1)
+		}
+		err, batches := csvio.Batches(records, *batch)
+		if err != nil {
+			fail(err)
+		}
+		for _, b := range batches {
+			if *vendor == "" {
+				fmt.Println(b)
+				continue
+			}
+			args, _ := json.Marshal(map[string][]string{"Args": {entity.Function, b, *vendor}})
+			fmt.Println(string(args))
+		}
+		fmt.Fprintf(os.Stderr, "%d %s records in %d batches for %s\n", len(records), entity.Name, len(batches), entity.Function)
+	case "export":
+		err, r := input(flags)
+		if err != nil {
+			fail(err)
+		}
+		defer r.Close()
+		payload, err := ioutil.ReadAll(r)
+		if err != nil {
+			fail(err)
+		}
+		err = entity.Export(payload, os.Stdout, mapping)
+		if err != nil {
+			fail(err)
+		}
+	default:
+		usage()
+	}
+}
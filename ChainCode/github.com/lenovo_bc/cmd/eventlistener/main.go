@@ -0,0 +1,441 @@
+// Command eventlistener listens to the block events of the peer and turns
+// the POSTED events of lenovo_bc into SAP outbound messages and partner
+// webhook calls, delivered through outboxes with retry and dead letters.
+//
+//	eventlistener listen -events-address 0.0.0.0:7053 -events-from-chaincode lenovo_bc -outbox ./outbox [-target ./sap | -url http://...] [-webhooks ./webhooks] [-api http://... -user u -password p] [-txlog replay.log]
+//	eventlistener flush  -outbox ./outbox [-target ./sap | -url http://...]
+//	eventlistener list   -outbox ./outbox [-state dead] [-queue webhook]
+//	eventlistener replay -outbox ./outbox [-queue webhook] [message ID ...]
+//	eventlistener subscriptions -webhooks ./webhooks [-import subscriptions.json]
+//	eventlistener deliveries -webhooks ./webhooks
+//	eventlistener stub   -addr :8081 -dir ./received [-fail 2] [-secret webhook-secret]
+//	eventlistener extract -txlog replay.log [-events-from-chaincode lenovo_bc] block.pb...
+//
+// Messages go to the -target directory, or are POSTed to -url if given.
+// replay without IDs queues all dead letters again.
+//
+// Webhook subscriptions are kept in -webhooks/subscriptions.json. Seed it with
+// the output of queryWebhookSubscriptions invoked by the buyer org; later
+// changes arrive with the POSTED events. Events carry no secrets: with -api,
+// -user and -password of a buyer org user the subscriptions are queried
+// through the API server before a delivery to a new or changed secret,
+// without them import the subscriptions again by hand. Calls are queued in
+// -webhooks/outbox and logged to -webhooks/delivery.log. The stub checks
+// signatures if -secret is set.
+//
+// With -txlog, listen appends the chaincode transactions of every block to a
+// replay log (package txlog) for cctool replay. extract does the same for
+// block files fetched with peer channel fetch <n> block.pb.
+package main
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+	"github.com/hyperledger/fabric/core/ledger/util"
+	"github.com/hyperledger/fabric/events/consumer"
+	"github.com/hyperledger/fabric/msp/mgmt"
+	"github.com/hyperledger/fabric/msp/mgmt/testtools"
+	"github.com/hyperledger/fabric/protos/common"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.com/hyperledger/fabric/protos/utils"
+	"github.com/lenovo_bc/client"
+	"github.com/lenovo_bc/outbound"
+	"github.com/lenovo_bc/txlog"
+	"github.com/lenovo_bc/webhook"
+)
+
+type adapter struct {
+	notfy chan *pb.Event_Block
+}
+
+//Disconnected implements consumer.EventAdapter interface for disconnecting
+func (a *adapter) Disconnected(err error) {
+	fmt.Print("Disconnected...exiting\n")
+	os.Exit(1)
+}
+
+//Recv implements consumer.EventAdapter interface for receiving events
+func (a *adapter) Recv(msg *pb.Event) (bool, error) {
+	if o, e := msg.Event.(*pb.Event_Block); e {
+		a.notfy <- o
+		return true, nil
+	}
+	return false, fmt.Errorf("Receive unknown type event: %v", msg)
+}
+
+//GetInterestedEvents implements consumer.EventAdapter interface for registering interested events
+func (a *adapter) GetInterestedEvents() ([]*pb.Interest, error) {
+	return []*pb.Interest{{EventType: pb.EventType_BLOCK}}, nil
+}
+
+func createEventClient(eventAddress string, _ string) *adapter {
+	var obcEHClient *consumer.EventsClient
+
+	done := make(chan *pb.Event_Block)
+	adapter := &adapter{notfy: done}
+	obcEHClient, _ = consumer.NewEventsClient(eventAddress, 5, adapter)
+	if err := obcEHClient.Start(); err != nil {
+		fmt.Printf("could not start chat. err: %s\n", err)
+		obcEHClient.Stop()
+		return nil
+	}
+
+	return adapter
+}
+// getChainCodeEvents parses block events for chaincode events associated with individual transactions
+func getChainCodeEvents(tdata []byte) (*pb.ChaincodeEvent, error) {
+	err, ccEvent := txlog.ChaincodeEvent(tdata)
+	if err != nil {
+		return nil, err
+	}
+	if ccEvent == nil {
+		return nil, errors.New("No events found")
+	}
+	return ccEvent, nil
+}
+func getTxPayload(tdata []byte) (*common.Payload, error) {
+	if tdata == nil {
+		return nil, errors.New("Cannot extract payload from nil transaction")
+	}
+
+	if env, err := utils.GetEnvelopeFromBlock(tdata); err != nil {
+		return nil, fmt.Errorf("Error getting tx from block(%s)", err)
+	} else if env != nil {
+		// get the payload from the envelope
+		payload, err := utils.GetPayload(env)
+		if err != nil {
+			return nil, fmt.Errorf("Could not extract payload from envelope, err %s", err)
+		}
+		return payload, nil
+	}
+	return nil, nil
+}
+
+type options struct {
+	eventAddress string
+	chaincodeID  string
+	mspDir       string
+	mspID        string
+	outboxDir    string
+	target       string
+	url          string
+	format       string
+	partner      outbound.Partner
+	maxAttempts  int
+	backoff      time.Duration
+	interval     time.Duration
+	state        string
+	addr         string
+	dir          string
+	fail         int
+	webhookDir   string
+	queue        string
+	importFile   string
+	secret       string
+	txlog        string
+	api          string
+	channel      string
+	user         string
+	password     string
+}
+
+type webhooks struct {
+	registry *webhook.Registry
+	log      *webhook.Log
+	outbox   *outbound.Outbox
+}
+
+func openWebhooks(opts options) *webhooks {
+	err, registry := webhook.OpenRegistry(filepath.Join(opts.webhookDir, "subscriptions.json"))
+	if err != nil {
+		fmt.Printf("Error opening webhook subscriptions: %s\n", err)
+		os.Exit(1)
+	}
+	if opts.api != "" {
+		registry.Source = subscriptionSource(opts)
+	}
+	log := &webhook.Log{Path: filepath.Join(opts.webhookDir, "delivery.log")}
+	err, outbox := outbound.NewOutbox(filepath.Join(opts.webhookDir, "outbox"), webhook.NewSink(registry, log))
+	if err != nil {
+		fmt.Printf("Error opening webhook outbox: %s\n", err)
+		os.Exit(1)
+	}
+	outbox.MaxAttempts = opts.maxAttempts
+	outbox.Backoff = opts.backoff
+	return &webhooks{registry: registry, log: log, outbox: outbox}
+}
+
+//queryWebhookSubscriptions through the API server as the buyer org user,
+//logged in for every call since refreshes are rare and tokens expire
+func subscriptionSource(opts options) func() (error, []byte) {
+	return func() (error, []byte) {
+		gateway := client.NewGateway(opts.api, opts.channel, opts.chaincodeID)
+		err := gateway.Login(opts.user, opts.password)
+		if err != nil {
+			return err, nil
+		}
+		return gateway.Query("queryWebhookSubscriptions", []string{gateway.Role, ""})
+	}
+}
+
+//Outbox of list and replay
+func queueOutbox(opts options) *outbound.Outbox {
+	if opts.queue == "webhook" {
+		return openWebhooks(opts).outbox
+	}
+	return openOutbox(opts)
+}
+
+func openOutbox(opts options) *outbound.Outbox {
+	var sink outbound.Sink = outbound.DirSink{Dir: opts.target}
+	if opts.url != "" {
+		sink = outbound.HTTPSink{URL: opts.url}
+	}
+	err, outbox := outbound.NewOutbox(opts.outboxDir, sink)
+	if err != nil {
+		fmt.Printf("Error opening outbox %s: %s\n", opts.outboxDir, err)
+		os.Exit(1)
+	}
+	outbox.MaxAttempts = opts.maxAttempts
+	outbox.Backoff = opts.backoff
+	return outbox
+}
+
+func flush(outbox *outbound.Outbox) {
+	err, result := outbox.Flush()
+	if err != nil {
+		fmt.Printf("Error flushing outbox %s: %s\n", outbox.Dir, err)
+		return
+	}
+	if result.Sent+result.Retried+result.Dead > 0 {
+		fmt.Printf("Outbox %s: %d sent, %d retried, %d dead, %d waiting\n", outbox.Dir, result.Sent, result.Retried, result.Dead, result.Waiting)
+	}
+}
+
+func enqueue(outbox *outbound.Outbox, messages []outbound.Message, txID string) {
+	for _, m := range messages {
+		err, queued := outbox.Enqueue(m)
+		if err != nil {
+			fmt.Printf("Error queuing message %s: %s\n", m.ID, err)
+		} else if queued {
+			fmt.Printf("Queued %s %s for tx %s\n", m.MessageType, m.ID, txID)
+		}
+	}
+}
+
+//块中有效交易的chaincode事件写入outbox
+func enqueueBlock(outbox *outbound.Outbox, hooks *webhooks, opts options, block *common.Block) {
+	txsFltr := util.TxValidationFlags(block.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER])
+	for i, r := range block.Data.Data {
+		if txsFltr.IsInvalid(i) {
+			fmt.Printf("Transaction %d is invalid, skipped\n", i)
+			continue
+		}
+		event, err := getChainCodeEvents(r)
+		if err != nil || event == nil {
+			continue
+		}
+		if opts.chaincodeID != "" && event.ChaincodeId != opts.chaincodeID {
+			continue
+		}
+		err, messages := outbound.Translate(event.EventName, event.Payload, opts.format, opts.partner)
+		if err != nil {
+			fmt.Printf("Error translating event %s of tx %s: %s\n", event.EventName, event.TxId, err)
+		} else {
+			enqueue(outbox, messages, event.TxId)
+		}
+		err, messages = webhook.Translate(hooks.registry, event.EventName, event.Payload)
+		if err != nil {
+			fmt.Printf("Error translating event %s of tx %s to webhooks: %s\n", event.EventName, event.TxId, err)
+		} else {
+			enqueue(hooks.outbox, messages, event.TxId)
+		}
+	}
+}
+
+//块中的chaincode交易写入replay log
+func recordBlock(opts options, block *common.Block) error {
+	err, entries := txlog.Decode(block, opts.chaincodeID)
+	if err != nil {
+		return err
+	}
+	return txlog.Append(opts.txlog, entries)
+}
+
+func extract(opts options, files []string) error {
+	if opts.txlog == "" {
+		return errors.New("-txlog is required")
+	}
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		err, block := txlog.UnmarshalBlock(b)
+		if err != nil {
+			return fmt.Errorf("%s: %s", file, err.Error())
+		}
+		err = recordBlock(opts, block)
+		if err != nil {
+			return fmt.Errorf("%s: %s", file, err.Error())
+		}
+		fmt.Printf("Block %d of %s written to %s\n", block.Header.Number, file, opts.txlog)
+	}
+	return nil
+}
+
+func listen(opts options) {
+	//if no msp info provided, we use the default MSP under fabric/sampleconfig
+	if opts.mspDir == "" {
+		err := testtools.LoadMSPSetupForTesting()
+		if err != nil {
+			fmt.Printf("Could not initialize msp, err %s\n", err)
+			os.Exit(-1)
+		}
+	} else {
+		err := mgmt.LoadLocalMsp(opts.mspDir, nil, opts.mspID)
+		if err != nil {
+			fmt.Printf("Could not initialize msp, err %s\n", err)
+			os.Exit(-1)
+		}
+	}
+	outbox := openOutbox(opts)
+	hooks := openWebhooks(opts)
+	fmt.Printf("Event Address: %s\n", opts.eventAddress)
+	a := createEventClient(opts.eventAddress, opts.chaincodeID)
+	if a == nil {
+		fmt.Println("Error creating event client")
+		os.Exit(1)
+	}
+	//retries are due without new blocks
+	ticker := time.NewTicker(opts.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case b := <-a.notfy:
+			fmt.Printf("Received block %d\n", b.Block.Header.Number)
+			enqueueBlock(outbox, hooks, opts, b.Block)
+			if opts.txlog != "" {
+				if err := recordBlock(opts, b.Block); err != nil {
+					fmt.Printf("Error writing block %d to %s: %s\n", b.Block.Header.Number, opts.txlog, err)
+				}
+			}
+			flush(outbox)
+			flush(hooks.outbox)
+		case <-ticker.C:
+			flush(outbox)
+			flush(hooks.outbox)
+		}
+	}
+}
+
+func main() {
+	command := "listen"
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		command, args = args[0], args[1:]
+	}
+	opts := options{}
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	flags.StringVar(&opts.eventAddress, "events-address", "0.0.0.0:7053", "address of events server")
+	flags.StringVar(&opts.chaincodeID, "events-from-chaincode", "lenovo_bc", "listen to events from given chaincode")
+	flags.StringVar(&opts.mspDir, "events-mspdir", "", "set up the msp direction")
+	flags.StringVar(&opts.mspID, "events-mspid", "", "set up the mspid")
+	flags.StringVar(&opts.outboxDir, "outbox", "outbox", "outbox directory")
+	flags.StringVar(&opts.target, "target", "sap", "directory SAP reads the messages from")
+	flags.StringVar(&opts.url, "url", "", "HTTP endpoint taking the messages, instead of -target")
+	flags.StringVar(&opts.format, "format", outbound.FORMAT_IDOC, "message format, idoc or json")
+	flags.StringVar(&opts.partner.MANDT, "mandt", "", "SAP client of the IDoc control record")
+	flags.StringVar(&opts.partner.RCVPRN, "rcvprn", "", "SAP logical system of the IDoc control record")
+	flags.IntVar(&opts.maxAttempts, "retries", 5, "failed deliveries before a message is dead")
+	flags.DurationVar(&opts.backoff, "backoff", 30*time.Second, "first retry delay, doubled per attempt")
+	flags.DurationVar(&opts.interval, "interval", 10*time.Second, "outbox flush interval")
+	flags.StringVar(&opts.state, "state", outbound.STATE_DEAD, "messages listed: pending, sent or dead")
+	flags.StringVar(&opts.addr, "addr", ":8081", "listen address of the stub")
+	flags.StringVar(&opts.dir, "dir", "received", "directory the stub stores messages in")
+	flags.IntVar(&opts.fail, "fail", 0, "requests the stub fails before accepting")
+	flags.StringVar(&opts.webhookDir, "webhooks", "webhooks", "webhook subscriptions, outbox and delivery log directory")
+	flags.StringVar(&opts.queue, "queue", "sap", "outbox listed or replayed: sap or webhook")
+	flags.StringVar(&opts.importFile, "import", "", "queryWebhookSubscriptions output replacing the subscriptions")
+	flags.StringVar(&opts.secret, "secret", "", "webhook secret the stub checks signatures with")
+	flags.StringVar(&opts.txlog, "txlog", "", "replay log the chaincode transactions of the blocks are appended to")
+	flags.StringVar(&opts.api, "api", "", "API server URL the webhook subscriptions are queried from")
+	flags.StringVar(&opts.channel, "channel", "mychannel", "channel of the API server")
+	flags.StringVar(&opts.user, "user", "", "API server user of the buyer org")
+	flags.StringVar(&opts.password, "password", "", "API server password")
+	flags.Parse(args)
+
+	switch command {
+	case "listen":
+		listen(opts)
+	case "flush":
+		flush(openOutbox(opts))
+		flush(openWebhooks(opts).outbox)
+	case "list":
+		err, messages := queueOutbox(opts).List(opts.state)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		for _, m := range messages {
+			fmt.Printf("%s\t%s\t%d\t%s\n", m.ID, m.MessageType, m.Attempts, m.LastError)
+		}
+	case "replay":
+		err, count := queueOutbox(opts).Replay(flags.Args())
+		fmt.Printf("%d messages queued again\n", count)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	case "stub":
+		err := os.MkdirAll(opts.dir, 0755)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Printf("Stub listening on %s, storing messages in %s\n", opts.addr, opts.dir)
+		var handler http.Handler = &outbound.Stub{Dir: opts.dir, Fail: opts.fail}
+		if opts.secret != "" {
+			handler = &webhook.Stub{Secret: opts.secret, Dir: opts.dir, Fail: opts.fail}
+		}
+		fmt.Println(http.ListenAndServe(opts.addr, handler))
+		os.Exit(1)
+	case "subscriptions":
+		hooks := openWebhooks(opts)
+		if opts.importFile != "" {
+			b, err := ioutil.ReadFile(opts.importFile)
+			if err == nil {
+				err, _ = hooks.registry.Import(b)
+			}
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		}
+		for _, sub := range hooks.registry.List() {
+			fmt.Printf("%s\t%s\t%s\t%s=%s\t%s\n", sub.ID, sub.Partner, sub.Entity, sub.FilterField, sub.FilterValue, sub.URL)
+		}
+	case "deliveries":
+		err, deliveries := openWebhooks(opts).log.Read()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		for _, d := range deliveries {
+			fmt.Printf("%s\t%s\t%s\t%s\t%d\t%s\n", d.Time, d.MessageID, d.Partner, d.Status, d.HTTPStatus, d.Error)
+		}
+	case "extract":
+		if err := extract(opts, flags.Args()); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	default:
+		fmt.Println("usage: eventlistener [listen|flush|list|replay|subscriptions|deliveries|stub|extract] [flags]")
+		os.Exit(2)
+	}
+}
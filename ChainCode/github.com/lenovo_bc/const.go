@@ -1,12 +0,0 @@
-package main
-
-
-//Key Prefix
-const SO_KEY = "SO"        //SalesOrder Key
-const PO_KEY = "PO"        //PurchaseOrder key
-const CPO_KEY = "CPO"      // ODM Key
-const SUPPLIER_KEY = "SUP" // ODM Key
-const STAR = "***"
-
-
-
@@ -0,0 +1,415 @@
+// Package csvio converts CSV files to the JSON batches taken by the
+// cr*Info chaincode functions, and flattens queryByIdRange output to CSV.
+//
+// Each entity fixes the chaincode function, the TRANSDOC and the columns.
+// Column names are the JSON names of the chaincode structs, nested
+// attachments are written as "Attachments.ID". A mapping translates other
+// CSV headers to these names.
+//
+// Item entities (BL, GI, GR, POCON, INV, INDN) group rows on the key columns
+// into one record. The chaincode replaces the item list of a record with the
+// one sent, so a file must hold all items of the records it touches.
+package csvio
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/lenovo_bc/model"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+//Header -> column, "-" ignores the header
+type Mapping map[string]string
+
+type Entity struct {
+	Name      string            //Entity name
+	Function  string            //Chaincode function taking the batches
+	TRANSDOC  string            //TRANSDOC of every record, "" keeps the TRANSDOC column
+	KeyPrefix string            //Key prefix of the exported records
+	Keys      []string          //Key columns, required on every row
+	Items     string            //JSON name of the item list, "" if a row is a record
+	Aliases   map[string]string //Ledger column -> request column, for export
+	request   reflect.Type      //Record sent to Function
+	ledger    reflect.Type      //Record returned by queryByIdRange
+}
+
+var Entities = map[string]Entity{
+	"SO":     {Name: "SO", Function: "crSalesOrderInfo", TRANSDOC: "SO", KeyPrefix: "SO", Keys: []string{"SONUMBER", "SOITEM"}},
+	"BL":     {Name: "BL", Function: "crSalesOrderInfo", TRANSDOC: "BL", KeyPrefix: "SO", Keys: []string{"SONUMBER", "SOITEM"}, Items: "BILLINFOS"},
+	"GI":     {Name: "GI", Function: "crSalesOrderInfo", TRANSDOC: "GI", KeyPrefix: "SO", Keys: []string{"SONUMBER", "SOITEM"}, Items: "GIINFOS"},
+	"PO":     {Name: "PO", Function: "crPurchaseOrderInfo", TRANSDOC: "PO", KeyPrefix: "PO", Keys: []string{"PONO", "POItemNO"}},
+	"GR":     {Name: "GR", Function: "crPurchaseOrderInfo", TRANSDOC: "GR", KeyPrefix: "PO", Keys: []string{"PONO", "POItemNO"}, Items: "GRInfos"},
+	"POCON":  {Name: "POCON", Function: "crPurchaseOrderInfo", TRANSDOC: "POCON", KeyPrefix: "PO", Keys: []string{"PONO", "POItemNO"}, Items: "Confirmation"},
+	"INV":    {Name: "INV", Function: "crPurchaseOrderInfo", TRANSDOC: "INV", KeyPrefix: "PO", Keys: []string{"PONO", "POItemNO"}, Items: "Invoice"},
+	"INDN":   {Name: "INDN", Function: "crPurchaseOrderInfo", TRANSDOC: "INDN", KeyPrefix: "PO", Keys: []string{"PONO", "POItemNO"}, Items: "InboundDelivery"},
+	"ASN":    {Name: "ASN", Function: "crSupplierOrderInfo", KeyPrefix: "SUP", Keys: []string{"ASNNumber"}},
+	"ODMGR":  {Name: "ODMGR", Function: "crCPurchaseOrderInfo", TRANSDOC: "GR", KeyPrefix: "CPO", Keys: []string{"CPONO"}, Items: "ODMGRInfos"},
+	"ODMPAY": {Name: "ODMPAY", Function: "crCPurchaseOrderInfo", TRANSDOC: "BL", KeyPrefix: "CPO", Keys: []string{"CPONO"}, Items: "ODMPayments", Aliases: map[string]string{"BILLINGNO": "INVOICENUM"}},
+}
+
+func init() {
+	types := map[string][2]interface{}{
+		"SO": {model.SalesOrder{}, model.SalesOrder{}}, "PO": {model.PurchaseOrder{}, model.PurchaseOrder{}},
+		"SUP": {model.SupplierOrder{}, model.SupplierOrder{}}, "CPO": {model.ODMInfoReq{}, model.ODMPurchaseOrder{}},
+	}
+	for name, entity := range Entities {
+		entity.request = reflect.TypeOf(types[entity.KeyPrefix][0])
+		entity.ledger = reflect.TypeOf(types[entity.KeyPrefix][1])
+		Entities[name] = entity
+	}
+}
+
+//Entity names, sorted
+func Names() []string {
+	names := []string{}
+	for name := range Entities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type column struct {
+	name  string
+	index []int
+}
+
+func jsonName(f reflect.StructField) string {
+	name := strings.Split(f.Tag.Get("json"), ",")[0]
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
+
+//Struct with exported string fields only, like Attachment
+func flatStruct(t reflect.Type) bool {
+	found := false
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		if f.Type.Kind() != reflect.String {
+			return false
+		}
+		found = true
+	}
+	return found
+}
+
+//String fields of t, fields of flat nested structs as "Parent.Child"
+func columnsOf(t reflect.Type) []column {
+	columns := []column{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := jsonName(f)
+		if f.PkgPath != "" || name == "-" || name == "TRANSDOC" {
+			continue
+		}
+		if f.Type.Kind() == reflect.String {
+			columns = append(columns, column{name: name, index: []int{i}})
+		} else if f.Type.Kind() == reflect.Struct && flatStruct(f.Type) {
+			for _, nested := range columnsOf(f.Type) {
+				columns = append(columns, column{name: name + "." + nested.name, index: append([]int{i}, nested.index...)})
+			}
+		}
+	}
+	return columns
+}
+
+//Field index of the item list, nil if t has none
+func itemsField(t reflect.Type, items string) []int {
+	if items == "" {
+		return nil
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if jsonName(f) == items && f.Type.Kind() == reflect.Slice {
+			return []int{i}
+		}
+	}
+	return nil
+}
+
+func (e Entity) keyColumns(t reflect.Type) []column {
+	all := map[string]column{}
+	for _, c := range columnsOf(t) {
+		all[c.name] = c
+	}
+	columns := []column{}
+	for _, key := range e.Keys {
+		columns = append(columns, all[key])
+	}
+	return columns
+}
+
+//Columns accepted by Import. index is relative to the item for item columns.
+func (e Entity) importColumns() (keys []column, items []column, index []int) {
+	index = itemsField(e.request, e.Items)
+	if index == nil {
+		return nil, columnsOf(e.request), nil
+	}
+	return e.keyColumns(e.request), columnsOf(e.request.FieldByIndex(index).Type.Elem()), index
+}
+
+//Column names accepted by Import
+func (e Entity) Columns() []string {
+	keys, items, _ := e.importColumns()
+	names := []string{}
+	for _, c := range append(keys, items...) {
+		names = append(names, c.name)
+	}
+	if e.TRANSDOC == "" {
+		names = append(names, "TRANSDOC")
+	}
+	return names
+}
+
+func lineError(line int, format string, a ...interface{}) error {
+	return fmt.Errorf("line %d: %s", line, fmt.Sprintf(format, a...))
+}
+
+//读取CSV, 按mapping对应到字段, 校验并生成chaincode记录.
+//Returns all row errors at once, records are nil if there are any.
+func (e Entity) Import(r io.Reader, mapping Mapping) ([]error, []interface{}) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return []error{fmt.Errorf("header: %s", err.Error())}, nil
+	}
+	keyColumns, itemColumns, itemsIndex := e.importColumns()
+	known := map[string]column{}
+	for _, c := range keyColumns {
+		known[c.name] = c
+	}
+	for _, c := range itemColumns {
+		known[c.name] = c
+	}
+	if e.TRANSDOC == "" {
+		if f, ok := e.request.FieldByName("TRANSDOC"); ok {
+			known["TRANSDOC"] = column{name: "TRANSDOC", index: f.Index}
+		}
+	}
+	errs := []error{}
+	targets := make([]*column, len(header))
+	seen := map[string]bool{}
+	for i, h := range header {
+		name := strings.TrimSpace(h)
+		if mapped, ok := mapping[name]; ok {
+			name = mapped
+		}
+		if name == "-" {
+			continue
+		}
+		c, ok := known[name]
+		if !ok {
+			for n, candidate := range known {
+				if strings.EqualFold(n, name) {
+					c, ok = candidate, true
+					name = n
+					break
+				}
+			}
+		}
+		if !ok {
+			errs = append(errs, lineError(1, "column %q is not a field of %s", h, e.Name))
+			continue
+		}
+		if seen[name] {
+			errs = append(errs, lineError(1, "column %s appears twice", name))
+			continue
+		}
+		seen[name] = true
+		target := c
+		targets[i] = &target
+	}
+	for _, key := range e.Keys {
+		if !seen[key] {
+			errs = append(errs, lineError(1, "key column %s is missing", key))
+		}
+	}
+	if len(errs) > 0 {
+		return errs, nil
+	}
+
+	isKey := map[string]bool{}
+	for _, key := range e.Keys {
+		isKey[key] = true
+	}
+	records := []reflect.Value{}
+	index := map[string]int{}
+	line := 1
+	for {
+		row, err := reader.Read()
+		line++
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			errs = append(errs, err)
+			if _, ok := err.(*csv.ParseError); ok {
+				continue
+			}
+			break
+		}
+		record := reflect.New(e.request).Elem()
+		var item reflect.Value
+		if itemsIndex != nil {
+			item = reflect.New(record.FieldByIndex(itemsIndex).Type().Elem()).Elem()
+		}
+		keys := []string{}
+		values := map[string]string{}
+		for i, value := range row {
+			if targets[i] == nil {
+				continue
+			}
+			values[targets[i].name] = strings.TrimSpace(value)
+		}
+		for _, key := range e.Keys {
+			if values[key] == "" {
+				errs = append(errs, lineError(line, "%s is required", key))
+			}
+			keys = append(keys, values[key])
+		}
+		for i := range row {
+			c := targets[i]
+			if c == nil {
+				continue
+			}
+			if itemsIndex == nil || isKey[c.name] || c.name == "TRANSDOC" {
+				record.FieldByIndex(c.index).SetString(values[c.name])
+			} else {
+				item.FieldByIndex(c.index).SetString(values[c.name])
+			}
+		}
+		if e.TRANSDOC != "" {
+			record.FieldByName("TRANSDOC").SetString(e.TRANSDOC)
+		}
+		if itemsIndex == nil {
+			records = append(records, record)
+			continue
+		}
+		key := strings.Join(keys, "\x00")
+		i, ok := index[key]
+		if !ok {
+			i = len(records)
+			index[key] = i
+			records = append(records, record)
+		}
+		items := records[i].FieldByIndex(itemsIndex)
+		items.Set(reflect.Append(items, item))
+	}
+	if len(errs) > 0 {
+		return errs, nil
+	}
+	result := []interface{}{}
+	for _, record := range records {
+		result = append(result, record.Interface())
+	}
+	return nil, result
+}
+
+//Split records into JSON arrays of at most size records, size <= 0 for one batch
+func Batches(records []interface{}, size int) (error, []string) {
+	if size <= 0 {
+		size = len(records)
+	}
+	batches := []string{}
+	for start := 0; start < len(records); start += size {
+		end := start + size
+		if end > len(records) {
+			end = len(records)
+		}
+		b, err := json.Marshal(records[start:end])
+		if err != nil {
+			return err, nil
+		}
+		batches = append(batches, string(b))
+	}
+	return nil, batches
+}
+
+//One row of queryByIdRange output
+type queryResult struct {
+	Key    string          `json:"Key"`
+	Record json.RawMessage `json:"Record"`
+}
+
+//Column names written by Export, before mapping
+func (e Entity) exportColumns() (keys []column, items []column, index []int) {
+	index = itemsField(e.ledger, e.Items)
+	if index == nil {
+		return nil, columnsOf(e.ledger), nil
+	}
+	return e.keyColumns(e.ledger), columnsOf(e.ledger.FieldByIndex(index).Type.Elem()), index
+}
+
+//queryByIdRange/queryByPartialCompositeKey输出转为CSV, 每个item一行.
+//A plain JSON array of records is accepted as well.
+func (e Entity) Export(payload []byte, w io.Writer, mapping Mapping) error {
+	rows := []json.RawMessage{}
+	err := json.Unmarshal(payload, &rows)
+	if err != nil {
+		return err
+	}
+	keyColumns, itemColumns, itemsIndex := e.exportColumns()
+	headers := map[string]string{}
+	for header, name := range mapping {
+		headers[name] = header
+	}
+	columns := append(keyColumns, itemColumns...)
+	header := []string{}
+	for _, c := range columns {
+		name := c.name
+		if alias, ok := e.Aliases[name]; ok {
+			name = alias
+		}
+		if h, ok := headers[name]; ok {
+			name = h
+		}
+		header = append(header, name)
+	}
+	writer := csv.NewWriter(w)
+	writer.Write(header)
+	for _, row := range rows {
+		result := queryResult{}
+		json.Unmarshal(row, &result)
+		raw := result.Record
+		if len(raw) == 0 {
+			raw = row
+		}
+		record := reflect.New(e.ledger)
+		err = json.Unmarshal(raw, record.Interface())
+		if err != nil {
+			return fmt.Errorf("%s: %s", result.Key, err.Error())
+		}
+		record = record.Elem()
+		if itemsIndex == nil {
+			row := []string{}
+			for _, c := range itemColumns {
+				row = append(row, record.FieldByIndex(c.index).String())
+			}
+			writer.Write(row)
+			continue
+		}
+		items := record.FieldByIndex(itemsIndex)
+		for i := 0; i < items.Len(); i++ {
+			row := []string{}
+			for _, c := range keyColumns {
+				row = append(row, record.FieldByIndex(c.index).String())
+			}
+			for _, c := range itemColumns {
+				row = append(row, items.Index(i).FieldByIndex(c.index).String())
+			}
+			writer.Write(row)
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,72 @@
+package csvio
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/lenovo_bc/model"
+	"strings"
+	"testing"
+)
+
+func TestImportItems(t *testing.T) {
+	payload := "PO Number,POItemNO,GRNO,grqty,Attachments.ID,Remark\n" +
+		"4500,10,5000,3,f1,x\n" +
+		"4501,10,5001,1,,\n" +
+		"4500,10,5002,2,,\n"
+	errs, records := Entities["GR"].Import(strings.NewReader(payload), Mapping{"PO Number": "PONO", "Remark": "-"})
+	if errs != nil {
+		t.Fatal(errs)
+	}
+	err, batches := Batches(records, 1)
+	if err != nil || len(batches) != 2 {
+		t.Fatalf("unexpected batches %v %v", err, batches)
+	}
+	orders := []model.PurchaseOrder{}
+	json.Unmarshal([]byte(batches[0]), &orders)
+	if len(orders) != 1 || orders[0].TRANSDOC != "GR" || len(orders[0].GRInfos) != 2 || orders[0].GRInfos[0].GRQty != "3" || orders[0].GRInfos[0].Attachment.FileId != "f1" || orders[0].GRInfos[1].GRNO != "5002" {
+		t.Fatalf("unexpected orders %+v", orders)
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	errs, _ := Entities["SO"].Import(strings.NewReader("SONUMBER,BOGUS\n1,2\n"), nil)
+	if len(errs) != 2 {
+		t.Fatalf("expected unknown and missing key column, got %v", errs)
+	}
+	errs, _ = Entities["SO"].Import(strings.NewReader("SONUMBER,SOITEM,SOQTY\n1,,5\n2,10\n"), nil)
+	if len(errs) != 2 || !strings.HasPrefix(errs[0].Error(), "line 2:") {
+		t.Fatalf("expected missing key and field count errors, got %v", errs)
+	}
+}
+
+func TestExport(t *testing.T) {
+	cpo := model.ODMPurchaseOrder{CPONO: "C1", ODMPayments: []model.ODMPayment{{BILLINGNO: "9001", INVOICESTATUS: "PAID", PAYMENTDATE: "20180301"}}}
+	b, _ := json.Marshal([]map[string]interface{}{{"Key": "CPOC1", "Record": cpo}})
+	var out bytes.Buffer
+	err := Entities["ODMPAY"].Export(b, &out, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "CPONO,INVOICENUM,INVOICESTATUS,PAYMENTDATE\nC1,9001,PAID,20180301\n" {
+		t.Fatalf("unexpected CSV %q", out.String())
+	}
+	errs, records := Entities["ODMPAY"].Import(&out, nil)
+	if errs != nil {
+		t.Fatal(errs)
+	}
+	request := records[0].(model.ODMInfoReq)
+	if request.TRANSDOC != "BL" || request.INVOICENUM != "9001" {
+		t.Fatalf("unexpected request %+v", request)
+	}
+
+	so := model.SalesOrder{SONUMBER: "478", SOITEM: "10", SOQTY: "5"}
+	b, _ = json.Marshal([]model.SalesOrder{so})
+	out.Reset()
+	err = Entities["SO"].Export(b, &out, Mapping{"Sales Order": "SONUMBER"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.String(), "Sales Order,SOITEM,") || !strings.Contains(out.String(), "\n478,10,") {
+		t.Fatalf("unexpected CSV %q", out.String())
+	}
+}
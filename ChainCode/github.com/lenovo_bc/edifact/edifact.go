@@ -0,0 +1,243 @@
+// Package edifact reads and writes UN/EDIFACT interchanges and converts
+// DESADV and INVOIC messages to and from the ledger documents of lenovo_bc.
+//
+// Service characters come from the UNA segment when present, otherwise the
+// defaults ":+.? '" apply. The release character escapes separators,
+// terminators and itself in data.
+package edifact
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//UNA service characters
+type Syntax struct {
+	Component byte //Component data element separator
+	Element   byte //Data element separator
+	Decimal   byte //Decimal notation
+	Release   byte //Release character
+	Segment   byte //Segment terminator
+}
+
+var DefaultSyntax = Syntax{Component: ':', Element: '+', Decimal: '.', Release: '?', Segment: '\''}
+
+//One segment, Elements[i] holds the components of element i+1
+type Segment struct {
+	Tag      string
+	Elements [][]string
+}
+
+//Component c of element e (both 1 based), "" if missing
+func (s Segment) Value(e int, c int) string {
+	if e < 1 || e > len(s.Elements) || c < 1 || c > len(s.Elements[e-1]) {
+		return ""
+	}
+	return s.Elements[e-1][c-1]
+}
+
+func NewSegment(tag string, elements ...[]string) Segment {
+	return Segment{Tag: tag, Elements: elements}
+}
+
+//UNH ... UNT
+type Message struct {
+	UNH      Segment
+	Segments []Segment //Segments between UNH and UNT
+}
+
+//UNB ... UNZ
+type Interchange struct {
+	Syntax   Syntax
+	UNB      Segment
+	Messages []Message
+}
+
+func (m Message) Type() string {
+	return m.UNH.Value(2, 1)
+}
+
+func (m Message) Reference() string {
+	return m.UNH.Value(1, 1)
+}
+
+//是否EDIFACT interchange
+func IsInterchange(payload string) bool {
+	payload = strings.TrimLeft(payload, "\r\n\t ")
+	return strings.HasPrefix(payload, "UNA") || strings.HasPrefix(payload, "UNB")
+}
+
+//按syntax切分segment/element/component, 处理release字符
+func tokenize(payload string, syntax Syntax) (error, []Segment) {
+	segments := []Segment{}
+	elements := [][]string{}
+	components := []string{}
+	current := []byte{}
+	released := false
+	for i := 0; i < len(payload); i++ {
+		ch := payload[i]
+		if released {
+			current = append(current, ch)
+			released = false
+			continue
+		}
+		switch ch {
+		case syntax.Release:
+			released = true
+		case syntax.Component:
+			components = append(components, string(current))
+			current = []byte{}
+		case syntax.Element:
+			elements = append(elements, append(components, string(current)))
+			components, current = []string{}, []byte{}
+		case syntax.Segment:
+			elements = append(elements, append(components, string(current)))
+			tag := strings.TrimSpace(elements[0][0])
+			segments = append(segments, Segment{Tag: tag, Elements: elements[1:]})
+			elements, components, current = [][]string{}, []string{}, []byte{}
+		case '\r', '\n':
+			//line breaks between segments
+		default:
+			current = append(current, ch)
+		}
+	}
+	if released {
+		return fmt.Errorf("release character at end of interchange"), nil
+	}
+	if strings.TrimSpace(string(current)) != "" || len(elements) > 0 {
+		return fmt.Errorf("last segment is not terminated"), nil
+	}
+	return nil, segments
+}
+
+func checkCount(segment Segment, expected int) error {
+	count, err := strconv.Atoi(segment.Value(1, 1))
+	if err != nil || count != expected {
+		return fmt.Errorf("%s count %s does not match %d", segment.Tag, segment.Value(1, 1), expected)
+	}
+	return nil
+}
+
+func checkReference(segment Segment, expected string) error {
+	if segment.Value(2, 1) != expected {
+		return fmt.Errorf("%s reference %s does not match %s", segment.Tag, segment.Value(2, 1), expected)
+	}
+	return nil
+}
+
+//解析并校验interchange: UNT segment数量, UNZ message数量和参考号
+func Parse(payload string) (error, Interchange) {
+	payload = strings.TrimLeft(payload, "\r\n\t ")
+	ic := Interchange{Syntax: DefaultSyntax, Messages: []Message{}}
+	if strings.HasPrefix(payload, "UNA") {
+		if len(payload) < 9 {
+			return fmt.Errorf("UNA must hold 6 service characters"), ic
+		}
+		ic.Syntax = Syntax{Component: payload[3], Element: payload[4], Decimal: payload[5], Release: payload[6], Segment: payload[8]}
+		payload = payload[9:]
+	}
+	err, segments := tokenize(payload, ic.Syntax)
+	if err != nil {
+		return err, ic
+	}
+	if len(segments) == 0 || segments[0].Tag != "UNB" {
+		return fmt.Errorf("interchange must start with UNB"), ic
+	}
+	ic.UNB = segments[0]
+	var message *Message
+	for _, segment := range segments[1:] {
+		switch segment.Tag {
+		case "UNH":
+			if message != nil {
+				return fmt.Errorf("UNH %s before UNT of message %s", segment.Value(1, 1), message.Reference()), ic
+			}
+			ic.Messages = append(ic.Messages, Message{UNH: segment, Segments: []Segment{}})
+			message = &ic.Messages[len(ic.Messages)-1]
+		case "UNT":
+			if message == nil {
+				return fmt.Errorf("UNT without UNH"), ic
+			}
+			err = checkCount(segment, len(message.Segments)+2)
+			if err != nil {
+				return err, ic
+			}
+			err = checkReference(segment, message.Reference())
+			if err != nil {
+				return err, ic
+			}
+			message = nil
+		case "UNZ":
+			if message != nil {
+				return fmt.Errorf("UNZ before UNT of message %s", message.Reference()), ic
+			}
+			err = checkCount(segment, len(ic.Messages))
+			if err != nil {
+				return err, ic
+			}
+			err = checkReference(segment, ic.UNB.Value(5, 1))
+			if err != nil {
+				return err, ic
+			}
+			return nil, ic
+		case "UNG", "UNE":
+			return fmt.Errorf("functional groups (UNG) are not supported"), ic
+		default:
+			if message == nil {
+				return fmt.Errorf("segment %s outside of a message", segment.Tag), ic
+			}
+			message.Segments = append(message.Segments, segment)
+		}
+	}
+	return fmt.Errorf("UNZ is missing"), ic
+}
+
+//新建interchange, date/time为YYMMDD/HHMM
+func NewInterchange(sender string, receiver string, reference string, date string, time string) Interchange {
+	return Interchange{
+		Syntax: DefaultSyntax,
+		UNB: NewSegment("UNB", []string{"UNOC", "3"}, []string{sender}, []string{receiver},
+			[]string{date, time}, []string{reference}),
+		Messages: []Message{},
+	}
+}
+
+func (ic Interchange) escape(value string) string {
+	b := []byte{}
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case ic.Syntax.Release, ic.Syntax.Component, ic.Syntax.Element, ic.Syntax.Segment:
+			b = append(b, ic.Syntax.Release)
+		}
+		b = append(b, value[i])
+	}
+	return string(b)
+}
+
+func (ic Interchange) write(segment Segment) string {
+	elements := []string{segment.Tag}
+	for _, components := range segment.Elements {
+		escaped := []string{}
+		for _, component := range components {
+			escaped = append(escaped, ic.escape(component))
+		}
+		elements = append(elements, strings.Join(escaped, string(ic.Syntax.Component)))
+	}
+	return strings.Join(elements, string(ic.Syntax.Element)) + string(ic.Syntax.Segment)
+}
+
+//生成interchange, UNT/UNZ按内容计算
+func (ic Interchange) String() string {
+	s := ic.Syntax
+	lines := []string{"UNA" + string([]byte{s.Component, s.Element, s.Decimal, s.Release, ' ', s.Segment})}
+	lines = append(lines, ic.write(ic.UNB))
+	for _, message := range ic.Messages {
+		lines = append(lines, ic.write(message.UNH))
+		for _, segment := range message.Segments {
+			lines = append(lines, ic.write(segment))
+		}
+		lines = append(lines, ic.write(NewSegment("UNT", []string{strconv.Itoa(len(message.Segments) + 2)}, []string{message.Reference()})))
+	}
+	lines = append(lines, ic.write(NewSegment("UNZ", []string{strconv.Itoa(len(ic.Messages))}, []string{ic.UNB.Value(5, 1)})))
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,62 @@
+package edifact
+
+import (
+	"github.com/lenovo_bc/model"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	asn := []model.SupplierOrder{{ASNNumber: "ASN?1+2", ASNDate: "20180110", PromisedDate: "20180120", PONumber: "4500", POItem: "10",
+		ShippedQty: "5", CarrierID: "DHL", CarrierTrackID: "JD'0001:A", TransporatationMode: "30", CountryOfOrigin: "CN"}}
+	po := model.PurchaseOrder{PONO: "4500", POItemNO: "10",
+		Invoice: []model.Invoice{{InvType: "380", VenInvNO: "INV1", DocDate: "20180201", InvItemNO: "1", PARTNO: "20HD", InvQty: "5", Unit: "PCE"}}}
+	ic := NewInterchange("SUP1209", "LENOVO", "REF1", "180109", "1200")
+	ic.Messages = append(ic.Messages, BuildDESADV(asn, "M1"), BuildINVOIC(po, "M2"))
+	payload := ic.String()
+	if !strings.Contains(payload, "ASN??1?+2") || !strings.Contains(payload, "JD?'0001?:A") {
+		t.Fatalf("separators were not escaped: %s", payload)
+	}
+	if !IsInterchange(payload) {
+		t.Fatal("interchange not recognized")
+	}
+	err, parsed := Parse(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, desadv := Convert(parsed.Messages[0])
+	if len(desadv.SupplierOrders) != 1 || !reflect.DeepEqual(desadv.SupplierOrders[0], asn[0]) {
+		t.Fatalf("unexpected DESADV result %+v", desadv.SupplierOrders)
+	}
+	_, invoic := Convert(parsed.Messages[1])
+	if len(invoic.PurchaseOrders) != 1 || invoic.PurchaseOrders[0].POItemNO != "10" || invoic.PurchaseOrders[0].Invoice[0] != po.Invoice[0] {
+		t.Fatalf("unexpected INVOIC result %+v", invoic.PurchaseOrders)
+	}
+}
+
+func TestParse(t *testing.T) {
+	//默认service characters, 无UNA
+	payload := "UNB+UNOC:3+SUP+LENOVO+180109:1200+7'\r\nUNH+1+DESADV:D:96A:UN'BGM+351+A?'1+9'LIN+1'QTY+12:3'RFF+ON:4500:10'UNT+6+1'UNZ+1+7'"
+	err, ic := Parse(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, doc := Convert(ic.Messages[0])
+	if doc.SupplierOrders[0].ASNNumber != "A'1" || doc.SupplierOrders[0].ShippedQty != "3" || doc.SupplierOrders[0].PONumber != "4500" {
+		t.Fatalf("unexpected DESADV result %+v", doc.SupplierOrders)
+	}
+	broken := map[string]string{
+		"UNT count":      strings.Replace(payload, "UNT+6+1", "UNT+5+1", 1),
+		"UNT reference":  strings.Replace(payload, "UNT+6+1", "UNT+6+2", 1),
+		"UNZ count":      strings.Replace(payload, "UNZ+1+7", "UNZ+2+7", 1),
+		"UNZ reference":  strings.Replace(payload, "UNZ+1+7", "UNZ+1+8", 1),
+		"not terminated": strings.TrimSuffix(payload, "'"),
+	}
+	for name, p := range broken {
+		err, _ := Parse(p)
+		if err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("%s: expected validation error, got %v", name, err)
+		}
+	}
+}
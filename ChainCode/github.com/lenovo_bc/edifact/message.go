@@ -0,0 +1,180 @@
+package edifact
+
+import (
+	"fmt"
+	"github.com/lenovo_bc/model"
+)
+
+//Message types
+const (
+	DESADV = "DESADV" //Despatch advice -> SupplierOrder
+	INVOIC = "INVOIC" //Invoice -> Invoice
+)
+
+//Documents of one message.
+//DESADV: SupplierOrders, one per line item; INVOIC: PurchaseOrders with TRANSDOC INV
+type Document struct {
+	Type           string                `json:"Type"`      //DESADV, INVOIC
+	Reference      string                `json:"Reference"` //UNH message reference
+	PurchaseOrders []model.PurchaseOrder `json:"PurchaseOrders"`
+	SupplierOrders []model.SupplierOrder `json:"SupplierOrders"`
+}
+
+//Message -> ledger documents
+func Convert(m Message) (error, Document) {
+	doc := Document{Type: m.Type(), Reference: m.Reference(), PurchaseOrders: []model.PurchaseOrder{}, SupplierOrders: []model.SupplierOrder{}}
+	if m.Type() == DESADV {
+		despatch := model.SupplierOrder{}
+		var current *model.SupplierOrder
+		for _, segment := range m.Segments {
+			switch segment.Tag {
+			case "BGM":
+				despatch.ASNNumber = segment.Value(2, 1)
+			case "DTM":
+				if segment.Value(1, 1) == "137" {
+					despatch.ASNDate = segment.Value(1, 2)
+				} else if segment.Value(1, 1) == "17" {
+					despatch.PromisedDate = segment.Value(1, 2)
+				}
+			case "TDT":
+				despatch.TransporatationMode, despatch.CarrierID = segment.Value(3, 1), segment.Value(5, 1)
+			case "RFF":
+				if segment.Value(1, 1) == "CN" {
+					despatch.CarrierTrackID = segment.Value(1, 2)
+				} else if segment.Value(1, 1) == "ON" && current == nil {
+					despatch.PONumber = segment.Value(1, 2)
+				} else if segment.Value(1, 1) == "ON" {
+					current.PONumber = segment.Value(1, 2)
+					if segment.Value(1, 3) != "" {
+						current.POItem = segment.Value(1, 3)
+					}
+				}
+			case "LIN":
+				item := despatch
+				item.POItem = segment.Value(1, 1)
+				doc.SupplierOrders = append(doc.SupplierOrders, item)
+				current = &doc.SupplierOrders[len(doc.SupplierOrders)-1]
+			case "QTY":
+				if current != nil && segment.Value(1, 1) == "12" {
+					current.ShippedQty = segment.Value(1, 2)
+				}
+			case "ALI":
+				if current != nil {
+					current.CountryOfOrigin = segment.Value(1, 1)
+				}
+			}
+		}
+		if despatch.ASNNumber == "" {
+			return fmt.Errorf("DESADV %s: BGM document number is missing", doc.Reference), doc
+		}
+	} else if m.Type() == INVOIC {
+		invoice := model.Invoice{}
+		pono := ""
+		orders := []model.PurchaseOrder{}
+		index := map[string]int{}
+		var current *model.Invoice
+		poItem := ""
+		flush := func() {
+			if current == nil {
+				return
+			}
+			key := pono + "/" + poItem
+			i, ok := index[key]
+			if !ok {
+				i = len(orders)
+				index[key] = i
+				orders = append(orders, model.PurchaseOrder{PONO: pono, POItemNO: poItem, TRANSDOC: "INV"})
+			}
+			orders[i].Invoice = append(orders[i].Invoice, *current)
+			current = nil
+		}
+		for _, segment := range m.Segments {
+			switch segment.Tag {
+			case "BGM":
+				invoice.InvType, invoice.VenInvNO = segment.Value(1, 1), segment.Value(2, 1)
+			case "DTM":
+				if segment.Value(1, 1) == "137" && current == nil {
+					invoice.DocDate = segment.Value(1, 2)
+				}
+			case "RFF":
+				if segment.Value(1, 1) == "ON" && current == nil {
+					pono = segment.Value(1, 2)
+				} else if segment.Value(1, 1) == "ON" && segment.Value(1, 3) != "" {
+					poItem = segment.Value(1, 3)
+				}
+			case "LIN":
+				flush()
+				item := invoice
+				item.InvItemNO, item.PARTNO = segment.Value(1, 1), segment.Value(3, 1)
+				current, poItem = &item, item.InvItemNO
+			case "QTY":
+				if current != nil && segment.Value(1, 1) == "47" {
+					current.InvQty, current.Unit = segment.Value(1, 2), segment.Value(1, 3)
+				}
+			case "UNS":
+				flush()
+			}
+		}
+		flush()
+		if pono == "" || invoice.VenInvNO == "" {
+			return fmt.Errorf("INVOIC %s: BGM invoice number and RFF+ON order number are required", doc.Reference), doc
+		}
+		doc.PurchaseOrders = orders
+	} else {
+		return fmt.Errorf("message type %s is not supported", m.Type()), doc
+	}
+	return nil, doc
+}
+
+func newMessage(messageType string, reference string, segments []Segment) Message {
+	return Message{UNH: NewSegment("UNH", []string{reference}, []string{messageType, "D", "96A", "UN"}), Segments: segments}
+}
+
+//ASN items of one despatch -> DESADV
+func BuildDESADV(orders []model.SupplierOrder, reference string) Message {
+	if len(orders) == 0 {
+		return newMessage(DESADV, reference, []Segment{})
+	}
+	despatch := orders[0]
+	segments := []Segment{
+		NewSegment("BGM", []string{"351"}, []string{despatch.ASNNumber}, []string{"9"}),
+		NewSegment("DTM", []string{"137", despatch.ASNDate, "102"}),
+		NewSegment("DTM", []string{"17", despatch.PromisedDate, "102"}),
+		NewSegment("RFF", []string{"CN", despatch.CarrierTrackID}),
+		NewSegment("TDT", []string{"20"}, []string{}, []string{despatch.TransporatationMode}, []string{}, []string{despatch.CarrierID}),
+		NewSegment("CPS", []string{"1"}),
+	}
+	for i, order := range orders {
+		segments = append(segments,
+			NewSegment("LIN", []string{fmt.Sprintf("%d", i+1)}),
+			NewSegment("QTY", []string{"12", order.ShippedQty}),
+			NewSegment("ALI", []string{order.CountryOfOrigin}),
+			NewSegment("RFF", []string{"ON", order.PONumber, order.POItem}))
+	}
+	return newMessage(DESADV, reference, segments)
+}
+
+//Invoices of one PO item -> INVOIC
+func BuildINVOIC(order model.PurchaseOrder, reference string) Message {
+	first := model.Invoice{}
+	if len(order.Invoice) > 0 {
+		first = order.Invoice[0]
+	}
+	invType := first.InvType
+	if invType == "" {
+		invType = "380"
+	}
+	segments := []Segment{
+		NewSegment("BGM", []string{invType}, []string{first.VenInvNO}, []string{"9"}),
+		NewSegment("DTM", []string{"137", first.DocDate, "102"}),
+		NewSegment("RFF", []string{"ON", order.PONO}),
+	}
+	for _, inv := range order.Invoice {
+		segments = append(segments,
+			NewSegment("LIN", []string{inv.InvItemNO}, []string{}, []string{inv.PARTNO, "BP"}),
+			NewSegment("QTY", []string{"47", inv.InvQty, inv.Unit}),
+			NewSegment("RFF", []string{"ON", order.PONO, order.POItemNO}))
+	}
+	segments = append(segments, NewSegment("UNS", []string{"S"}))
+	return newMessage(INVOIC, reference, segments)
+}
@@ -0,0 +1,238 @@
+// Package epcis renders the events of an order as a GS1 EPCIS 2.0 JSON-LD
+// document.
+//
+// Records carry no serial numbers, so objects are reported as quantities of
+// a part class. Identifiers that have no GS1 key use the urn:lenovo_bc:
+// namespace. SAP dates (YYYYMMDD) and times (HHMMSS) are taken as UTC.
+package epcis
+
+import (
+	"github.com/lenovo_bc/model"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const CONTEXT = "https://ref.gs1.org/standards/epcis/2.0.0/epcis-context.jsonld"
+const URN = "urn:lenovo_bc:"
+
+//Event types
+const (
+	OBJECT_EVENT      = "ObjectEvent"
+	AGGREGATION_EVENT = "AggregationEvent"
+)
+
+type QuantityElement struct {
+	EPCClass string   `json:"epcClass"`
+	Quantity *float64 `json:"quantity,omitempty"`
+	UOM      string   `json:"uom,omitempty"`
+}
+
+type Location struct {
+	ID string `json:"id"`
+}
+
+type BizTransaction struct {
+	Type           string `json:"type,omitempty"`
+	BizTransaction string `json:"bizTransaction"`
+}
+
+//ObjectEvent or AggregationEvent
+type Event struct {
+	Type                string            `json:"type"`
+	EventID             string            `json:"eventID"`
+	EventTime           string            `json:"eventTime"`
+	EventTimeZoneOffset string            `json:"eventTimeZoneOffset"`
+	Action              string            `json:"action"`
+	ParentID            string            `json:"parentID,omitempty"`
+	QuantityList        []QuantityElement `json:"quantityList,omitempty"`
+	ChildQuantityList   []QuantityElement `json:"childQuantityList,omitempty"`
+	BizStep             string            `json:"bizStep"`
+	Disposition         string            `json:"disposition,omitempty"`
+	ReadPoint           *Location         `json:"readPoint,omitempty"`
+	BizTransactionList  []BizTransaction  `json:"bizTransactionList,omitempty"`
+}
+
+type Body struct {
+	EventList []Event `json:"eventList"`
+}
+
+type Document struct {
+	Context       []string `json:"@context"`
+	Type          string   `json:"type"`
+	SchemaVersion string   `json:"schemaVersion"`
+	CreationDate  string   `json:"creationDate"`
+	EPCISBody     Body     `json:"epcisBody"`
+}
+
+//按eventTime排序
+type byEventTime []Event
+
+func (e byEventTime) Len() int           { return len(e) }
+func (e byEventTime) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+func (e byEventTime) Less(i, j int) bool { return e[i].EventTime < e[j].EventTime }
+
+func NewDocument(creationDate string, events []Event) Document {
+	sort.Stable(byEventTime(events))
+	return Document{
+		Context:       []string{CONTEXT},
+		Type:          "EPCISDocument",
+		SchemaVersion: "2.0",
+		CreationDate:  creationDate,
+		EPCISBody:     Body{EventList: events},
+	}
+}
+
+func urn(kind string, ids ...string) string {
+	return URN + kind + ":" + strings.Join(ids, ":")
+}
+
+//SAP日期/时间 -> RFC3339, 无法解析返回""
+func Timestamp(date string, clock string) string {
+	date = strings.NewReplacer("-", "", ".", "", "/", "").Replace(strings.TrimSpace(date))
+	clock = strings.Replace(strings.TrimSpace(clock), ":", "", -1)
+	if clock == "" {
+		clock = "000000"
+	}
+	t, err := time.Parse("20060102150405", date+clock)
+	if err != nil {
+		t, err = time.Parse("20060102", date)
+		if err != nil {
+			return ""
+		}
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+//第一个可解析的日期, dates: date, time, date, time ...
+func firstTimestamp(dates ...string) string {
+	for i := 0; i+1 < len(dates); i += 2 {
+		ts := Timestamp(dates[i], dates[i+1])
+		if ts != "" {
+			return ts
+		}
+	}
+	return ""
+}
+
+func quantity(part string, qty string, uom string) []QuantityElement {
+	if part == "" {
+		return nil
+	}
+	element := QuantityElement{EPCClass: urn("part", part), UOM: uom}
+	q, err := strconv.ParseFloat(strings.TrimSpace(qty), 64)
+	if err == nil {
+		element.Quantity = &q
+	}
+	return []QuantityElement{element}
+}
+
+func location(kind string, id string) *Location {
+	if id == "" {
+		return nil
+	}
+	return &Location{ID: urn("location", kind, id)}
+}
+
+func newEvent(eventType string, eventID string, eventTime string, action string, bizStep string, disposition string) Event {
+	return Event{
+		Type:                eventType,
+		EventID:             eventID,
+		EventTime:           eventTime,
+		EventTimeZoneOffset: "+00:00",
+		Action:              action,
+		BizStep:             bizStep,
+		Disposition:         disposition,
+	}
+}
+
+//SO creation and GI. Events without a usable date are left out.
+func SalesOrderEvents(so model.SalesOrder) []Event {
+	events := []Event{}
+	readPoint := location("country", so.COUNTRY_WE)
+	transactions := []BizTransaction{{BizTransaction: urn("so", so.SONUMBER, so.SOITEM)}}
+	if so.CPONO != "" {
+		transactions = append(transactions, BizTransaction{Type: "po", BizTransaction: urn("cpo", so.CPONO)})
+	}
+	ts := firstTimestamp(so.SOCDATE, so.SOCTIME, so.UPDATEDAY, so.UPTIME)
+	if ts != "" {
+		event := newEvent(OBJECT_EVENT, urn("event", "so", so.SONUMBER, so.SOITEM), ts, "ADD", "reserving", "reserved")
+		event.QuantityList = quantity(so.PARTSNO, so.SOQTY, so.UNIT)
+		event.ReadPoint = readPoint
+		event.BizTransactionList = transactions
+		events = append(events, event)
+	}
+	for _, gi := range so.GIINFOS {
+		ts := firstTimestamp(gi.DNDATE, "", gi.UPDATEDAY, gi.UPTIME)
+		if ts == "" {
+			continue
+		}
+		event := newEvent(OBJECT_EVENT, urn("event", "gi", gi.DNNUMBER, gi.DNITEM), ts, "OBSERVE", "shipping", "in_transit")
+		event.QuantityList = quantity(gi.PARTSNO, gi.DNQTY, gi.UNIT)
+		event.ReadPoint = readPoint
+		event.BizTransactionList = append([]BizTransaction{{Type: "desadv", BizTransaction: urn("dn", gi.DNNUMBER)}}, transactions...)
+		events = append(events, event)
+	}
+	return events
+}
+
+//Supplier ASN (aggregation), inbound delivery and GR. Events without a usable date are left out.
+func PurchaseOrderEvents(po model.PurchaseOrder) []Event {
+	events := []Event{}
+	readPoint := location("plant", po.Plant)
+	transactions := []BizTransaction{{Type: "po", BizTransaction: urn("po", po.PONO, po.POItemNO)}}
+	asns := map[string]string{}
+	for _, sup := range po.SupplierOrders {
+		parent := urn("asn", sup.VendorNO, sup.ASNNumber)
+		asns[sup.ASNNumber] = parent
+		ts := firstTimestamp(sup.ASNDate, "")
+		if ts == "" {
+			continue
+		}
+		event := newEvent(AGGREGATION_EVENT, urn("event", "asn", sup.VendorNO, sup.ASNNumber), ts, "ADD", "shipping", "in_transit")
+		event.ParentID = parent
+		event.ChildQuantityList = quantity(po.PARTSNO, sup.ShippedQty, po.Unit)
+		event.BizTransactionList = append([]BizTransaction{{Type: "desadv", BizTransaction: urn("asn", sup.VendorNO, sup.ASNNumber)}}, transactions...)
+		events = append(events, event)
+	}
+	for _, inbound := range po.InboundDelivery {
+		ts := firstTimestamp(inbound.IDDlvyDate, "", inbound.IDCrtDate, "", inbound.UPDATEDAY, inbound.UPTIME)
+		if ts == "" {
+			continue
+		}
+		part := inbound.PARTSNO
+		if part == "" {
+			part = po.PARTSNO
+		}
+		event := newEvent(OBJECT_EVENT, urn("event", "indn", inbound.IBDNNUMBER, inbound.IBDNITEM), ts, "OBSERVE", "arriving", "in_transit")
+		event.QuantityList = quantity(part, inbound.DlvyQty, po.Unit)
+		event.ReadPoint = readPoint
+		event.BizTransactionList = append([]BizTransaction{{Type: "desadv", BizTransaction: urn("indn", inbound.IBDNNUMBER)}}, transactions...)
+		events = append(events, event)
+	}
+	for _, gr := range po.GRInfos {
+		ts := firstTimestamp(gr.GRDate, "", gr.UPDATEDAY, gr.UPTIME)
+		if ts == "" {
+			continue
+		}
+		grReadPoint := readPoint
+		if gr.Plant != "" {
+			grReadPoint = location("plant", gr.Plant)
+		}
+		grTransactions := append([]BizTransaction{{Type: "recadv", BizTransaction: urn("gr", gr.FiscalYear, gr.GRNO)}}, transactions...)
+		if parent, ok := asns[gr.SupDeliveryNote]; ok {
+			unpack := newEvent(AGGREGATION_EVENT, urn("event", "unpack", gr.FiscalYear, gr.GRNO, gr.GRItemNO), ts, "DELETE", "unpacking", "")
+			unpack.ParentID = parent
+			unpack.ReadPoint = grReadPoint
+			unpack.BizTransactionList = grTransactions
+			events = append(events, unpack)
+		}
+		event := newEvent(OBJECT_EVENT, urn("event", "gr", gr.FiscalYear, gr.GRNO, gr.GRItemNO), ts, "OBSERVE", "receiving", "in_progress")
+		event.QuantityList = quantity(gr.PARTSNO, gr.GRQty, gr.Unit)
+		event.ReadPoint = grReadPoint
+		event.BizTransactionList = grTransactions
+		events = append(events, event)
+	}
+	return events
+}
@@ -0,0 +1,40 @@
+package epcis
+
+import (
+	"encoding/json"
+	"github.com/lenovo_bc/model"
+	"strings"
+	"testing"
+)
+
+func TestEvents(t *testing.T) {
+	so := model.SalesOrder{SONUMBER: "478", SOITEM: "10", SOCDATE: "20180105", SOCTIME: "093000", PARTSNO: "20HD", SOQTY: "5", UNIT: "EA", COUNTRY_WE: "CN",
+		GIINFOS: []model.GIInfo{{DNNUMBER: "800001", DNITEM: "10", DNDATE: "20180115", PARTSNO: "20HD", DNQTY: "5"}, {DNNUMBER: "800002"}}}
+	po := model.PurchaseOrder{PONO: "4500", POItemNO: "10", PARTSNO: "20HD", Unit: "EA", Plant: "CN01",
+		SupplierOrders:  []model.SupplierOrder{{VendorNO: "1209", ASNNumber: "ASN1", ASNDate: "2018-01-08", ShippedQty: "5"}},
+		InboundDelivery: []model.InboundDelivery{{IBDNNUMBER: "180001", IBDNITEM: "10", IDDlvyDate: "20180110", DlvyQty: "5"}},
+		GRInfos:         []model.GRInfo{{GRNO: "500001", FiscalYear: "2018", GRItemNO: "1", GRDate: "20180112", SupDeliveryNote: "ASN1", GRQty: "5"}}}
+	events := append(SalesOrderEvents(so), PurchaseOrderEvents(po)...)
+	doc := NewDocument("2018-02-01T00:00:00Z", events)
+
+	expected := []string{"reserving", "shipping", "arriving", "unpacking", "receiving", "shipping"}
+	if len(doc.EPCISBody.EventList) != len(expected) {
+		t.Fatalf("expected %d events, got %+v", len(expected), doc.EPCISBody.EventList)
+	}
+	for i, event := range doc.EPCISBody.EventList {
+		if event.BizStep != expected[i] {
+			t.Fatalf("event %d: expected %s, got %+v", i, expected[i], event)
+		}
+	}
+	asn := doc.EPCISBody.EventList[1]
+	if asn.Type != AGGREGATION_EVENT || asn.EventTime != "2018-01-08T00:00:00Z" || asn.ParentID != "urn:lenovo_bc:asn:1209:ASN1" || *asn.ChildQuantityList[0].Quantity != 5 {
+		t.Fatalf("unexpected ASN event %+v", asn)
+	}
+	if doc.EPCISBody.EventList[0].ReadPoint.ID != "urn:lenovo_bc:location:country:CN" || doc.EPCISBody.EventList[4].ReadPoint.ID != "urn:lenovo_bc:location:plant:CN01" {
+		t.Fatal("unexpected read points")
+	}
+	b, _ := json.Marshal(doc)
+	if !strings.Contains(string(b), `"@context":["`+CONTEXT+`"]`) || !strings.Contains(string(b), `"eventTime":"2018-01-05T09:30:00Z"`) {
+		t.Fatalf("unexpected JSON-LD %s", b)
+	}
+}
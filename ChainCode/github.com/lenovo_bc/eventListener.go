@@ -1,116 +0,0 @@
-package main
-import (
-	"errors"
-	"flag"
-	"fmt"
-	"os"
-	"github.com/hyperledger/fabric/core/ledger/util"
-	"github.com/hyperledger/fabric/events/consumer"
-	"github.com/hyperledger/fabric/msp/mgmt"
-	"github.com/hyperledger/fabric/msp/mgmt/testtools"
-	"github.com/hyperledger/fabric/protos/common"
-	pb "github.com/hyperledger/fabric/protos/peer"
-	"github.com/hyperledger/fabric/protos/utils"
-)
-
-type adapter struct {
-	notfy chan *pb.Event_Block
-}
-
-//Disconnected implements consumer.EventAdapter interface for disconnecting
-func (a *adapter) Disconnected(err error) {
-	fmt.Print("Disconnected...exiting\n")
-	os.Exit(1)
-}
-
-//Recv implements consumer.EventAdapter interface for receiving events
-func (a *adapter) Recv(msg *pb.Event) (bool, error) {
-	if o, e := msg.Event.(*pb.Event_Block); e {
-		a.notfy <- o
-		return true, nil
-	}
-	return false, fmt.Errorf("Receive unknown type event: %v", msg)
-}
-
-//GetInterestedEvents implements consumer.EventAdapter interface for registering interested events
-func (a *adapter) GetInterestedEvents() ([]*pb.Interest, error) {
-	return []*pb.Interest{{EventType: pb.EventType_BLOCK}}, nil
-}
-
-func createEventClient(eventAddress string, _ string) *adapter {
-	var obcEHClient *consumer.EventsClient
-
-	done := make(chan *pb.Event_Block)
-	adapter := &adapter{notfy: done}
-	obcEHClient, _ = consumer.NewEventsClient(eventAddress, 5, adapter)
-	if err := obcEHClient.Start(); err != nil {
-		fmt.Printf("could not start chat. err: %s\n", err)
-		obcEHClient.Stop()
-		return nil
-	}
-
-	return adapter
-}
-// getChainCodeEvents parses block events for chaincode events associated with individual transactions
-func getChainCodeEvents(tdata []byte) (*pb.ChaincodeEvent, error) {
-	if tdata == nil {
-		return nil, errors.New("Cannot extract payload from nil transaction")
-	}
-
-	if env, err := utils.GetEnvelopeFromBlock(tdata); err != nil {
-		return nil, fmt.Errorf("Error getting tx from block(%s)", err)
-	} else if env != nil {
-		// get the payload from the envelope
-		payload, err := utils.GetPayload(env)
-		if err != nil {
-			return nil, fmt.Errorf("Could not extract payload from envelope, err %s", err)
-		}
-
-		chdr, err := utils.UnmarshalChannelHeader(payload.Header.ChannelHeader)
-		if err != nil {
-			return nil, fmt.Errorf("Could not extract channel header from envelope, err %s", err)
-		}
-
-		if common.HeaderType(chdr.Type) == common.HeaderType_ENDORSER_TRANSACTION {
-			tx, err := utils.GetTransaction(payload.Data)
-			if err != nil {
-				return nil, fmt.Errorf("Error unmarshalling transaction payload for block event: %s", err)
-			}
-			chaincodeActionPayload, err := utils.GetChaincodeActionPayload(tx.Actions[0].Payload)
-			if err != nil {
-				return nil, fmt.Errorf("Error unmarshalling transaction action payload for block event: %s", err)
-			}
-			propRespPayload, err := utils.GetProposalResponsePayload(chaincodeActionPayload.Action.ProposalResponsePayload)
-			if err != nil {
-				return nil, fmt.Errorf("Error unmarshalling proposal response payload for block event: %s", err)
-			}
-			caPayload, err := utils.GetChaincodeAction(propRespPayload.Extension)
-			if err != nil {
-				return nil, fmt.Errorf("Error unmarshalling chaincode action for block event: %s", err)
-			}
-			ccEvent, err := utils.GetChaincodeEvents(caPayload.Events)
-
-			if ccEvent != nil {
-				return ccEvent, nil
-			}
-		}
-	}
-	return nil, errors.New("No events found")
-}
-func getTxPayload(tdata []byte) (*common.Payload, error) {
-	if tdata == nil {
-		return nil, errors.New("Cannot extract payload from nil transaction")
-	}
-
-	if env, err := utils.GetEnvelopeFromBlock(tdata); err != nil {
-		return nil, fmt.Errorf("Error getting tx from block(%s)", err)
-	} else if env != nil {
-		// get the payload from the envelope
-		payload, err := utils.GetPayload(env)
-		if err != nil {
-			return nil, fmt.Errorf("Could not extract payload from envelope, err %s", err)
-		}
-		return payload, nil
-	}
-	return nil, nil
-}
\ No newline at end of file
@@ -0,0 +1,117 @@
+package idoc
+
+import (
+	"fmt"
+	"strings"
+)
+
+//Fixed length field, left aligned
+func pad(value string, length int) string {
+	if len(value) > length {
+		return value[:length]
+	}
+	return value + strings.Repeat(" ", length-len(value))
+}
+
+//EDI_DC40 control record, same offsets as parseControl
+func (c Control) record() string {
+	b := []byte(strings.Repeat(" ", 287))
+	put := func(offset int, length int, value string) {
+		copy(b[offset:offset+length], pad(value, length))
+	}
+	put(0, 10, CONTROL_RECORD)
+	put(10, 3, c.MANDT)
+	put(13, 16, c.DOCNUM)
+	put(29, 4, c.DOCREL)
+	put(35, 1, c.DIRECT)
+	put(39, 30, c.IDOCTYP)
+	put(69, 30, c.CIMTYP)
+	put(99, 30, c.MESTYP)
+	put(162, 10, c.SNDPRN)
+	put(277, 10, c.RCVPRN)
+	return strings.TrimRight(string(b), " ")
+}
+
+//生成flat file: EDI_DC40 + EDI_DD40 data records
+func (doc IDoc) String() string {
+	lines := []string{doc.Control.record()}
+	for i, segment := range doc.Segments {
+		lines = append(lines, pad(segment.SEGNAM, SEGNAM_LEN)+pad(doc.Control.MANDT, 3)+pad(doc.Control.DOCNUM, 16)+
+			fmt.Sprintf("%06d%06d", i+1, 0)+pad(segment.HLEVEL, 2)+strings.TrimRight(segment.SDATA, " "))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+//Fields of one segment, key: segment type + qualifier
+type segmentFields struct {
+	segment   string
+	qualifier string
+	fields    []FieldMap
+}
+
+func groupFields(fields []FieldMap) []*segmentFields {
+	groups := []*segmentFields{}
+	index := map[string]*segmentFields{}
+	for _, fieldMap := range fields {
+		key := fieldMap.Segment + "/" + fieldMap.Qualifier
+		group, ok := index[key]
+		if !ok {
+			group = &segmentFields{segment: fieldMap.Segment, qualifier: fieldMap.Qualifier}
+			index[key] = group
+			groups = append(groups, group)
+		}
+		group.fields = append(group.fields, fieldMap)
+	}
+	return groups
+}
+
+//Segment with the mapped values, false if none of them is set
+func (g *segmentFields) build(values map[string]string, hlevel string) (Segment, bool) {
+	b := []byte(g.qualifier)
+	found := false
+	for _, fieldMap := range g.fields {
+		value := values[fieldMap.Field]
+		if value == "" {
+			continue
+		}
+		found = true
+		if len(b) < fieldMap.Offset+fieldMap.Length {
+			b = append(b, []byte(strings.Repeat(" ", fieldMap.Offset+fieldMap.Length-len(b)))...)
+		}
+		copy(b[fieldMap.Offset:fieldMap.Offset+fieldMap.Length], pad(value, fieldMap.Length))
+	}
+	return Segment{SEGNAM: g.segment, HLEVEL: hlevel, SDATA: string(b)}, found
+}
+
+//Convert的逆过程: 按mapping生成IDoc. Segments are written in the order of
+//docMapping.Fields; segments listed before the ItemSegment are header
+//segments filled from header, the rest are written once per item.
+func Build(control Control, docMapping DocMapping, header map[string]string, items []map[string]string) IDoc {
+	doc := IDoc{Control: control, Segments: []Segment{}}
+	groups := groupFields(docMapping.Fields)
+	itemStart := len(groups)
+	for i, group := range groups {
+		if group.segment == docMapping.ItemSegment {
+			itemStart = i
+			break
+		}
+	}
+	for _, group := range groups[:itemStart] {
+		if segment, ok := group.build(header, "02"); ok {
+			doc.Segments = append(doc.Segments, segment)
+		}
+	}
+	for _, item := range items {
+		for i, group := range groups[itemStart:] {
+			hlevel := "04"
+			if i == 0 {
+				hlevel = "03"
+			}
+			segment, ok := group.build(item, hlevel)
+			if ok || i == 0 {
+				doc.Segments = append(doc.Segments, segment)
+			}
+		}
+	}
+	return doc
+}
@@ -0,0 +1,117 @@
+package idoc
+
+import (
+	"github.com/lenovo_bc/model"
+	"reflect"
+	"strings"
+)
+
+//Documents of one IDoc, ready for crSalesOrderInfo (SO, BL, GI) or
+//crPurchaseOrderInfo (PO, INDN)
+type Document struct {
+	Control        Control               `json:"Control"`
+	TRANSDOC       string                `json:"TRANSDOC"`
+	SalesOrders    []model.SalesOrder    `json:"SalesOrders"`
+	PurchaseOrders []model.PurchaseOrder `json:"PurchaseOrders"`
+}
+
+//按json名设置string字段
+func setFields(v interface{}, values map[string]string) {
+	obj := reflect.ValueOf(v).Elem()
+	for i := 0; i < obj.NumField(); i++ {
+		name := strings.Split(obj.Type().Field(i).Tag.Get("json"), ",")[0]
+		value, ok := values[name]
+		if ok && obj.Field(i).Kind() == reflect.String && obj.Field(i).CanSet() {
+			obj.Field(i).SetString(value)
+		}
+	}
+}
+
+//按mapping取出每个item的字段值, header字段复制到每个item
+func itemValues(doc IDoc, docMapping DocMapping) []map[string]string {
+	header := map[string]string{}
+	items := []map[string]string{}
+	var current map[string]string
+	for _, segment := range doc.Segments {
+		if segment.SEGNAM == docMapping.ItemSegment {
+			current = map[string]string{}
+			for k, v := range header {
+				current[k] = v
+			}
+			items = append(items, current)
+		}
+		values := header
+		if current != nil {
+			values = current
+		}
+		for _, fieldMap := range docMapping.Fields {
+			if fieldMap.Segment != segment.SEGNAM || !strings.HasPrefix(segment.SDATA, fieldMap.Qualifier) {
+				continue
+			}
+			value := field(segment.SDATA, fieldMap.Offset, fieldMap.Length)
+			if value != "" {
+				values[fieldMap.Field] = value
+			}
+		}
+	}
+	return items
+}
+
+//IDoc -> ledger documents. Items of BL/GI/INDN are grouped by the SO/PO item they belong to.
+func (m Mapping) Convert(doc IDoc) (error, Document) {
+	err, docMapping := m.Lookup(doc.Control)
+	if err != nil {
+		return err, Document{}
+	}
+	result := Document{Control: doc.Control, TRANSDOC: docMapping.TRANSDOC, SalesOrders: []model.SalesOrder{}, PurchaseOrders: []model.PurchaseOrder{}}
+	soIndex := map[string]int{}
+	poIndex := map[string]int{}
+	salesOrder := func(values map[string]string) *model.SalesOrder {
+		key := values["SONUMBER"] + "/" + values["SOITEM"]
+		if i, ok := soIndex[key]; ok {
+			return &result.SalesOrders[i]
+		}
+		soIndex[key] = len(result.SalesOrders)
+		result.SalesOrders = append(result.SalesOrders, model.SalesOrder{SONUMBER: values["SONUMBER"], SOITEM: values["SOITEM"], TRANSDOC: docMapping.TRANSDOC})
+		return &result.SalesOrders[len(result.SalesOrders)-1]
+	}
+	purchaseOrder := func(values map[string]string) *model.PurchaseOrder {
+		key := values["PONO"] + "/" + values["POItemNO"]
+		if i, ok := poIndex[key]; ok {
+			return &result.PurchaseOrders[i]
+		}
+		poIndex[key] = len(result.PurchaseOrders)
+		result.PurchaseOrders = append(result.PurchaseOrders, model.PurchaseOrder{PONO: values["PONO"], POItemNO: values["POItemNO"], TRANSDOC: docMapping.TRANSDOC})
+		return &result.PurchaseOrders[len(result.PurchaseOrders)-1]
+	}
+
+	for _, values := range itemValues(doc, docMapping) {
+		if docMapping.TRANSDOC == TARGET_SO {
+			order := model.SalesOrder{}
+			setFields(&order, values)
+			order.TRANSDOC = TARGET_SO
+			result.SalesOrders = append(result.SalesOrders, order)
+		} else if docMapping.TRANSDOC == TARGET_PO {
+			order := model.PurchaseOrder{}
+			setFields(&order, values)
+			order.TRANSDOC = TARGET_PO
+			result.PurchaseOrders = append(result.PurchaseOrders, order)
+		} else if docMapping.TRANSDOC == TARGET_BL {
+			billing := model.BillingInfo{}
+			setFields(&billing, values)
+			order := salesOrder(values)
+			order.BILLINFOS = append(order.BILLINFOS, billing)
+		} else if docMapping.TRANSDOC == TARGET_GI {
+			gi := model.GIInfo{}
+			setFields(&gi, values)
+			order := salesOrder(values)
+			order.GIINFOS = append(order.GIINFOS, gi)
+		} else if docMapping.TRANSDOC == TARGET_INDN {
+			inbound := model.InboundDelivery{}
+			setFields(&inbound, values)
+			order := purchaseOrder(values)
+			order.InboundDelivery = append(order.InboundDelivery, inbound)
+		}
+	}
+	return nil, result
+}
@@ -0,0 +1,124 @@
+// Package idoc parses SAP flat-file IDocs and maps them onto the ledger
+// documents of lenovo_bc.
+//
+// A flat file holds one or more IDocs. Every IDoc starts with an EDI_DC40
+// control record followed by its EDI_DD40 data records:
+//
+//	SEGNAM(30) MANDT(3) DOCNUM(16) SEGNUM(6) PSGNUM(6) HLEVEL(2) SDATA(1000)
+//
+// Segment names may be given as segment type (E1EDK01) or as segment
+// definition (E2EDK01005); both are reduced to the segment type.
+package idoc
+
+import (
+	"fmt"
+	"strings"
+)
+
+const CONTROL_RECORD = "EDI_DC40"
+
+//EDI_DD40 offsets
+const (
+	SEGNAM_LEN   = 30
+	SDATA_OFFSET = 63
+)
+
+//EDI_DC40 control record
+type Control struct {
+	TABNAM  string `json:"TABNAM"`  //Table name, EDI_DC40
+	MANDT   string `json:"MANDT"`   //Client
+	DOCNUM  string `json:"DOCNUM"`  //IDoc number
+	DOCREL  string `json:"DOCREL"`  //SAP release
+	DIRECT  string `json:"DIRECT"`  //Direction, 1 outbound 2 inbound
+	IDOCTYP string `json:"IDOCTYP"` //Basic type, e.g. ORDERS05
+	CIMTYP  string `json:"CIMTYP"`  //Extension
+	MESTYP  string `json:"MESTYP"`  //Message type, e.g. ORDERS
+	SNDPRN  string `json:"SNDPRN"`  //Sender partner number
+	RCVPRN  string `json:"RCVPRN"`  //Receiver partner number
+}
+
+//EDI_DD40 data record
+type Segment struct {
+	SEGNAM string //Segment type, e.g. E1EDK01
+	HLEVEL string //Hierarchy level
+	SDATA  string //Segment data, untrimmed
+}
+
+type IDoc struct {
+	Control  Control
+	Segments []Segment
+}
+
+//取定长字段, 越界部分视为空
+func field(record string, offset int, length int) string {
+	if offset >= len(record) {
+		return ""
+	}
+	end := offset + length
+	if end > len(record) {
+		end = len(record)
+	}
+	return strings.TrimSpace(record[offset:end])
+}
+
+//E2EDK01005 -> E1EDK01
+func segmentType(name string) string {
+	if strings.HasPrefix(name, "E2") && len(name) > 5 {
+		name = "E1" + name[2:]
+		if strings.TrimRight(name[len(name)-3:], "0123456789") == "" {
+			name = name[:len(name)-3]
+		}
+	}
+	return name
+}
+
+func parseControl(record string) Control {
+	return Control{
+		TABNAM:  field(record, 0, 10),
+		MANDT:   field(record, 10, 3),
+		DOCNUM:  field(record, 13, 16),
+		DOCREL:  field(record, 29, 4),
+		DIRECT:  field(record, 35, 1),
+		IDOCTYP: field(record, 39, 30),
+		CIMTYP:  field(record, 69, 30),
+		MESTYP:  field(record, 99, 30),
+		SNDPRN:  field(record, 162, 10),
+		RCVPRN:  field(record, 277, 10),
+	}
+}
+
+//解析flat file, 返回其中所有IDoc
+func Parse(payload string) (error, []IDoc) {
+	idocs := []IDoc{}
+	lines := strings.Split(strings.Replace(payload, "\r\n", "\n", -1), "\n")
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if strings.HasPrefix(line, CONTROL_RECORD) {
+			idocs = append(idocs, IDoc{Control: parseControl(line), Segments: []Segment{}})
+			continue
+		}
+		if len(idocs) == 0 {
+			return fmt.Errorf("line %d: data record before %s control record", i+1, CONTROL_RECORD), nil
+		}
+		name := field(line, 0, SEGNAM_LEN)
+		if name == "" {
+			return fmt.Errorf("line %d: segment name is missing", i+1), nil
+		}
+		sdata := ""
+		if len(line) > SDATA_OFFSET {
+			sdata = line[SDATA_OFFSET:]
+		}
+		current := &idocs[len(idocs)-1]
+		current.Segments = append(current.Segments, Segment{
+			SEGNAM: segmentType(name),
+			HLEVEL: field(line, 61, 2),
+			SDATA:  sdata,
+		})
+	}
+	if len(idocs) == 0 {
+		return fmt.Errorf("no %s control record found", CONTROL_RECORD), nil
+	}
+	return nil, idocs
+}
@@ -0,0 +1,124 @@
+package idoc
+
+import (
+	"strings"
+	"testing"
+)
+
+//定长记录, values: offset, value, offset, value ...
+func record(length int, values ...interface{}) string {
+	b := []byte(strings.Repeat(" ", length))
+	for i := 0; i+1 < len(values); i += 2 {
+		copy(b[values[i].(int):], values[i+1].(string))
+	}
+	return string(b)
+}
+
+func control(idocType string, mesType string) string {
+	return record(524, 0, CONTROL_RECORD, 13, "0000000000012345", 35, "1", 39, idocType, 99, mesType)
+}
+
+func segment(name string, values ...interface{}) string {
+	sdata := record(1000, values...)
+	return record(SDATA_OFFSET, 0, name, 61, "02") + sdata
+}
+
+func TestParse(t *testing.T) {
+	payload := strings.Join([]string{
+		control("ORDERS05", "ORDRSP"),
+		segment("E2EDK01005", 4, "USD", 83, "478"),
+		segment("E1EDKA1", 0, "AG ", 3, "100001", 37, "Lenovo PC HK"),
+		segment("E1EDKA1", 0, "WE ", 3, "100002", 344, "CN"),
+		segment("E1EDK02", 0, "001", 3, "CPO-1"),
+		segment("E1EDP01", 0, "000010", 11, "5", 26, "PC"),
+		segment("E1EDP19", 0, "001", 3, "CUSTMAT"),
+		segment("E1EDP19", 0, "002", 3, "20HD0001", 38, "ThinkPad"),
+		segment("E1EDP01", 0, "000020", 11, "7", 26, "PC"),
+	}, "\r\n")
+	err, idocs := Parse(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(idocs) != 1 || idocs[0].Control.DOCNUM != "0000000000012345" || idocs[0].Segments[0].SEGNAM != "E1EDK01" {
+		t.Fatalf("unexpected parse result %+v", idocs)
+	}
+	err, doc := DefaultMapping().Convert(idocs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.TRANSDOC != TARGET_SO || len(doc.SalesOrders) != 2 {
+		t.Fatalf("expected 2 sales orders, got %+v", doc)
+	}
+	so := doc.SalesOrders[0]
+	if so.SONUMBER != "478" || so.SOITEM != "000010" || so.CPONO != "CPO-1" || so.NAME1_AG != "Lenovo PC HK" ||
+		so.COUNTRY_WE != "CN" || so.PARTSNO != "20HD0001" || so.SOQTY != "5" || so.CURRENCY != "USD" {
+		t.Fatalf("unexpected sales order %+v", so)
+	}
+	if doc.SalesOrders[1].SOITEM != "000020" || doc.SalesOrders[1].PARTSNO != "" || doc.SalesOrders[1].SOLDTO != "100001" {
+		t.Fatalf("item data leaked between items %+v", doc.SalesOrders[1])
+	}
+}
+
+func TestConvertGrouped(t *testing.T) {
+	payload := strings.Join([]string{
+		control("INVOIC02", "INVOIC"),
+		segment("E1EDK01", 83, "90001"),
+		segment("E1EDP01", 0, "000010", 11, "5"),
+		segment("E1EDP02", 0, "002", 3, "478", 38, "000010"),
+		segment("E1EDP01", 0, "000020", 11, "2"),
+		segment("E1EDP02", 0, "002", 3, "478", 38, "000010"),
+		control("DELVRY07", "DESADV"),
+		segment("E1EDL20", 0, "180001", 218, "ASN1"),
+		segment("E1EDL24", 0, "000010", 189, "5"),
+		segment("E1EDL41", 0, "001", 3, "4500", 50, "000010"),
+	}, "\n")
+	err, idocs := Parse(payload)
+	if err != nil || len(idocs) != 2 {
+		t.Fatalf("expected 2 IDocs, got %v %d", err, len(idocs))
+	}
+	_, billing := DefaultMapping().Convert(idocs[0])
+	if len(billing.SalesOrders) != 1 || len(billing.SalesOrders[0].BILLINFOS) != 2 || billing.SalesOrders[0].TRANSDOC != TARGET_BL {
+		t.Fatalf("expected billing items grouped on one SO, got %+v", billing.SalesOrders)
+	}
+	_, inbound := DefaultMapping().Convert(idocs[1])
+	if len(inbound.PurchaseOrders) != 1 || inbound.PurchaseOrders[0].PONO != "4500" || inbound.PurchaseOrders[0].InboundDelivery[0].ASNNO != "ASN1" {
+		t.Fatalf("unexpected inbound delivery %+v", inbound.PurchaseOrders)
+	}
+}
+
+func TestMapping(t *testing.T) {
+	err, _ := Parse(segment("E1EDK01"))
+	if err == nil {
+		t.Fatal("data record without control record accepted")
+	}
+	err, m := ParseMapping([]byte(`{"ZORD01":{"TRANSDOC":"PO","ItemSegment":"Z1ITEM","Fields":[{"Segment":"Z1ITEM","Offset":0,"Length":5,"Field":"POItemNO"}]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err, _ = m.Lookup(Control{IDOCTYP: "ORDERS05", MESTYP: "ORDERS"})
+	if err == nil {
+		t.Fatal("lookup of unmapped type succeeded")
+	}
+	err, _ = ParseMapping([]byte(`{"ZORD01":{"TRANSDOC":"XX","ItemSegment":"Z1ITEM"}}`))
+	if err == nil {
+		t.Fatal("unknown TRANSDOC accepted")
+	}
+}
+
+func TestBuild(t *testing.T) {
+	control := Control{TABNAM: CONTROL_RECORD, MANDT: "800", DOCNUM: "1", DIRECT: "2", IDOCTYP: "DELVRY03", MESTYP: "DESADV", RCVPRN: "SAPCLNT800"}
+	header := map[string]string{"IBDNNUMBER": "ASN1", "ASNNO": "ASN1", "VendorNO": "1209", "IDDlvyDate": "20180110"}
+	items := []map[string]string{{"IBDNITEM": "1", "DlvyQty": "5", "PONO": "4500", "POItemNO": "10"}, {"IBDNITEM": "2", "DlvyQty": "3", "PONO": "4500", "POItemNO": "20"}}
+	err, idocs := Parse(Build(control, DefaultMapping()["DELVRY"], header, items).String())
+	if err != nil || len(idocs) != 1 || idocs[0].Control != control {
+		t.Fatalf("unexpected IDocs %v %+v", err, idocs)
+	}
+	err, doc := DefaultMapping().Convert(idocs[0])
+	if err != nil || len(doc.PurchaseOrders) != 2 {
+		t.Fatalf("unexpected document %v %+v", err, doc)
+	}
+	inbound := doc.PurchaseOrders[1].InboundDelivery[0]
+	if doc.PurchaseOrders[1].POItemNO != "20" || inbound.DlvyQty != "3" || inbound.ASNNO != "ASN1" || inbound.VendorNO != "1209" || inbound.IDDlvyDate != "20180110" {
+		t.Fatalf("unexpected inbound delivery %+v", doc.PurchaseOrders[1])
+	}
+}
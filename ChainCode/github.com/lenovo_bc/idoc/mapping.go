@@ -0,0 +1,214 @@
+package idoc
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+//Target document, same values as TRANSDOC of the chaincode
+const (
+	TARGET_SO   = "SO"   //SalesOrder
+	TARGET_PO   = "PO"   //PurchaseOrder
+	TARGET_BL   = "BL"   //BillingInfo of SalesOrder
+	TARGET_GI   = "GI"   //GIInfo of SalesOrder
+	TARGET_INDN = "INDN" //InboundDelivery of PurchaseOrder
+)
+
+//One SDATA field -> one json field of the target document.
+//Qualifier, if set, must match the start of SDATA (QUALF, PARVW, IDDAT ...)
+type FieldMap struct {
+	Segment   string `json:"Segment"`   //Segment type, e.g. E1EDKA1
+	Qualifier string `json:"Qualifier"` //Leading qualifier, e.g. AG
+	Offset    int    `json:"Offset"`    //Offset in SDATA
+	Length    int    `json:"Length"`    //Field length
+	Field     string `json:"Field"`     //json name, e.g. NAME1_AG
+}
+
+//Mapping of one IDoc type. Segments before the first ItemSegment are header
+//data copied into every item.
+type DocMapping struct {
+	TRANSDOC    string     `json:"TRANSDOC"`    //SO, PO, BL, GI, INDN
+	ItemSegment string     `json:"ItemSegment"` //Segment starting an item
+	Fields      []FieldMap `json:"Fields"`      //Field mapping
+}
+
+//Key: basic type with or without version, optionally "/"+message type,
+//e.g. "ORDERS05/ORDRSP", "INVOIC02", "DELVRY"
+type Mapping map[string]DocMapping
+
+//查找IDoc对应的mapping, 越具体的key优先
+func (m Mapping) Lookup(control Control) (error, DocMapping) {
+	base := strings.TrimRight(control.IDOCTYP, "0123456789")
+	keys := []string{
+		control.IDOCTYP + "/" + control.MESTYP,
+		control.IDOCTYP,
+		base + "/" + control.MESTYP,
+		base,
+	}
+	for _, key := range keys {
+		if docMapping, ok := m[key]; ok {
+			return nil, docMapping
+		}
+	}
+	return fmt.Errorf("no mapping for IDoc type %s/%s", control.IDOCTYP, control.MESTYP), DocMapping{}
+}
+
+func (m Mapping) Validate() error {
+	for key, docMapping := range m {
+		switch docMapping.TRANSDOC {
+		case TARGET_SO, TARGET_PO, TARGET_BL, TARGET_GI, TARGET_INDN:
+		default:
+			return fmt.Errorf("%s: unknown TRANSDOC %s", key, docMapping.TRANSDOC)
+		}
+		if docMapping.ItemSegment == "" {
+			return fmt.Errorf("%s: ItemSegment is required", key)
+		}
+		for _, fieldMap := range docMapping.Fields {
+			if fieldMap.Segment == "" || fieldMap.Field == "" {
+				return fmt.Errorf("%s: Segment and Field are required", key)
+			}
+			if fieldMap.Offset < 0 || fieldMap.Length <= 0 {
+				return fmt.Errorf("%s: invalid offset/length for %s", key, fieldMap.Field)
+			}
+		}
+	}
+	return nil
+}
+
+//解析json格式的mapping
+func ParseMapping(b []byte) (error, Mapping) {
+	m := Mapping{}
+	err := json.Unmarshal(b, &m)
+	if err != nil {
+		return err, nil
+	}
+	err = m.Validate()
+	if err != nil {
+		return err, nil
+	}
+	return nil, m
+}
+
+//SAP标准段结构的默认mapping
+func DefaultMapping() Mapping {
+	return Mapping{
+		"ORDERS05/ORDRSP": {TRANSDOC: TARGET_SO, ItemSegment: "E1EDP01", Fields: salesOrderFields()},
+		"ORDERS05/ORDERS": {TRANSDOC: TARGET_PO, ItemSegment: "E1EDP01", Fields: purchaseOrderFields()},
+		"ORDERS05/ORDCHG": {TRANSDOC: TARGET_PO, ItemSegment: "E1EDP01", Fields: purchaseOrderFields()},
+		"INVOIC02":        {TRANSDOC: TARGET_BL, ItemSegment: "E1EDP01", Fields: billingFields()},
+		"DESADV":          {TRANSDOC: TARGET_GI, ItemSegment: "E1EDL24", Fields: goodsIssueFields()},
+		"DELVRY":          {TRANSDOC: TARGET_INDN, ItemSegment: "E1EDL24", Fields: inboundDeliveryFields()},
+	}
+}
+
+//ORDERS05 sales order confirmation
+func salesOrderFields() []FieldMap {
+	return []FieldMap{
+		{Segment: "E1EDK01", Offset: 83, Length: 35, Field: "SONUMBER"},
+		{Segment: "E1EDK01", Offset: 4, Length: 3, Field: "CURRENCY"},
+		{Segment: "E1EDK14", Qualifier: "012", Offset: 3, Length: 35, Field: "SOTYPE"},
+		{Segment: "E1EDK03", Qualifier: "025", Offset: 3, Length: 8, Field: "SOCDATE"},
+		{Segment: "E1EDK03", Qualifier: "025", Offset: 11, Length: 6, Field: "SOCTIME"},
+		{Segment: "E1EDK02", Qualifier: "001", Offset: 3, Length: 35, Field: "CPONO"},
+		{Segment: "E1EDKA1", Qualifier: "AG", Offset: 3, Length: 17, Field: "SOLDTO"},
+		{Segment: "E1EDKA1", Qualifier: "AG", Offset: 37, Length: 35, Field: "NAME1_AG"},
+		{Segment: "E1EDKA1", Qualifier: "AG", Offset: 72, Length: 35, Field: "NAME2_AG"},
+		{Segment: "E1EDKA1", Qualifier: "AG", Offset: 282, Length: 35, Field: "CITY_AG"},
+		{Segment: "E1EDKA1", Qualifier: "AG", Offset: 344, Length: 3, Field: "COUNTRY_AG"},
+		{Segment: "E1EDKA1", Qualifier: "WE", Offset: 3, Length: 17, Field: "SHIPTO"},
+		{Segment: "E1EDKA1", Qualifier: "WE", Offset: 37, Length: 35, Field: "NAME1_WE"},
+		{Segment: "E1EDKA1", Qualifier: "WE", Offset: 72, Length: 35, Field: "NAME2_WE"},
+		{Segment: "E1EDKA1", Qualifier: "WE", Offset: 282, Length: 35, Field: "CITY_WE"},
+		{Segment: "E1EDKA1", Qualifier: "WE", Offset: 344, Length: 3, Field: "COUNTRY_WE"},
+		{Segment: "E1EDKA1", Qualifier: "LF", Offset: 3, Length: 17, Field: "VENDORNO"},
+		{Segment: "E1EDKA1", Qualifier: "LF", Offset: 37, Length: 35, Field: "VENDORNAME"},
+		{Segment: "E1EDP01", Offset: 0, Length: 6, Field: "SOITEM"},
+		{Segment: "E1EDP01", Offset: 11, Length: 15, Field: "SOQTY"},
+		{Segment: "E1EDP01", Offset: 26, Length: 3, Field: "UNIT"},
+		{Segment: "E1EDP01", Offset: 54, Length: 15, Field: "NETPRICE"},
+		{Segment: "E1EDP01", Offset: 78, Length: 18, Field: "NETVALUE"},
+		{Segment: "E1EDP19", Qualifier: "002", Offset: 3, Length: 35, Field: "PARTSNO"},
+		{Segment: "E1EDP19", Qualifier: "002", Offset: 38, Length: 70, Field: "PARTSDESC"},
+		{Segment: "E1EDP20", Offset: 30, Length: 8, Field: "CRAD"},
+	}
+}
+
+//ORDERS05 purchase order
+func purchaseOrderFields() []FieldMap {
+	return []FieldMap{
+		{Segment: "E1EDK01", Offset: 83, Length: 35, Field: "PONO"},
+		{Segment: "E1EDK01", Offset: 79, Length: 4, Field: "POTYPE"},
+		{Segment: "E1EDK01", Offset: 22, Length: 17, Field: "PaymentTerm"},
+		{Segment: "E1EDK03", Qualifier: "012", Offset: 3, Length: 8, Field: "PODate"},
+		{Segment: "E1EDK17", Qualifier: "001", Offset: 3, Length: 3, Field: "IncoTerm"},
+		{Segment: "E1EDKA1", Qualifier: "LF", Offset: 3, Length: 17, Field: "VendorNO"},
+		{Segment: "E1EDKA1", Qualifier: "LF", Offset: 37, Length: 35, Field: "VendorName"},
+		{Segment: "E1EDP01", Offset: 0, Length: 6, Field: "POItemNO"},
+		{Segment: "E1EDP01", Offset: 11, Length: 15, Field: "POQty"},
+		{Segment: "E1EDP01", Offset: 26, Length: 3, Field: "Unit"},
+		{Segment: "E1EDP01", Offset: 311, Length: 4, Field: "Plant"},
+		{Segment: "E1EDP02", Qualifier: "002", Offset: 3, Length: 35, Field: "SONUMBER"},
+		{Segment: "E1EDP02", Qualifier: "002", Offset: 38, Length: 6, Field: "SOITEM"},
+		{Segment: "E1EDP19", Qualifier: "001", Offset: 3, Length: 35, Field: "PARTSNO"},
+		{Segment: "E1EDP19", Qualifier: "001", Offset: 38, Length: 70, Field: "PARTSDESC"},
+	}
+}
+
+//INVOIC02, SONUMBER/SOITEM locate the sales order
+func billingFields() []FieldMap {
+	return []FieldMap{
+		{Segment: "E1EDK01", Offset: 83, Length: 35, Field: "BILLINGNO"},
+		{Segment: "E1EDK01", Offset: 4, Length: 3, Field: "CURRENCY"},
+		{Segment: "E1EDK14", Qualifier: "015", Offset: 3, Length: 35, Field: "BILLINGTYPE"},
+		{Segment: "E1EDK03", Qualifier: "026", Offset: 3, Length: 8, Field: "BPOSTDATE"},
+		{Segment: "E1EDK03", Qualifier: "012", Offset: 3, Length: 8, Field: "BILLINGCDATE"},
+		{Segment: "E1EDK03", Qualifier: "012", Offset: 11, Length: 6, Field: "BILLINGTIME"},
+		{Segment: "E1EDP01", Offset: 0, Length: 6, Field: "BILLINGITEM"},
+		{Segment: "E1EDP01", Offset: 11, Length: 15, Field: "BILLINGQTY"},
+		{Segment: "E1EDP01", Offset: 26, Length: 3, Field: "UNIT"},
+		{Segment: "E1EDP01", Offset: 78, Length: 18, Field: "NETVALUE"},
+		{Segment: "E1EDP02", Qualifier: "002", Offset: 3, Length: 35, Field: "SONUMBER"},
+		{Segment: "E1EDP02", Qualifier: "002", Offset: 38, Length: 6, Field: "SOITEM"},
+		{Segment: "E1EDP02", Qualifier: "012", Offset: 3, Length: 35, Field: "DNNUMBER"},
+		{Segment: "E1EDP02", Qualifier: "012", Offset: 38, Length: 6, Field: "DNITEM"},
+		{Segment: "E1EDP04", Offset: 24, Length: 18, Field: "TAXAMOUNT"},
+		{Segment: "E1EDP19", Qualifier: "002", Offset: 3, Length: 35, Field: "PARTSNO"},
+		{Segment: "E1EDP19", Qualifier: "002", Offset: 38, Length: 70, Field: "PARTSDESC"},
+	}
+}
+
+//DESADV on DELVRY segments (outbound delivery), SONUMBER/SOITEM locate the sales order
+func goodsIssueFields() []FieldMap {
+	return []FieldMap{
+		{Segment: "E1EDL20", Offset: 0, Length: 10, Field: "DNNUMBER"},
+		{Segment: "E1EDT13", Qualifier: "006", Offset: 61, Length: 8, Field: "DNDATE"},
+		{Segment: "E1EDL24", Offset: 0, Length: 6, Field: "DNITEM"},
+		{Segment: "E1EDL24", Offset: 6, Length: 18, Field: "PARTSNO"},
+		{Segment: "E1EDL24", Offset: 42, Length: 40, Field: "PARTSDESC"},
+		{Segment: "E1EDL24", Offset: 189, Length: 15, Field: "DNQTY"},
+		{Segment: "E1EDL24", Offset: 204, Length: 3, Field: "UNIT"},
+		{Segment: "E1EDL43", Qualifier: "C", Offset: 1, Length: 35, Field: "SONUMBER"},
+		{Segment: "E1EDL43", Qualifier: "C", Offset: 36, Length: 6, Field: "SOITEM"},
+	}
+}
+
+//DELVRY inbound delivery, PONO/POItemNO locate the purchase order
+func inboundDeliveryFields() []FieldMap {
+	return []FieldMap{
+		{Segment: "E1EDL20", Offset: 0, Length: 10, Field: "IBDNNUMBER"},
+		{Segment: "E1EDL20", Offset: 52, Length: 3, Field: "IncoTerm"},
+		{Segment: "E1EDL20", Offset: 149, Length: 35, Field: "TrackID"},
+		{Segment: "E1EDL20", Offset: 184, Length: 4, Field: "MOT"},
+		{Segment: "E1EDL20", Offset: 218, Length: 35, Field: "ASNNO"},
+		{Segment: "E1ADRM1", Qualifier: "LF", Offset: 3, Length: 17, Field: "VendorNO"},
+		{Segment: "E1EDT13", Qualifier: "015", Offset: 27, Length: 8, Field: "IDCrtDate"},
+		{Segment: "E1EDT13", Qualifier: "007", Offset: 41, Length: 8, Field: "IDDlvyDate"},
+		{Segment: "E1EDL24", Offset: 0, Length: 6, Field: "IBDNITEM"},
+		{Segment: "E1EDL24", Offset: 6, Length: 18, Field: "PARTSNO"},
+		{Segment: "E1EDL24", Offset: 42, Length: 40, Field: "PARTSDESC"},
+		{Segment: "E1EDL24", Offset: 189, Length: 15, Field: "DlvyQty"},
+		{Segment: "E1EDL41", Qualifier: "001", Offset: 3, Length: 35, Field: "PONO"},
+		{Segment: "E1EDL41", Qualifier: "001", Offset: 50, Length: 6, Field: "POItemNO"},
+	}
+}
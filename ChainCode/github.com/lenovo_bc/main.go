@@ -0,0 +1,15 @@
+package main
+
+import (
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/lenovo_bc/chaincode"
+)
+
+var logger = shim.NewLogger("lenovo_bc")
+
+func main() {
+	err := shim.Start(new(chaincode.SmartContract))
+	if err != nil {
+		logger.Errorf("Error starting smartcontract chaincode: %s", err)
+	}
+}
@@ -0,0 +1,440 @@
+package mockstub
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+//CouchDB Mango query, the part GetQueryResult evaluates
+type Query struct {
+	Selector map[string]interface{} `json:"selector"`
+	Fields   []string               `json:"fields"` //Returned fields, all if empty
+	Sort     []interface{}          `json:"sort"`   //"field" or {"field": "asc"|"desc"}
+	Limit    int                    `json:"limit"`  //0 for no limit
+	Skip     int                    `json:"skip"`
+	UseIndex interface{}            `json:"use_index"` //Ignored, there are no indexes
+}
+
+func ParseQuery(query string) (error, Query) {
+	q := Query{}
+	decoder := json.NewDecoder(strings.NewReader(query))
+	decoder.UseNumber()
+	err := decoder.Decode(&q)
+	if err != nil {
+		return fmt.Errorf("invalid query: %s", err.Error()), q
+	}
+	if q.Selector == nil {
+		return fmt.Errorf("invalid query: selector is missing"), q
+	}
+	if q.Limit < 0 || q.Skip < 0 {
+		return fmt.Errorf("invalid query: negative limit or skip"), q
+	}
+	for _, s := range q.Sort {
+		if err, _, _ := sortField(s); err != nil {
+			return err, q
+		}
+	}
+	//check the operators once, documents may not reach all of them
+	if err, _ := matchSelector(q.Selector, map[string]interface{}{}); err != nil {
+		return err, q
+	}
+	return nil, q
+}
+
+//Decodes a ledger value, numbers are kept as json.Number
+func decode(value []byte) (error, interface{}) {
+	var doc interface{}
+	decoder := json.NewDecoder(strings.NewReader(string(value)))
+	decoder.UseNumber()
+	err := decoder.Decode(&doc)
+	return err, doc
+}
+
+//Whether the JSON document matches the selector
+func (q Query) Match(doc interface{}) (error, bool) {
+	return matchSelector(q.Selector, doc)
+}
+
+func matchSelector(selector map[string]interface{}, doc interface{}) (error, bool) {
+	//sorted so the same error is reported first
+	names := []string{}
+	for name := range selector {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	matched := true
+	for _, name := range names {
+		condition := selector[name]
+		var ok bool
+		var err error
+		if strings.HasPrefix(name, "$") {
+			err, ok = matchCombination(name, condition, doc)
+		} else {
+			value, found := field(doc, name)
+			err, ok = matchCondition(condition, value, found)
+		}
+		if err != nil {
+			return err, false
+		}
+		matched = matched && ok
+	}
+	return nil, matched
+}
+
+func selectors(operator string, condition interface{}) (error, []map[string]interface{}) {
+	list, ok := condition.([]interface{})
+	if !ok {
+		return fmt.Errorf("invalid query: %s takes an array of selectors", operator), nil
+	}
+	result := []map[string]interface{}{}
+	for _, item := range list {
+		s, ok := item.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("invalid query: %s takes an array of selectors", operator), nil
+		}
+		result = append(result, s)
+	}
+	return nil, result
+}
+
+//$and, $or, $nor, $not at selector level
+func matchCombination(operator string, condition interface{}, doc interface{}) (error, bool) {
+	if operator == "$not" {
+		s, ok := condition.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("invalid query: $not takes a selector"), false
+		}
+		err, matched := matchSelector(s, doc)
+		return err, !matched
+	}
+	err, list := selectors(operator, condition)
+	if err != nil {
+		return err, false
+	}
+	count := 0
+	for _, s := range list {
+		err, matched := matchSelector(s, doc)
+		if err != nil {
+			return err, false
+		}
+		if matched {
+			count++
+		}
+	}
+	switch operator {
+	case "$and":
+		return nil, count == len(list)
+	case "$or":
+		return nil, count > 0
+	case "$nor":
+		return nil, count == 0
+	}
+	return fmt.Errorf("invalid query: unknown operator %s", operator), false
+}
+
+//Value of a dotted field path
+func field(doc interface{}, path string) (interface{}, bool) {
+	value := doc
+	for _, name := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		value, ok = object[name]
+		if !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+func isOperatorObject(condition interface{}) (map[string]interface{}, bool) {
+	object, ok := condition.(map[string]interface{})
+	if !ok || len(object) == 0 {
+		return nil, false
+	}
+	for name := range object {
+		if !strings.HasPrefix(name, "$") {
+			return nil, false
+		}
+	}
+	return object, true
+}
+
+//Condition on one field: operators, a sub selector or a value to equal
+func matchCondition(condition interface{}, value interface{}, found bool) (error, bool) {
+	operators, ok := isOperatorObject(condition)
+	if !ok {
+		if sub, ok := condition.(map[string]interface{}); ok {
+			//{"rows": {"soNo": "1"}} is rows.soNo
+			if !found {
+				value = map[string]interface{}{}
+			}
+			return matchSelector(sub, value)
+		}
+		return nil, found && equal(value, condition)
+	}
+	names := []string{}
+	for name := range operators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	matched := true
+	for _, name := range names {
+		err, ok := matchOperator(name, operators[name], value, found)
+		if err != nil {
+			return err, false
+		}
+		matched = matched && ok
+	}
+	return nil, matched
+}
+
+func matchOperator(operator string, arg interface{}, value interface{}, found bool) (error, bool) {
+	switch operator {
+	case "$exists":
+		exists, ok := arg.(bool)
+		if !ok {
+			return fmt.Errorf("invalid query: $exists takes a boolean"), false
+		}
+		return nil, found == exists
+	case "$not":
+		err, matched := matchCondition(arg, value, found)
+		return err, found && !matched
+	case "$eq":
+		return nil, found && equal(value, arg)
+	case "$ne":
+		return nil, found && !equal(value, arg)
+	case "$gt", "$gte", "$lt", "$lte":
+		if !found {
+			return nil, false
+		}
+		c := compare(value, arg)
+		return nil, (operator == "$gt" && c > 0) || (operator == "$gte" && c >= 0) ||
+			(operator == "$lt" && c < 0) || (operator == "$lte" && c <= 0)
+	case "$in", "$nin":
+		list, ok := arg.([]interface{})
+		if !ok {
+			return fmt.Errorf("invalid query: %s takes an array", operator), false
+		}
+		in := false
+		for _, item := range list {
+			if equal(value, item) {
+				in = true
+			}
+		}
+		return nil, found && in == (operator == "$in")
+	case "$all":
+		list, ok := arg.([]interface{})
+		if !ok {
+			return fmt.Errorf("invalid query: $all takes an array"), false
+		}
+		array, ok := value.([]interface{})
+		if !ok {
+			return nil, false
+		}
+		for _, item := range list {
+			if !contains(array, item) {
+				return nil, false
+			}
+		}
+		return nil, true
+	case "$size":
+		size, ok := arg.(json.Number)
+		if !ok {
+			return fmt.Errorf("invalid query: $size takes a number"), false
+		}
+		array, ok := value.([]interface{})
+		return nil, ok && json.Number(fmt.Sprint(len(array))) == size
+	case "$regex":
+		pattern, ok := arg.(string)
+		if !ok {
+			return fmt.Errorf("invalid query: $regex takes a string"), false
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid query: %s", err.Error()), false
+		}
+		s, ok := value.(string)
+		return nil, ok && re.MatchString(s)
+	case "$elemMatch", "$allMatch":
+		array, ok := value.([]interface{})
+		if !ok {
+			//check the condition anyway so errors are reported
+			err, _ := matchCondition(arg, nil, false)
+			return err, false
+		}
+		count := 0
+		for _, item := range array {
+			err, matched := matchCondition(arg, item, true)
+			if err != nil {
+				return err, false
+			}
+			if matched {
+				count++
+			}
+		}
+		if operator == "$elemMatch" {
+			return nil, count > 0
+		}
+		return nil, len(array) > 0 && count == len(array)
+	}
+	return fmt.Errorf("invalid query: unknown operator %s", operator), false
+}
+
+func contains(array []interface{}, value interface{}) bool {
+	for _, item := range array {
+		if equal(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func equal(a interface{}, b interface{}) bool {
+	return compare(a, b) == 0
+}
+
+//CouchDB collation: null, false, true, numbers, strings, arrays, objects.
+//Strings are compared by bytes, CouchDB uses ICU.
+func rank(v interface{}) int {
+	switch x := v.(type) {
+	case nil:
+		return 0
+	case bool:
+		if x {
+			return 2
+		}
+		return 1
+	case json.Number, float64:
+		return 3
+	case string:
+		return 4
+	case []interface{}:
+		return 5
+	}
+	return 6
+}
+
+func number(v interface{}) float64 {
+	if n, ok := v.(json.Number); ok {
+		f, _ := n.Float64()
+		return f
+	}
+	return v.(float64)
+}
+
+func compare(a interface{}, b interface{}) int {
+	ra, rb := rank(a), rank(b)
+	if ra != rb {
+		return ra - rb
+	}
+	switch ra {
+	case 3:
+		x, y := number(a), number(b)
+		if x < y {
+			return -1
+		} else if x > y {
+			return 1
+		}
+		return 0
+	case 4:
+		return strings.Compare(a.(string), b.(string))
+	case 5:
+		x, y := a.([]interface{}), b.([]interface{})
+		for i := 0; i < len(x) && i < len(y); i++ {
+			if c := compare(x[i], y[i]); c != 0 {
+				return c
+			}
+		}
+		return len(x) - len(y)
+	case 6:
+		if reflect.DeepEqual(a, b) {
+			return 0
+		}
+		x, _ := json.Marshal(a)
+		y, _ := json.Marshal(b)
+		if c := strings.Compare(string(x), string(y)); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func sortField(s interface{}) (error, string, bool) {
+	if name, ok := s.(string); ok {
+		return nil, name, false
+	}
+	if object, ok := s.(map[string]interface{}); ok && len(object) == 1 {
+		for name, direction := range object {
+			if direction == "asc" || direction == "desc" {
+				return nil, name, direction == "desc"
+			}
+		}
+	}
+	return fmt.Errorf("invalid query: sort takes field names or {\"field\": \"asc\"|\"desc\"}"), "", false
+}
+
+//Sorts documents in place, stable so equal documents keep the key order
+func (q Query) sort(docs []document) {
+	if len(q.Sort) == 0 {
+		return
+	}
+	sort.Stable(byFields{docs, q.Sort})
+}
+
+type document struct {
+	key   string
+	value []byte
+	doc   interface{}
+}
+
+type byFields struct {
+	docs   []document
+	fields []interface{}
+}
+
+func (b byFields) Len() int      { return len(b.docs) }
+func (b byFields) Swap(i, j int) { b.docs[i], b.docs[j] = b.docs[j], b.docs[i] }
+func (b byFields) Less(i, j int) bool {
+	for _, s := range b.fields {
+		_, name, desc := sortField(s)
+		x, _ := field(b.docs[i].doc, name)
+		y, _ := field(b.docs[j].doc, name)
+		if c := compare(x, y); c != 0 {
+			return (c < 0) != desc
+		}
+	}
+	return false
+}
+
+//Value with the selected fields only
+func (q Query) project(value []byte, doc interface{}) []byte {
+	if len(q.Fields) == 0 {
+		return value
+	}
+	result := map[string]interface{}{}
+	for _, path := range q.Fields {
+		v, found := field(doc, path)
+		if !found {
+			continue
+		}
+		names := strings.Split(path, ".")
+		object := result
+		for _, name := range names[:len(names)-1] {
+			child, ok := object[name].(map[string]interface{})
+			if !ok {
+				child = map[string]interface{}{}
+				object[name] = child
+			}
+			object = child
+		}
+		object[names[len(names)-1]] = v
+	}
+	b, _ := json.Marshal(result)
+	return b
+}
@@ -0,0 +1,312 @@
+// Package mockstub wraps shim.MockStub with the two queries it leaves out:
+// GetQueryResult evaluates CouchDB Mango queries against the JSON values of
+// the world state, GetHistoryForKey returns the writes recorded per key.
+//
+//	stub := mockstub.NewStub("lenovo_bc", new(SmartContract))
+//	stub.MockInit("1", nil)
+//	stub.MockInvoke("2", [][]byte{[]byte("getQueryResult"), []byte("lenovo"), []byte(query)})
+//
+// Like on a peer, a transaction doesn't see its own writes: they are
+// committed when it succeeds, the last write of a key wins, and dropped when
+// it fails. Mango support: implicit $eq, $eq, $ne, $gt, $gte, $lt,
+// $lte, $exists, $in, $nin, $all, $size, $regex, $elemMatch, $allMatch,
+// $not, $and, $or, $nor, dotted and nested field names, fields, sort, skip
+// and limit. Strings compare by bytes, not by the CouchDB ICU collation.
+//
+// Written, Reads and Writes describe the state accesses of the last
+// transaction, for tests and load measurements. SetCreator sets the MSP ID
+// of the identity creating the following transactions, there is none
+// until it is called.
+package mockstub
+
+import (
+	"errors"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/ledger/queryresult"
+	"github.com/hyperledger/fabric/protos/msp"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+//MockStub driving the chaincode with itself as the stub, so the chaincode
+//calls the emulated queries. Use MockInit and MockInvoke of Stub, the
+//MockStub ones pass the bare MockStub.
+type Stub struct {
+	*shim.MockStub
+	History map[string][]*queryresult.KeyModification //Writes per key, oldest first
+	Written []string                                  //Keys written by the running or the last transaction, none if it failed
+	Reads   int                                       //Values read by the running or the last transaction, GetState and query results
+	Writes  int                                       //PutState and DelState calls of the running or the last transaction
+	Creator []byte                                    //Serialized identity of the transaction creator, see SetCreator
+	cc      shim.Chaincode
+	args    [][]byte
+	pending map[string]pendingWrite //Last write of each key of the running transaction
+}
+
+type pendingWrite struct {
+	value    []byte
+	isDelete bool
+}
+
+func NewStub(name string, cc shim.Chaincode) *Stub {
+	return &Stub{
+		MockStub: shim.NewMockStub(name, cc),
+		History:  map[string][]*queryresult.KeyModification{},
+		cc:       cc,
+	}
+}
+
+func (s *Stub) MockInit(uuid string, args [][]byte) pb.Response {
+	s.begin(uuid, args)
+	res := s.cc.Init(s)
+	s.end(res)
+	return res
+}
+
+func (s *Stub) MockInvoke(uuid string, args [][]byte) pb.Response {
+	return s.MockInvokeAt(uuid, nil, args)
+}
+
+//MockInvoke with the transaction time of a recorded transaction, now if nil
+func (s *Stub) MockInvokeAt(uuid string, ts *timestamp.Timestamp, args [][]byte) pb.Response {
+	s.begin(uuid, args)
+	if ts != nil {
+		s.TxTimestamp = ts
+	}
+	res := s.cc.Invoke(s)
+	s.end(res)
+	return res
+}
+
+func (s *Stub) begin(uuid string, args [][]byte) {
+	s.args = args
+	s.Written = nil
+	s.Reads = 0
+	s.Writes = 0
+	s.pending = map[string]pendingWrite{}
+	s.MockTransactionStart(uuid)
+}
+
+//Commits the last write of every key like a block and records it in the
+//history. A failed transaction writes nothing.
+func (s *Stub) end(res pb.Response) {
+	if res.Status >= shim.ERRORTHRESHOLD {
+		s.Written = nil
+	}
+	for _, key := range s.Written {
+		w := s.pending[key]
+		if w.isDelete {
+			s.MockStub.DelState(key)
+		} else {
+			s.MockStub.PutState(key, w.value)
+		}
+		modification := &queryresult.KeyModification{
+			TxId:      s.TxID,
+			Value:     w.value,
+			Timestamp: &timestamp.Timestamp{Seconds: s.TxTimestamp.Seconds, Nanos: s.TxTimestamp.Nanos},
+			IsDelete:  w.isDelete,
+		}
+		s.History[key] = append(s.History[key], modification)
+	}
+	s.pending = nil
+	s.MockTransactionEnd(s.TxID)
+}
+
+func (s *Stub) write(key string) {
+	s.Writes++
+	for _, k := range s.Written {
+		if k == key {
+			return
+		}
+	}
+	s.Written = append(s.Written, key)
+}
+
+//Creates the following transactions as an identity of the MSP, no
+//certificate is included
+func (s *Stub) SetCreator(mspID string) {
+	s.Creator, _ = proto.Marshal(&msp.SerializedIdentity{Mspid: mspID})
+}
+
+func (s *Stub) GetCreator() ([]byte, error) {
+	return s.Creator, nil
+}
+
+func (s *Stub) GetArgs() [][]byte {
+	return s.args
+}
+
+func (s *Stub) GetStringArgs() []string {
+	args := []string{}
+	for _, arg := range s.args {
+		args = append(args, string(arg))
+	}
+	return args
+}
+
+func (s *Stub) GetFunctionAndParameters() (string, []string) {
+	args := s.GetStringArgs()
+	if len(args) == 0 {
+		return "", []string{}
+	}
+	return args[0], args[1:]
+}
+
+func (s *Stub) GetArgsSlice() ([]byte, error) {
+	b := []byte{}
+	for _, arg := range s.args {
+		b = append(b, arg...)
+	}
+	return b, nil
+}
+
+func (s *Stub) GetState(key string) ([]byte, error) {
+	value, err := s.MockStub.GetState(key)
+	if err == nil {
+		s.Reads++
+	}
+	return value, err
+}
+
+func (s *Stub) GetStateByRange(startKey string, endKey string) (shim.StateQueryIteratorInterface, error) {
+	it, err := s.MockStub.GetStateByRange(startKey, endKey)
+	if err != nil {
+		return nil, err
+	}
+	return &countingIterator{StateQueryIteratorInterface: it, reads: &s.Reads}, nil
+}
+
+func (s *Stub) GetStateByPartialCompositeKey(objectType string, attributes []string) (shim.StateQueryIteratorInterface, error) {
+	it, err := s.MockStub.GetStateByPartialCompositeKey(objectType, attributes)
+	if err != nil {
+		return nil, err
+	}
+	return &countingIterator{StateQueryIteratorInterface: it, reads: &s.Reads}, nil
+}
+
+func (s *Stub) PutState(key string, value []byte) error {
+	if s.pending == nil {
+		return errors.New("PutState outside of a transaction")
+	}
+	s.pending[key] = pendingWrite{value: value}
+	s.write(key)
+	return nil
+}
+
+func (s *Stub) DelState(key string) error {
+	if s.pending == nil {
+		return errors.New("DelState outside of a transaction")
+	}
+	s.pending[key] = pendingWrite{isDelete: true}
+	s.write(key)
+	return nil
+}
+
+//Mango query over the world state in key order, values that are not JSON
+//objects are skipped like CouchDB attachments
+func (s *Stub) GetQueryResult(query string) (shim.StateQueryIteratorInterface, error) {
+	err, q := ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	docs := []document{}
+	for e := s.Keys.Front(); e != nil; e = e.Next() {
+		key := e.Value.(string)
+		value, ok := s.State[key]
+		if !ok {
+			continue
+		}
+		err, doc := decode(value)
+		if _, object := doc.(map[string]interface{}); err != nil || !object {
+			continue
+		}
+		err, matched := q.Match(doc)
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			docs = append(docs, document{key: key, value: value, doc: doc})
+		}
+	}
+	q.sort(docs)
+	if q.Skip >= len(docs) {
+		docs = nil
+	} else {
+		docs = docs[q.Skip:]
+	}
+	if q.Limit > 0 && q.Limit < len(docs) {
+		docs = docs[:q.Limit]
+	}
+	results := []*queryresult.KV{}
+	for _, d := range docs {
+		results = append(results, &queryresult.KV{Namespace: s.Name, Key: d.key, Value: q.project(d.value, d.doc)})
+	}
+	return &countingIterator{StateQueryIteratorInterface: &stateIterator{results: results}, reads: &s.Reads}, nil
+}
+
+func (s *Stub) GetHistoryForKey(key string) (shim.HistoryQueryIteratorInterface, error) {
+	return &historyIterator{results: s.History[key], reads: &s.Reads}, nil
+}
+
+//Counts the results read from a state iterator
+type countingIterator struct {
+	shim.StateQueryIteratorInterface
+	reads *int
+}
+
+func (it *countingIterator) Next() (*queryresult.KV, error) {
+	kv, err := it.StateQueryIteratorInterface.Next()
+	if err == nil {
+		*it.reads++
+	}
+	return kv, err
+}
+
+type stateIterator struct {
+	results []*queryresult.KV
+	closed  bool
+}
+
+func (it *stateIterator) HasNext() bool {
+	return !it.closed && len(it.results) > 0
+}
+
+func (it *stateIterator) Next() (*queryresult.KV, error) {
+	if !it.HasNext() {
+		return nil, errors.New("no more results")
+	}
+	kv := it.results[0]
+	it.results = it.results[1:]
+	return kv, nil
+}
+
+func (it *stateIterator) Close() error {
+	it.closed = true
+	return nil
+}
+
+type historyIterator struct {
+	results []*queryresult.KeyModification
+	closed  bool
+	reads   *int
+}
+
+func (it *historyIterator) HasNext() bool {
+	return !it.closed && len(it.results) > 0
+}
+
+func (it *historyIterator) Next() (*queryresult.KeyModification, error) {
+	if !it.HasNext() {
+		return nil, errors.New("no more results")
+	}
+	modification := it.results[0]
+	it.results = it.results[1:]
+	*it.reads++
+	return modification, nil
+}
+
+func (it *historyIterator) Close() error {
+	it.closed = true
+	return nil
+}
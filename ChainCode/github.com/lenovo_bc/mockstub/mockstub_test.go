@@ -0,0 +1,175 @@
+package mockstub
+
+import (
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"testing"
+)
+
+const order = `{"SONUMBER":"478","SOITEM":"10","NETPRICE":7,"Deleted":false,
+	"rows":{"soNo":"478","type":"sokey"},
+	"BILLINFOS":[{"BILLINGNO":"9001","BILLINGQTY":2},{"BILLINGNO":"9002","BILLINGQTY":5}]}`
+
+func TestMatch(t *testing.T) {
+	err, doc := decode([]byte(order))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		selector string
+		matched  bool
+	}{
+		{`{}`, true},
+		{`{"SONUMBER":"478"}`, true},
+		{`{"SONUMBER":"479"}`, false},
+		{`{"SONUMBER":{"$eq":"478"},"SOITEM":{"$ne":"20"}}`, true},
+		{`{"NETPRICE":{"$gt":5,"$lte":7}}`, true},
+		{`{"NETPRICE":{"$lt":7}}`, false},
+		{`{"NETPRICE":{"$gt":"5"}}`, false},
+		{`{"SOITEM":{"$in":["10","20"]}}`, true},
+		{`{"SOITEM":{"$nin":["10","20"]}}`, false},
+		{`{"PONO":{"$exists":false}}`, true},
+		{`{"PONO":{"$ne":"1"}}`, false},
+		{`{"Deleted":{"$exists":true,"$eq":false}}`, true},
+		{`{"rows.soNo":"478"}`, true},
+		{`{"rows":{"soNo":{"$eq":"478"},"type":"sokey"}}`, true},
+		{`{"rows":{"soNo":"479"}}`, false},
+		{`{"SONUMBER":{"$regex":"^4[0-9]+$"}}`, true},
+		{`{"BILLINFOS":{"$elemMatch":{"BILLINGNO":"9002","BILLINGQTY":{"$gt":4}}}}`, true},
+		{`{"BILLINFOS":{"$elemMatch":{"BILLINGNO":"9001","BILLINGQTY":{"$gt":4}}}}`, false},
+		{`{"BILLINFOS":{"$allMatch":{"BILLINGQTY":{"$gte":2}}}}`, true},
+		{`{"BILLINFOS":{"$size":2}}`, true},
+		{`{"$or":[{"SONUMBER":"1"},{"SOITEM":"10"}]}`, true},
+		{`{"$and":[{"SONUMBER":"478"},{"SOITEM":"20"}]}`, false},
+		{`{"$nor":[{"SONUMBER":"1"}]}`, true},
+		{`{"$not":{"SONUMBER":"478"}}`, false},
+		{`{"SOITEM":{"$not":{"$in":["20"]}}}`, true},
+	}
+	for _, c := range cases {
+		err, q := ParseQuery(`{"selector":` + c.selector + `}`)
+		if err != nil {
+			t.Fatalf("%s: %s", c.selector, err.Error())
+		}
+		err, matched := q.Match(doc)
+		if err != nil || matched != c.matched {
+			t.Errorf("%s matched %v, expected %v %v", c.selector, matched, c.matched, err)
+		}
+	}
+	for _, query := range []string{`{}`, `{"selector":{"a":{"$foo":1}}}`, `{"selector":{"$or":{}}}`,
+		`{"selector":{"a":{"$regex":"("}}}`, `{"selector":{},"sort":[{"a":"up"}]}`, `{"selector":{},"limit":-1}`} {
+		if err, _ := ParseQuery(query); err == nil {
+			t.Errorf("%s is accepted", query)
+		}
+	}
+}
+
+//Chaincode writing args[1] to args[0], deleting args[0] without a value
+type kv struct{}
+
+func (cc *kv) Init(stub shim.ChaincodeStubInterface) pb.Response {
+	return shim.Success(nil)
+}
+
+func (cc *kv) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
+	function, args := stub.GetFunctionAndParameters()
+	if function == "query" {
+		it, err := stub.GetQueryResult(args[0])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		defer it.Close()
+		keys := ""
+		for it.HasNext() {
+			kv, _ := it.Next()
+			keys += kv.Key + "=" + string(kv.Value) + ";"
+		}
+		return shim.Success([]byte(keys))
+	}
+	if function == "putget" {
+		stub.PutState(args[0], []byte(args[1]))
+		value, _ := stub.GetState(args[0])
+		return shim.Success(value)
+	}
+	for i := 0; i+1 < len(args); i += 2 {
+		stub.PutState(args[i], []byte(args[i+1]))
+	}
+	if function == "fail" {
+		return shim.Error("failed")
+	}
+	if len(args)%2 == 1 {
+		stub.DelState(args[len(args)-1])
+	}
+	return shim.Success(nil)
+}
+
+func invoke(stub *Stub, tx string, args ...string) pb.Response {
+	b := [][]byte{}
+	for _, arg := range args {
+		b = append(b, []byte(arg))
+	}
+	return stub.MockInvoke(tx, b)
+}
+
+func TestStub(t *testing.T) {
+	stub := NewStub("kv", &kv{})
+	stub.MockInit("tx0", nil)
+	invoke(stub, "tx1", "put", "b", `{"n":2,"t":"x"}`, "a", `{"n":3,"t":"x"}`, "c", `{"n":1,"t":"y"}`, "d", `not json`)
+	invoke(stub, "tx2", "put", "a", `{"n":4,"t":"x"}`, "a", `{"n":5,"t":"x"}`)
+	if len(stub.Written) != 1 || stub.Writes != 2 || stub.Reads != 0 {
+		t.Fatalf("unexpected writes %q %d", stub.Written, stub.Writes)
+	}
+	invoke(stub, "tx3", "put", "b")
+
+	res := invoke(stub, "tx4", "query", `{"selector":{"t":"x"}}`)
+	if string(res.Payload) != `a={"n":5,"t":"x"};` {
+		t.Fatalf("unexpected result %s %s", res.Payload, res.Message)
+	}
+	invoke(stub, "tx5", "put", "b", `{"n":2,"t":"x"}`)
+	res = invoke(stub, "tx6", "query", `{"selector":{"n":{"$gte":1}},"sort":[{"n":"desc"}],"skip":1,"limit":2,"fields":["n"]}`)
+	if string(res.Payload) != `b={"n":2};c={"n":1};` {
+		t.Fatalf("unexpected result %s %s", res.Payload, res.Message)
+	}
+	if stub.Reads != 2 || stub.Writes != 0 {
+		t.Fatalf("%d reads, %d writes", stub.Reads, stub.Writes)
+	}
+	if res = invoke(stub, "tx7", "query", `{"selector":{"n":{"$bad":1}}}`); res.Status == shim.OK {
+		t.Fatal("bad operator accepted")
+	}
+
+	it, _ := stub.GetHistoryForKey("a")
+	txs := ""
+	for it.HasNext() {
+		m, _ := it.Next()
+		txs += m.TxId + "=" + string(m.Value) + ";"
+	}
+	if txs != `tx1={"n":3,"t":"x"};tx2={"n":5,"t":"x"};` || stub.Reads != 2 {
+		t.Fatalf("unexpected history %s", txs)
+	}
+	b := stub.History["b"]
+	if len(b) != 3 || !b[1].IsDelete || b[1].TxId != "tx3" || b[1].Value != nil || b[2].Timestamp == nil {
+		t.Fatalf("unexpected history of b %v", b)
+	}
+	if len(stub.History["c"]) != 1 || stub.History["x"] != nil {
+		t.Fatal("unexpected history")
+	}
+}
+
+//Writes are committed when the transaction succeeds, a transaction reads
+//the committed value
+func TestCommit(t *testing.T) {
+	stub := NewStub("kv", &kv{})
+	stub.MockInit("tx0", nil)
+	invoke(stub, "tx1", "put", "a", "1")
+	if res := invoke(stub, "tx2", "putget", "a", "2"); string(res.Payload) != "1" || string(stub.State["a"]) != "2" {
+		t.Fatalf("unexpected read %s, state %s", res.Payload, stub.State["a"])
+	}
+	if res := invoke(stub, "tx3", "fail", "a", "3", "b", "3"); res.Status == shim.OK {
+		t.Fatal("fail succeeded")
+	}
+	if string(stub.State["a"]) != "2" || stub.State["b"] != nil || len(stub.Written) != 0 || len(stub.History["a"]) != 2 {
+		t.Fatalf("failed transaction was committed %s %q", stub.State["a"], stub.Written)
+	}
+	if err := stub.PutState("a", []byte("4")); err == nil {
+		t.Fatal("write outside of a transaction was accepted")
+	}
+}
@@ -1,10 +1,6 @@
-package main
-
-import (
-	"encoding/json"
-	"errors"
-	"github.com/hyperledger/fabric/core/chaincode/shim"
-)
+// Package model holds the ledger documents of lenovo_bc, shared by the
+// chaincode and the tools working with its JSON.
+package model
 
 //附件
 type Attachment struct {
@@ -13,10 +9,25 @@ type Attachment struct {
 	FileType string `json:"FileType"` //文件类型
 }
 
+//Schema version of a stored record, stamped by the chaincode on every write.
+//Records written before versioning have none, they are version 1.
+type Versioned struct {
+	SchemaVersion int `json:"SchemaVersion,omitempty"`
+}
+
+func (v *Versioned) SetSchemaVersion(version int) {
+	v.SchemaVersion = version
+}
+
+func (v *Versioned) GetSchemaVersion() int {
+	return v.SchemaVersion
+}
+
 type QueryParam struct {
-	KeyPrefix string   `json:"keyPrefix"` //keyPrefix
-	KeysStart []string `json:"keysStart"` //keys start
-	KeysEnd   []string `json:"keysEnd"`   //keys end
+	KeyPrefix      string   `json:"keyPrefix"`      //keyPrefix
+	KeysStart      []string `json:"keysStart"`      //keys start
+	KeysEnd        []string `json:"keysEnd"`        //keys end
+	IncludeDeleted bool     `json:"includeDeleted"` //include soft deleted records
 }
 
 type POAndSOOrder struct {
@@ -40,6 +51,38 @@ type ODMInfoReq struct {
 	PAYMENTDATE   string `json:"PAYMENTDATE"`
 }
 
+//Payload of the POSTED chaincode event, one per transaction
+type PostingEvent struct {
+	TxID           string                `json:"TxID"`                     //Transaction ID
+	Time           string                `json:"Time"`                     //Transaction time
+	VendorNO       string                `json:"VendorNO"`                 //Vendor no of the caller
+	Documents      []DocumentRef         `json:"Documents,omitempty"`      //Written SO, PO, CPO and supplier ASN records
+	SupplierOrders []SupplierOrder       `json:"SupplierOrders,omitempty"` //Posted ASNs
+	ODMGRInfos     []ODMInfoReq          `json:"ODMGRInfos,omitempty"`     //Posted ODM GRs
+	Subscriptions  []WebhookSubscription `json:"Subscriptions,omitempty"`  //Changed webhook subscriptions
+}
+
+//Record written by a transaction
+type DocumentRef struct {
+	Entity string            `json:"Entity"` //Key prefix: SO, PO, CPO, SUP
+	Keys   []string          `json:"Keys"`   //Composite key attributes
+	Fields map[string]string `json:"Fields"` //TRANSDOC and the webhook filter fields of the record
+}
+
+//Webhook subscription   Key: "WEBHOOK" + Partner + ID
+type WebhookSubscription struct {
+	ID            string `json:"ID"`                      //Transaction ID of creation
+	Partner       string `json:"Partner"`                 //Subscribing partner org
+	Entity        string `json:"Entity"`                  //Key prefix: SO, PO, CPO, SUP
+	FilterField   string `json:"FilterField"`             //e.g. VendorNO, CPONO
+	FilterValue   string `json:"FilterValue"`             //Only records with this value are sent
+	URL           string `json:"URL"`                     //http(s) endpoint of the partner
+	Secret        string `json:"Secret"`                  //HMAC-SHA256 key of the signature, empty in PostingEvent
+	UpdateTime    string `json:"UpdateTime"`              //Last change
+	Removed       bool   `json:"Removed,omitempty"`       //Only in PostingEvent, subscription was removed
+	SecretChanged bool   `json:"SecretChanged,omitempty"` //Only in PostingEvent, the secret is new or changed
+}
+
 //Supplier PO   Key: "SUP"+ Vendor No + ASNNumber
 type SupplierOrder struct {
 	ASNNumber           string        `json:"ASNNumber"`           //ASNNumber   -> Supplier ASN, Inbound Delivery/GR  Reference
@@ -55,8 +98,10 @@ type SupplierOrder struct {
 	TransporatationMode string        `json:"TransporatationMode"` //PO Number
 	CountryOfOrigin     string        `json:"CountryOfOrigin"`     //PO Number
 	PackingList         Attachment    `json:"PackingList"`         //Attachments
+	DELFLAG             string        `json:"DELETEFLAG"`          //DELETEFLAG, cascaded from PO
 	SalesOrder          SalesOrder    `json:"SalesOrder"`          //Sales Order info, only for search
 	PurchaseOrder       PurchaseOrder `json:"PurchaseOrder"`       //Purchase Order info,only for search
+	Versioned
 }
 
 //ODM PO   Key: "CPO"+ CPONo
@@ -70,6 +115,8 @@ type ODMPurchaseOrder struct {
 	PurchaseOrder PurchaseOrder `json:"PurchaseOrder"` //Purchase Order info,only for search
 	ODMPayments   []ODMPayment  `json:"ODMPayments"`   //Billing info
 	ODMGRInfos    []ODMGRInfo   `json:"ODMGRInfos"`    //GR info
+	DELFLAG       string        `json:"DELETEFLAG"`    //DELETEFLAG, cascaded from SO
+	Versioned
 }
 
 type ODMPayment struct {
@@ -114,7 +161,7 @@ type SalesOrder struct {
 	NETPRICE    string        `json:"NETPRICE"`    //Net price
 	NETVALUE    string        `json:"NETVALUE"`    //Net value
 	CURRENCY    string        `json:"CURRENCY"`    //Currency
-	UPDATE      string        `json:"UPDATEDAY"`   //Changed On
+	UPDATEDAY   string        `json:"UPDATEDAY"`   //Changed On
 	UPTIME     string        `json:"UPTIME"`       //Changed time
 	UPNAME      string        `json:"UPNAME"`      //Changed name
 	DELFLAG     string        `json:"DELETEFLAG"`  //DELETEFLAG
@@ -126,6 +173,7 @@ type SalesOrder struct {
 	POITEM      string        `json:"POITEM"`      //PO  item no
 	ODMPayments []ODMPayment  `json:"ODMPayments"` //Billing info only for search
 	ODMGRInfos  []ODMGRInfo   `json:"ODMGRInfos"`  //GR info only for search
+	Versioned
 }
 
 type BillingInfo struct {
@@ -148,7 +196,7 @@ type BillingInfo struct {
 	CURRENCY    string `json:"CURRENCY"`      //Currency
 	DNNUMBER    string `json:"DNNUMBER"`      //DNNUMBER      ->GI DN Number
 	DNITEM      string `json:"DNITEM"`        //DNITEM
-	UPDATE      string `json:"UPDATEDAY"`     //Changed On
+	UPDATEDAY   string `json:"UPDATEDAY"`     //Changed On
 	UPTIME      string `json:"UPTIME"`        //Changed time
 	UPNAME      string `json:"UPNAME"`        //Changed name
 }
@@ -202,6 +250,7 @@ type PurchaseOrder struct {
 	InboundDelivery []InboundDelivery `json:"InboundDelivery"` //Inbound Delivery
 	Invoice         []Invoice         `json:"Invoice"`         //Invoice
 	SupplierOrders  []SupplierOrder   `json:"SupplierOrders"`  //SupplierOrder
+	Versioned
 }
 
 type GRInfo struct {
@@ -261,7 +310,7 @@ type Invoice  struct {
 	PostDate    string `json:"PostDate"`   //Posting Date
 	BaseDate  string `json:"BaseDate"`     //Baseline Date
 	VenInvNO  string `json:"VenInvNO"`     //Vendor Invoice Number
-	comCode   string `json:"comCode"`      //Company Code
+	ComCode   string `json:"comCode"`      //Company Code
 	VendorNO  string `json:"VendorNO"`     //Vendor Number
 	InvStatus string `json:"InvStatus"`    //Inv. Status
 	InvItemNO string `json:"InvItemNO"`    //Item Number
@@ -273,62 +322,3 @@ type Invoice  struct {
 	UPTIME    string `json:"UPTIME"`       //GI UPTIME
 	UPNAME    string `json:"UPNAME"`       //GI UPNAME
 }
-
-//生成Key
-func generateKey(stub shim.ChaincodeStubInterface, keyPrefix string, keyArray []string) (error, string) {
-	if keyPrefix == "" {
-		return errors.New("Invalid object name"), ""
-	}
-	key, _ := stub.CreateCompositeKey(keyPrefix, keyArray)
-	return nil, key
-}
-
-//生成查询Key
-func generateQueryKey(stub shim.ChaincodeStubInterface, args []string) (error, string, string) {
-
-	keyStart := ""
-	keyEnd := ""
-
-	if len(args) != 2 {
-		return errors.New("Incorrect number of arguments."), keyStart, keyEnd
-	}
-
-	jsonStr := args[1]
-	param := QueryParam{}
-	err := json.Unmarshal([]byte(jsonStr), &param)
-	if err != nil {
-		return errors.New(err.Error()), keyStart, keyEnd
-	}
-
-	if param.KeyPrefix == "" {
-		return errors.New("Invalid object name"), keyStart, keyEnd
-	}
-	if len(param.KeysStart) > 0 {
-		keyStart, _ = stub.CreateCompositeKey(param.KeyPrefix, param.KeysStart)
-	} else {
-		return errors.New("Keys start is required"), keyStart, keyEnd
-	}
-	if len(param.KeysEnd) > 0 {
-		keyEnd, _ = stub.CreateCompositeKey(param.KeyPrefix, param.KeysEnd)
-	}
-	return nil, keyStart, keyEnd
-}
-
-func generateQueryKey2(stub shim.ChaincodeStubInterface, keyPrefix string, keysStart []string, keysEnd []string) (error, string, string) {
-
-	keyStart := ""
-	keyEnd := ""
-
-	if keyPrefix == "" {
-		return errors.New("Invalid object name"), keyStart, keyEnd
-	}
-	if len(keysStart) > 0 {
-		keyStart, _ = stub.CreateCompositeKey(keyPrefix, keysStart)
-	} else {
-		return errors.New("Keys start is required"), keyStart, keyEnd
-	}
-	if len(keysEnd) > 0 {
-		keyEnd, _ = stub.CreateCompositeKey(keyPrefix, keysEnd)
-	}
-	return nil,keyStart, keyEnd
-}
@@ -0,0 +1,162 @@
+// Package outbound turns the posting events of the chaincode into messages
+// for SAP and delivers them through an outbox with retry and dead letters.
+//
+// Each ASN of a POSTED event becomes one DESADV (DELVRY03, inbound delivery)
+// and each ODM GR one STPPOD proof of delivery per Lenovo DN, either as IDoc
+// flat file or as JSON. Message IDs are derived from the transaction, so an
+// event received twice is queued once.
+package outbound
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/lenovo_bc/idoc"
+	"github.com/lenovo_bc/model"
+	"hash/fnv"
+	"reflect"
+	"strings"
+)
+
+//Chaincode event name, same value as the chaincode
+const POSTING_EVENT = "POSTED"
+
+//Message formats
+const (
+	FORMAT_IDOC = "idoc"
+	FORMAT_JSON = "json"
+)
+
+//SAP side of the IDoc control record
+type Partner struct {
+	MANDT  string `json:"MANDT"`  //SAP client
+	RCVPRN string `json:"RCVPRN"` //Logical system of SAP
+}
+
+type Message struct {
+	ID          string `json:"ID"`               //TxID-sequence
+	Event       string `json:"Event"`            //Chaincode event name
+	MessageType string `json:"MessageType"`      //DESADV, STPPOD
+	Format      string `json:"Format"`           //idoc, json
+	FileName    string `json:"FileName"`         //File name in the target directory
+	Body        string `json:"Body"`             //IDoc flat file or JSON
+	Attempts    int    `json:"Attempts"`         //Failed deliveries
+	NextAttempt string `json:"NextAttempt"`      //RFC3339, "" for now
+	LastError   string `json:"LastError"`        //Error of the last delivery
+	Target      string `json:"Target,omitempty"` //Receiver of the message, webhook subscription ID
+}
+
+func (m Message) ContentType() string {
+	if m.Format == FORMAT_JSON {
+		return "application/json"
+	}
+	return "text/plain"
+}
+
+//ASN on DELVRY segments, same offsets as the inbound delivery mapping of idoc
+var asnMapping = idoc.DocMapping{ItemSegment: "E1EDL24", Fields: []idoc.FieldMap{
+	{Segment: "E1EDL20", Offset: 149, Length: 35, Field: "CarrierTrackID"},
+	{Segment: "E1EDL20", Offset: 184, Length: 4, Field: "TransporatationMode"},
+	{Segment: "E1EDL20", Offset: 218, Length: 35, Field: "ASNNumber"},
+	{Segment: "E1ADRM1", Qualifier: "LF", Offset: 3, Length: 17, Field: "VendorNO"},
+	{Segment: "E1ADRM1", Qualifier: "SP", Offset: 3, Length: 17, Field: "CarrierID"},
+	{Segment: "E1EDT13", Qualifier: "015", Offset: 27, Length: 8, Field: "ASNDate"},
+	{Segment: "E1EDT13", Qualifier: "007", Offset: 41, Length: 8, Field: "PromisedDate"},
+	{Segment: "E1EDL24", Offset: 189, Length: 15, Field: "ShippedQty"},
+	{Segment: "E1EDL41", Qualifier: "001", Offset: 3, Length: 35, Field: "PONumber"},
+	{Segment: "E1EDL41", Qualifier: "001", Offset: 50, Length: 6, Field: "POItem"},
+}}
+
+//Proof of delivery: Lenovo DN, part and quantity received by the ODM
+var podMapping = idoc.DocMapping{ItemSegment: "E1EDL24", Fields: []idoc.FieldMap{
+	{Segment: "E1EDL20", Offset: 0, Length: 10, Field: "LenDNNO"},
+	{Segment: "E1EDL24", Offset: 6, Length: 18, Field: "PARTNUM"},
+	{Segment: "E1EDL24", Offset: 189, Length: 15, Field: "GRQTY"},
+	{Segment: "E1EDL43", Qualifier: "V", Offset: 1, Length: 35, Field: "CPONO"},
+}}
+
+//按json名取string字段
+func values(v interface{}) map[string]string {
+	result := map[string]string{}
+	obj := reflect.ValueOf(v)
+	for i := 0; i < obj.NumField(); i++ {
+		name := strings.Split(obj.Type().Field(i).Tag.Get("json"), ",")[0]
+		if obj.Field(i).Kind() == reflect.String && obj.Type().Field(i).PkgPath == "" {
+			result[name] = obj.Field(i).String()
+		}
+	}
+	return result
+}
+
+//16 digit IDoc number of a message
+func docnum(id string) string {
+	h := fnv.New64a()
+	h.Write([]byte(id))
+	return fmt.Sprintf("%016d", h.Sum64()%10000000000000000)
+}
+
+func newMessage(event string, messageType string, format string, id string) Message {
+	ext := ".txt"
+	if format == FORMAT_JSON {
+		ext = ".json"
+	}
+	return Message{ID: id, Event: event, MessageType: messageType, Format: format, FileName: messageType + "_" + id + ext}
+}
+
+func render(m *Message, partner Partner, posting model.PostingEvent, docMapping idoc.DocMapping, idocType string, record interface{}) error {
+	if m.Format == FORMAT_JSON {
+		b, err := json.MarshalIndent(map[string]interface{}{
+			"MessageType": m.MessageType,
+			"TxID":        posting.TxID,
+			"Time":        posting.Time,
+			"VendorNO":    posting.VendorNO,
+			"Document":    record,
+		}, "", "  ")
+		if err != nil {
+			return err
+		}
+		m.Body = string(b)
+		return nil
+	}
+	control := idoc.Control{MANDT: partner.MANDT, DOCNUM: docnum(m.ID), DIRECT: "2", IDOCTYP: idocType, MESTYP: m.MessageType,
+		SNDPRN: posting.VendorNO, RCVPRN: partner.RCVPRN}
+	header := values(record)
+	m.Body = idoc.Build(control, docMapping, header, []map[string]string{header}).String()
+	return nil
+}
+
+//Chaincode event -> messages, one per ASN or ODM GR. Other events give none.
+func Translate(eventName string, payload []byte, format string, partner Partner) (error, []Message) {
+	if eventName != POSTING_EVENT {
+		return nil, []Message{}
+	}
+	if format != FORMAT_IDOC && format != FORMAT_JSON {
+		return fmt.Errorf("unknown format %s", format), nil
+	}
+	posting := model.PostingEvent{}
+	err := json.Unmarshal(payload, &posting)
+	if err != nil {
+		return fmt.Errorf("%s payload: %s", eventName, err.Error()), nil
+	}
+	if posting.TxID == "" {
+		return fmt.Errorf("%s payload without TxID", eventName), nil
+	}
+	messages := []Message{}
+	for _, order := range posting.SupplierOrders {
+		m := newMessage(eventName, "DESADV", format, fmt.Sprintf("%s-%d", posting.TxID, len(messages)+1))
+		order.SalesOrder, order.PurchaseOrder = model.SalesOrder{}, model.PurchaseOrder{}
+		err = render(&m, partner, posting, asnMapping, "DELVRY03", order)
+		if err != nil {
+			return err, nil
+		}
+		messages = append(messages, m)
+	}
+	for _, gr := range posting.ODMGRInfos {
+		m := newMessage(eventName, "STPPOD", format, fmt.Sprintf("%s-%d", posting.TxID, len(messages)+1))
+		err = render(&m, partner, posting, podMapping, "DELVRY03", gr)
+		if err != nil {
+			return err, nil
+		}
+		messages = append(messages, m)
+	}
+	return nil, messages
+}
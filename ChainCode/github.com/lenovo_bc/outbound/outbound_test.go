@@ -0,0 +1,103 @@
+package outbound
+
+import (
+	"encoding/json"
+	"github.com/lenovo_bc/idoc"
+	"github.com/lenovo_bc/model"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func posting() []byte {
+	b, _ := json.Marshal(model.PostingEvent{TxID: "tx1", VendorNO: "1209",
+		SupplierOrders: []model.SupplierOrder{{ASNNumber: "ASN1", VendorNO: "1209", PONumber: "4500", POItem: "10", ShippedQty: "5", ASNDate: "20180108"}}})
+	return b
+}
+
+func TestTranslate(t *testing.T) {
+	err, messages := Translate(POSTING_EVENT, posting(), FORMAT_IDOC, Partner{MANDT: "800", RCVPRN: "SAPCLNT800"})
+	if err != nil || len(messages) != 1 || messages[0].ID != "tx1-1" || messages[0].FileName != "DESADV_tx1-1.txt" {
+		t.Fatalf("unexpected messages %v %+v", err, messages)
+	}
+	err, idocs := idoc.Parse(messages[0].Body)
+	if err != nil || idocs[0].Control.MESTYP != "DESADV" || idocs[0].Control.RCVPRN != "SAPCLNT800" || idocs[0].Control.SNDPRN != "1209" {
+		t.Fatalf("unexpected IDoc %v %+v", err, idocs)
+	}
+	err, doc := idoc.DefaultMapping().Convert(idocs[0])
+	if err != nil || doc.PurchaseOrders[0].PONO != "4500" || doc.PurchaseOrders[0].InboundDelivery[0].ASNNO != "ASN1" || doc.PurchaseOrders[0].InboundDelivery[0].DlvyQty != "5" {
+		t.Fatalf("unexpected inbound delivery %v %+v", err, doc)
+	}
+
+	b, _ := json.Marshal(model.PostingEvent{TxID: "tx2", ODMGRInfos: []model.ODMInfoReq{{CPONO: "C1", LenDNNO: "800001", PARTNUM: "20HD", GRQTY: "5"}}})
+	err, messages = Translate(POSTING_EVENT, b, FORMAT_JSON, Partner{})
+	if err != nil || len(messages) != 1 || messages[0].MessageType != "STPPOD" || !strings.Contains(messages[0].Body, `"LenDNNO": "800001"`) {
+		t.Fatalf("unexpected messages %v %+v", err, messages)
+	}
+	err, messages = Translate("PURGE", []byte("{}"), FORMAT_JSON, Partner{})
+	if err != nil || len(messages) != 0 {
+		t.Fatal("PURGE event translated")
+	}
+}
+
+func TestOutbox(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "outbox")
+	defer os.RemoveAll(dir)
+	received := filepath.Join(dir, "received")
+	os.MkdirAll(received, 0755)
+	stub := &Stub{Dir: received, Fail: 3}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	now := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	err, outbox := NewOutbox(filepath.Join(dir, "outbox"), HTTPSink{URL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	outbox.MaxAttempts, outbox.Backoff, outbox.now = 2, time.Minute, func() time.Time { return now }
+	_, messages := Translate(POSTING_EVENT, posting(), FORMAT_JSON, Partner{})
+	_, queued := outbox.Enqueue(messages[0])
+	_, again := outbox.Enqueue(messages[0])
+	if !queued || again {
+		t.Fatal("duplicate message queued")
+	}
+
+	_, result := outbox.Flush()
+	if result.Retried != 1 {
+		t.Fatalf("expected retry, got %+v", result)
+	}
+	_, result = outbox.Flush()
+	if result.Waiting != 1 {
+		t.Fatalf("expected backoff, got %+v", result)
+	}
+	now = now.Add(time.Minute)
+	_, result = outbox.Flush()
+	_, dead := outbox.List(STATE_DEAD)
+	if result.Dead != 1 || len(dead) != 1 || dead[0].Attempts != 2 || !strings.Contains(dead[0].LastError, "503") {
+		t.Fatalf("expected dead letter, got %+v %+v", result, dead)
+	}
+
+	err, count := outbox.Replay(nil)
+	if err != nil || count != 1 {
+		t.Fatalf("unexpected replay %v %d", err, count)
+	}
+	outbox.Flush()
+	now = now.Add(time.Minute)
+	_, result = outbox.Flush()
+	_, sent := outbox.List(STATE_SENT)
+	if len(sent) != 1 {
+		t.Fatalf("expected sent message, got %+v", result)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(received, "tx1-1"))
+	if err != nil || !strings.Contains(string(b), `"ASNNumber": "ASN1"`) {
+		t.Fatalf("unexpected delivery %v %s", err, b)
+	}
+	err, _ = outbox.Replay([]string{"unknown"})
+	if err == nil {
+		t.Fatal("replay of unknown message succeeded")
+	}
+}
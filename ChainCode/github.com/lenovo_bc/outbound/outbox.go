@@ -0,0 +1,284 @@
+package outbound
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Outbox states, one directory each
+const (
+	STATE_PENDING = "pending"
+	STATE_SENT    = "sent"
+	STATE_DEAD    = "dead"
+)
+
+//Delivers one message to SAP
+type Sink interface {
+	Deliver(m Message) error
+}
+
+//Writes the message body to Dir, for a SAP file port
+type DirSink struct {
+	Dir string
+}
+
+func (s DirSink) Deliver(m Message) error {
+	err := os.MkdirAll(s.Dir, 0755)
+	if err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(s.Dir, m.FileName), []byte(m.Body))
+}
+
+//POSTs the message body to URL, any status but 2xx fails
+type HTTPSink struct {
+	URL    string
+	Client *http.Client
+}
+
+func (s HTTPSink) Deliver(m Message) error {
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	req, err := http.NewRequest("POST", s.URL, bytes.NewBufferString(m.Body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", m.ContentType())
+	req.Header.Set("X-Message-ID", m.ID)
+	req.Header.Set("X-Message-Type", m.MessageType)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %s %s", s.URL, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+//先写临时文件再rename, 读取方不会看到半个文件
+func writeFile(path string, b []byte) error {
+	tmp := path + ".tmp"
+	err := ioutil.WriteFile(tmp, b, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+//Messages under Dir/pending, Dir/sent and Dir/dead. A failed delivery is
+//retried after Backoff, doubled per attempt; after MaxAttempts failures the
+//message moves to dead until it is replayed.
+type Outbox struct {
+	Dir         string
+	Sink        Sink
+	MaxAttempts int
+	Backoff     time.Duration
+	now         func() time.Time
+}
+
+func NewOutbox(dir string, sink Sink) (error, *Outbox) {
+	for _, state := range []string{STATE_PENDING, STATE_SENT, STATE_DEAD} {
+		err := os.MkdirAll(filepath.Join(dir, state), 0755)
+		if err != nil {
+			return err, nil
+		}
+	}
+	return nil, &Outbox{Dir: dir, Sink: sink, MaxAttempts: 5, Backoff: 30 * time.Second, now: time.Now}
+}
+
+func (o *Outbox) path(state string, id string) string {
+	return filepath.Join(o.Dir, state, id+".json")
+}
+
+func (o *Outbox) save(state string, m Message) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(o.path(state, m.ID), b)
+}
+
+//Move a message, the file is written to the new state before the old one is removed
+func (o *Outbox) move(from string, to string, m Message) error {
+	err := o.save(to, m)
+	if err != nil {
+		return err
+	}
+	return os.Remove(o.path(from, m.ID))
+}
+
+//Queue m, false if a message with the same ID is already known
+func (o *Outbox) Enqueue(m Message) (error, bool) {
+	for _, state := range []string{STATE_PENDING, STATE_SENT, STATE_DEAD} {
+		if _, err := os.Stat(o.path(state, m.ID)); err == nil {
+			return nil, false
+		}
+	}
+	m.Attempts, m.NextAttempt, m.LastError = 0, "", ""
+	return o.save(STATE_PENDING, m), true
+}
+
+//Messages in state, ordered by ID
+func (o *Outbox) List(state string) (error, []Message) {
+	files, err := filepath.Glob(filepath.Join(o.Dir, state, "*.json"))
+	if err != nil {
+		return err, nil
+	}
+	sort.Strings(files)
+	messages := []Message{}
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err, nil
+		}
+		m := Message{}
+		err = json.Unmarshal(b, &m)
+		if err != nil {
+			return fmt.Errorf("%s: %s", file, err.Error()), nil
+		}
+		messages = append(messages, m)
+	}
+	return nil, messages
+}
+
+type FlushResult struct {
+	Sent    int `json:"Sent"`
+	Retried int `json:"Retried"` //Failed, left in pending
+	Dead    int `json:"Dead"`    //Failed MaxAttempts times
+	Waiting int `json:"Waiting"` //Not due yet
+}
+
+//Deliver the pending messages that are due
+func (o *Outbox) Flush() (error, FlushResult) {
+	result := FlushResult{}
+	err, messages := o.List(STATE_PENDING)
+	if err != nil {
+		return err, result
+	}
+	now := o.now()
+	for _, m := range messages {
+		if m.NextAttempt != "" {
+			next, err := time.Parse(time.RFC3339, m.NextAttempt)
+			if err == nil && now.Before(next) {
+				result.Waiting++
+				continue
+			}
+		}
+		deliveryErr := o.Sink.Deliver(m)
+		if deliveryErr == nil {
+			m.LastError, m.NextAttempt = "", ""
+			err = o.move(STATE_PENDING, STATE_SENT, m)
+			result.Sent++
+		} else {
+			m.Attempts++
+			m.LastError = deliveryErr.Error()
+			if m.Attempts >= o.MaxAttempts {
+				m.NextAttempt = ""
+				err = o.move(STATE_PENDING, STATE_DEAD, m)
+				result.Dead++
+			} else {
+				m.NextAttempt = now.Add(o.Backoff << uint(m.Attempts-1)).UTC().Format(time.RFC3339)
+				err = o.save(STATE_PENDING, m)
+				result.Retried++
+			}
+		}
+		if err != nil {
+			return err, result
+		}
+	}
+	return nil, result
+}
+
+//Queue dead messages again, all of them if ids is empty. IDs of sent
+//messages are resent as well.
+func (o *Outbox) Replay(ids []string) (error, int) {
+	count := 0
+	if len(ids) == 0 {
+		err, dead := o.List(STATE_DEAD)
+		if err != nil {
+			return err, count
+		}
+		for _, m := range dead {
+			ids = append(ids, m.ID)
+		}
+	}
+	for _, id := range ids {
+		found := false
+		for _, state := range []string{STATE_DEAD, STATE_SENT} {
+			b, err := ioutil.ReadFile(o.path(state, id))
+			if err != nil {
+				continue
+			}
+			m := Message{}
+			err = json.Unmarshal(b, &m)
+			if err != nil {
+				return fmt.Errorf("%s: %s", id, err.Error()), count
+			}
+			m.Attempts, m.NextAttempt, m.LastError = 0, "", ""
+			err = o.move(state, STATE_PENDING, m)
+			if err != nil {
+				return err, count
+			}
+			found = true
+			count++
+			break
+		}
+		if !found {
+			return fmt.Errorf("message %s is neither dead nor sent", id), count
+		}
+	}
+	return nil, count
+}
+
+//HTTP endpoint standing in for SAP: stores every body under Dir. The first
+//Fail requests are answered with 503 to exercise retries.
+type Stub struct {
+	Dir  string
+	Fail int
+	mu   sync.Mutex
+	seen int
+}
+
+func (s *Stub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.seen++
+	fail := s.seen <= s.Fail
+	s.mu.Unlock()
+	if r.Method != "POST" {
+		http.Error(w, "POST only", http.StatusMethodNotAllowed)
+		return
+	}
+	if fail {
+		http.Error(w, "stub failure", http.StatusServiceUnavailable)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	id := filepath.Base(r.Header.Get("X-Message-ID"))
+	if id == "" || id == "." {
+		id = fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	err = writeFile(filepath.Join(s.Dir, id), body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,152 @@
+package schema
+
+//Chaincode function argument. Fabric passes every argument as a string,
+//JSON arguments use JSONString.
+type Arg struct {
+	Name     string
+	Schema   *Schema
+	Optional bool //Trailing arguments only
+}
+
+//Record variant of a write function selected by TRANSDOC
+type Variant struct {
+	TRANSDOC    string   `json:"TRANSDOC"`
+	Description string   `json:"description"`
+	Fields      []string `json:"fields,omitempty"` //Fields taken from the request, besides the keys
+}
+
+type Function struct {
+	Name      string
+	Summary   string
+	Query     bool //Read only, called with a query instead of a transaction
+	Args      []Arg
+	TRANSDOC  []Variant
+	Response  *Schema  //shim.Success payload
+	MediaType string   //Of the response, application/json if empty
+	Roles     []string //Roles allowed to call it, any role if empty
+}
+
+//HTTP call sent to subscribers, listed under webhooks
+type Webhook struct {
+	Name    string
+	Summary string
+	Headers []Arg
+	Body    *Schema
+}
+
+//Chaincode API: functions, error payload and outgoing webhooks
+type API struct {
+	Title       string
+	Version     string
+	Description string
+	Functions   []Function
+	Error       *Schema //shim.Error message
+	Webhooks    []Webhook
+}
+
+//Schema of the argument list: an array of strings, one item per argument
+func Arguments(args []Arg) *Schema {
+	min, max := 0, len(args)
+	s := &Schema{Type: "array", PrefixItems: []*Schema{}, MinItems: &min, MaxItems: &max}
+	for _, arg := range args {
+		item := *arg.Schema
+		if item.Description == "" {
+			item.Description = arg.Name
+		} else {
+			item.Description = arg.Name + ": " + item.Description
+		}
+		s.PrefixItems = append(s.PrefixItems, &item)
+		if !arg.Optional {
+			min++
+		}
+	}
+	return s
+}
+
+func content(mediaType string, schema *Schema) map[string]interface{} {
+	if mediaType == "" {
+		mediaType = "application/json"
+	}
+	return map[string]interface{}{mediaType: map[string]interface{}{"schema": schema}}
+}
+
+func (api API) operation(f Function) map[string]interface{} {
+	tag := "invoke"
+	if f.Query {
+		tag = "query"
+	}
+	response := f.Response
+	if response == nil {
+		response = &Schema{}
+	}
+	op := map[string]interface{}{
+		"operationId":       f.Name,
+		"summary":           f.Summary,
+		"tags":              []string{tag},
+		"x-fabric-function": f.Name,
+		"requestBody": map[string]interface{}{
+			"description": "Chaincode arguments after the function name",
+			"required":    true,
+			"content":     content("", Arguments(f.Args)),
+		},
+		"responses": map[string]interface{}{
+			"200": map[string]interface{}{"description": "shim.Success payload", "content": content(f.MediaType, response)},
+			"500": map[string]interface{}{"description": "shim.Error, the message is JSON", "content": content("", api.Error)},
+		},
+	}
+	if len(f.TRANSDOC) > 0 {
+		op["x-transdoc"] = f.TRANSDOC
+	}
+	if len(f.Roles) > 0 {
+		op["x-roles"] = f.Roles
+	}
+	return op
+}
+
+//OpenAPI 3.1 document. Fabric has no HTTP paths, each function is described
+//as POST /<function> taking the argument list; the API server and the peer
+//CLI ({"Args":[function, args...]}) map it to a chaincode call.
+func (api API) OpenAPI(g *Generator) map[string]interface{} {
+	paths := map[string]interface{}{}
+	for _, f := range api.Functions {
+		paths["/"+f.Name] = map[string]interface{}{"post": api.operation(f)}
+	}
+	doc := map[string]interface{}{
+		"openapi": "3.1.0",
+		"info": map[string]interface{}{
+			"title":       api.Title,
+			"version":     api.Version,
+			"description": api.Description,
+		},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": g.Definitions},
+	}
+	if len(api.Webhooks) > 0 {
+		webhooks := map[string]interface{}{}
+		for _, w := range api.Webhooks {
+			parameters := []interface{}{}
+			for _, header := range w.Headers {
+				parameters = append(parameters, map[string]interface{}{
+					"name": header.Name, "in": "header", "required": !header.Optional, "schema": header.Schema})
+			}
+			webhooks[w.Name] = map[string]interface{}{"post": map[string]interface{}{
+				"summary":     w.Summary,
+				"parameters":  parameters,
+				"requestBody": map[string]interface{}{"required": true, "content": content("", w.Body)},
+				"responses":   map[string]interface{}{"2XX": map[string]interface{}{"description": "Delivered, other statuses are retried"}},
+			}}
+		}
+		doc["webhooks"] = webhooks
+	}
+	return doc
+}
+
+//JSON Schema document with the definitions of g, g.RefPrefix should be "#/$defs/"
+func (g *Generator) Document(id string, title string) map[string]interface{} {
+	return map[string]interface{}{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"$id":     id,
+		"title":   title,
+		"$defs":   g.Definitions,
+	}
+}
@@ -0,0 +1,235 @@
+// Package schema generates JSON Schema (2020-12) and OpenAPI 3.1 documents
+// from the Go types of the chaincode, so clients get the payloads from the
+// struct tags instead of reading them. Property names are the json names;
+// where they differ from the Go field (UPDATE is sent as UPDATEDAY,
+// Attachment as Attachments) the Go name is kept in x-go-name.
+//
+// Descriptions come from the field comments of the Go source, see Comments.
+package schema
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+//JSON Schema subset used by the generator
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	PrefixItems          []*Schema          `json:"prefixItems,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	ContentMediaType     string             `json:"contentMediaType,omitempty"` //String argument holding a document
+	ContentSchema        *Schema            `json:"contentSchema,omitempty"`    //Schema of the JSON in the string
+	GoName               string             `json:"x-go-name,omitempty"`        //Go field name if it differs
+}
+
+func String(description string) *Schema {
+	return &Schema{Type: "string", Description: description}
+}
+
+func Enum(description string, values ...string) *Schema {
+	return &Schema{Type: "string", Description: description, Enum: values}
+}
+
+func ArrayOf(items *Schema) *Schema {
+	return &Schema{Type: "array", Items: items}
+}
+
+func OneOf(description string, schemas ...*Schema) *Schema {
+	return &Schema{Description: description, OneOf: schemas}
+}
+
+//String argument carrying the JSON document described by content
+func JSONString(description string, content *Schema) *Schema {
+	return &Schema{Type: "string", Description: description, ContentMediaType: "application/json", ContentSchema: content}
+}
+
+//Object with the given properties, all of them required
+func Object(description string, properties map[string]*Schema) *Schema {
+	s := &Schema{Type: "object", Description: description, Properties: properties}
+	for name := range properties {
+		s.Required = append(s.Required, name)
+	}
+	sort.Strings(s.Required)
+	return s
+}
+
+func (s *Schema) WithDescription(description string) *Schema {
+	c := *s
+	c.Description = description
+	return &c
+}
+
+//Definition name of a type: plain for the chaincode and model types, package
+//qualified (idoc.Mapping) for the others
+func typeName(pkg string, name string) string {
+	if pkg == "chaincode" || pkg == "model" || pkg == "" {
+		return name
+	}
+	return pkg + "." + name
+}
+
+var rawMessageType = reflect.TypeOf(json.RawMessage{})
+
+//Generates schemas of Go types, struct types become definitions referenced
+//by RefPrefix + name.
+type Generator struct {
+	RefPrefix   string
+	Comments    map[string]string //"Type" and "Type.Field" -> description
+	Definitions map[string]*Schema
+}
+
+func NewGenerator(refPrefix string, comments map[string]string) *Generator {
+	if comments == nil {
+		comments = map[string]string{}
+	}
+	return &Generator{RefPrefix: refPrefix, Comments: comments, Definitions: map[string]*Schema{}}
+}
+
+//Schema of t, registering the struct types it uses
+func (g *Generator) Schema(t reflect.Type) *Schema {
+	if t == rawMessageType {
+		return &Schema{}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.Schema(t.Elem())
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Description: "base64"}
+		}
+		return ArrayOf(g.Schema(t.Elem()))
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.Schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t, "")
+		}
+		name := typeName(path.Base(t.PkgPath()), t.Name())
+		if _, ok := g.Definitions[name]; !ok {
+			//placeholder first, types may refer to themselves
+			g.Definitions[name] = &Schema{}
+			*g.Definitions[name] = *g.object(t, name)
+		}
+		return &Schema{Ref: g.RefPrefix + name}
+	}
+	//interface{}: any JSON value
+	return &Schema{}
+}
+
+//Properties of a struct, encoding/json naming, embedded structs are flattened
+func (g *Generator) object(t reflect.Type, name string) *Schema {
+	s := &Schema{Type: "object", Description: g.Comments[name], Properties: map[string]*Schema{}}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := strings.Split(field.Tag.Get("json"), ",")
+		if (field.PkgPath != "" && !field.Anonymous) || tag[0] == "-" {
+			continue
+		}
+		if field.Anonymous && tag[0] == "" && field.Type.Kind() == reflect.Struct {
+			embedded := g.object(field.Type, typeName(path.Base(field.Type.PkgPath()), field.Type.Name()))
+			for property, p := range embedded.Properties {
+				if _, ok := s.Properties[property]; !ok {
+					s.Properties[property] = p
+				}
+			}
+			continue
+		}
+		property := tag[0]
+		if property == "" {
+			property = field.Name
+		}
+		p := g.Schema(field.Type)
+		if p.Ref != "" {
+			//siblings of $ref are allowed since 2019-09, keep the field comment
+			p = &Schema{Ref: p.Ref}
+		}
+		p.Description = g.Comments[name+"."+field.Name]
+		if property != field.Name {
+			p.GoName = field.Name
+		}
+		s.Properties[property] = p
+	}
+	return s
+}
+
+//Descriptions of the types and fields declared in dirs, from the doc or
+//trailing comments: "Type" and "Type.Field" -> comment
+func Comments(dirs ...string) (error, map[string]string) {
+	comments := map[string]string{}
+	for _, dir := range dirs {
+		pkgs, err := parser.ParseDir(token.NewFileSet(), dir, nil, parser.ParseComments)
+		if err != nil {
+			return err, nil
+		}
+		for pkgName, pkg := range pkgs {
+			if strings.HasSuffix(pkgName, "_test") {
+				continue
+			}
+			for _, file := range pkg.Files {
+				for _, decl := range file.Decls {
+					gen, ok := decl.(*ast.GenDecl)
+					if !ok || gen.Tok != token.TYPE {
+						continue
+					}
+					for _, spec := range gen.Specs {
+						typeSpec := spec.(*ast.TypeSpec)
+						name := typeName(pkgName, typeSpec.Name.Name)
+						if doc := text(typeSpec.Doc, gen.Doc); doc != "" {
+							comments[name] = doc
+						}
+						structType, ok := typeSpec.Type.(*ast.StructType)
+						if !ok {
+							continue
+						}
+						for _, field := range structType.Fields.List {
+							doc := text(field.Comment, field.Doc)
+							for _, fieldName := range field.Names {
+								if doc != "" {
+									comments[name+"."+fieldName.Name] = doc
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	return nil, comments
+}
+
+//First non-empty comment, on one line
+func text(groups ...*ast.CommentGroup) string {
+	for _, group := range groups {
+		if group == nil {
+			continue
+		}
+		if s := strings.Join(strings.Fields(group.Text()), " "); s != "" {
+			return s
+		}
+	}
+	return ""
+}
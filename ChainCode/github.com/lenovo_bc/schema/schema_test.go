@@ -0,0 +1,76 @@
+package schema
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type line struct {
+	No string `json:"NO"` //Line no
+}
+
+type base struct {
+	ID string `json:"ID"`
+}
+
+type order struct {
+	base
+	UPDATE   string          `json:"UPDATEDAY"` //Changed On
+	Lines    []line          `json:"Lines"`
+	Parent   *order          `json:"Parent,omitempty"`
+	Extra    map[string]int  `json:"Extra"`
+	Raw      json.RawMessage `json:"Raw"`
+	Any      interface{}     `json:"Any"`
+	Skipped  string          `json:"-"`
+	internal string
+	Flags    map[string]bool
+}
+
+func TestGenerator(t *testing.T) {
+	err, comments := Comments(".")
+	if err != nil || comments["schema.line.No"] != "Line no" || comments["schema.Schema.ContentSchema"] != "Schema of the JSON in the string" {
+		t.Fatalf("unexpected comments %v %v", err, comments)
+	}
+	g := NewGenerator("#/$defs/", comments)
+	ref := g.Schema(reflect.TypeOf([]order{}))
+	if ref.Type != "array" || ref.Items.Ref != "#/$defs/schema.order" {
+		t.Fatalf("unexpected schema %+v", ref)
+	}
+	o := g.Definitions["schema.order"]
+	if len(o.Properties) != 8 || o.Properties["ID"] == nil || o.Properties["Skipped"] != nil || o.Properties["internal"] != nil {
+		t.Fatalf("unexpected properties %+v", o.Properties)
+	}
+	if p := o.Properties["UPDATEDAY"]; p.Type != "string" || p.GoName != "UPDATE" || p.Description != "Changed On" {
+		t.Fatalf("unexpected renamed field %+v", p)
+	}
+	if o.Properties["Parent"].Ref != "#/$defs/schema.order" || o.Properties["Lines"].Items.Ref != "#/$defs/schema.line" ||
+		o.Properties["Extra"].AdditionalProperties.Type != "integer" || o.Properties["Raw"].Type != "" || o.Properties["Flags"].GoName != "" {
+		t.Fatalf("unexpected properties %+v", o.Properties)
+	}
+	b, _ := json.Marshal(g.Document("test.json", "test"))
+	if !strings.Contains(string(b), `"$defs":{"schema.line":`) {
+		t.Fatalf("unexpected document %s", b)
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	g := NewGenerator("#/components/schemas/", nil)
+	api := API{Title: "test", Version: "1", Error: String("error"), Functions: []Function{
+		{Name: "crLine", Args: []Arg{{Name: "json", Schema: JSONString("", g.Schema(reflect.TypeOf([]line{})))},
+			{Name: "vendorNo", Schema: String(""), Optional: true}},
+			TRANSDOC: []Variant{{TRANSDOC: "L", Description: "line"}}, Roles: []string{"lenovo"}},
+	}}
+	b, _ := json.Marshal(api.OpenAPI(g))
+	doc := map[string]interface{}{}
+	json.Unmarshal(b, &doc)
+	op := doc["paths"].(map[string]interface{})["/crLine"].(map[string]interface{})["post"].(map[string]interface{})
+	args := op["requestBody"].(map[string]interface{})["content"].(map[string]interface{})["application/json"].(map[string]interface{})["schema"].(map[string]interface{})
+	if args["minItems"] != 1.0 || args["maxItems"] != 2.0 || op["x-transdoc"] == nil || op["x-roles"] == nil {
+		t.Fatalf("unexpected operation %s", b)
+	}
+	if doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})["schema.line"] == nil {
+		t.Fatalf("definitions missing %s", b)
+	}
+}
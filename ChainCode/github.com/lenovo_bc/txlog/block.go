@@ -0,0 +1,192 @@
+package txlog
+
+import (
+	"errors"
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/rwsetutil"
+	"github.com/hyperledger/fabric/core/ledger/util"
+	"github.com/hyperledger/fabric/protos/common"
+	"github.com/hyperledger/fabric/protos/msp"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.com/hyperledger/fabric/protos/utils"
+)
+
+//Endorser transaction of a block entry, nil header for other transactions
+type transaction struct {
+	header  *common.ChannelHeader
+	creator *msp.SerializedIdentity
+	payload *pb.ChaincodeActionPayload
+	action  *pb.ChaincodeAction
+}
+
+//Envelope -> payload -> transaction -> chaincode action, as in the block
+//events of the peer
+func decodeTransaction(tdata []byte) (error, transaction) {
+	tx := transaction{}
+	if tdata == nil {
+		return errors.New("Cannot extract payload from nil transaction"), tx
+	}
+	env, err := utils.GetEnvelopeFromBlock(tdata)
+	if err != nil {
+		return fmt.Errorf("Error getting tx from block(%s)", err), tx
+	}
+	if env == nil {
+		return nil, tx
+	}
+	payload, err := utils.GetPayload(env)
+	if err != nil {
+		return fmt.Errorf("Could not extract payload from envelope, err %s", err), tx
+	}
+	chdr, err := utils.UnmarshalChannelHeader(payload.Header.ChannelHeader)
+	if err != nil {
+		return fmt.Errorf("Could not extract channel header from envelope, err %s", err), tx
+	}
+	if common.HeaderType(chdr.Type) != common.HeaderType_ENDORSER_TRANSACTION {
+		return nil, tx
+	}
+	shdr, err := utils.GetSignatureHeader(payload.Header.SignatureHeader)
+	if err != nil {
+		return fmt.Errorf("Could not extract signature header from envelope, err %s", err), tx
+	}
+	creator := &msp.SerializedIdentity{}
+	err = proto.Unmarshal(shdr.Creator, creator)
+	if err != nil {
+		return fmt.Errorf("Could not extract creator identity from envelope, err %s", err), tx
+	}
+	endorserTx, err := utils.GetTransaction(payload.Data)
+	if err != nil {
+		return fmt.Errorf("Error unmarshalling transaction payload for block event: %s", err), tx
+	}
+	//Fabric 1.0 endorser transactions have one action
+	if len(endorserTx.Actions) == 0 {
+		return errors.New("Transaction has no actions"), tx
+	}
+	chaincodeActionPayload, err := utils.GetChaincodeActionPayload(endorserTx.Actions[0].Payload)
+	if err != nil {
+		return fmt.Errorf("Error unmarshalling transaction action payload for block event: %s", err), tx
+	}
+	propRespPayload, err := utils.GetProposalResponsePayload(chaincodeActionPayload.Action.ProposalResponsePayload)
+	if err != nil {
+		return fmt.Errorf("Error unmarshalling proposal response payload for block event: %s", err), tx
+	}
+	caPayload, err := utils.GetChaincodeAction(propRespPayload.Extension)
+	if err != nil {
+		return fmt.Errorf("Error unmarshalling chaincode action for block event: %s", err), tx
+	}
+	return nil, transaction{header: chdr, creator: creator, payload: chaincodeActionPayload, action: caPayload}
+}
+
+//Chaincode event of a block entry, nil if it has none
+func ChaincodeEvent(tdata []byte) (error, *pb.ChaincodeEvent) {
+	err, tx := decodeTransaction(tdata)
+	if err != nil || tx.header == nil {
+		return err, nil
+	}
+	event, err := utils.GetChaincodeEvents(tx.action.Events)
+	if err != nil {
+		return fmt.Errorf("Error unmarshalling chaincode event: %s", err), nil
+	}
+	if event == nil || event.EventName == "" {
+		return nil, nil
+	}
+	return nil, event
+}
+
+//Invocation of a decoded transaction
+func invocation(tx transaction) (error, *pb.ChaincodeSpec) {
+	cpp, err := utils.GetChaincodeProposalPayload(tx.payload.ChaincodeProposalPayload)
+	if err != nil {
+		return fmt.Errorf("Error unmarshalling chaincode proposal payload: %s", err), nil
+	}
+	cis := &pb.ChaincodeInvocationSpec{}
+	err = proto.Unmarshal(cpp.Input, cis)
+	if err != nil {
+		return fmt.Errorf("Error unmarshalling chaincode invocation spec: %s", err), nil
+	}
+	if cis.ChaincodeSpec == nil || cis.ChaincodeSpec.ChaincodeId == nil || cis.ChaincodeSpec.Input == nil {
+		return errors.New("Chaincode invocation spec is incomplete"), nil
+	}
+	return nil, cis.ChaincodeSpec
+}
+
+//Writes of the namespace in the read-write set of the action
+func writes(tx transaction, namespace string) (error, []Write) {
+	result := []Write{}
+	rwset := &rwsetutil.TxRwSet{}
+	err := rwset.FromProtoBytes(tx.action.Results)
+	if err != nil {
+		return fmt.Errorf("Error unmarshalling read-write set: %s", err), nil
+	}
+	for _, ns := range rwset.NsRwSets {
+		if ns.NameSpace != namespace || ns.KvRwSet == nil {
+			continue
+		}
+		for _, w := range ns.KvRwSet.Writes {
+			result = append(result, NewWrite(w.Key, w.Value, w.IsDelete))
+		}
+	}
+	return nil, result
+}
+
+//Entries of the transactions invoking the chaincode, in block order.
+//Invalid transactions are kept with Valid false.
+func Decode(block *common.Block, chaincode string) (error, []Entry) {
+	entries := []Entry{}
+	if block == nil || block.Header == nil || block.Data == nil {
+		return errors.New("block is incomplete"), nil
+	}
+	var flags util.TxValidationFlags
+	if block.Metadata != nil && len(block.Metadata.Metadata) > int(common.BlockMetadataIndex_TRANSACTIONS_FILTER) {
+		flags = util.TxValidationFlags(block.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER])
+	}
+	for i, tdata := range block.Data.Data {
+		err, tx := decodeTransaction(tdata)
+		if err != nil {
+			return fmt.Errorf("block %d tx %d: %s", block.Header.Number, i, err.Error()), nil
+		}
+		if tx.header == nil {
+			continue
+		}
+		err, spec := invocation(tx)
+		if err != nil {
+			return fmt.Errorf("block %d tx %d: %s", block.Header.Number, i, err.Error()), nil
+		}
+		if spec.ChaincodeId.Name != chaincode {
+			continue
+		}
+		entry := Entry{
+			Block:     block.Header.Number,
+			TxNum:     i,
+			TxID:      tx.header.TxId,
+			Timestamp: formatTime(tx.header.Timestamp),
+			Valid:     !flags.IsInvalid(i),
+			Chaincode: chaincode,
+			Creator:   tx.creator.Mspid,
+			Args:      []string{},
+		}
+		for _, arg := range spec.Input.Args {
+			entry.Args = append(entry.Args, string(arg))
+		}
+		err, entry.Writes = writes(tx, chaincode)
+		if err != nil {
+			return fmt.Errorf("block %d tx %s: %s", block.Header.Number, entry.TxID, err.Error()), nil
+		}
+		event, err := utils.GetChaincodeEvents(tx.action.Events)
+		if err == nil && event != nil && event.EventName != "" {
+			entry.Event = NewEvent(event.EventName, event.Payload)
+		}
+		entries = append(entries, entry)
+	}
+	return nil, entries
+}
+
+//Block of a file written by peer channel fetch
+func UnmarshalBlock(b []byte) (error, *common.Block) {
+	block := &common.Block{}
+	err := proto.Unmarshal(b, block)
+	if err != nil {
+		return fmt.Errorf("Error unmarshalling block: %s", err), nil
+	}
+	return nil, block
+}
@@ -0,0 +1,215 @@
+// Package txlog records the lenovo_bc transactions of the blocks as a replay
+// log, so a production issue can be reproduced against the current chaincode.
+//
+// Each entry holds the invocation (function and arguments), the transaction
+// ID and time, and what the peer committed for it: the writes of the
+// chaincode namespace and the chaincode event. Decode extracts the entries of
+// a block, Append and Read write and read the log, one JSON object per line.
+//
+//	eventlistener extract -txlog replay.log block-*.pb
+//	cctool replay -state snapshot.json replay.log
+package txlog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+//Longest log line read, a transaction may carry a large batch
+const MAX_ENTRY_SIZE = 64 * 1024 * 1024
+
+//Transaction of the log
+type Entry struct {
+	Block     uint64   `json:"Block"`           //Block number
+	TxNum     int      `json:"TxNum"`           //Index in the block
+	TxID      string   `json:"TxID"`            //Transaction ID
+	Timestamp string   `json:"Timestamp"`       //Transaction time, RFC3339Nano
+	Valid     bool     `json:"Valid"`           //false if the committer rejected it, nothing was written
+	Chaincode string   `json:"Chaincode"`       //Chaincode name
+	Creator   string   `json:"Creator"`         //MSP ID of the creator
+	Args      []string `json:"Args"`            //Function and arguments
+	Writes    []Write  `json:"Writes"`          //Writes of the chaincode namespace, in rwset order
+	Event     *Event   `json:"Event,omitempty"` //Chaincode event
+}
+
+//Key written by a transaction
+type Write struct {
+	Key      string          `json:"Key"`                //Composite key, separators as \u0000
+	Value    json.RawMessage `json:"Value,omitempty"`    //JSON values
+	Bytes    []byte          `json:"Bytes,omitempty"`    //Other values
+	IsDelete bool            `json:"IsDelete,omitempty"` //DelState
+}
+
+type Event struct {
+	Name    string          `json:"Name"`
+	Payload json.RawMessage `json:"Payload,omitempty"` //JSON payloads
+	Bytes   []byte          `json:"Bytes,omitempty"`   //Other payloads
+}
+
+//Value as JSON if encoding/json writes it back unchanged, as bytes otherwise
+func encode(value []byte) (json.RawMessage, []byte) {
+	if b, err := json.Marshal(json.RawMessage(value)); err == nil && bytes.Equal(b, value) {
+		return value, nil
+	}
+	return nil, value
+}
+
+func NewWrite(key string, value []byte, isDelete bool) Write {
+	w := Write{Key: key, IsDelete: isDelete}
+	if !isDelete {
+		w.Value, w.Bytes = encode(value)
+	}
+	return w
+}
+
+//Written value, nil for a delete
+func (w Write) Data() []byte {
+	if w.IsDelete {
+		return nil
+	}
+	if w.Bytes != nil {
+		return w.Bytes
+	}
+	if w.Value == nil {
+		return []byte{}
+	}
+	return w.Value
+}
+
+func NewEvent(name string, payload []byte) *Event {
+	e := &Event{Name: name}
+	e.Payload, e.Bytes = encode(payload)
+	return e
+}
+
+func (e *Event) Data() []byte {
+	if e.Bytes != nil {
+		return e.Bytes
+	}
+	return e.Payload
+}
+
+//Transaction time to hand to the chaincode
+func (e Entry) Time() (error, *timestamp.Timestamp) {
+	t, err := time.Parse(time.RFC3339Nano, e.Timestamp)
+	if err != nil {
+		return fmt.Errorf("tx %s: invalid timestamp %q", e.TxID, e.Timestamp), nil
+	}
+	return nil, &timestamp.Timestamp{Seconds: t.Unix(), Nanos: int32(t.Nanosecond())}
+}
+
+func formatTime(ts *timestamp.Timestamp) string {
+	if ts == nil {
+		return ""
+	}
+	return time.Unix(ts.Seconds, int64(ts.Nanos)).UTC().Format(time.RFC3339Nano)
+}
+
+//Arguments as the chaincode receives them
+func (e Entry) ArgsBytes() [][]byte {
+	args := [][]byte{}
+	for _, arg := range e.Args {
+		args = append(args, []byte(arg))
+	}
+	return args
+}
+
+//Writes the entries at the end of the log, created if missing
+func Append(path string, entries []Entry) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for _, e := range entries {
+		b, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(append(b, '\n'))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Entries of the log in log order
+func Read(path string) (error, []Entry) {
+	f, err := os.Open(path)
+	if err != nil {
+		return err, nil
+	}
+	defer f.Close()
+	entries := []Entry{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, MAX_ENTRY_SIZE)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		e := Entry{}
+		err = json.Unmarshal(scanner.Bytes(), &e)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %s", path, line, err.Error()), nil
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%s:%d: %s", path, line+1, err.Error()), nil
+	}
+	return nil, entries
+}
+
+//Applies the writes of a valid entry to the state, key -> value
+func Apply(state map[string][]byte, e Entry) {
+	if !e.Valid {
+		return
+	}
+	for _, w := range e.Writes {
+		if w.IsDelete {
+			delete(state, w.Key)
+		} else {
+			state[w.Key] = w.Data()
+		}
+	}
+}
+
+//Key whose value differs, nil for a missing key
+type Difference struct {
+	Key      string
+	Expected []byte
+	Actual   []byte
+}
+
+//Keys of the two states with different values, in key order
+func Diff(expected map[string][]byte, actual map[string][]byte) []Difference {
+	keys := []string{}
+	for key := range expected {
+		keys = append(keys, key)
+	}
+	for key := range actual {
+		if _, ok := expected[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	differences := []Difference{}
+	for _, key := range keys {
+		e, inExpected := expected[key]
+		a, inActual := actual[key]
+		if inExpected != inActual || !bytes.Equal(e, a) {
+			differences = append(differences, Difference{Key: key, Expected: e, Actual: a})
+		}
+	}
+	return differences
+}
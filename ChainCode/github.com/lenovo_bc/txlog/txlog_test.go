@@ -0,0 +1,113 @@
+package txlog
+
+import (
+	"bytes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	w := NewWrite("\x00SO\x00478\x0010\x00", []byte(`{"SONUMBER":"478"}`), false)
+	if string(w.Value) != `{"SONUMBER":"478"}` || w.Bytes != nil || string(w.Data()) != `{"SONUMBER":"478"}` {
+		t.Fatalf("unexpected write %+v", w)
+	}
+	//reformatted by encoding/json, kept as bytes
+	w = NewWrite("k", []byte(`{ "a": 1 }`), false)
+	if w.Value != nil || string(w.Data()) != `{ "a": 1 }` {
+		t.Fatalf("unexpected write %+v", w)
+	}
+	w = NewWrite("k", []byte("not json"), false)
+	if w.Value != nil || string(w.Data()) != "not json" {
+		t.Fatalf("unexpected write %+v", w)
+	}
+	w = NewWrite("k", nil, true)
+	if w.Data() != nil {
+		t.Fatalf("delete has data %q", w.Data())
+	}
+	if data := NewWrite("k", []byte{}, false).Data(); data == nil || len(data) != 0 {
+		t.Fatalf("empty value is %q", data)
+	}
+}
+
+func TestLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "txlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "replay.log")
+	ts := &timestamp.Timestamp{Seconds: 1514862000, Nanos: 123456789}
+	entries := []Entry{
+		{Block: 5, TxID: "a1", Timestamp: formatTime(ts), Valid: true, Chaincode: "lenovo_bc",
+			Args:   []string{"crSalesOrderInfo", `[{"SONUMBER":"478","SOITEM":"10"}]`, "1209"},
+			Writes: []Write{NewWrite("\x00SO\x00478\x0010\x00", []byte(`{"SONUMBER":"478"}`), false)},
+			Event:  NewEvent("POSTED", []byte(`{"TxID":"a1"}`))},
+		{Block: 5, TxNum: 1, TxID: "a2", Timestamp: formatTime(ts), Valid: false, Chaincode: "lenovo_bc",
+			Args:   []string{"removeFromStateByKey", `{"keyPrefix":"SO","keysStart":["478"]}`},
+			Writes: []Write{NewWrite("\x00SO\x00478\x0010\x00", nil, true)}},
+	}
+	if err := Append(path, entries[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := Append(path, entries[1:]); err != nil {
+		t.Fatal(err)
+	}
+	err, read := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read) != 2 || read[0].TxID != "a1" || read[1].TxNum != 1 || read[1].Valid {
+		t.Fatalf("unexpected entries %+v", read)
+	}
+	if read[0].Writes[0].Key != "\x00SO\x00478\x0010\x00" || string(read[0].Event.Data()) != `{"TxID":"a1"}` {
+		t.Fatalf("unexpected entry %+v", read[0])
+	}
+	if args := read[0].ArgsBytes(); len(args) != 3 || string(args[2]) != "1209" {
+		t.Fatalf("unexpected args %q", args)
+	}
+	err, replayed := read[0].Time()
+	if err != nil || replayed.Seconds != ts.Seconds || replayed.Nanos != ts.Nanos {
+		t.Fatalf("time %v %v, expected %v", err, replayed, ts)
+	}
+
+	//the invalid transaction wrote nothing
+	state := map[string][]byte{}
+	for _, e := range read {
+		Apply(state, e)
+	}
+	if string(state["\x00SO\x00478\x0010\x00"]) != `{"SONUMBER":"478"}` {
+		t.Fatalf("unexpected state %q", state)
+	}
+	read[1].Valid = true
+	Apply(state, read[1])
+	if len(state) != 0 {
+		t.Fatalf("delete not applied %q", state)
+	}
+
+	ioutil.WriteFile(path, []byte("{\"TxID\":\"a1\"}\n\nnot json\n"), 0644)
+	if err, _ := Read(path); err == nil || !bytes.Contains([]byte(err.Error()), []byte(":3:")) {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	expected := map[string][]byte{"a": []byte("1"), "b": []byte("2"), "c": {}, "d": []byte("4")}
+	actual := map[string][]byte{"a": []byte("1"), "b": []byte("3"), "d": []byte("4"), "e": []byte("5")}
+	differences := Diff(expected, actual)
+	if len(differences) != 3 {
+		t.Fatalf("unexpected differences %+v", differences)
+	}
+	if differences[0].Key != "b" || string(differences[0].Expected) != "2" || string(differences[0].Actual) != "3" {
+		t.Fatalf("unexpected difference %+v", differences[0])
+	}
+	//an empty value is not a missing key
+	if differences[1].Key != "c" || differences[1].Expected == nil || differences[1].Actual != nil {
+		t.Fatalf("unexpected difference %+v", differences[1])
+	}
+	if differences[2].Key != "e" || differences[2].Expected != nil {
+		t.Fatalf("unexpected difference %+v", differences[2])
+	}
+}
@@ -0,0 +1,264 @@
+package ubl
+
+import (
+	"github.com/lenovo_bc/model"
+	"strconv"
+	"strings"
+)
+
+//SD document categories (VBTYP) exported as CreditNote
+var CreditCategories = map[string]bool{"N": true, "O": true, "S": true}
+
+//MM invoice types exported as CreditNote
+var CreditInvoiceTypes = map[string]bool{"KG": true, CREDIT_NOTE_TYPE: true}
+
+//YYYYMMDD -> YYYY-MM-DD
+func isoDate(date string) string {
+	if len(date) == 8 && !strings.Contains(date, "-") {
+		return date[:4] + "-" + date[4:6] + "-" + date[6:]
+	}
+	return date
+}
+
+//YYYY-MM-DD -> YYYYMMDD
+func sapDate(date string) string {
+	return strings.Replace(date, "-", "", -1)
+}
+
+func sum(values ...string) float64 {
+	total := 0.0
+	for _, value := range values {
+		v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err == nil {
+			total += v
+		}
+	}
+	return total
+}
+
+func amount(value float64, currency string) Amount {
+	return Amount{CurrencyID: currency, Value: strconv.FormatFloat(value, 'f', 2, 64)}
+}
+
+func typeCode(doc *Document, credit bool) {
+	if credit {
+		doc.CreditNoteTypeCode = CREDIT_NOTE_TYPE
+	} else {
+		doc.InvoiceTypeCode = INVOICE_TYPE
+	}
+}
+
+//Order referenced by a sales order item: the linked purchase order, the
+//customer PO for items without one
+func orderOf(so model.SalesOrder) (string, string) {
+	if so.PONO != "" {
+		return so.PONO, so.POITEM
+	}
+	return so.CPONO, so.SOITEM
+}
+
+//Billing document billingNo of the given sales order items -> UBL.
+//Lenovo is the supplier, the sold-to party the customer.
+func FromBilling(orders []model.SalesOrder, billingNo string) Document {
+	lines := []Line{}
+	quantities := []Quantity{}
+	netValues, taxAmounts := []string{}, []string{}
+	credit, currency := false, ""
+	var header model.SalesOrder
+	for _, so := range orders {
+		for _, billing := range so.BILLINFOS {
+			if billing.BILLINGNO != billingNo {
+				continue
+			}
+			if len(lines) == 0 {
+				header = so
+				credit = CreditCategories[billing.CATEGORY]
+				currency = billing.CURRENCY
+			}
+			orderNo, orderItem := orderOf(so)
+			line := Line{
+				ID:                  billing.BILLINGITEM,
+				LineExtensionAmount: amount(sum(billing.NETVALUE), billing.CURRENCY),
+				OrderLineReference:  &OrderLineReference{LineID: orderItem, SalesOrderLineID: so.SOITEM, OrderID: orderNo},
+				TaxTotal:            &TaxTotal{TaxAmount: amount(sum(billing.TAXAMOUNT), billing.CURRENCY)},
+				Item:                Item{Description: billing.PARTSDESC, SellersID: billing.PARTSNO},
+			}
+			if billing.DNNUMBER != "" {
+				line.DespatchLineReference = &DespatchLineReference{LineID: billing.DNITEM, DocumentID: billing.DNNUMBER}
+			}
+			lines = append(lines, line)
+			quantities = append(quantities, Quantity{UnitCode: billing.UNIT, Value: billing.BILLINGQTY})
+			netValues = append(netValues, billing.NETVALUE)
+			taxAmounts = append(taxAmounts, billing.TAXAMOUNT)
+		}
+	}
+	doc := NewDocument(credit)
+	doc.ID = billingNo
+	typeCode(&doc, credit)
+	doc.DocumentCurrencyCode = currency
+	if orderNo, _ := orderOf(header); orderNo != "" || header.SONUMBER != "" {
+		doc.OrderReference = &OrderReference{ID: orderNo, SalesOrderID: header.SONUMBER}
+	}
+	for _, billing := range header.BILLINFOS {
+		if billing.BILLINGNO == billingNo {
+			doc.IssueDate = isoDate(billing.BPOSTDATE)
+			break
+		}
+	}
+	doc.Supplier = Party{ID: header.VENDORNO, Name: header.VENDORNAME}
+	doc.Customer = Party{ID: header.SOLDTO, Name: header.NAME1_AG, City: header.CITY_AG, Country: header.COUNTRY_AG}
+	net, tax := sum(netValues...), sum(taxAmounts...)
+	doc.TaxTotal = &TaxTotal{TaxAmount: amount(tax, currency)}
+	doc.LegalMonetaryTotal = MonetaryTotal{
+		LineExtensionAmount: amount(net, currency),
+		TaxExclusiveAmount:  amount(net, currency),
+		TaxInclusiveAmount:  amount(net+tax, currency),
+		PayableAmount:       amount(net+tax, currency),
+	}
+	for i, line := range lines {
+		doc.AddLine(line, quantities[i])
+	}
+	return doc
+}
+
+//Vendor invoice venInvNo of a PO item -> UBL. Invoice records carry no
+//amounts, so monetary totals are zero in the given currency.
+func FromInvoices(po model.PurchaseOrder, venInvNo string, currency string) Document {
+	invoices := []model.Invoice{}
+	for _, inv := range po.Invoice {
+		if inv.VenInvNO == venInvNo {
+			invoices = append(invoices, inv)
+		}
+	}
+	first := model.Invoice{}
+	if len(invoices) > 0 {
+		first = invoices[0]
+	}
+	credit := CreditInvoiceTypes[first.InvType]
+	doc := NewDocument(credit)
+	doc.ID = venInvNo
+	doc.IssueDate = isoDate(first.DocDate)
+	typeCode(&doc, credit)
+	doc.DocumentCurrencyCode = currency
+	doc.OrderReference = &OrderReference{ID: po.PONO}
+	doc.Supplier = Party{ID: po.VendorNO, Name: po.VendorName}
+	doc.Customer = Party{ID: po.Plant}
+	doc.LegalMonetaryTotal = MonetaryTotal{
+		LineExtensionAmount: amount(0, currency),
+		TaxExclusiveAmount:  amount(0, currency),
+		TaxInclusiveAmount:  amount(0, currency),
+		PayableAmount:       amount(0, currency),
+	}
+	for _, inv := range invoices {
+		line := Line{
+			ID:                  inv.InvItemNO,
+			LineExtensionAmount: amount(0, currency),
+			OrderLineReference:  &OrderLineReference{LineID: po.POItemNO, OrderID: po.PONO},
+			Item:                Item{SellersID: inv.PARTNO},
+		}
+		doc.AddLine(line, Quantity{UnitCode: inv.Unit, Value: inv.InvQty})
+	}
+	return doc
+}
+
+func lineQuantity(line Line) Quantity {
+	if line.CreditedQuantity != nil {
+		return *line.CreditedQuantity
+	}
+	if line.InvoicedQuantity != nil {
+		return *line.InvoicedQuantity
+	}
+	return Quantity{}
+}
+
+//UBL -> BillingInfo, grouped on the sales order items (TRANSDOC BL) named by
+//SalesOrderID and SalesOrderLineID
+func ToBilling(doc Document) []model.SalesOrder {
+	orders := []model.SalesOrder{}
+	index := map[string]int{}
+	category := "M"
+	if doc.IsCreditNote() {
+		category = "O"
+	}
+	soNumber := ""
+	if doc.OrderReference != nil {
+		soNumber = doc.OrderReference.SalesOrderID
+	}
+	for _, line := range doc.Lines() {
+		soItem := ""
+		if line.OrderLineReference != nil {
+			soItem = line.OrderLineReference.SalesOrderLineID
+		}
+		quantity := lineQuantity(line)
+		billing := model.BillingInfo{
+			BILLINGNO:   doc.ID,
+			BILLINGITEM: line.ID,
+			CATEGORY:    category,
+			BPOSTDATE:   sapDate(doc.IssueDate),
+			PARTSNO:     line.Item.SellersID,
+			PARTSDESC:   line.Item.Description,
+			BILLINGQTY:  quantity.Value,
+			UNIT:        quantity.UnitCode,
+			NETVALUE:    line.LineExtensionAmount.Value,
+			CURRENCY:    doc.DocumentCurrencyCode,
+		}
+		if line.TaxTotal != nil {
+			billing.TAXAMOUNT = line.TaxTotal.TaxAmount.Value
+		}
+		if line.DespatchLineReference != nil {
+			billing.DNNUMBER, billing.DNITEM = line.DespatchLineReference.DocumentID, line.DespatchLineReference.LineID
+		}
+		key := soNumber + "/" + soItem
+		i, ok := index[key]
+		if !ok {
+			i = len(orders)
+			index[key] = i
+			orders = append(orders, model.SalesOrder{SONUMBER: soNumber, SOITEM: soItem, TRANSDOC: "BL"})
+		}
+		orders[i].BILLINFOS = append(orders[i].BILLINFOS, billing)
+	}
+	return orders
+}
+
+//UBL -> Invoice, grouped on the PO items (TRANSDOC INV) named by
+//OrderReference and OrderLineReference
+func ToInvoices(doc Document) []model.PurchaseOrder {
+	orders := []model.PurchaseOrder{}
+	index := map[string]int{}
+	invType := INVOICE_TYPE
+	if doc.IsCreditNote() {
+		invType = CREDIT_NOTE_TYPE
+	}
+	for _, line := range doc.Lines() {
+		pono, poItem := "", ""
+		if doc.OrderReference != nil {
+			pono = doc.OrderReference.ID
+		}
+		if line.OrderLineReference != nil {
+			poItem = line.OrderLineReference.LineID
+			if line.OrderLineReference.OrderID != "" {
+				pono = line.OrderLineReference.OrderID
+			}
+		}
+		quantity := lineQuantity(line)
+		invoice := model.Invoice{
+			VenInvNO:  doc.ID,
+			InvType:   invType,
+			DocDate:   sapDate(doc.IssueDate),
+			VendorNO:  doc.Supplier.ID,
+			InvItemNO: line.ID,
+			PARTNO:    line.Item.SellersID,
+			InvQty:    quantity.Value,
+			Unit:      quantity.UnitCode,
+		}
+		key := pono + "/" + poItem
+		i, ok := index[key]
+		if !ok {
+			i = len(orders)
+			index[key] = i
+			orders = append(orders, model.PurchaseOrder{PONO: pono, POItemNO: poItem, TRANSDOC: "INV"})
+		}
+		orders[i].Invoice = append(orders[i].Invoice, invoice)
+	}
+	return orders
+}
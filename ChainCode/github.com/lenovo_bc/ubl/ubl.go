@@ -0,0 +1,306 @@
+// Package ubl converts BillingInfo and Invoice records to and from OASIS
+// UBL 2.1 Invoice and CreditNote documents.
+//
+// Documents are written with the usual cac/cbc prefixes. Reading ignores
+// prefixes and matches elements by local name.
+package ubl
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+//UBL 2.1 namespaces
+const (
+	NS_INVOICE     = "urn:oasis:names:specification:ubl:schema:xsd:Invoice-2"
+	NS_CREDIT_NOTE = "urn:oasis:names:specification:ubl:schema:xsd:CreditNote-2"
+	NS_CAC         = "urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2"
+	NS_CBC         = "urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2"
+)
+
+//Type codes, UNCL1001
+const (
+	INVOICE_TYPE     = "380"
+	CREDIT_NOTE_TYPE = "381"
+)
+
+type Amount struct {
+	CurrencyID string `xml:"currencyID,attr,omitempty"`
+	Value      string `xml:",chardata"`
+}
+
+type Quantity struct {
+	UnitCode string `xml:"unitCode,attr,omitempty"`
+	Value    string `xml:",chardata"`
+}
+
+type Party struct {
+	ID      string `xml:"cac:Party>cac:PartyIdentification>cbc:ID,omitempty"`
+	Name    string `xml:"cac:Party>cac:PartyName>cbc:Name,omitempty"`
+	City    string `xml:"cac:Party>cac:PostalAddress>cbc:CityName,omitempty"`
+	Country string `xml:"cac:Party>cac:PostalAddress>cac:Country>cbc:IdentificationCode,omitempty"`
+}
+
+type OrderReference struct {
+	ID           string `xml:"cbc:ID"`
+	SalesOrderID string `xml:"cbc:SalesOrderID,omitempty"`
+}
+
+type OrderLineReference struct {
+	LineID           string `xml:"cbc:LineID"`
+	SalesOrderLineID string `xml:"cbc:SalesOrderLineID,omitempty"`
+	OrderID          string `xml:"cac:OrderReference>cbc:ID,omitempty"`
+}
+
+type DespatchLineReference struct {
+	LineID     string `xml:"cbc:LineID"`
+	DocumentID string `xml:"cac:DocumentReference>cbc:ID"`
+}
+
+type TaxTotal struct {
+	TaxAmount Amount `xml:"cbc:TaxAmount"`
+}
+
+type MonetaryTotal struct {
+	LineExtensionAmount Amount `xml:"cbc:LineExtensionAmount"`
+	TaxExclusiveAmount  Amount `xml:"cbc:TaxExclusiveAmount"`
+	TaxInclusiveAmount  Amount `xml:"cbc:TaxInclusiveAmount"`
+	PayableAmount       Amount `xml:"cbc:PayableAmount"`
+}
+
+type Item struct {
+	Description string `xml:"cbc:Description,omitempty"`
+	SellersID   string `xml:"cac:SellersItemIdentification>cbc:ID,omitempty"`
+}
+
+//InvoiceLine or CreditNoteLine
+type Line struct {
+	ID                    string                 `xml:"cbc:ID"`
+	InvoicedQuantity      *Quantity              `xml:"cbc:InvoicedQuantity,omitempty"`
+	CreditedQuantity      *Quantity              `xml:"cbc:CreditedQuantity,omitempty"`
+	LineExtensionAmount   Amount                 `xml:"cbc:LineExtensionAmount"`
+	OrderLineReference    *OrderLineReference    `xml:"cac:OrderLineReference,omitempty"`
+	DespatchLineReference *DespatchLineReference `xml:"cac:DespatchLineReference,omitempty"`
+	TaxTotal              *TaxTotal              `xml:"cac:TaxTotal,omitempty"`
+	Item                  Item                   `xml:"cac:Item"`
+}
+
+//Invoice or CreditNote, written in UBL element order
+type Document struct {
+	XMLName              xml.Name
+	Xmlns                string          `xml:"xmlns,attr"`
+	XmlnsCac             string          `xml:"xmlns:cac,attr"`
+	XmlnsCbc             string          `xml:"xmlns:cbc,attr"`
+	UBLVersionID         string          `xml:"cbc:UBLVersionID"`
+	ID                   string          `xml:"cbc:ID"`
+	IssueDate            string          `xml:"cbc:IssueDate"`
+	InvoiceTypeCode      string          `xml:"cbc:InvoiceTypeCode,omitempty"`
+	CreditNoteTypeCode   string          `xml:"cbc:CreditNoteTypeCode,omitempty"`
+	DocumentCurrencyCode string          `xml:"cbc:DocumentCurrencyCode,omitempty"`
+	OrderReference       *OrderReference `xml:"cac:OrderReference,omitempty"`
+	Supplier             Party           `xml:"cac:AccountingSupplierParty"`
+	Customer             Party           `xml:"cac:AccountingCustomerParty"`
+	TaxTotal             *TaxTotal       `xml:"cac:TaxTotal,omitempty"`
+	LegalMonetaryTotal   MonetaryTotal   `xml:"cac:LegalMonetaryTotal"`
+	InvoiceLines         []Line          `xml:"cac:InvoiceLine,omitempty"`
+	CreditNoteLines      []Line          `xml:"cac:CreditNoteLine,omitempty"`
+}
+
+//新建Invoice或CreditNote
+func NewDocument(credit bool) Document {
+	doc := Document{
+		XMLName:      xml.Name{Local: "Invoice"},
+		Xmlns:        NS_INVOICE,
+		XmlnsCac:     NS_CAC,
+		XmlnsCbc:     NS_CBC,
+		UBLVersionID: "2.1",
+	}
+	if credit {
+		doc.XMLName.Local = "CreditNote"
+		doc.Xmlns = NS_CREDIT_NOTE
+	}
+	return doc
+}
+
+func (d Document) IsCreditNote() bool {
+	return d.XMLName.Local == "CreditNote"
+}
+
+//Invoice lines or credit note lines
+func (d Document) Lines() []Line {
+	if d.IsCreditNote() {
+		return d.CreditNoteLines
+	}
+	return d.InvoiceLines
+}
+
+//添加行, 数量写入InvoicedQuantity或CreditedQuantity
+func (d *Document) AddLine(line Line, quantity Quantity) {
+	if d.IsCreditNote() {
+		line.CreditedQuantity = &quantity
+		d.CreditNoteLines = append(d.CreditNoteLines, line)
+	} else {
+		line.InvoicedQuantity = &quantity
+		d.InvoiceLines = append(d.InvoiceLines, line)
+	}
+}
+
+func (d Document) Marshal() (error, []byte) {
+	b, err := xml.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return err, nil
+	}
+	return nil, append([]byte(xml.Header), b...)
+}
+
+//Element tree for reading, names without namespace
+type node struct {
+	Name  string
+	Attr  map[string]string
+	Text  string
+	Nodes []*node
+}
+
+func (n *node) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	n.Name = start.Name.Local
+	n.Attr = map[string]string{}
+	for _, attr := range start.Attr {
+		n.Attr[attr.Name.Local] = attr.Value
+	}
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			child := &node{}
+			err = d.DecodeElement(child, &t)
+			if err != nil {
+				return err
+			}
+			n.Nodes = append(n.Nodes, child)
+		case xml.CharData:
+			n.Text += string(t)
+		case xml.EndElement:
+			n.Text = strings.TrimSpace(n.Text)
+			return nil
+		}
+	}
+}
+
+//按路径取第一个子节点
+func (n *node) find(path ...string) *node {
+	current := n
+	for _, name := range path {
+		var next *node
+		for _, child := range current.Nodes {
+			if child.Name == name {
+				next = child
+				break
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		current = next
+	}
+	return current
+}
+
+func (n *node) text(path ...string) string {
+	found := n.find(path...)
+	if found == nil {
+		return ""
+	}
+	return found.Text
+}
+
+func (n *node) all(name string) []*node {
+	nodes := []*node{}
+	for _, child := range n.Nodes {
+		if child.Name == name {
+			nodes = append(nodes, child)
+		}
+	}
+	return nodes
+}
+
+func readParty(n *node) Party {
+	if n == nil {
+		return Party{}
+	}
+	return Party{
+		ID:      n.text("Party", "PartyIdentification", "ID"),
+		Name:    n.text("Party", "PartyName", "Name"),
+		City:    n.text("Party", "PostalAddress", "CityName"),
+		Country: n.text("Party", "PostalAddress", "Country", "IdentificationCode"),
+	}
+}
+
+func readAmount(n *node) Amount {
+	if n == nil {
+		return Amount{}
+	}
+	return Amount{CurrencyID: n.Attr["currencyID"], Value: n.Text}
+}
+
+//解析UBL Invoice/CreditNote, 支持任意namespace前缀
+func Parse(b []byte) (error, Document) {
+	root := &node{}
+	err := xml.Unmarshal(b, root)
+	if err != nil {
+		return err, Document{}
+	}
+	if root.Name != "Invoice" && root.Name != "CreditNote" {
+		return fmt.Errorf("root element %s is neither Invoice nor CreditNote", root.Name), Document{}
+	}
+	doc := NewDocument(root.Name == "CreditNote")
+	doc.UBLVersionID = root.text("UBLVersionID")
+	doc.ID = root.text("ID")
+	doc.IssueDate = root.text("IssueDate")
+	doc.InvoiceTypeCode = root.text("InvoiceTypeCode")
+	doc.CreditNoteTypeCode = root.text("CreditNoteTypeCode")
+	doc.DocumentCurrencyCode = root.text("DocumentCurrencyCode")
+	if ref := root.find("OrderReference"); ref != nil {
+		doc.OrderReference = &OrderReference{ID: ref.text("ID"), SalesOrderID: ref.text("SalesOrderID")}
+	}
+	doc.Supplier = readParty(root.find("AccountingSupplierParty"))
+	doc.Customer = readParty(root.find("AccountingCustomerParty"))
+	if tax := root.find("TaxTotal"); tax != nil {
+		doc.TaxTotal = &TaxTotal{TaxAmount: readAmount(tax.find("TaxAmount"))}
+	}
+	doc.LegalMonetaryTotal = MonetaryTotal{
+		LineExtensionAmount: readAmount(root.find("LegalMonetaryTotal", "LineExtensionAmount")),
+		TaxExclusiveAmount:  readAmount(root.find("LegalMonetaryTotal", "TaxExclusiveAmount")),
+		TaxInclusiveAmount:  readAmount(root.find("LegalMonetaryTotal", "TaxInclusiveAmount")),
+		PayableAmount:       readAmount(root.find("LegalMonetaryTotal", "PayableAmount")),
+	}
+	lineName, quantityName := "InvoiceLine", "InvoicedQuantity"
+	if doc.IsCreditNote() {
+		lineName, quantityName = "CreditNoteLine", "CreditedQuantity"
+	}
+	for _, l := range root.all(lineName) {
+		line := Line{
+			ID:                  l.text("ID"),
+			LineExtensionAmount: readAmount(l.find("LineExtensionAmount")),
+			Item:                Item{Description: l.text("Item", "Description"), SellersID: l.text("Item", "SellersItemIdentification", "ID")},
+		}
+		if ref := l.find("OrderLineReference"); ref != nil {
+			line.OrderLineReference = &OrderLineReference{LineID: ref.text("LineID"), SalesOrderLineID: ref.text("SalesOrderLineID"), OrderID: ref.text("OrderReference", "ID")}
+		}
+		if ref := l.find("DespatchLineReference"); ref != nil {
+			line.DespatchLineReference = &DespatchLineReference{LineID: ref.text("LineID"), DocumentID: ref.text("DocumentReference", "ID")}
+		}
+		if tax := l.find("TaxTotal"); tax != nil {
+			line.TaxTotal = &TaxTotal{TaxAmount: readAmount(tax.find("TaxAmount"))}
+		}
+		quantity := Quantity{}
+		if q := l.find(quantityName); q != nil {
+			quantity = Quantity{UnitCode: q.Attr["unitCode"], Value: q.Text}
+		}
+		doc.AddLine(line, quantity)
+	}
+	return nil, doc
+}
@@ -0,0 +1,117 @@
+package ubl
+
+import (
+	"github.com/lenovo_bc/model"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBillingRoundTrip(t *testing.T) {
+	so := model.SalesOrder{SONUMBER: "478", SOITEM: "10", CPONO: "CPO-1", VENDORNO: "LEN", SOLDTO: "C100", NAME1_AG: "Acme", COUNTRY_AG: "DE",
+		BILLINFOS: []model.BillingInfo{
+			{BILLINGNO: "9001", BILLINGITEM: "10", CATEGORY: "M", BPOSTDATE: "20180120", PARTSNO: "20HD", PARTSDESC: "ThinkPad", BILLINGQTY: "5", UNIT: "EA", NETVALUE: "5000", TAXAMOUNT: "950", CURRENCY: "EUR", DNNUMBER: "800001", DNITEM: "10"},
+			{BILLINGNO: "9002", BILLINGITEM: "10", CATEGORY: "M", NETVALUE: "1"}}}
+	doc := FromBilling([]model.SalesOrder{so}, "9001")
+	if doc.IsCreditNote() || len(doc.InvoiceLines) != 1 || doc.IssueDate != "2018-01-20" || doc.LegalMonetaryTotal.PayableAmount.Value != "5950.00" {
+		t.Fatalf("unexpected invoice %+v", doc)
+	}
+	err, b := doc.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{`<Invoice xmlns="` + NS_INVOICE + `"`, `<cbc:InvoiceTypeCode>380</cbc:InvoiceTypeCode>`, `<cbc:TaxAmount currencyID="EUR">950.00</cbc:TaxAmount>`,
+		`<cbc:InvoicedQuantity unitCode="EA">5</cbc:InvoicedQuantity>`, `<cbc:ID>800001</cbc:ID>`} {
+		if !strings.Contains(string(b), s) {
+			t.Fatalf("expected %s in %s", s, b)
+		}
+	}
+	err, parsed := Parse(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, doc) {
+		t.Fatalf("round trip mismatch\n%+v\n%+v", parsed, doc)
+	}
+	orders := ToBilling(parsed)
+	if len(orders) != 1 || orders[0].SONUMBER != "478" || orders[0].SOITEM != "10" || orders[0].TRANSDOC != "BL" {
+		t.Fatalf("unexpected orders %+v", orders)
+	}
+	billing := orders[0].BILLINFOS[0]
+	if billing.BILLINGNO != "9001" || billing.BPOSTDATE != "20180120" || billing.BILLINGQTY != "5" || billing.TAXAMOUNT != "950.00" || billing.DNNUMBER != "800001" {
+		t.Fatalf("unexpected billing %+v", billing)
+	}
+}
+
+//Orders are referenced by the linked PO, by the customer PO without one
+func TestBillingOrderReference(t *testing.T) {
+	billing := []model.BillingInfo{{BILLINGNO: "9001", BILLINGITEM: "10", NETVALUE: "1", CURRENCY: "EUR"}}
+	linked := model.SalesOrder{SONUMBER: "478", SOITEM: "10", CPONO: "CPO-1", PONO: "4500", POITEM: "20", BILLINFOS: billing}
+	unlinked := model.SalesOrder{SONUMBER: "478", SOITEM: "30", CPONO: "CPO-1", BILLINFOS: billing}
+	doc := FromBilling([]model.SalesOrder{linked, unlinked}, "9001")
+	if doc.OrderReference == nil || doc.OrderReference.ID != "4500" || doc.OrderReference.SalesOrderID != "478" || len(doc.InvoiceLines) != 2 {
+		t.Fatalf("unexpected order reference %+v", doc.OrderReference)
+	}
+	expected := []OrderLineReference{{LineID: "20", SalesOrderLineID: "10", OrderID: "4500"}, {LineID: "30", SalesOrderLineID: "30", OrderID: "CPO-1"}}
+	for i, line := range doc.InvoiceLines {
+		if line.OrderLineReference == nil || *line.OrderLineReference != expected[i] {
+			t.Errorf("line %d references %+v", i, line.OrderLineReference)
+		}
+	}
+	err, b := doc.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err, parsed := Parse(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.OrderReference.ID != "4500" || *parsed.InvoiceLines[0].OrderLineReference != expected[0] {
+		t.Fatalf("PO is not referenced in %s", b)
+	}
+	orders := ToBilling(parsed)
+	if len(orders) != 2 || orders[0].SOITEM != "10" || orders[1].SOITEM != "30" {
+		t.Fatalf("unexpected orders %+v", orders)
+	}
+}
+
+func TestCreditNote(t *testing.T) {
+	po := model.PurchaseOrder{PONO: "4500", POItemNO: "10", VendorNO: "1209",
+		Invoice: []model.Invoice{{VenInvNO: "CN-7", InvType: "KG", DocDate: "20180201", InvItemNO: "1", PARTNO: "20HD", InvQty: "2", Unit: "EA"}}}
+	err, b := FromInvoices(po, "CN-7", "USD").Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `<CreditNote xmlns="`+NS_CREDIT_NOTE+`"`) || !strings.Contains(string(b), `<cbc:CreditedQuantity unitCode="EA">2</cbc:CreditedQuantity>`) {
+		t.Fatalf("unexpected credit note %s", b)
+	}
+	err, doc := Parse(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	orders := ToInvoices(doc)
+	if len(orders) != 1 || orders[0].PONO != "4500" || orders[0].POItemNO != "10" || orders[0].Invoice[0].InvType != CREDIT_NOTE_TYPE || orders[0].Invoice[0].InvQty != "2" {
+		t.Fatalf("unexpected orders %+v", orders)
+	}
+}
+
+func TestParsePrefixes(t *testing.T) {
+	payload := `<inv:Invoice xmlns:inv="` + NS_INVOICE + `" xmlns:a="` + NS_CAC + `" xmlns:b="` + NS_CBC + `">
+  <b:ID>INV-1</b:ID><b:IssueDate>2018-03-01</b:IssueDate><b:DocumentCurrencyCode>CNY</b:DocumentCurrencyCode>
+  <a:OrderReference><b:ID>4500</b:ID></a:OrderReference>
+  <a:InvoiceLine><b:ID>1</b:ID><b:InvoicedQuantity unitCode="EA">3</b:InvoicedQuantity>
+    <a:OrderLineReference><b:LineID>20</b:LineID></a:OrderLineReference></a:InvoiceLine>
+</inv:Invoice>`
+	err, doc := Parse([]byte(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	orders := ToInvoices(doc)
+	if len(orders) != 1 || orders[0].PONO != "4500" || orders[0].POItemNO != "20" || orders[0].Invoice[0].InvQty != "3" || orders[0].Invoice[0].DocDate != "20180301" {
+		t.Fatalf("unexpected orders %+v", orders)
+	}
+	err, _ = Parse([]byte(`<Order/>`))
+	if err == nil {
+		t.Fatal("expected error for Order root")
+	}
+}
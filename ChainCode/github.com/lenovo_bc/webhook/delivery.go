@@ -0,0 +1,214 @@
+package webhook
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/lenovo_bc/outbound"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Delivery log status
+const (
+	DELIVERY_SENT    = "SENT"
+	DELIVERY_FAILED  = "FAILED"
+	DELIVERY_DROPPED = "DROPPED" //Subscription was removed, the message is not sent
+)
+
+//One line of the delivery log
+type Delivery struct {
+	Time           string `json:"Time"`           //RFC3339
+	MessageID      string `json:"MessageID"`      //outbound.Message ID
+	SubscriptionID string `json:"SubscriptionID"` //Webhook subscription
+	Partner        string `json:"Partner"`        //Subscribing partner org
+	URL            string `json:"URL"`            //Called URL
+	Status         string `json:"Status"`         //SENT, FAILED, DROPPED
+	HTTPStatus     int    `json:"HTTPStatus"`     //0 if no response
+	Error          string `json:"Error"`          //Error of a failed call
+	Millis         int64  `json:"Millis"`         //Duration of the call
+}
+
+//Delivery log, one JSON object per line
+type Log struct {
+	Path string
+	mu   sync.Mutex
+}
+
+func (l *Log) Write(d Delivery) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	err := os.MkdirAll(filepath.Dir(l.Path), 0755)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	b, _ := json.Marshal(d)
+	_, err = f.Write(append(b, '\n'))
+	return err
+}
+
+//Deliveries in the log, oldest first
+func (l *Log) Read() (error, []Delivery) {
+	deliveries := []Delivery{}
+	f, err := os.Open(l.Path)
+	if os.IsNotExist(err) {
+		return nil, deliveries
+	} else if err != nil {
+		return err, nil
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		d := Delivery{}
+		err = json.Unmarshal(scanner.Bytes(), &d)
+		if err != nil {
+			return fmt.Errorf("%s: %s", l.Path, err.Error()), nil
+		}
+		deliveries = append(deliveries, d)
+	}
+	return scanner.Err(), deliveries
+}
+
+//outbound.Sink calling the URL of the subscription the message targets. The
+//subscription is looked up at delivery, so a changed secret or URL applies to
+//retries as well. The registry is refreshed for a subscription without a
+//secret, new or changed since the last import.
+type Sink struct {
+	Registry *Registry
+	Log      *Log
+	Client   *http.Client
+	now      func() time.Time
+}
+
+func NewSink(registry *Registry, log *Log) *Sink {
+	return &Sink{Registry: registry, Log: log, Client: &http.Client{Timeout: 30 * time.Second}, now: time.Now}
+}
+
+func (s *Sink) Deliver(m outbound.Message) error {
+	start := s.now()
+	d := Delivery{Time: start.UTC().Format(time.RFC3339), MessageID: m.ID, SubscriptionID: m.Target}
+	sub, ok := s.Registry.Get(m.Target)
+	if !ok {
+		d.Status = DELIVERY_DROPPED
+		return s.log(d, nil)
+	}
+	var err error
+	if sub.Secret == "" {
+		err = s.Registry.Refresh()
+		sub, ok = s.Registry.Get(m.Target)
+		if !ok {
+			d.Status = DELIVERY_DROPPED
+			return s.log(d, nil)
+		}
+	}
+	d.Partner, d.URL = sub.Partner, sub.URL
+	if err == nil && sub.Secret == "" {
+		err = fmt.Errorf("subscription %s has no secret after the import", sub.ID)
+	}
+	if err == nil {
+		err = s.call(sub.URL, sub.Secret, m, start, &d)
+	}
+	d.Millis = int64(s.now().Sub(start) / time.Millisecond)
+	if err != nil {
+		d.Status, d.Error = DELIVERY_FAILED, err.Error()
+	} else {
+		d.Status = DELIVERY_SENT
+	}
+	return s.log(d, err)
+}
+
+func (s *Sink) call(url string, secret string, m outbound.Message, now time.Time, d *Delivery) error {
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	req, err := http.NewRequest("POST", url, bytes.NewBufferString(m.Body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", m.ContentType())
+	req.Header.Set("X-Message-ID", m.ID)
+	req.Header.Set("X-Message-Type", m.MessageType)
+	req.Header.Set(TIMESTAMP_HEADER, timestamp)
+	req.Header.Set(SIGNATURE_HEADER, Sign(secret, timestamp, []byte(m.Body)))
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	d.HTTPStatus = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %s %s", url, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+//写日志失败时投递也算失败, 消息会重试
+func (s *Sink) log(d Delivery, err error) error {
+	if s.Log != nil {
+		logErr := s.Log.Write(d)
+		if err == nil && logErr != nil {
+			return logErr
+		}
+	}
+	return err
+}
+
+//HTTP endpoint standing in for a partner: checks the signature with Secret
+//and stores every body under Dir. The first Fail requests are answered with
+//503 to exercise retries, unsigned or wrongly signed calls with 401.
+type Stub struct {
+	Secret string
+	Dir    string
+	Fail   int
+	mu     sync.Mutex
+	seen   int
+}
+
+func (s *Stub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.seen++
+	fail := s.seen <= s.Fail
+	s.mu.Unlock()
+	if r.Method != "POST" {
+		http.Error(w, "POST only", http.StatusMethodNotAllowed)
+		return
+	}
+	if fail {
+		http.Error(w, "stub failure", http.StatusServiceUnavailable)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = Verify(s.Secret, r.Header.Get(TIMESTAMP_HEADER), r.Header.Get(SIGNATURE_HEADER), body, 5*time.Minute, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	id := filepath.Base(r.Header.Get("X-Message-ID"))
+	if id == "" || id == "." {
+		id = fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	err = ioutil.WriteFile(filepath.Join(s.Dir, id), body, 0644)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,257 @@
+// Package webhook notifies partners of the documents written on the ledger.
+//
+// Partners register subscriptions on-chain (setWebhookSubscription): an
+// entity (SO, PO, CPO, SUP), a filter such as VendorNO=1209 or CPONO=C1, a
+// URL and a secret. For each POSTED event the documents matching a
+// subscription are sent to its URL as one JSON call, queued in an
+// outbound.Outbox for retry with backoff and dead letters.
+//
+// Calls carry X-Timestamp (unix seconds) and X-Signature, "sha256=" and the
+// hex HMAC-SHA256 of timestamp + "." + body keyed with the secret. Receivers
+// check it with Verify.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/lenovo_bc/model"
+	"github.com/lenovo_bc/outbound"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	MESSAGE_TYPE     = "WEBHOOK"
+	SIGNATURE_HEADER = "X-Signature"
+	TIMESTAMP_HEADER = "X-Timestamp"
+	SIGNATURE_PREFIX = "sha256="
+)
+
+//Body of a webhook call
+type Payload struct {
+	ID             string              `json:"ID"`             //TxID-SubscriptionID, same for retries
+	SubscriptionID string              `json:"SubscriptionID"` //Matched subscription
+	Partner        string              `json:"Partner"`        //Subscribing partner org
+	TxID           string              `json:"TxID"`           //Transaction ID
+	Time           string              `json:"Time"`           //Transaction time
+	Documents      []model.DocumentRef `json:"Documents"`      //Matching documents, read them with queryById
+}
+
+//HMAC-SHA256 signature of a call
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return SIGNATURE_PREFIX + hex.EncodeToString(mac.Sum(nil))
+}
+
+//Check the signature of a call and that timestamp is within tolerance of now
+func Verify(secret string, timestamp string, signature string, body []byte, tolerance time.Duration, now time.Time) error {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q", TIMESTAMP_HEADER, timestamp)
+	}
+	age := now.Sub(time.Unix(seconds, 0))
+	if age > tolerance || age < -tolerance {
+		return fmt.Errorf("%s %s is out of tolerance", TIMESTAMP_HEADER, timestamp)
+	}
+	if !hmac.Equal([]byte(signature), []byte(Sign(secret, timestamp, body))) {
+		return fmt.Errorf("%s doesn't match", SIGNATURE_HEADER)
+	}
+	return nil
+}
+
+//Subscriptions known to the event listener, kept in a JSON file in the
+//format of queryWebhookSubscriptions and updated from the POSTED events.
+//Events carry no secrets, Source is imported again when a subscription has
+//none.
+type Registry struct {
+	Path   string
+	Source func() (error, []byte) //queryWebhookSubscriptions invoked by the buyer org, nil to import by hand
+	mu     sync.Mutex
+	subs   map[string]model.WebhookSubscription
+}
+
+func OpenRegistry(path string) (error, *Registry) {
+	r := &Registry{Path: path, subs: map[string]model.WebhookSubscription{}}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, r
+	} else if err != nil {
+		return err, nil
+	}
+	err = r.load(b)
+	if err != nil {
+		return fmt.Errorf("%s: %s", path, err.Error()), nil
+	}
+	return nil, r
+}
+
+func (r *Registry) load(b []byte) error {
+	var subs []model.WebhookSubscription
+	err := json.Unmarshal(b, &subs)
+	if err != nil {
+		return err
+	}
+	r.subs = map[string]model.WebhookSubscription{}
+	for _, sub := range subs {
+		r.subs[sub.ID] = sub
+	}
+	return nil
+}
+
+func (r *Registry) save() error {
+	b, _ := json.MarshalIndent(r.list(), "", "  ")
+	err := os.MkdirAll(filepath.Dir(r.Path), 0755)
+	if err != nil {
+		return err
+	}
+	tmp := r.Path + ".tmp"
+	err = ioutil.WriteFile(tmp, b, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.Path)
+}
+
+func (r *Registry) list() []model.WebhookSubscription {
+	subs := []model.WebhookSubscription{}
+	for _, sub := range r.subs {
+		subs = append(subs, sub)
+	}
+	sort.Stable(byID(subs))
+	return subs
+}
+
+type byID []model.WebhookSubscription
+
+func (s byID) Len() int           { return len(s) }
+func (s byID) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byID) Less(i, j int) bool { return s[i].ID < s[j].ID }
+
+//Replace all subscriptions with the output of queryWebhookSubscriptions
+//invoked by the buyer org, masked secrets are rejected.
+func (r *Registry) Import(b []byte) (error, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var subs []model.WebhookSubscription
+	err := json.Unmarshal(b, &subs)
+	if err != nil {
+		return err, 0
+	}
+	for _, sub := range subs {
+		if sub.Secret == "" || sub.Secret == "***" {
+			return fmt.Errorf("subscription %s has no secret, query the subscriptions as the buyer org", sub.ID), 0
+		}
+	}
+	old := r.subs
+	r.load(b)
+	err = r.save()
+	if err != nil {
+		r.subs = old
+		return err, 0
+	}
+	return nil, len(subs)
+}
+
+//Imports the subscriptions of Source
+func (r *Registry) Refresh() error {
+	if r.Source == nil {
+		return fmt.Errorf("no subscription source, import the subscriptions queried as the buyer org")
+	}
+	err, b := r.Source()
+	if err != nil {
+		return fmt.Errorf("querying the subscriptions: %s", err.Error())
+	}
+	err, _ = r.Import(b)
+	return err
+}
+
+//Apply the subscription changes of a POSTED event. Events carry no secret:
+//the known secret is kept unless it changed, new and changed secrets are
+//only known after the next Import or Refresh.
+func (r *Registry) Apply(changes []model.WebhookSubscription) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, sub := range changes {
+		if sub.Removed {
+			delete(r.subs, sub.ID)
+			continue
+		}
+		if old, ok := r.subs[sub.ID]; ok && !sub.SecretChanged {
+			sub.Secret = old.Secret
+		}
+		sub.SecretChanged = false
+		r.subs[sub.ID] = sub
+	}
+	return r.save()
+}
+
+func (r *Registry) Get(id string) (model.WebhookSubscription, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sub, ok := r.subs[id]
+	return sub, ok
+}
+
+//Subscriptions ordered by ID
+func (r *Registry) List() []model.WebhookSubscription {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.list()
+}
+
+//Documents of posting matching sub
+func Match(sub model.WebhookSubscription, posting model.PostingEvent) []model.DocumentRef {
+	documents := []model.DocumentRef{}
+	for _, document := range posting.Documents {
+		if document.Entity == sub.Entity && sub.FilterValue != "" && document.Fields[sub.FilterField] == sub.FilterValue {
+			documents = append(documents, document)
+		}
+	}
+	return documents
+}
+
+//POSTED event -> one message per subscription with matching documents.
+//Subscription changes of the event are applied to registry first.
+func Translate(registry *Registry, eventName string, payload []byte) (error, []outbound.Message) {
+	if eventName != outbound.POSTING_EVENT {
+		return nil, []outbound.Message{}
+	}
+	posting := model.PostingEvent{}
+	err := json.Unmarshal(payload, &posting)
+	if err != nil {
+		return fmt.Errorf("%s payload: %s", eventName, err.Error()), nil
+	}
+	if posting.TxID == "" {
+		return fmt.Errorf("%s payload without TxID", eventName), nil
+	}
+	err = registry.Apply(posting.Subscriptions)
+	if err != nil {
+		return err, nil
+	}
+	messages := []outbound.Message{}
+	for _, sub := range registry.List() {
+		documents := Match(sub, posting)
+		if len(documents) == 0 {
+			continue
+		}
+		id := posting.TxID + "-" + sub.ID
+		b, _ := json.MarshalIndent(Payload{ID: id, SubscriptionID: sub.ID, Partner: sub.Partner, TxID: posting.TxID,
+			Time: posting.Time, Documents: documents}, "", "  ")
+		messages = append(messages, outbound.Message{ID: id, Event: eventName, MessageType: MESSAGE_TYPE,
+			Format: outbound.FORMAT_JSON, FileName: MESSAGE_TYPE + "_" + id + ".json", Body: string(b), Target: sub.ID})
+	}
+	return nil, messages
+}
@@ -0,0 +1,129 @@
+package webhook
+
+import (
+	"encoding/json"
+	"github.com/lenovo_bc/model"
+	"github.com/lenovo_bc/outbound"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const secret = "0123456789abcdef"
+
+func posting(subs ...model.WebhookSubscription) []byte {
+	b, _ := json.Marshal(model.PostingEvent{TxID: "tx1", VendorNO: "1209", Subscriptions: subs, Documents: []model.DocumentRef{
+		{Entity: "SUP", Keys: []string{"1209", "ASN1"}, Fields: map[string]string{"VendorNO": "1209", "PONumber": "4500"}},
+		{Entity: "SUP", Keys: []string{"1300", "ASN2"}, Fields: map[string]string{"VendorNO": "1300", "PONumber": "4500"}},
+		{Entity: "CPO", Keys: []string{"C1"}, Fields: map[string]string{"CPONO": "C1", "TRANSDOC": "GR"}},
+	}})
+	return b
+}
+
+func TestSign(t *testing.T) {
+	now := time.Unix(1515000000, 0)
+	signature := Sign(secret, "1515000000", []byte("{}"))
+	if err := Verify(secret, "1515000000", signature, []byte("{}"), time.Minute, now); err != nil {
+		t.Fatal(err)
+	}
+	if Verify(secret, "1515000000", signature, []byte("{ }"), time.Minute, now) == nil {
+		t.Fatal("tampered body verified")
+	}
+	if Verify("fedcba9876543210", "1515000000", signature, []byte("{}"), time.Minute, now) == nil {
+		t.Fatal("wrong secret verified")
+	}
+	if Verify(secret, "1515000000", signature, []byte("{}"), time.Minute, now.Add(2*time.Minute)) == nil {
+		t.Fatal("old timestamp verified")
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "webhook")
+	defer os.RemoveAll(dir)
+	_, registry := OpenRegistry(filepath.Join(dir, "subscriptions.json"))
+	sub := model.WebhookSubscription{ID: "s1", Partner: "1209", Entity: "SUP", FilterField: "VendorNO", FilterValue: "1209", URL: "http://localhost", SecretChanged: true}
+	other := model.WebhookSubscription{ID: "s2", Partner: "lenovo", Entity: "CPO", FilterField: "CPONO", FilterValue: "C9", URL: "http://localhost", SecretChanged: true}
+	err, messages := Translate(registry, outbound.POSTING_EVENT, posting(sub, other))
+	if err != nil || len(messages) != 1 || messages[0].ID != "tx1-s1" || messages[0].Target != "s1" {
+		t.Fatalf("unexpected messages %v %+v", err, messages)
+	}
+	payload := Payload{}
+	json.Unmarshal([]byte(messages[0].Body), &payload)
+	if payload.Partner != "1209" || len(payload.Documents) != 1 || payload.Documents[0].Keys[1] != "ASN1" {
+		t.Fatalf("unexpected payload %s", messages[0].Body)
+	}
+
+	_, reopened := OpenRegistry(registry.Path)
+	if len(reopened.List()) != 2 || reopened.List()[0].Secret != "" || reopened.List()[0].SecretChanged {
+		t.Fatalf("registry not saved %+v", reopened.List())
+	}
+
+	//the imported secret is kept until an event changes it
+	b, _ := json.Marshal([]model.WebhookSubscription{{ID: "s1", Partner: "1209", Secret: secret}, {ID: "s2", Partner: "lenovo", Secret: secret}})
+	if err, _ := reopened.Import(b); err != nil {
+		t.Fatal(err)
+	}
+	sub.SecretChanged, sub.URL = false, "http://partner"
+	other.SecretChanged = true
+	Translate(reopened, outbound.POSTING_EVENT, posting(sub, other))
+	if s1, _ := reopened.Get("s1"); s1.Secret != secret || s1.URL != "http://partner" {
+		t.Fatalf("secret not kept %+v", s1)
+	}
+	if s2, _ := reopened.Get("s2"); s2.Secret != "" {
+		t.Fatalf("changed secret kept %+v", s2)
+	}
+	sub.Removed = true
+	err, messages = Translate(reopened, outbound.POSTING_EVENT, posting(sub))
+	if err != nil || len(messages) != 0 || len(reopened.List()) != 1 {
+		t.Fatalf("removed subscription matched %v %+v", err, messages)
+	}
+	if err, _ := reopened.Import([]byte(`[{"ID":"s3","Secret":"***"}]`)); err == nil {
+		t.Fatal("masked secret imported")
+	}
+}
+
+func TestDelivery(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "webhook")
+	defer os.RemoveAll(dir)
+	received := filepath.Join(dir, "received")
+	os.MkdirAll(received, 0755)
+	server := httptest.NewServer(&Stub{Secret: secret, Dir: received, Fail: 1})
+	defer server.Close()
+
+	_, registry := OpenRegistry(filepath.Join(dir, "subscriptions.json"))
+	err, count := registry.Import([]byte(`[{"ID":"s1","Partner":"1209","Entity":"SUP","FilterField":"VendorNO","FilterValue":"1209","URL":"` + server.URL + `","Secret":"` + secret + `"},
+		{"ID":"s2","Partner":"1300","Entity":"SUP","FilterField":"VendorNO","FilterValue":"1300","URL":"` + server.URL + `","Secret":"wrong-secret-0000"}]`))
+	if err != nil || count != 2 {
+		t.Fatalf("unexpected import %v %d", err, count)
+	}
+	log := &Log{Path: filepath.Join(dir, "delivery.log")}
+	_, outbox := outbound.NewOutbox(filepath.Join(dir, "outbox"), NewSink(registry, log))
+	outbox.MaxAttempts, outbox.Backoff = 2, 0
+	_, messages := Translate(registry, outbound.POSTING_EVENT, posting())
+	for _, m := range messages {
+		outbox.Enqueue(m)
+	}
+	outbox.Flush()
+	_, result := outbox.Flush()
+	if result.Sent != 1 || result.Dead != 1 {
+		t.Fatalf("unexpected flush %+v", result)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(received, "tx1-s1"))
+	if err != nil || json.Unmarshal(b, &Payload{}) != nil {
+		t.Fatalf("unexpected delivery %v %s", err, b)
+	}
+	err, deliveries := log.Read()
+	statuses := map[string]int{}
+	for _, d := range deliveries {
+		statuses[d.SubscriptionID+" "+d.Status]++
+		if d.Status == DELIVERY_FAILED && d.HTTPStatus != 503 && d.HTTPStatus != 401 {
+			t.Fatalf("unexpected failure %+v", d)
+		}
+	}
+	if err != nil || len(deliveries) != 4 || statuses["s1 SENT"] != 1 || statuses["s2 FAILED"] != 2 {
+		t.Fatalf("unexpected delivery log %v %+v", err, deliveries)
+	}
+}
@@ -0,0 +1,232 @@
+package x12
+
+import (
+	"fmt"
+	"github.com/lenovo_bc/model"
+	"strconv"
+)
+
+//Transaction set codes
+const (
+	PO_ACK      = "855" //PO acknowledgment -> Confirmation
+	SHIP_NOTICE = "856" //Ship notice -> SupplierOrder / InboundDelivery
+	INVOICE     = "810" //Invoice -> Invoice
+)
+
+//Functional identifier of the GS segment per transaction set
+var FunctionalID = map[string]string{PO_ACK: "PR", SHIP_NOTICE: "SH", INVOICE: "IN"}
+
+//Documents of one transaction set.
+//855: PurchaseOrders with TRANSDOC POCON; 810: PurchaseOrders with TRANSDOC INV;
+//856: SupplierOrders, one per PO item, and PurchaseOrders with TRANSDOC INDN
+type Document struct {
+	Code           string                `json:"Code"`          //855, 856, 810
+	ControlNumber  string                `json:"ControlNumber"` //ST02
+	PurchaseOrders []model.PurchaseOrder `json:"PurchaseOrders"`
+	SupplierOrders []model.SupplierOrder `json:"SupplierOrders"`
+}
+
+//LIN/PO1/IT1 product id pairs, qualifier -> id
+func productIDs(segment Segment, from int) map[string]string {
+	ids := map[string]string{}
+	for i := from; i+1 < len(segment); i += 2 {
+		ids[segment[i]] = segment[i+1]
+	}
+	return ids
+}
+
+//按PO item归组
+type poIndex struct {
+	orders []model.PurchaseOrder
+	index  map[string]int
+}
+
+func (p *poIndex) get(pono string, item string, transdoc string) *model.PurchaseOrder {
+	key := pono + "/" + item
+	i, ok := p.index[key]
+	if !ok {
+		i = len(p.orders)
+		p.index[key] = i
+		p.orders = append(p.orders, model.PurchaseOrder{PONO: pono, POItemNO: item, TRANSDOC: transdoc})
+	}
+	return &p.orders[i]
+}
+
+//Transaction set -> ledger documents
+func Convert(t Transaction) (error, Document) {
+	doc := Document{Code: t.Code(), ControlNumber: t.ControlNumber(), PurchaseOrders: []model.PurchaseOrder{}, SupplierOrders: []model.SupplierOrder{}}
+	pos := &poIndex{orders: []model.PurchaseOrder{}, index: map[string]int{}}
+	if t.Code() == PO_ACK {
+		pono, reference, ackDate := "", "", ""
+		var current *model.PurchaseOrder
+		for _, segment := range t.Segments {
+			switch segment[0] {
+			case "BAK":
+				pono, reference, ackDate = segment.Element(3), segment.Element(8), segment.Element(9)
+			case "PO1":
+				current = pos.get(pono, segment.Element(1), "POCON")
+			case "ACK":
+				if current == nil {
+					return fmt.Errorf("855 %s: ACK before PO1", doc.ControlNumber), doc
+				}
+				current.Confirmation = append(current.Confirmation, model.Confirmation{
+					CnfSeqNO:     strconv.Itoa(len(current.Confirmation) + 1),
+					CnfRfrnNO:    reference,
+					CnfQty:       segment.Element(2),
+					CnfDlvryDate: segment.Element(5),
+					CnfCrtnDate:  ackDate,
+				})
+			}
+		}
+		if pono == "" {
+			return fmt.Errorf("855 %s: BAK03 PO number is missing", doc.ControlNumber), doc
+		}
+	} else if t.Code() == SHIP_NOTICE {
+		shipment := model.SupplierOrder{}
+		var current *model.SupplierOrder
+		for _, segment := range t.Segments {
+			switch segment[0] {
+			case "BSN":
+				shipment.ASNNumber, shipment.ASNDate = segment.Element(2), segment.Element(3)
+			case "TD5":
+				shipment.CarrierID, shipment.TransporatationMode = segment.Element(3), segment.Element(4)
+			case "REF":
+				if segment.Element(1) == "CN" {
+					shipment.CarrierTrackID = segment.Element(2)
+				}
+			case "DTM":
+				if segment.Element(1) == "017" {
+					shipment.PromisedDate = segment.Element(2)
+				}
+			case "PRF":
+				shipment.PONumber = segment.Element(1)
+			case "LIN":
+				item := shipment
+				item.POItem = segment.Element(1)
+				item.CountryOfOrigin = productIDs(segment, 2)["CH"]
+				doc.SupplierOrders = append(doc.SupplierOrders, item)
+				current = &doc.SupplierOrders[len(doc.SupplierOrders)-1]
+			case "SN1":
+				if current == nil {
+					return fmt.Errorf("856 %s: SN1 before LIN", doc.ControlNumber), doc
+				}
+				current.ShippedQty = segment.Element(2)
+			}
+		}
+		if shipment.ASNNumber == "" {
+			return fmt.Errorf("856 %s: BSN02 shipment id is missing", doc.ControlNumber), doc
+		}
+		for _, order := range doc.SupplierOrders {
+			po := pos.get(order.PONumber, order.POItem, "INDN")
+			po.InboundDelivery = append(po.InboundDelivery, ToInboundDelivery(order))
+		}
+	} else if t.Code() == INVOICE {
+		invoice := model.Invoice{}
+		pono := ""
+		for _, segment := range t.Segments {
+			switch segment[0] {
+			case "BIG":
+				invoice.DocDate, invoice.VenInvNO, invoice.InvType = segment.Element(1), segment.Element(2), segment.Element(7)
+				pono = segment.Element(4)
+			case "IT1":
+				item := invoice
+				ids := productIDs(segment, 6)
+				item.InvItemNO, item.InvQty, item.Unit, item.PARTNO = segment.Element(1), segment.Element(2), segment.Element(3), ids["BP"]
+				poItem := ids["PL"]
+				if poItem == "" {
+					poItem = item.InvItemNO
+				}
+				po := pos.get(pono, poItem, "INV")
+				po.Invoice = append(po.Invoice, item)
+			}
+		}
+		if pono == "" || invoice.VenInvNO == "" {
+			return fmt.Errorf("810 %s: BIG02 invoice number and BIG04 PO number are required", doc.ControlNumber), doc
+		}
+	} else {
+		return fmt.Errorf("transaction set %s is not supported", t.Code()), doc
+	}
+	doc.PurchaseOrders = pos.orders
+	return nil, doc
+}
+
+//Ship notice item -> InboundDelivery of the PO item
+func ToInboundDelivery(order model.SupplierOrder) model.InboundDelivery {
+	return model.InboundDelivery{
+		VendorNO:   order.VendorNO,
+		IDCrtDate:  order.ASNDate,
+		IDDlvyDate: order.PromisedDate,
+		ASNNO:      order.ASNNumber,
+		DlvyQty:    order.ShippedQty,
+		COO:        order.CountryOfOrigin,
+		TrackID:    order.CarrierTrackID,
+		MOT:        order.TransporatationMode,
+	}
+}
+
+func newTransaction(code string, controlNo int, segments []Segment) Transaction {
+	return Transaction{ST: Segment{"ST", code, fmt.Sprintf("%04d", controlNo)}, Segments: segments}
+}
+
+//PO item confirmations -> 855
+func Build855(order model.PurchaseOrder, controlNo int) Transaction {
+	reference, ackDate := "", ""
+	if len(order.Confirmation) > 0 {
+		reference, ackDate = order.Confirmation[0].CnfRfrnNO, order.Confirmation[0].CnfCrtnDate
+	}
+	segments := []Segment{
+		{"BAK", "00", "AC", order.PONO, order.PODate, "", "", "", reference, ackDate},
+		{"PO1", order.POItemNO, order.POQty, order.Unit, "", "", "BP", order.PARTSNO},
+	}
+	for _, cnf := range order.Confirmation {
+		segments = append(segments, Segment{"ACK", "IA", cnf.CnfQty, order.Unit, "067", cnf.CnfDlvryDate})
+	}
+	segments = append(segments, Segment{"CTT", "1"})
+	return newTransaction(PO_ACK, controlNo, segments)
+}
+
+//ASN items of one shipment -> 856
+func Build856(orders []model.SupplierOrder, controlNo int) Transaction {
+	if len(orders) == 0 {
+		return newTransaction(SHIP_NOTICE, controlNo, []Segment{})
+	}
+	shipment := orders[0]
+	segments := []Segment{
+		{"BSN", "00", shipment.ASNNumber, shipment.ASNDate, "0000"},
+		{"HL", "1", "", "S"},
+		{"TD5", "B", "2", shipment.CarrierID, shipment.TransporatationMode},
+		{"REF", "CN", shipment.CarrierTrackID},
+		{"DTM", "017", shipment.PromisedDate},
+	}
+	hl, orderHL, pono := 1, 0, ""
+	for _, order := range orders {
+		if order.PONumber != pono || orderHL == 0 {
+			hl++
+			orderHL, pono = hl, order.PONumber
+			segments = append(segments, Segment{"HL", strconv.Itoa(hl), "1", "O"}, Segment{"PRF", order.PONumber})
+		}
+		hl++
+		segments = append(segments,
+			Segment{"HL", strconv.Itoa(hl), strconv.Itoa(orderHL), "I"},
+			Segment{"LIN", order.POItem, "CH", order.CountryOfOrigin},
+			Segment{"SN1", "", order.ShippedQty, "EA"})
+	}
+	segments = append(segments, Segment{"CTT", strconv.Itoa(hl)})
+	return newTransaction(SHIP_NOTICE, controlNo, segments)
+}
+
+//Invoices of one PO item -> 810
+func Build810(order model.PurchaseOrder, controlNo int) Transaction {
+	first := model.Invoice{}
+	if len(order.Invoice) > 0 {
+		first = order.Invoice[0]
+	}
+	segments := []Segment{
+		{"BIG", first.DocDate, first.VenInvNO, order.PODate, order.PONO, "", "", first.InvType},
+	}
+	for _, inv := range order.Invoice {
+		segments = append(segments, Segment{"IT1", inv.InvItemNO, inv.InvQty, inv.Unit, "", "", "BP", inv.PARTNO, "PL", order.POItemNO})
+	}
+	segments = append(segments, Segment{"TDS", "0"}, Segment{"CTT", strconv.Itoa(len(order.Invoice))})
+	return newTransaction(INVOICE, controlNo, segments)
+}
@@ -0,0 +1,208 @@
+// Package x12 reads and writes ANSI X12 interchanges and converts the
+// supplier transaction sets 855, 856 and 810 to and from the ledger
+// documents of lenovo_bc.
+//
+// Separators are taken from the fixed length ISA segment: the element
+// separator is the 4th character, the component separator is ISA16 and
+// the segment terminator follows ISA16.
+package x12
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const ISA_LENGTH = 106 //ISA segment including terminator
+
+//One segment, [0] is the segment id
+type Segment []string
+
+//Element n (1 based), "" if missing
+func (s Segment) Element(n int) string {
+	if n < len(s) {
+		return s[n]
+	}
+	return ""
+}
+
+//ST ... SE
+type Transaction struct {
+	ST       Segment
+	Segments []Segment //Segments between ST and SE
+}
+
+//GS ... GE
+type Group struct {
+	GS           Segment
+	Transactions []Transaction
+}
+
+//ISA ... IEA
+type Interchange struct {
+	ISA          Segment
+	Groups       []Group
+	ElementSep   string
+	ComponentSep string
+	SegmentTerm  string
+}
+
+func (t Transaction) Code() string {
+	return t.ST.Element(1)
+}
+
+func (t Transaction) ControlNumber() string {
+	return t.ST.Element(2)
+}
+
+func checkCount(segment Segment, n int, expected int) error {
+	count, err := strconv.Atoi(segment.Element(n))
+	if err != nil || count != expected {
+		return fmt.Errorf("%s%02d count %s does not match %d", segment[0], n, segment.Element(n), expected)
+	}
+	return nil
+}
+
+func checkControl(segment Segment, n int, expected string) error {
+	if strings.TrimSpace(segment.Element(n)) != strings.TrimSpace(expected) {
+		return fmt.Errorf("%s%02d control number %s does not match %s", segment[0], n, segment.Element(n), expected)
+	}
+	return nil
+}
+
+func splitSegments(payload string, elementSep string, segmentTerm string) []Segment {
+	segments := []Segment{}
+	for _, raw := range strings.Split(payload, segmentTerm) {
+		raw = strings.Trim(raw, "\r\n\t ")
+		if raw == "" {
+			continue
+		}
+		segments = append(segments, Segment(strings.Split(raw, elementSep)))
+	}
+	return segments
+}
+
+//解析并校验interchange: segment数量和control number
+func Parse(payload string) (error, Interchange) {
+	payload = strings.TrimLeft(payload, "\r\n\t ")
+	if len(payload) < ISA_LENGTH || !strings.HasPrefix(payload, "ISA") {
+		return fmt.Errorf("interchange must start with a %d character ISA segment", ISA_LENGTH), Interchange{}
+	}
+	ic := Interchange{
+		ElementSep:   payload[3:4],
+		ComponentSep: payload[104:105],
+		SegmentTerm:  payload[105:106],
+		Groups:       []Group{},
+	}
+	segments := splitSegments(payload, ic.ElementSep, ic.SegmentTerm)
+	ic.ISA = segments[0]
+	if len(ic.ISA) != 17 {
+		return fmt.Errorf("ISA has %d elements, expected 16", len(ic.ISA)-1), Interchange{}
+	}
+	var group *Group
+	var transaction *Transaction
+	for _, segment := range segments[1:] {
+		switch segment[0] {
+		case "GS":
+			if group != nil {
+				return fmt.Errorf("GS %s before GE of group %s", segment.Element(6), group.GS.Element(6)), Interchange{}
+			}
+			ic.Groups = append(ic.Groups, Group{GS: segment, Transactions: []Transaction{}})
+			group = &ic.Groups[len(ic.Groups)-1]
+		case "ST":
+			if group == nil || transaction != nil {
+				return fmt.Errorf("ST %s outside of a functional group", segment.Element(2)), Interchange{}
+			}
+			group.Transactions = append(group.Transactions, Transaction{ST: segment, Segments: []Segment{}})
+			transaction = &group.Transactions[len(group.Transactions)-1]
+		case "SE":
+			if transaction == nil {
+				return fmt.Errorf("SE without ST"), Interchange{}
+			}
+			if err := checkCount(segment, 1, len(transaction.Segments)+2); err != nil {
+				return err, Interchange{}
+			}
+			if err := checkControl(segment, 2, transaction.ControlNumber()); err != nil {
+				return err, Interchange{}
+			}
+			transaction = nil
+		case "GE":
+			if group == nil || transaction != nil {
+				return fmt.Errorf("GE without GS or before SE"), Interchange{}
+			}
+			if err := checkCount(segment, 1, len(group.Transactions)); err != nil {
+				return err, Interchange{}
+			}
+			if err := checkControl(segment, 2, group.GS.Element(6)); err != nil {
+				return err, Interchange{}
+			}
+			group = nil
+		case "IEA":
+			if group != nil {
+				return fmt.Errorf("IEA before GE"), Interchange{}
+			}
+			if err := checkCount(segment, 1, len(ic.Groups)); err != nil {
+				return err, Interchange{}
+			}
+			if err := checkControl(segment, 2, ic.ISA.Element(13)); err != nil {
+				return err, Interchange{}
+			}
+			return nil, ic
+		default:
+			if transaction == nil {
+				return fmt.Errorf("segment %s outside of a transaction set", segment[0]), Interchange{}
+			}
+			transaction.Segments = append(transaction.Segments, segment)
+		}
+	}
+	return fmt.Errorf("IEA is missing"), Interchange{}
+}
+
+func pad(value string, length int) string {
+	if len(value) > length {
+		return value[:length]
+	}
+	return value + strings.Repeat(" ", length-len(value))
+}
+
+//新建interchange, controlNo为ISA13, date/time为YYMMDD/HHMM
+func NewInterchange(senderID string, receiverID string, controlNo int, date string, time string) Interchange {
+	control := fmt.Sprintf("%09d", controlNo)
+	return Interchange{
+		ISA: Segment{"ISA", "00", pad("", 10), "00", pad("", 10), "ZZ", pad(senderID, 15), "ZZ", pad(receiverID, 15),
+			date, time, "U", "00401", control, "0", "P", ">"},
+		Groups:       []Group{},
+		ElementSep:   "*",
+		ComponentSep: ">",
+		SegmentTerm:  "~",
+	}
+}
+
+//添加functional group, 855->PR 856->SH 810->IN
+func (ic *Interchange) AddGroup(functionalID string, controlNo int, date string, time string, transactions []Transaction) {
+	gs := Segment{"GS", functionalID, strings.TrimSpace(ic.ISA.Element(6)), strings.TrimSpace(ic.ISA.Element(8)),
+		"20" + date, time, strconv.Itoa(controlNo), "X", "004010"}
+	ic.Groups = append(ic.Groups, Group{GS: gs, Transactions: transactions})
+}
+
+//生成interchange, SE/GE/IEA按内容计算
+func (ic Interchange) String() string {
+	lines := []string{}
+	write := func(segment Segment) {
+		lines = append(lines, strings.Join(segment, ic.ElementSep)+ic.SegmentTerm)
+	}
+	write(ic.ISA)
+	for _, group := range ic.Groups {
+		write(group.GS)
+		for _, transaction := range group.Transactions {
+			write(transaction.ST)
+			for _, segment := range transaction.Segments {
+				write(segment)
+			}
+			write(Segment{"SE", strconv.Itoa(len(transaction.Segments) + 2), transaction.ControlNumber()})
+		}
+		write(Segment{"GE", strconv.Itoa(len(group.Transactions)), group.GS.Element(6)})
+	}
+	write(Segment{"IEA", strconv.Itoa(len(ic.Groups)), ic.ISA.Element(13)})
+	return strings.Join(lines, "\n")
+}
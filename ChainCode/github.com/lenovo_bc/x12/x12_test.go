@@ -0,0 +1,76 @@
+package x12
+
+import (
+	"github.com/lenovo_bc/model"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func interchange(transactions ...Transaction) string {
+	ic := NewInterchange("SUP1209", "LENOVO", 1, "180109", "1200")
+	for i, transaction := range transactions {
+		ic.AddGroup(FunctionalID[transaction.Code()], i+1, "180109", "1200", []Transaction{transaction})
+	}
+	return ic.String()
+}
+
+func TestRoundTrip(t *testing.T) {
+	po := model.PurchaseOrder{PONO: "4500", POItemNO: "10", POQty: "5", Unit: "EA",
+		Confirmation: []model.Confirmation{{CnfRfrnNO: "SO-1", CnfQty: "3", CnfDlvryDate: "20180120", CnfCrtnDate: "20180109"}, {CnfRfrnNO: "SO-1", CnfQty: "2", CnfDlvryDate: "20180130", CnfCrtnDate: "20180109"}},
+		Invoice:      []model.Invoice{{VenInvNO: "INV-1", DocDate: "20180201", InvItemNO: "1", InvQty: "5", Unit: "EA", PARTNO: "20HD"}}}
+	asn := []model.SupplierOrder{
+		{ASNNumber: "ASN1", ASNDate: "20180110", PONumber: "4500", POItem: "10", ShippedQty: "3", CarrierID: "UPSN", CarrierTrackID: "1Z999", CountryOfOrigin: "CN"},
+		{ASNNumber: "ASN1", ASNDate: "20180110", PONumber: "4500", POItem: "20", ShippedQty: "1", CarrierID: "UPSN", CarrierTrackID: "1Z999", CountryOfOrigin: "MX"},
+	}
+	payload := interchange(Build855(po, 1), Build856(asn, 2), Build810(po, 3))
+	if strings.Index(payload, "~") != ISA_LENGTH-1 {
+		t.Fatalf("ISA is not %d characters: %s", ISA_LENGTH, payload)
+	}
+	err, ic := Parse(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ic.Groups) != 3 {
+		t.Fatalf("expected 3 groups, got %d", len(ic.Groups))
+	}
+
+	_, ack := Convert(ic.Groups[0].Transactions[0])
+	if len(ack.PurchaseOrders) != 1 || len(ack.PurchaseOrders[0].Confirmation) != 2 || ack.PurchaseOrders[0].Confirmation[1].CnfSeqNO != "2" ||
+		ack.PurchaseOrders[0].Confirmation[1].CnfDlvryDate != "20180130" || ack.PurchaseOrders[0].TRANSDOC != "POCON" {
+		t.Fatalf("unexpected 855 result %+v", ack.PurchaseOrders)
+	}
+	_, ship := Convert(ic.Groups[1].Transactions[0])
+	if len(ship.SupplierOrders) != 2 || !reflect.DeepEqual(ship.SupplierOrders[1], asn[1]) || len(ship.PurchaseOrders) != 2 {
+		t.Fatalf("unexpected 856 result %+v", ship.SupplierOrders)
+	}
+	_, inv := Convert(ic.Groups[2].Transactions[0])
+	if len(inv.PurchaseOrders) != 1 || inv.PurchaseOrders[0].POItemNO != "10" || inv.PurchaseOrders[0].Invoice[0] != po.Invoice[0] {
+		t.Fatalf("unexpected 810 result %+v", inv.PurchaseOrders)
+	}
+}
+
+func TestValidation(t *testing.T) {
+	payload := interchange(Build855(model.PurchaseOrder{PONO: "4500", POItemNO: "10"}, 7))
+	broken := map[string]string{
+		"SE01":  strings.Replace(payload, "SE*5*0007", "SE*6*0007", 1),
+		"SE02":  strings.Replace(payload, "SE*5*0007", "SE*5*0008", 1),
+		"GE01":  strings.Replace(payload, "GE*1*1", "GE*2*1", 1),
+		"GE02":  strings.Replace(payload, "GE*1*1", "GE*1*9", 1),
+		"IEA02": strings.Replace(payload, "IEA*1*000000001", "IEA*1*000000002", 1),
+		"IEA":   payload[:strings.Index(payload, "IEA")],
+	}
+	for name, p := range broken {
+		if p == payload {
+			t.Fatalf("%s: test payload was not changed", name)
+		}
+		err, _ := Parse(p)
+		if err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("%s: expected validation error, got %v", name, err)
+		}
+	}
+	err, _ := Parse(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+}